@@ -0,0 +1,22 @@
+package bd_xray
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+)
+
+func SetupCRDCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "crd",
+		Short: "print the CustomResourceDefinition of the ImageScanReports",
+		Long:  "print the CustomResourceDefinition of the ImageScanReports created by `--write-results reports`, to apply it with `kubectl apply -f -`",
+		Args:  cobra.MaximumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Print(kube.ImageScanReportCRD)
+		},
+	}
+	return command
+}
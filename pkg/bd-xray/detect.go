@@ -0,0 +1,80 @@
+package bd_xray
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/detect"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+type DetectUpdateFlags struct {
+	BlackDuckURL   string
+	BlackDuckToken string
+	DetectVersion  string
+	DetectChecksum string
+}
+
+// AddDetectFlags adds the flags pinning and verifying the detect script
+func AddDetectFlags(command *cobra.Command, detectVersion *string, detectChecksum *string) {
+	command.Flags().StringVar(detectVersion, DetectVersionFlagName, "", "Detect version to run, i.e.: 6.5.0; defaults to the version pinned by 'bd-xray detect update' or the latest")
+	command.Flags().StringVar(detectChecksum, DetectChecksumFlagName, "", "Expected SHA-256 checksum of the detect script; no checksum of detect is published, so that without it the script is trusted on first use: its checksum is recorded when it's downloaded and runs fail if it changes")
+}
+
+func SetupDetectCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "detect",
+		Short: "manage the detect script",
+		Long:  "manage the detect script",
+		Args:  cobra.MaximumNArgs(0),
+	}
+	command.AddCommand(SetupDetectUpdateCommand())
+	return command
+}
+
+func SetupDetectUpdateCommand() *cobra.Command {
+	detectUpdateFlags := &DetectUpdateFlags{}
+
+	command := &cobra.Command{
+		Use:   "update",
+		Short: "download the latest detect script and pin the detect version recommended for the Black Duck server",
+		Long:  "download the latest detect script and pin the detect version recommended for the Black Duck server; --detect-version pins a specific version instead, and without either the latest version is used",
+		Args:  cobra.MaximumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.DoOrDie(RunDetectUpdateCommand(detectUpdateFlags))
+		},
+	}
+
+	command.Flags().StringVar(&detectUpdateFlags.BlackDuckURL, BlackDuckURLFlagName, "", "Black Duck Server URL")
+	command.Flags().StringVar(&detectUpdateFlags.BlackDuckToken, BlackDuckTokenFlagName, "", "Black Duck API Token")
+	AddDetectFlags(command, &detectUpdateFlags.DetectVersion, &detectUpdateFlags.DetectChecksum)
+
+	return command
+}
+
+func RunDetectUpdateCommand(detectUpdateFlags *DetectUpdateFlags) error {
+	version := detectUpdateFlags.DetectVersion
+	if version == "" && detectUpdateFlags.BlackDuckURL != "" {
+		if detectUpdateFlags.BlackDuckToken == "" {
+			return errors.Errorf("--%s is required to look up the detect version recommended for %s", BlackDuckTokenFlagName, detectUpdateFlags.BlackDuckURL)
+		}
+		var err error
+		version, err = detect.GetRecommendedDetectVersion(detectUpdateFlags.BlackDuckURL, detectUpdateFlags.BlackDuckToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	detectClient := detect.NewDefaultClient()
+	detectClient.DetectChecksum = detectUpdateFlags.DetectChecksum
+	if err := detectClient.UpdateDetect(version); err != nil {
+		return err
+	}
+	if version == "" {
+		log.Infof("updated detect at %s, the latest detect version will be used", detectClient.DetectPath)
+	} else {
+		log.Infof("updated detect at %s, detect version %s will be used", detectClient.DetectPath, version)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package bd_xray
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/report"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+func SetupDiffCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "diff REPORT_A REPORT_B",
+		Short: "print what changed between two scan reports",
+		Long:  "print the images added, removed and running with other tags, and the vulnerabilities introduced and fixed, between the reports of two runs saved with --report-dir",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.DoOrDie(RunDiffCommand(args[0], args[1]))
+		},
+	}
+	return command
+}
+
+func RunDiffCommand(oldPath, newPath string) error {
+	oldReport, err := report.Load(oldPath)
+	if err != nil {
+		return err
+	}
+	newReport, err := report.Load(newPath)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report.Compare(oldReport, newReport).Render())
+	return nil
+}
@@ -0,0 +1,166 @@
+package bd_xray
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/rest"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/detect"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/results"
+)
+
+// fakeServer answers GET requests with the bodies of its routes, by "METHOD PATH", and records all other requests
+// with their bodies; unknown GET requests are answered with defaultBody
+type fakeServer struct {
+	mutex       sync.Mutex
+	routes      map[string]string
+	defaultBody string
+	requests    []string
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	request := r.Method + " " + r.URL.Path
+	w.Header().Set("Content-Type", "application/json")
+	if body, ok := s.routes[request]; ok {
+		w.Write([]byte(body))
+		return
+	}
+	if r.Method == http.MethodGet {
+		if s.defaultBody == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(s.defaultBody))
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	s.requests = append(s.requests, strings.TrimSpace(request+" "+string(body)))
+	w.Write(body)
+}
+
+func (s *fakeServer) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// newFakeKubeClient serves the routes like an API server, with empty lists for everything else
+func newFakeKubeClient(t *testing.T, routes map[string]string) (*fakeServer, *kube.Client, func()) {
+	fake := &fakeServer{routes: routes, defaultBody: `{"items": []}`}
+	server := httptest.NewServer(fake)
+	client, err := kube.NewClientForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		server.Close()
+		t.Fatalf("%+v", err)
+	}
+	return fake, client, server.Close
+}
+
+// newFakeBlackDuck serves the routes like a Black Duck server, which accepts the API token api-token; the routes can
+// refer to the URL of the server as SERVER
+func newFakeBlackDuck(t *testing.T, routes map[string]string) (*fakeServer, *httptest.Server) {
+	fake := &fakeServer{routes: map[string]string{}}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tokens/authenticate" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"bearerToken": "bearer-token"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer bearer-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	for request, body := range routes {
+		fake.routes[request] = strings.Replace(body, "SERVER", server.URL, -1)
+	}
+	return fake, server
+}
+
+// newTestCommonFlags uses an empty registry config, so that the registry config of the user doesn't matter; the
+// returned func removes it
+func newTestCommonFlags(t *testing.T, blackDuckURL string) (*CommonFlags, func()) {
+	dir, err := ioutil.TempDir("", "bd-xray")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	registryConfigPath := filepath.Join(dir, "registries.yaml")
+	if err := ioutil.WriteFile(registryConfigPath, []byte("{}\n"), 0644); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return &CommonFlags{BlackDuckURL: blackDuckURL, BlackDuckToken: "api-token", RegistryConfigPath: registryConfigPath}, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// fakeDetectScript writes a status.json with the exit status and results of statusJSON to runs/1/status of the output
+// dir, appends its arguments to args.txt in its dir and exits with the code in exit-code, if any
+const fakeDetectScript = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$@" >> "$dir/args.txt"
+for arg in "$@"; do
+	case "$arg" in
+		--detect.output.path=*) output="${arg#--detect.output.path=}" ;;
+	esac
+done
+mkdir -p "$output/runs/1/status"
+cp "$dir/status.json" "$output/runs/1/status/status.json"
+exit "$(cat "$dir/exit-code" 2>/dev/null || echo 0)"
+`
+
+// fakeDetect is a detect client running a script instead of detect
+type fakeDetect struct {
+	dir    string
+	client *detect.Client
+}
+
+// newFakeDetect runs scans which write statusJSON, with SERVER replaced by blackDuckURL, to output dirs in a temporary
+// dir; the returned func removes it and restores the output dir and results index
+func newFakeDetect(t *testing.T, statusJSON, blackDuckURL string) (*fakeDetect, func()) {
+	dir, err := ioutil.TempDir("", "bd-xray-detect")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	script := filepath.Join(dir, "detect.sh")
+	if err := ioutil.WriteFile(script, []byte(fakeDetectScript), 0755); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "status.json"), []byte(strings.Replace(statusJSON, "SERVER", blackDuckURL, -1)), 0644); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	outputDir := detect.DefaultDetectBlackduckDirectory
+	detect.DefaultDetectBlackduckDirectory = filepath.Join(dir, "blackduck")
+	index := resultsIndex
+	resultsIndex = results.NewIndex(filepath.Join(dir, "blackduck", "index.json"))
+	return &fakeDetect{dir: dir, client: &detect.Client{DetectPath: script, ImageInspector: detect.NewDefaultImageInspectorConfig()}}, func() {
+		detect.DefaultDetectBlackduckDirectory = outputDir
+		resultsIndex = index
+		os.RemoveAll(dir)
+	}
+}
+
+// Args are the arguments of every run of the script, one run per line
+func (d *fakeDetect) Args() string {
+	args, _ := ioutil.ReadFile(filepath.Join(d.dir, "args.txt"))
+	return string(args)
+}
+
+// SetExitCode makes the following runs of the script exit with the code, after writing the status.json
+func (d *fakeDetect) SetExitCode(t *testing.T, code int) {
+	if err := ioutil.WriteFile(filepath.Join(d.dir, "exit-code"), []byte(fmt.Sprintf("%d\n", code)), 0644); err != nil {
+		t.Fatalf("%+v", err)
+	}
+}
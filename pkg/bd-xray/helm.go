@@ -2,16 +2,36 @@ package bd_xray
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/helm"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/report"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/yaml"
 )
 
+const (
+	ChartVersionFlagName = "version"
+	ReleaseFlagName      = "release"
+)
+
+type HelmFlags struct {
+	ChartVersion string
+	// Releases are the arguments release names, installed in Namespace
+	Releases  bool
+	Namespace string
+}
+
 func SetupHelmScanCommand() *cobra.Command {
 	commonFlags := &CommonFlags{}
+	helmFlags := &HelmFlags{}
 
 	detectPassThroughFlagsMap := map[string]interface{}{
 		DetectOfflineModeFlagName: &commonFlags.DetectOfflineMode,
@@ -19,17 +39,20 @@ func SetupHelmScanCommand() *cobra.Command {
 		BlackDuckTokenFlagName:    &commonFlags.BlackDuckToken,
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
 	command := &cobra.Command{
-		Use:   "helm CHART_URL",
+		Use:   "helm CHART_URL | --release RELEASE",
 		Short: "scan all images in a Chart",
-		Long:  "scan all images in a Chart",
+		Long:  "scan all images in a Chart, or with --release in the manifest of an installed release",
 		Args: func(cmd *cobra.Command, args []string) error {
+			if helmFlags.Releases && helmFlags.ChartVersion != "" {
+				return errors.Errorf("--%s can't be used with --%s, releases are scanned at their installed version", ChartVersionFlagName, ReleaseFlagName)
+			}
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			utils.DoOrDie(RunHelmScanCommand(args, ctx, cancel, commonFlags, detectPassThroughFlagsMap))
+			ctx, cancel := utils.NewSignalContext()
+			defer cancel()
+			utils.DoOrDie(RunHelmScanCommand(args, ctx, cancel, commonFlags, helmFlags, detectPassThroughFlagsMap))
 		},
 	}
 
@@ -38,22 +61,101 @@ func SetupHelmScanCommand() *cobra.Command {
 	command.Flags().StringVar(&commonFlags.BlackDuckToken, BlackDuckTokenFlagName, "", "Black Duck API Token")
 	command.Flags().StringVar(&commonFlags.DetectProjectName, DetectProjectNameFlagName, "", "An override for the name to use for the Black Duck project. If not supplied, a project will be created with chart name and image name and tag will be passed as version.")
 	command.Flags().BoolVarP(&commonFlags.CleanupPersistentDockerInspectorServices, CleanupPersistentDockerInspectorServicesName, "c", true, "Clean up the docker inspector services")
+	command.Flags().StringVar(&helmFlags.ChartVersion, ChartVersionFlagName, "", "Chart version to scan. If not supplied, the latest version is used")
+	command.Flags().BoolVar(&helmFlags.Releases, ReleaseFlagName, false, "The arguments are installed releases, whose images are read from their manifests and whose charts are compared with the chart repositories")
+	command.Flags().StringVarP(&helmFlags.Namespace, "namespace", "n", "", "The namespace of the releases. If not supplied, the namespace of helm is used")
+
+	AddCommonScanFlags(command, commonFlags)
+	AddReportFlags(command, commonFlags)
 
 	return command
 }
 
-func RunHelmScanCommand(charts []string, ctx context.Context, cancellationFunc context.CancelFunc, commonFlags *CommonFlags, detectPassThroughFlagsMap map[string]interface{}) error {
+func RunHelmScanCommand(charts []string, ctx context.Context, cancellationFunc context.CancelFunc, commonFlags *CommonFlags, helmFlags *HelmFlags, detectPassThroughFlagsMap map[string]interface{}) error {
+	namer, err := NewNamer(naming.SourceHelm, naming.Context{}, commonFlags)
+	if err != nil {
+		return err
+	}
+
 	var imageList []string
+	chartsByImage := map[string]string{}
 
 	for _, chart := range charts {
-		chartOutput, err := helm.TemplateChart(chart)
+		var chartOutput string
+		if helmFlags.Releases {
+			chartOutput, err = helm.GetReleaseManifest(chart, helmFlags.Namespace)
+		} else {
+			chartOutput, err = helm.TemplateChartVersion(chart, helmFlags.ChartVersion)
+		}
 		if err != nil {
 			return err
 		}
 		chartImages := yaml.GetImageFromYamlString(chartOutput)
+		for _, image := range chartImages {
+			if _, ok := chartsByImage[image]; !ok {
+				chartsByImage[image] = chart
+			}
+		}
 
 		imageList = append(imageList, chartImages...)
 	}
 
-	return RunAndPrintMultipleImageScansConcurrently(ctx, cancellationFunc, imageList, detectPassThroughFlagsMap, commonFlags.DetectProjectName, commonFlags.CleanupPersistentDockerInspectorServices)
+	namer.SetCharts(chartsByImage)
+
+	err = RunAndPrintMultipleImageScansConcurrently(ctx, cancellationFunc, imageList, detectPassThroughFlagsMap, namer, commonFlags)
+	SaveReport(ctx, report.Scope(naming.SourceHelm, charts...), err, commonFlags)
+	if err != nil {
+		return err
+	}
+
+	PrintChartUpgradeTable(GetChartUpgrades(charts, helmFlags))
+	return staleImages.Err(commonFlags.StalenessThreshold)
+}
+
+// GetChartUpgrades looks up chart level upgrade remediation for every chart, or release; charts that can't be looked up
+// are skipped
+func GetChartUpgrades(charts []string, helmFlags *HelmFlags) []*helm.ChartUpgrade {
+	var upgrades []*helm.ChartUpgrade
+
+	repositories, err := helm.ListRepositories()
+	if err != nil {
+		log.Warnf("unable to list helm repositories, skipping chart upgrade suggestions: %+v", err)
+		return upgrades
+	}
+	for _, chart := range charts {
+		var upgrade *helm.ChartUpgrade
+		if helmFlags.Releases {
+			upgrade, err = helm.GetReleaseUpgrade(chart, helmFlags.Namespace, repositories)
+		} else {
+			upgrade, err = helm.GetChartUpgrade(chart, helmFlags.ChartVersion, repositories)
+		}
+		if err != nil {
+			log.Warnf("unable to find chart upgrade for '%s': %+v", chart, err)
+			continue
+		}
+		upgrades = append(upgrades, upgrade)
+	}
+	return upgrades
+}
+
+func PrintChartUpgradeTable(upgrades []*helm.ChartUpgrade) {
+	if len(upgrades) == 0 {
+		return
+	}
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Chart", "Chart Version", "Latest Available Chart Version", "Upgrade", "Images In Latest Chart Version"})
+	for _, upgrade := range upgrades {
+		chart := upgrade.Chart
+		if upgrade.Release != "" {
+			chart = fmt.Sprintf("%s (release %s)", upgrade.Chart, upgrade.Release)
+		}
+		t.AppendRow([]interface{}{
+			chart,
+			upgrade.CurrentVersion,
+			upgrade.LatestVersion,
+			upgrade.Status,
+			strings.Join(upgrade.LatestImages, "\n"),
+		})
+	}
+	fmt.Printf("\n%s\n\n", t.Render())
 }
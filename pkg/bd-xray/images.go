@@ -3,17 +3,31 @@ package bd_xray
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jedib0t/go-pretty/table"
 	"github.com/oklog/run"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/bdio"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/detect"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/remediation"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/report"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/results"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/sbom"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
 )
 
 const (
@@ -23,6 +37,48 @@ const (
 	DetectProjectNameFlagName                    = "detect.project.name"
 	DetectVersionNameFlagName                    = "detect.project.version.name"
 	CleanupPersistentDockerInspectorServicesName = "cleanup"
+	RegistryConfigFlagName                       = "registry-config"
+	StalenessThresholdFlagName                   = "staleness-threshold"
+	DetectVersionFlagName                        = "detect-version"
+	DetectChecksumFlagName                       = "detect-checksum"
+	ImageInspectorVersionFlagName                = "imageinspector-version"
+	ImageInspectorPortFlagName                   = "imageinspector-port"
+	ImageInspectorHealthTimeoutFlagName          = "imageinspector-health-timeout"
+	ScanTimeoutFlagName                          = "scan-timeout"
+	ScanRetriesFlagName                          = "scan-retries"
+	ScanRetryBackoffFlagName                     = "scan-retry-backoff"
+	SBOMDirFlagName                              = "sbom-dir"
+	SBOMFormatFlagName                           = "sbom-format"
+	ProjectTemplateFlagName                      = "project-template"
+	VersionTemplateFlagName                      = "version-template"
+	CodeLocationTemplateFlagName                 = "code-location-template"
+	ProjectTagFlagName                           = "project-tag"
+	ProjectLabelFlagName                         = "project-label"
+	ProjectGroupFlagName                         = "project-group"
+	WriteResultsFlagName                         = "write-results"
+	ReportDirFlagName                            = "report-dir"
+	CompareWithFlagName                          = "compare-with"
+
+	// DetectWaitForResultsFlag makes detect wait until Black Duck has built the BOM of a scan, so that its components,
+	// vulnerabilities and policy status are complete when detect returns
+	DetectWaitForResultsFlag = "--detect.wait.for.results=true"
+)
+
+var (
+	// resultsIndex records every detect run, so that `bd-xray logs` and `bd-xray gc` can find them
+	resultsIndex = results.NewDefaultIndex()
+	// sbomCollector collects the inventories of the scanned images for the aggregated SBOM of a namespace; nil outside
+	// of a namespace run, so that the long running serve and watch don't keep every inventory
+	sbomCollector *sbom.Collector
+	// reportCollector collects the results of the scanned images for the report of the run
+	reportCollector = report.NewCollector()
+	// resultWriter writes the results back to the cluster with --write-results; nil if they aren't written
+	resultWriter *kube.ResultWriter
+	// staleImages collects the images above --staleness-threshold, so that a run of images, namespace, yaml or helm
+	// fails once all images are scanned; serve and watch only log the alerts
+	staleImages = NewStaleImages()
+	// latestVersionLookups limits how many of the concurrently scanned images look up their latest versions at once
+	latestVersionLookups = make(chan struct{}, 10)
 )
 
 type CommonFlags struct {
@@ -31,6 +87,23 @@ type CommonFlags struct {
 	BlackDuckToken                           string
 	DetectProjectName                        string // TODO: this is handle specially, not just a passthrough
 	CleanupPersistentDockerInspectorServices bool
+	RegistryConfigPath                       string
+	StalenessThreshold                       int
+	DetectVersion                            string
+	DetectChecksum                           string
+	ImageInspector                           detect.ImageInspectorConfig
+	ScanTimeout                              time.Duration
+	ScanRetries                              int
+	ScanRetryBackoff                         time.Duration
+	SBOMDir                                  string
+	SBOMFormats                              []string
+	NamingTemplates                          naming.Templates
+	ProjectLabels                            map[string]string
+	WriteResults                             []string
+	ReportDir                                string
+	CompareWith                              string
+	// WaitForResults waits for the BOM of every scan, even if no other flag reads it, i.e.: for the metrics of serve
+	WaitForResults bool
 	// TODO: add how many scans to process simultaneously
 	// ConcurrencyLevel  string
 }
@@ -44,8 +117,6 @@ func SetupImageScanCommand() *cobra.Command {
 		BlackDuckTokenFlagName:    &commonFlags.BlackDuckToken,
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
 	command := &cobra.Command{
 		Use:   "images DOCKER_IMAGE...",
 		Short: "scan multiple images",
@@ -54,7 +125,9 @@ func SetupImageScanCommand() *cobra.Command {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			utils.DoOrDie(RunAndPrintMultipleImageScansConcurrently(ctx, cancel, args, detectPassThroughFlagsMap, commonFlags.DetectProjectName, commonFlags.CleanupPersistentDockerInspectorServices))
+			ctx, cancel := utils.NewSignalContext()
+			defer cancel()
+			utils.DoOrDie(RunImagesScanCommand(args, ctx, cancel, commonFlags, detectPassThroughFlagsMap))
 		},
 	}
 
@@ -64,22 +137,183 @@ func SetupImageScanCommand() *cobra.Command {
 	command.Flags().StringVar(&commonFlags.DetectProjectName, DetectProjectNameFlagName, "", "An override for the name to use for the Black Duck project. If not supplied, a project will be created for each image")
 	command.Flags().BoolVarP(&commonFlags.CleanupPersistentDockerInspectorServices, CleanupPersistentDockerInspectorServicesName, "c", true, "Clean up the docker inspector services")
 
+	AddCommonScanFlags(command, commonFlags)
+	AddReportFlags(command, commonFlags)
+
 	return command
 }
 
-func RunAndPrintMultipleImageScansConcurrently(ctx context.Context, cancellationFunc context.CancelFunc, imageList []string, detectPassThroughFlagsMap map[string]interface{}, projectName string, cleanup bool) error {
-	var err error
+// AddCommonScanFlags adds the flags which are shared by all scan commands
+func AddCommonScanFlags(command *cobra.Command, commonFlags *CommonFlags) {
+	command.Flags().StringVar(&commonFlags.RegistryConfigPath, RegistryConfigFlagName, registries.DefaultRegistryConfigPath, "Path to the registry config file with credentials, overrides and private registries used for looking up the latest image versions")
+	command.Flags().IntVar(&commonFlags.StalenessThreshold, StalenessThresholdFlagName, 0, "Alert on images with a staleness score above this threshold and fail the run once all images are scanned; 0 disables alerting")
+	AddDetectFlags(command, &commonFlags.DetectVersion, &commonFlags.DetectChecksum)
+	command.Flags().StringVar(&commonFlags.ImageInspector.Version, ImageInspectorVersionFlagName, detect.DefaultImageInspectorVersion, "Version of the imageinspector services used by docker inspector")
+	command.Flags().IntVar(&commonFlags.ImageInspector.BasePort, ImageInspectorPortFlagName, detect.DefaultImageInspectorBasePort, "Host port of the alpine imageinspector service; the centos and ubuntu services use the next two ports")
+	command.Flags().DurationVar(&commonFlags.ImageInspector.HealthTimeout, ImageInspectorHealthTimeoutFlagName, detect.DefaultImageInspectorHealthTimeout, "How long to wait for the imageinspector services to become healthy")
+	commonFlags.ImageInspector.SharedDirectory = detect.DefaultImageInspectorSharedDirectory
+	command.Flags().DurationVar(&commonFlags.ScanTimeout, ScanTimeoutFlagName, time.Hour, "Timeout of a single scan of an image, after which detect is killed; 0 disables the timeout")
+	command.Flags().IntVar(&commonFlags.ScanRetries, ScanRetriesFlagName, 2, "How often a scan is retried after a transient failure, i.e.: an image pull error, a Black Duck 5xx response or the scan timeout")
+	command.Flags().DurationVar(&commonFlags.ScanRetryBackoff, ScanRetryBackoffFlagName, 30*time.Second, "Wait before the first retry of a scan, doubled for every further retry")
+	command.Flags().StringVar(&commonFlags.SBOMDir, SBOMDirFlagName, "", "Directory to export an SBOM of every scanned image to; empty disables the export")
+	command.Flags().StringSliceVar(&commonFlags.SBOMFormats, SBOMFormatFlagName, sbom.Formats, fmt.Sprintf("SBOM formats to export, any of [%s]", strings.Join(sbom.Formats, ", ")))
+	AddNamingFlags(command, commonFlags)
+	command.Flags().StringSliceVar(&commonFlags.NamingTemplates.Tags, ProjectTagFlagName, nil, "Tags to add to the Black Duck projects, Go templates like the project name, i.e.: 'namespace:{{.Namespace}}'")
+	command.Flags().StringToStringVar(&commonFlags.ProjectLabels, ProjectLabelFlagName, nil, "Labels to add to the Black Duck projects as KEY:VALUE tags, i.e.: cluster=prod")
+	command.Flags().StringVar(&commonFlags.NamingTemplates.Group, ProjectGroupFlagName, "", "Black Duck project group to put the projects in, a Go template like the project name; the group has to exist")
+}
 
-	detectClient := detect.NewDefaultClient()
-	err = detectClient.DownloadDetectIfNotExists()
+// AddReportFlags adds the flags to save the report of a run and compare it with another one, which only the commands
+// scanning once have
+func AddReportFlags(command *cobra.Command, commonFlags *CommonFlags) {
+	command.Flags().StringVar(&commonFlags.ReportDir, ReportDirFlagName, "", fmt.Sprintf("Directory to save a JSON report of every run to, with the vulnerabilities of the images scanned by Black Duck, i.e.: %s; the scans then wait for Black Duck to build their BOMs", report.DefaultReportsDirectory))
+	command.Flags().StringVar(&commonFlags.CompareWith, CompareWithFlagName, "", fmt.Sprintf("Print what changed since a report: '%s' for the previous run of the same namespace, file, charts or images, or the path of a report", report.CompareWithLast))
+}
+
+// ValidateReportFlags checks that --compare-with can be found, before scanning
+func ValidateReportFlags(commonFlags *CommonFlags) error {
+	if commonFlags.CompareWith == "" {
+		return nil
+	}
+	if commonFlags.ReportDir == "" {
+		return errors.Errorf("--%s needs --%s", CompareWithFlagName, ReportDirFlagName)
+	}
+	if commonFlags.CompareWith != report.CompareWithLast {
+		_, err := report.Load(commonFlags.CompareWith)
+		return err
+	}
+	return nil
+}
+
+// SaveReport saves the report of the images scanned in a run and prints what changed since --compare-with; the scope
+// identifies what was scanned, see report.Scope. The report of a cancelled or failed run is saved as partial, since
+// images may be missing from it, and isn't compared
+func SaveReport(ctx context.Context, scope string, runErr error, commonFlags *CommonFlags) {
+	if commonFlags.ReportDir == "" {
+		return
+	}
+	store := report.NewStore(commonFlags.ReportDir)
+	newReport := reportCollector.Report(scope, GetCurrent(), time.Now())
+	if len(newReport.Images) == 0 {
+		// nothing was scanned, i.e.: the flags were invalid
+		return
+	}
+	comparePath := commonFlags.CompareWith
+	newReport.Partial = ctx.Err() != nil || runErr != nil
+	if newReport.Partial {
+		log.Warnf("the run of %s didn't finish, saving a partial report which isn't compared", scope)
+		comparePath = ""
+	}
+	if comparePath == report.CompareWithLast {
+		var err error
+		if comparePath, err = store.Last(scope); err != nil {
+			log.Errorf("%+v", err)
+		} else if comparePath == "" {
+			log.Infof("no previous report of %s to compare with", scope)
+		}
+	}
+	if comparePath != "" {
+		oldReport, err := report.Load(comparePath)
+		if err != nil {
+			log.Errorf("%+v", err)
+		} else {
+			fmt.Printf("\n%s\n", report.Compare(oldReport, newReport).Render())
+		}
+	}
+
+	path, err := store.Save(newReport)
+	if err != nil {
+		log.Errorf("unable to save the report of %s: %+v", scope, err)
+		return
+	}
+	log.Infof("saved the report of %s with %d images to %s", scope, len(newReport.Images), path)
+}
+
+// AddWriteResultsFlag adds the flag to write the results back to the cluster, which only the commands scanning
+// namespaces have
+func AddWriteResultsFlag(command *cobra.Command, commonFlags *CommonFlags) {
+	command.Flags().StringSliceVar(&commonFlags.WriteResults, WriteResultsFlagName, nil, fmt.Sprintf("Write the results back to the cluster, any of [%s, %s]: annotate the workloads using the images and/or create an ImageScanReport per image digest, see `bd-xray crd`", kube.WriteResultsAnnotations, kube.WriteResultsReports))
+}
+
+// SetupResultWriter sets up writing the results back to the cluster if --write-results is given
+func SetupResultWriter(cli *kube.Client, commonFlags *CommonFlags) error {
+	if len(commonFlags.WriteResults) == 0 {
+		return nil
+	}
+	writer, err := kube.NewResultWriter(cli, commonFlags.WriteResults)
+	if err != nil {
+		return err
+	}
+	resultWriter = writer
+	return nil
+}
+
+// AddNamingFlags adds the flags of the Black Duck project, version and code location names, which are shared by the
+// scan commands and `bd-xray prune`
+func AddNamingFlags(command *cobra.Command, commonFlags *CommonFlags) {
+	command.Flags().StringVar(&commonFlags.NamingTemplates.Project, ProjectTemplateFlagName, "", "Go template of the Black Duck project name, i.e.: '{{.Namespace}}-{{.Workload}}'. If not supplied, projects are named as before, see --detect.project.name")
+	command.Flags().StringVar(&commonFlags.NamingTemplates.Version, VersionTemplateFlagName, "", "Go template of the Black Duck project version name, i.e.: '{{.Tag}}-{{.Digest | short}}'")
+	command.Flags().StringVar(&commonFlags.NamingTemplates.CodeLocation, CodeLocationTemplateFlagName, naming.DefaultCodeLocationTemplate, "Go template of the Black Duck code location name, which can use the rendered {{.Project}} and {{.Version}}")
+}
+
+// NewNamer creates the namer of the scans of a command from the naming templates and --detect.project.name
+func NewNamer(source string, base naming.Context, commonFlags *CommonFlags) (*naming.Namer, error) {
+	base.Source = source
+	base.ProjectName = commonFlags.DetectProjectName
+	templates := commonFlags.NamingTemplates
+	templates.Tags = append(append([]string{}, templates.Tags...), LabelTags(commonFlags.ProjectLabels)...)
+	return naming.NewNamer(templates, base)
+}
+
+// LabelTags turns labels into KEY:VALUE tags, sorted by key
+func LabelTags(labels map[string]string) []string {
+	var tags []string
+	for key, value := range labels {
+		tags = append(tags, fmt.Sprintf("%s:%s", key, value))
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func RunImagesScanCommand(imageList []string, ctx context.Context, cancellationFunc context.CancelFunc, commonFlags *CommonFlags, detectPassThroughFlagsMap map[string]interface{}) error {
+	namer, err := NewNamer(naming.SourceImages, naming.Context{}, commonFlags)
 	if err != nil {
 		return err
 	}
-	err = detectClient.SetupPersistentDockerInspectorServices()
+	err = RunAndPrintMultipleImageScansConcurrently(ctx, cancellationFunc, imageList, detectPassThroughFlagsMap, namer, commonFlags)
+	// runs of other images aren't compared with each other
+	SaveReport(ctx, report.SetScope(naming.SourceImages, imageList), err, commonFlags)
 	if err != nil {
 		return err
 	}
-	if cleanup {
+	return staleImages.Err(commonFlags.StalenessThreshold)
+}
+
+func RunAndPrintMultipleImageScansConcurrently(ctx context.Context, cancellationFunc context.CancelFunc, imageList []string, detectPassThroughFlagsMap map[string]interface{}, namer *naming.Namer, commonFlags *CommonFlags) error {
+	imageRegistries, err := registries.LoadImageRegistries(commonFlags.RegistryConfigPath)
+	if err != nil {
+		return err
+	}
+	return RunAndPrintMultipleImageScansConcurrentlyWithRegistries(ctx, cancellationFunc, imageRegistries, imageList, detectPassThroughFlagsMap, namer, commonFlags)
+}
+
+func RunAndPrintMultipleImageScansConcurrentlyWithRegistries(ctx context.Context, cancellationFunc context.CancelFunc, imageRegistries registries.ImageRegistries, imageList []string, detectPassThroughFlagsMap map[string]interface{}, namer *naming.Namer, commonFlags *CommonFlags) error {
+	var err error
+
+	if commonFlags.SBOMDir != "" {
+		if err = sbom.ValidateFormats(commonFlags.SBOMFormats); err != nil {
+			return err
+		}
+	}
+	if err = ValidateReportFlags(commonFlags); err != nil {
+		return err
+	}
+
+	detectClient, err := NewDetectClient(commonFlags)
+	if err != nil {
+		return err
+	}
+	if commonFlags.CleanupPersistentDockerInspectorServices {
 		defer detectClient.StopAndCleanupPersistentDockerInspectorServices()
 	}
 
@@ -91,14 +325,27 @@ func RunAndPrintMultipleImageScansConcurrently(ctx context.Context, cancellation
 		return err
 	}
 
-	err = RunMultipleImageScansConcurrently(ctx, cancellationFunc, detectClient, imageList, detectPassThroughFlagsMap, scanStatusRowChan, projectName)
-	if err != nil {
-		return err
-	}
+	err = RunMultipleImageScansConcurrently(ctx, cancellationFunc, detectClient, imageRegistries, imageList, detectPassThroughFlagsMap, scanStatusRowChan, namer, commonFlags)
 
+	// wait for the table with the partial results as well, before the cleanup runs
 	BlockOnDoneChan(doneChan)
 
-	return nil
+	return err
+}
+
+// NewDetectClient downloads detect if needed and sets up the persistent docker inspector services
+func NewDetectClient(commonFlags *CommonFlags) (*detect.Client, error) {
+	detectClient := detect.NewDefaultClient()
+	detectClient.DetectVersion = commonFlags.DetectVersion
+	detectClient.DetectChecksum = commonFlags.DetectChecksum
+	detectClient.ImageInspector = commonFlags.ImageInspector
+	if err := detectClient.DownloadDetectIfNotExists(); err != nil {
+		return nil, err
+	}
+	if err := detectClient.SetupPersistentDockerInspectorServices(); err != nil {
+		return nil, err
+	}
+	return detectClient, nil
 }
 
 func RunPrinterConcurrently(cancellationFunc context.CancelFunc, scanStatusTableValues <-chan *ScanStatusRow, doneChan chan<- bool) error {
@@ -122,7 +369,7 @@ func BlockOnDoneChan(doneChan chan bool) {
 	}
 }
 
-func RunMultipleImageScansConcurrently(ctx context.Context, cancellationFunc context.CancelFunc, detectClient *detect.Client, imageList []string, detectPassThroughFlagsMap map[string]interface{}, scanStatusRowChan chan *ScanStatusRow, projectName string) error {
+func RunMultipleImageScansConcurrently(ctx context.Context, cancellationFunc context.CancelFunc, detectClient *detect.Client, imageRegistries registries.ImageRegistries, imageList []string, detectPassThroughFlagsMap map[string]interface{}, scanStatusRowChan chan *ScanStatusRow, namer *naming.Namer, commonFlags *CommonFlags) error {
 	var err error
 
 	var goRoutineGroup run.Group
@@ -131,7 +378,16 @@ func RunMultipleImageScansConcurrently(ctx context.Context, cancellationFunc con
 		image := image
 		scanStatusRow := &ScanStatusRow{}
 		goRoutineGroup.Add(func() error {
-			return RunImageScanCommand(ctx, detectClient, image, detectPassThroughFlagsMap, scanStatusRow, scanStatusRowChan, projectName)
+			err := RunImageScanCommand(ctx, detectClient, imageRegistries, image, detectPassThroughFlagsMap, scanStatusRow, scanStatusRowChan, namer, commonFlags)
+			if err != nil {
+				// still report the image, so that the table shows which scans didn't complete
+				unfinishedScanStatusRow := NewUnfinishedScanStatusRow(ctx, image, scanStatusRow)
+				scanStatusRowChan <- unfinishedScanStatusRow
+				if commonFlags.ReportDir != "" {
+					reportCollector.Add(report.Image{Image: image, Tag: unfinishedScanStatusRow.ImageTag, Status: unfinishedScanStatusRow.Status, Workloads: namer.Workloads(image)})
+				}
+			}
+			return err
 		}, func(error) {
 			cancellationFunc()
 		})
@@ -139,8 +395,10 @@ func RunMultipleImageScansConcurrently(ctx context.Context, cancellationFunc con
 
 	log.Tracef("starting scanning goroutines")
 	err = goRoutineGroup.Run()
-	if err != nil {
-		log.Fatalf("FATAL ERROR: %+v", err)
+	if ctx.Err() != nil {
+		log.Warnf("scans were cancelled, printing the partial results")
+	} else if err != nil {
+		log.Errorf("scan failed, cancelled the remaining scans: %s", detect.DescribeScanError(err))
 	}
 
 	log.Tracef("closing the output channel")
@@ -148,9 +406,74 @@ func RunMultipleImageScansConcurrently(ctx context.Context, cancellationFunc con
 	return err
 }
 
+// RunImageScanWithRetries runs detect against an image, killing it after --scan-timeout and retrying transient
+// failures up to --scan-retries times, waiting --scan-retry-backoff before the first retry and twice as long before
+// every further one; every attempt writes to a new output dir, the one of the last attempt is returned. The runs are
+// indexed with the namespace the image runs in, empty if it wasn't scanned in a namespace
+func RunImageScanWithRetries(ctx context.Context, detectClient *detect.Client, fullImageName, namespace, imageName, imageTag string, names naming.Names, detectPassThroughFlags string, commonFlags *CommonFlags) (string, error) {
+	backoff := commonFlags.ScanRetryBackoff
+	for attempt := 0; ; attempt++ {
+		// a unique string, but something that's human readable, i.e.: TIMESTAMP_NAME_TAG_RANDOMSTRING
+		timestampUniqueSanitizedString := utils.SanitizeString(fmt.Sprintf("%s_%s_%s_%s", time.Now().Format("20060102150405"), imageName, imageTag, utils.GenerateRandomString(16)))
+		uniqueOutputDirName := fmt.Sprintf("%s/%s", detect.DefaultDetectBlackduckDirectory, timestampUniqueSanitizedString)
+		log.Tracef("output dir is: %s", uniqueOutputDirName)
+
+		startedAt := time.Now()
+		err := runImageScanWithTimeout(ctx, detectClient, fullImageName, names, uniqueOutputDirName, detectPassThroughFlags, commonFlags.ScanTimeout)
+		indexErr := resultsIndex.Add(results.Entry{
+			RunID:     timestampUniqueSanitizedString,
+			Image:     fullImageName,
+			Namespace: namespace,
+			OutputDir: uniqueOutputDirName,
+			LogFile:   detect.LogFilePath(uniqueOutputDirName),
+			ExitCode:  detect.ExitCodeOf(err),
+			Error:     detect.DescribeScanError(err),
+			StartedAt: startedAt,
+			Duration:  time.Since(startedAt),
+		})
+		if indexErr != nil {
+			log.Warnf("%+v", indexErr)
+		}
+		if err == nil {
+			return uniqueOutputDirName, nil
+		}
+		if ctx.Err() != nil || attempt >= commonFlags.ScanRetries || !detect.IsTransientScanError(err) {
+			return uniqueOutputDirName, err
+		}
+
+		log.Warnf("scan of '%s' failed transiently (attempt %d of %d), retrying in %s: %s, see %s", fullImageName, attempt+1, commonFlags.ScanRetries+1, backoff, detect.DescribeScanError(err), detect.LogFilePath(uniqueOutputDirName))
+		select {
+		case <-ctx.Done():
+			return uniqueOutputDirName, errors.Wrapf(ctx.Err(), "scan of '%s' was cancelled", fullImageName)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func runImageScanWithTimeout(ctx context.Context, detectClient *detect.Client, fullImageName string, names naming.Names, outputDirName, detectPassThroughFlags string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	project := detect.Project{
+		Name:             names.Project,
+		VersionName:      names.Version,
+		CodeLocationName: names.CodeLocation,
+		Tags:             names.Tags,
+		GroupName:        names.Group,
+	}
+	err := detectClient.RunImageScan(ctx, fullImageName, project, outputDirName, detectPassThroughFlags)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errors.Wrapf(err, "scan of '%s' timed out after %s", fullImageName, timeout)
+	}
+	return err
+}
+
 // RunImageScanCommand
 // https://synopsys.atlassian.net/wiki/spaces/INTDOCS/pages/631374044/Detect+Properties
-func RunImageScanCommand(ctx context.Context, detectClient *detect.Client, fullImageName string, detectPassThroughFlagsMap map[string]interface{}, scanStatusRow *ScanStatusRow, scanStatusRowChan chan *ScanStatusRow, projectName string) error {
+func RunImageScanCommand(ctx context.Context, detectClient *detect.Client, imageRegistries registries.ImageRegistries, fullImageName string, detectPassThroughFlagsMap map[string]interface{}, scanStatusRow *ScanStatusRow, scanStatusRowChan chan *ScanStatusRow, namer *naming.Namer, commonFlags *CommonFlags) error {
 
 	var err error
 
@@ -162,6 +485,21 @@ func RunImageScanCommand(ctx context.Context, detectClient *detect.Client, fullI
 		}
 		detectPassThroughFlags += fmt.Sprintf("--%s=%v ", flagName, castFlagVal)
 	}
+	if WaitsForResults(commonFlags) {
+		detectPassThroughFlags += DetectWaitForResultsFlag + " "
+	}
+
+	oneImage, parseErr := remediation.NewImage(fullImageName)
+	if parseErr == nil {
+		username, password := imageRegistries.FindRegistryByURL(oneImage.URL).Credentials()
+		if username != "" || password != "" {
+			// detect pulls images without credentials, so pull them beforehand if the registry needs credentials
+			err = detectClient.DockerCLIClient.PullDockerImageWithAuth(ctx, fullImageName, username, password)
+			if err != nil {
+				log.Warnf("%+v", err)
+			}
+		}
+	}
 
 	imageName := utils.ParseImageName(fullImageName)
 	imageTag := utils.ParseImageTag(fullImageName)
@@ -174,13 +512,19 @@ func RunImageScanCommand(ctx context.Context, detectClient *detect.Client, fullI
 	// if err != nil {
 	// 	return err
 	// }
-	// a unique string, but something that's human readable, i.e.: TIMESTAMP_NAME_TAG_RANDOMSTRING
-	timestampUniqueSanitizedString := utils.SanitizeString(fmt.Sprintf("%s_%s_%s_%s", time.Now().Format("20060102150405"), imageName, imageTag, utils.GenerateRandomString(16)))
-	uniqueOutputDirName := fmt.Sprintf("%s/%s", detect.DefaultDetectBlackduckDirectory, timestampUniqueSanitizedString)
-	log.Tracef("output dir is: %s", uniqueOutputDirName)
-
-	err = detectClient.RunImageScan(fullImageName, projectName, imageName, imageTag, uniqueOutputDirName, detectPassThroughFlags)
+	names, err := ImageScanNames(namer, imageRegistries, fullImageName)
+	if err != nil {
+		return err
+	}
+	uniqueOutputDirName, err := RunImageScanWithRetries(ctx, detectClient, fullImageName, namer.ContextFor(fullImageName).Namespace, imageName, imageTag, names, detectPassThroughFlags, commonFlags)
+	scanStatusRow.LogFile = detect.LogFilePath(uniqueOutputDirName)
 	if err != nil {
+		statusJSON, err := DescribeFailedScan(fullImageName, uniqueOutputDirName, scanStatusRow, err)
+		if resultWriter != nil && ctx.Err() == nil {
+			if writeErr := WriteFailedScanResult(ctx, namer, imageRegistries, fullImageName, statusJSON, scanStatusRow, err, commonFlags); writeErr != nil {
+				log.Errorf("%+v", writeErr)
+			}
+		}
 		return err
 	}
 
@@ -190,39 +534,81 @@ func RunImageScanCommand(ctx context.Context, detectClient *detect.Client, fullI
 	if err != nil {
 		return err
 	}
+	if statusFilePath == "" {
+		return errors.Errorf("no status.json found in output dir %s of the scan of '%s'", uniqueOutputDirName, fullImageName)
+	}
 	log.Tracef("statusFilePath: %s", statusFilePath)
 	statusJSON, err := detect.ParseStatusJSONFile(statusFilePath)
 	if err != nil {
 		return err
 	}
+	for _, issue := range statusJSON.FormatIssues() {
+		log.Warnf("scan of '%s' reported an issue: %s", fullImageName, issue)
+	}
+	var location string
 	locations := detect.FindLocationFromStatus(statusJSON)
-	if len(locations) == 0 {
-		// TODO: how to handle this better??
-		log.Warnf("no location found; either running offline mode or something went wrong")
-		return nil
+	if len(locations) > 0 {
+		location = locations[0]
+		log.Tracef("BlackDuckURL: %s", location)
+	} else if IsOfflineMode(commonFlags) {
+		// in offline mode nothing is uploaded, so report the components found in the BDIO files instead
+		location, err = ReportOfflineScan(fullImageName, uniqueOutputDirName)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Warnf("scan of '%s' reported no Black Duck location, its results may not have been uploaded", fullImageName)
 	}
-	location := locations[0]
-	log.Tracef("BlackDuckURL: %s", location)
 
 	// fill in all the rows
 	scanStatusRow.ImageName = imageName
 	scanStatusRow.ImageTag = imageTag
+	scanStatusRow.Status = ScanStatusSucceeded
+	if !statusJSON.Succeeded() {
+		log.Errorf("scan of '%s' finished with exit status %s and failed tools [%s]", fullImageName, statusJSON.ExitCodeKey(), strings.Join(statusJSON.FailedTools(), ", "))
+		scanStatusRow.Status = ScanStatusFailed
+	}
+	scanStatusRow.Tools = statusJSON.FormatToolStatuses()
+	scanStatusRow.Issues = len(statusJSON.Issues)
 	scanStatusRow.BlackDuckURL = location
-	// TODO: add a column in table for where detect logs so users can examine afterwards if needed
+	scanStatusRow.BOMComplete = len(locations) > 0 && scanStatusRow.Status == ScanStatusSucceeded && WaitsForResults(commonFlags)
+
+	if parseErr != nil {
+		log.Warnf("unable to look up latest version of '%s': %+v", fullImageName, parseErr)
+		scanStatusRow.LatestAvailableImageVersion = versioning.Notfound
+		scanStatusRow.Recommendation = versioning.NewRecommendation(imageTag)
+	} else {
+		latestInfo := LookUpLatestVersion(ctx, oneImage, imageRegistries)
+		scanStatusRow.LatestAvailableImageVersion = latestInfo.LatestVersion
+		scanStatusRow.Recommendation = latestInfo.Recommendation
+		scanStatusRow.Staleness = latestInfo.Staleness
+		if commonFlags.StalenessThreshold > 0 && scanStatusRow.Staleness.Score > commonFlags.StalenessThreshold {
+			log.Warnf("ALERT: image '%s' has a staleness score of %d, above the threshold of %d; %d major, %d minor, %d patch releases and %d days behind",
+				fullImageName, scanStatusRow.Staleness.Score, commonFlags.StalenessThreshold,
+				scanStatusRow.Recommendation.MajorsBehind, scanStatusRow.Recommendation.MinorsBehind, scanStatusRow.Recommendation.PatchesBehind, scanStatusRow.Staleness.AgeGapDays())
+			staleImages.Add(fullImageName, scanStatusRow.Staleness.Score)
+		}
+	}
 
-	var images []remediation.Image
-	oneImage := remediation.Image{FullPath: fullImageName, URL: "docker.io", Name: imageName, Version: imageTag}
-	images = append(images, oneImage)
+	blackDuckLocation := ""
+	if len(locations) > 0 {
+		blackDuckLocation = locations[0]
+	}
+	if commonFlags.SBOMDir != "" {
+		if err := ExportImageSBOM(fullImageName, blackDuckLocation, uniqueOutputDirName, commonFlags); err != nil {
+			log.Errorf("unable to export SBOM of '%s': %+v", fullImageName, err)
+		}
+	}
 
-	newRegistries := registries.ImageRegistries{}
-	newRegistries.DefaultRegistries()
-	latestInfo := remediation.GetLatestVersionsForImages(images, newRegistries)
+	if commonFlags.ReportDir != "" {
+		CollectImageReport(namer, imageRegistries, fullImageName, blackDuckLocation, scanStatusRow, commonFlags)
+	}
 
-	var latestVersion string
-	for _, inf := range latestInfo {
-		latestVersion = inf.LatestVersion
+	if resultWriter != nil {
+		if err := WriteScanResult(ctx, namer, imageRegistries, fullImageName, blackDuckLocation, statusJSON.ExitCodeKey(), scanStatusRow, commonFlags); err != nil {
+			log.Errorf("%+v", err)
+		}
 	}
-	scanStatusRow.LatestAvailableImageVersion = latestVersion
 
 	log.Tracef("sending to printer: '%s' '%s' '%s'", scanStatusRow.ImageName, scanStatusRow.BlackDuckURL, scanStatusRow.LatestAvailableImageVersion)
 	scanStatusRowChan <- scanStatusRow
@@ -230,12 +616,296 @@ func RunImageScanCommand(ctx context.Context, detectClient *detect.Client, fullI
 	return err
 }
 
+// DescribeFailedScan adds the failed tools and issues of the status.json of a failed detect run, if it wrote one, to
+// its error and to the tools and issues of its row; returns the status.json, nil if there is none
+func DescribeFailedScan(fullImageName, outputDirName string, scanStatusRow *ScanStatusRow, err error) (*detect.Status, error) {
+	statusFilePath, findErr := detect.FindScanStatusFile(outputDirName)
+	if findErr != nil || statusFilePath == "" {
+		log.Debugf("no status.json of the failed scan of '%s' in %s: %v", fullImageName, outputDirName, findErr)
+		return nil, err
+	}
+	statusJSON, parseErr := detect.ParseStatusJSONFile(statusFilePath)
+	if parseErr != nil {
+		log.Debugf("%+v", parseErr)
+		return nil, err
+	}
+	scanStatusRow.Tools = statusJSON.FormatToolStatuses()
+	scanStatusRow.Issues = len(statusJSON.Issues)
+	scanStatusRow.BlackDuckURL = PolicyViolationLocation(statusJSON)
+	return statusJSON, errors.Wrapf(err, "scan of '%s' finished with exit status %s, failed tools [%s] and issues [%s]",
+		fullImageName, statusJSON.ExitCodeKey(), strings.Join(statusJSON.FailedTools(), ", "), strings.Join(statusJSON.FormatIssues(), "; "))
+}
+
+// WriteFailedScanResult writes the result of a failed scan back to the namespace of the image, with the exit status
+// detect reported; the BOM of a scan violating a policy is complete, so its vulnerability counts are written too
+func WriteFailedScanResult(ctx context.Context, namer *naming.Namer, imageRegistries registries.ImageRegistries, fullImageName string, statusJSON *detect.Status, scanStatusRow *ScanStatusRow, err error, commonFlags *CommonFlags) error {
+	failedScanStatusRow := NewUnfinishedScanStatusRow(ctx, fullImageName, scanStatusRow)
+	exitStatus := detect.DescribeScanError(err)
+	if statusJSON != nil {
+		exitStatus = statusJSON.ExitCodeKey()
+	}
+	return WriteScanResult(ctx, namer, imageRegistries, fullImageName, PolicyViolationLocation(statusJSON), exitStatus, failedScanStatusRow, commonFlags)
+}
+
+// PolicyViolationLocation is the Black Duck location of a detect run which failed because its BOM violates a policy:
+// the BOM is complete, only the build fails; empty for other runs and if there's no status.json
+func PolicyViolationLocation(statusJSON *detect.Status) string {
+	if statusJSON == nil || statusJSON.ExitCodeKey() != detect.ExitCodeKeyFailurePolicyViolation {
+		return ""
+	}
+	if locations := detect.FindLocationFromStatus(statusJSON); len(locations) > 0 {
+		return locations[0]
+	}
+	return ""
+}
+
+// WaitsForResults is true if the results of the scans are read from Black Duck right after detect returns: for the
+// SBOMs, the results written back to the cluster, the reports and the metrics of serve
+func WaitsForResults(commonFlags *CommonFlags) bool {
+	return commonFlags.SBOMDir != "" || len(commonFlags.WriteResults) > 0 || commonFlags.ReportDir != "" || commonFlags.WaitForResults
+}
+
+// IsOfflineMode is true if detect runs in offline mode, so that the scans aren't uploaded to Black Duck
+func IsOfflineMode(commonFlags *CommonFlags) bool {
+	offline, _ := strconv.ParseBool(commonFlags.DetectOfflineMode)
+	return offline
+}
+
+// LookUpLatestVersion looks up the latest version of an image, with at most as many lookups at once across the
+// concurrent scans as latestVersionLookups allows; the latest version isn't found if the scan is cancelled meanwhile
+func LookUpLatestVersion(ctx context.Context, image remediation.Image, imageRegistries registries.ImageRegistries) remediation.ContainerInfo {
+	select {
+	case latestVersionLookups <- struct{}{}:
+	case <-ctx.Done():
+		return remediation.ContainerInfo{Container: image, LatestVersion: versioning.Notfound, Recommendation: versioning.NewRecommendation(image.Version)}
+	}
+	defer func() { <-latestVersionLookups }()
+	return remediation.GetLatestVersionForImage(image, imageRegistries)
+}
+
+// ImageScanNames renders the project, version and code location names of an image; the digest of a tagged image is
+// only looked up in the registry if a template uses it, and a failed lookup fails, rather than naming the scan without
+// the digest, i.e.: into another version
+func ImageScanNames(namer *naming.Namer, imageRegistries registries.ImageRegistries, fullImageName string) (naming.Names, error) {
+	imageContext, err := ImageNamingContext(namer, imageRegistries, fullImageName)
+	if err != nil {
+		return naming.Names{}, errors.Wrapf(err, "unable to look up the digest of '%s'", fullImageName)
+	}
+	return namer.Names(imageContext)
+}
+
+// ImageNamingContext is the naming context of an image, with the digest looked up in the registry if a template
+// uses it
+func ImageNamingContext(namer *naming.Namer, imageRegistries registries.ImageRegistries, fullImageName string) (naming.Context, error) {
+	imageContext := namer.ContextFor(fullImageName)
+	if !namer.UsesDigest() || imageContext.Digest != "" {
+		return imageContext, nil
+	}
+	image, err := remediation.NewImage(fullImageName)
+	if err != nil {
+		return imageContext, err
+	}
+	imageContext.Digest, err = imageRegistries.GetDigestForImage(image.Name, image.URL, image.Version)
+	return imageContext, err
+}
+
+// ReportOfflineScan parses the BDIO files and docker inspector results of a scan in offline mode, prints the components
+// and writes them to a report in the output dir; returns what to show instead of the Black Duck URL
+func ReportOfflineScan(fullImageName, outputDirName string) (string, error) {
+	report, err := bdio.FindReport(outputDirName)
+	if err != nil {
+		return "", err
+	}
+	if len(report.BDIOFiles) == 0 {
+		return "", errors.Errorf("scan of '%s' has neither a Black Duck URL nor BDIO files in %s", fullImageName, outputDirName)
+	}
+	reportPath, err := report.Write(fullImageName)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("\n%s\n", report.Render(fullImageName))
+	log.Infof("scan of '%s' ran in offline mode, upload it with 'bd-xray upload %s'", fullImageName, filepath.Base(outputDirName))
+	return fmt.Sprintf("OFFLINE: %d components, see %s", len(report.Components), reportPath), nil
+}
+
+// ExportImageSBOM exports the SBOMs of an image, with the components of the Black Duck BOM at blackDuckLocation, or of
+// the local BDIO files in the output dir if the scan ran in offline mode
+func ExportImageSBOM(fullImageName, blackDuckLocation, outputDirName string, commonFlags *CommonFlags) error {
+	inventory := &sbom.ImageInventory{Image: fullImageName}
+	if blackDuckLocation != "" {
+		bomComponents, err := blackduck.NewClient(commonFlags.BlackDuckURL, commonFlags.BlackDuckToken).GetBOMComponents(blackDuckLocation)
+		if err != nil {
+			return err
+		}
+		inventory.Source = sbom.SourceBlackDuck
+		inventory.Components = sbom.ComponentsFromBOM(bomComponents)
+	} else {
+		report, err := bdio.FindReport(outputDirName)
+		if err != nil {
+			return err
+		}
+		inventory.Source = sbom.SourceBDIO
+		inventory.Components = sbom.ComponentsFromBDIO(report.Components)
+	}
+	if sbomCollector != nil {
+		sbomCollector.Add(inventory)
+	}
+
+	paths, err := sbom.NewGenerator(GetCurrent()).WriteImage(commonFlags.SBOMDir, commonFlags.SBOMFormats, inventory)
+	if err != nil {
+		return err
+	}
+	log.Infof("exported SBOM of '%s' with %d components to %s", fullImageName, len(inventory.Components), strings.Join(paths, ", "))
+	return nil
+}
+
+// WriteScanResult writes the result of a scan back to the namespace of the image, with the exit status detect reported
+// and the vulnerability counts of the Black Duck project version at blackDuckLocation, if the scan was uploaded
+func WriteScanResult(ctx context.Context, namer *naming.Namer, imageRegistries registries.ImageRegistries, fullImageName, blackDuckLocation, exitStatus string, scanStatusRow *ScanStatusRow, commonFlags *CommonFlags) error {
+	result := kube.ScanResult{
+		Image:      fullImageName,
+		Digest:     ImageDigest(namer, imageRegistries, fullImageName),
+		Status:     scanStatusRow.Status,
+		ExitStatus: exitStatus,
+		LatestTag:  scanStatusRow.LatestAvailableImageVersion,
+		ScannedAt:  time.Now().UTC(),
+		Workloads:  namer.Workloads(fullImageName),
+	}
+	if blackDuckLocation != "" {
+		result.BlackDuckURL = blackDuckLocation
+		counts, err := blackduck.NewClient(commonFlags.BlackDuckURL, commonFlags.BlackDuckToken).GetVulnerabilityCounts(blackDuckLocation)
+		if err != nil {
+			log.Warnf("unable to get the vulnerability counts of '%s', writing the result without them: %+v", fullImageName, err)
+		} else {
+			result.Vulnerabilities = &kube.VulnerabilityCounts{Critical: counts.Critical, High: counts.High, Medium: counts.Medium, Low: counts.Low}
+		}
+	}
+	return resultWriter.Write(ctx, namer.ContextFor(fullImageName).Namespace, result)
+}
+
+// CollectImageReport adds the result of a scan to the report of the run, with the vulnerabilities of the Black Duck
+// project version at blackDuckLocation, if the scan was uploaded and its BOM is complete; otherwise the vulnerabilities
+// are unknown, so that they aren't reported as fixed
+func CollectImageReport(namer *naming.Namer, imageRegistries registries.ImageRegistries, fullImageName, blackDuckLocation string, scanStatusRow *ScanStatusRow, commonFlags *CommonFlags) {
+	image := report.Image{
+		Image:        fullImageName,
+		Tag:          scanStatusRow.ImageTag,
+		Digest:       ImageDigest(namer, imageRegistries, fullImageName),
+		Status:       scanStatusRow.Status,
+		BlackDuckURL: blackDuckLocation,
+		LatestTag:    scanStatusRow.LatestAvailableImageVersion,
+		Workloads:    namer.Workloads(fullImageName),
+	}
+	if blackDuckLocation != "" && scanStatusRow.BOMComplete {
+		vulnerableComponents, err := blackduck.NewClient(commonFlags.BlackDuckURL, commonFlags.BlackDuckToken).GetVulnerableComponents(blackDuckLocation)
+		if err != nil {
+			log.Warnf("unable to get the vulnerabilities of '%s', reporting them as unknown: %+v", fullImageName, err)
+		} else {
+			image.VulnerabilitiesKnown = true
+			for _, vulnerableComponent := range vulnerableComponents {
+				image.Vulnerabilities = append(image.Vulnerabilities, report.Vulnerability{
+					ID:        vulnerableComponent.Vulnerability.VulnerabilityName,
+					Severity:  vulnerableComponent.Vulnerability.Severity,
+					Component: vulnerableComponent.ComponentName,
+					Version:   vulnerableComponent.ComponentVersionName,
+				})
+			}
+		}
+	}
+	reportCollector.Add(image)
+}
+
+// ImageDigest is the digest of an image reference, or looked up in its registry for a tag; empty if the lookup fails
+func ImageDigest(namer *naming.Namer, imageRegistries registries.ImageRegistries, fullImageName string) string {
+	if digest := namer.ContextFor(fullImageName).Digest; digest != "" {
+		return digest
+	}
+	image, err := remediation.NewImage(fullImageName)
+	if err != nil {
+		return ""
+	}
+	digest, err := imageRegistries.GetDigestForImage(image.Name, image.URL, image.Version)
+	if err != nil {
+		log.Debugf("unable to look up the digest of '%s': %+v", fullImageName, err)
+	}
+	return digest
+}
+
+const (
+	// ScanStatusSucceeded means the scan completed
+	ScanStatusSucceeded = "SUCCEEDED"
+	// ScanStatusFailed means the scan failed, and the remaining scans were cancelled, or detect reported a failed tool
+	ScanStatusFailed = "FAILED"
+	// ScanStatusCancelled means the scan was cancelled, i.e.: by Ctrl-C or because another scan failed
+	ScanStatusCancelled = "CANCELLED"
+)
+
+// StaleImages are the images of a run whose staleness score is above --staleness-threshold
+type StaleImages struct {
+	mutex  sync.Mutex
+	scores map[string]int
+}
+
+func NewStaleImages() *StaleImages {
+	return &StaleImages{scores: map[string]int{}}
+}
+
+func (s *StaleImages) Add(image string, score int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.scores[image] = score
+}
+
+// Err fails with the stale images sorted by image, nil if there are none; the images are reset for the next run
+func (s *StaleImages) Err(threshold int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.scores) == 0 {
+		return nil
+	}
+	var images []string
+	for image, score := range s.scores {
+		images = append(images, fmt.Sprintf("%s (%d)", image, score))
+	}
+	sort.Strings(images)
+	s.scores = map[string]int{}
+	return errors.Errorf("%d images have a staleness score above the threshold of %d: %s", len(images), threshold, strings.Join(images, ", "))
+}
+
 type ScanStatusRow struct {
 	ImageName                   string
 	ImageTag                    string
+	Status                      string
+	Tools                       string
+	Issues                      int
 	ImageSha                    string
 	BlackDuckURL                string
+	LogFile                     string
 	LatestAvailableImageVersion string
+	Recommendation              versioning.Recommendation
+	Staleness                   remediation.Staleness
+	// BOMComplete is true if detect waited for Black Duck to build the BOM of the uploaded scan, so that the
+	// components and vulnerabilities read from it are complete
+	BOMComplete bool
+}
+
+// NewUnfinishedScanStatusRow is the row of an image whose scan failed or was cancelled, with the log file and tool
+// statuses of scanStatusRow, the row filled in by RunImageScanCommand before it failed
+func NewUnfinishedScanStatusRow(ctx context.Context, fullImageName string, scanStatusRow *ScanStatusRow) *ScanStatusRow {
+	status := ScanStatusFailed
+	if ctx.Err() != nil {
+		status = ScanStatusCancelled
+	}
+	return &ScanStatusRow{
+		ImageName:      utils.ParseImageName(fullImageName),
+		ImageTag:       utils.ParseImageTag(fullImageName),
+		Status:         status,
+		Tools:          scanStatusRow.Tools,
+		Issues:         scanStatusRow.Issues,
+		BlackDuckURL:   scanStatusRow.BlackDuckURL,
+		LogFile:        scanStatusRow.LogFile,
+		Recommendation: versioning.NewRecommendation(utils.ParseImageTag(fullImageName)),
+	}
 }
 
 func PrintScanStatusTable(scanStatusRowChan <-chan *ScanStatusRow, printingFinishedChannel chan<- bool) {
@@ -243,23 +913,61 @@ func PrintScanStatusTable(scanStatusRowChan <-chan *ScanStatusRow, printingFinis
 	t := table.NewWriter()
 	// t.SetOutputMirror(os.Stdout)
 	// t.SetAutoIndex(true)
-	t.AppendHeader(table.Row{"Image Name", "Image Tag", "BlackDuck URL", "Latest Available Image Tag"})
+	t.AppendHeader(scanStatusTableHeader())
+	t.SortBy([]table.SortBy{{Name: "Staleness", Mode: table.DscNumeric}})
 
 	// process output structs concurrently
 	log.Tracef("waiting for values over channel")
+	statusCounts := map[string]int{}
 	for row := range scanStatusRowChan {
 		log.Tracef("processing table value for image: %s, url: %s", row.ImageName, row.BlackDuckURL)
-		t.AppendRow([]interface{}{
-			fmt.Sprintf("%s", row.ImageName),
-			fmt.Sprintf("%s", row.ImageTag),
-			fmt.Sprintf("%s", row.BlackDuckURL),
-			fmt.Sprintf("%s", row.LatestAvailableImageVersion),
-		})
+		statusCounts[row.Status]++
+		t.AppendRow(scanStatusTableRow(row))
 		log.Tracef("rendering intermediate table")
 		fmt.Printf("\n%s\n\n", t.Render())
 	}
 	// TODO: to be able to render concurrently
 	log.Tracef("finished rendering table")
+	if statusCounts[ScanStatusFailed] > 0 || statusCounts[ScanStatusCancelled] > 0 {
+		log.Warnf("%d scans succeeded, %d failed, %d were cancelled", statusCounts[ScanStatusSucceeded], statusCounts[ScanStatusFailed], statusCounts[ScanStatusCancelled])
+	}
 	printingFinishedChannel <- true
 	close(printingFinishedChannel)
 }
+
+// PrintScanStatusRows prints every row as soon as it arrives, for scans which don't end, i.e.: of `bd-xray watch`
+func PrintScanStatusRows(scanStatusRowChan <-chan *ScanStatusRow, printingFinishedChannel chan<- bool) {
+	statusCounts := map[string]int{}
+	for row := range scanStatusRowChan {
+		statusCounts[row.Status]++
+		t := table.NewWriter()
+		t.AppendHeader(scanStatusTableHeader())
+		t.AppendRow(scanStatusTableRow(row))
+		fmt.Printf("\n%s\n\n", t.Render())
+	}
+	log.Infof("%d scans succeeded, %d failed, %d were cancelled", statusCounts[ScanStatusSucceeded], statusCounts[ScanStatusFailed], statusCounts[ScanStatusCancelled])
+	printingFinishedChannel <- true
+	close(printingFinishedChannel)
+}
+
+func scanStatusTableHeader() table.Row {
+	return table.Row{"Image Name", "Image Tag", "Status", "Tools", "Issues", "BlackDuck URL", "Latest Patch", "Latest Minor", "Latest Major", "Behind (Major/Minor/Patch)", "Age Gap (Days)", "Staleness", "Logs"}
+}
+
+func scanStatusTableRow(row *ScanStatusRow) table.Row {
+	return table.Row{
+		fmt.Sprintf("%s", row.ImageName),
+		fmt.Sprintf("%s", row.ImageTag),
+		fmt.Sprintf("%s", row.Status),
+		row.Tools,
+		row.Issues,
+		fmt.Sprintf("%s", row.BlackDuckURL),
+		versioning.FormatUpgrade(row.Recommendation.LatestPatch, row.Recommendation.PatchStatus),
+		versioning.FormatUpgrade(row.Recommendation.LatestMinor, row.Recommendation.MinorStatus),
+		versioning.FormatUpgrade(row.Recommendation.LatestMajor, row.Recommendation.MajorStatus),
+		fmt.Sprintf("%d/%d/%d", row.Recommendation.MajorsBehind, row.Recommendation.MinorsBehind, row.Recommendation.PatchesBehind),
+		row.Staleness.AgeGapDays(),
+		row.Staleness.Score,
+		row.LogFile,
+	}
+}
@@ -0,0 +1,360 @@
+package bd_xray
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/detect"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/remediation"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/report"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
+)
+
+// testImage isn't a valid reference, because of its upper case repository, so that its latest version isn't looked up
+const testImage = "registry.shop.example/Nginx:1.19"
+
+// testStatusJSON is the status.json of a successful scan uploaded to the Black Duck server SERVER
+const testStatusJSON = `{"formatVersion": "0.4.0", "detectVersion": "6.9.1",
+	"status": [{"key": "DOCKER", "status": "SUCCESS"}, {"key": "SIGNATURE_SCAN", "status": "SUCCESS"}],
+	"overallStatus": [{"exitCode": 0, "exitCodeKey": "SUCCESS"}],
+	"results": [{"location": "SERVER/api/projects/1/versions/1/components"}]}`
+
+// runTestImageScan scans testImage in the namespace shop with the fake detect and returns its row
+func runTestImageScan(t *testing.T, ctx context.Context, fake *fakeDetect, commonFlags *CommonFlags) (*ScanStatusRow, error) {
+	namer, err := NewNamer(naming.SourceNamespace, naming.Context{Namespace: "shop"}, commonFlags)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	row := &ScanStatusRow{}
+	rows := make(chan *ScanStatusRow, 1)
+	err = RunImageScanCommand(ctx, fake.client, registries.ImageRegistries{}, testImage, map[string]interface{}{}, row, rows, namer, commonFlags)
+	return row, err
+}
+
+func TestImageScanWaitsForResults(t *testing.T) {
+	_, server := newFakeBlackDuck(t, nil)
+	defer server.Close()
+	fake, cleanup := newFakeDetect(t, testStatusJSON, server.URL)
+	defer cleanup()
+	commonFlags, cleanupFlags := newTestCommonFlags(t, server.URL)
+	defer cleanupFlags()
+
+	if _, err := runTestImageScan(t, context.Background(), fake, commonFlags); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if strings.Contains(fake.Args(), DetectWaitForResultsFlag) {
+		t.Errorf("Expected no [%s] if nothing reads the results, but got [%s]", DetectWaitForResultsFlag, fake.Args())
+	}
+
+	// serve reads the vulnerabilities of every scan right after it
+	commonFlags.WaitForResults = true
+	row, err := runTestImageScan(t, context.Background(), fake, commonFlags)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if runs := strings.Split(strings.TrimSpace(fake.Args()), "\n"); len(runs) != 2 || !strings.Contains(runs[1], DetectWaitForResultsFlag) {
+		t.Errorf("Expected [%s], but got [%s]", DetectWaitForResultsFlag, fake.Args())
+	}
+	if row.Status != ScanStatusSucceeded || row.BlackDuckURL != server.URL+"/api/projects/1/versions/1/components" {
+		t.Errorf("Expected a succeeded scan uploaded to the Black Duck server, but got [%+v]", row)
+	}
+}
+
+func TestScansDontWaitForResultsByDefault(t *testing.T) {
+	command := SetupImageScanCommand()
+	for _, name := range []string{ReportDirFlagName, SBOMDirFlagName} {
+		if flag := command.Flags().Lookup(name); flag == nil || flag.DefValue != "" {
+			t.Errorf("Expected --%s to be off by default, but got [%+v]", name, flag)
+		}
+	}
+	if WaitsForResults(&CommonFlags{}) {
+		t.Errorf("Expected a plain scan not to wait for its results")
+	}
+}
+
+func TestImageScanWithoutLocation(t *testing.T) {
+	_, server := newFakeBlackDuck(t, nil)
+	defer server.Close()
+	statusJSON := `{"formatVersion": "0.4.0", "status": [{"key": "DOCKER", "status": "SUCCESS"}], "overallStatus": [{"exitCode": 0, "exitCodeKey": "SUCCESS"}]}`
+	fake, cleanup := newFakeDetect(t, statusJSON, server.URL)
+	defer cleanup()
+	commonFlags, cleanupFlags := newTestCommonFlags(t, server.URL)
+	defer cleanupFlags()
+
+	// an online scan without location isn't reported as offline
+	row, err := runTestImageScan(t, context.Background(), fake, commonFlags)
+	if err != nil || row.BlackDuckURL != "" {
+		t.Errorf("Expected a scan without Black Duck URL, but got [%+v %+v]", row, err)
+	}
+
+	// an offline scan reports its BDIO files, of which there are none
+	commonFlags.DetectOfflineMode = "true"
+	if _, err := runTestImageScan(t, context.Background(), fake, commonFlags); err == nil || !strings.Contains(err.Error(), "BDIO") {
+		t.Errorf("Expected an error about the missing BDIO files, but got [%+v]", err)
+	}
+}
+
+func TestImageScanNamesWithFailedDigestLookup(t *testing.T) {
+	namer, err := naming.NewNamer(naming.Templates{Version: "{{.Tag}}-{{.Digest | short}}"}, naming.Context{Source: naming.SourceImages})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	// the digest of testImage can't be looked up, the scan mustn't be named into a version without it
+	if names, err := ImageScanNames(namer, registries.ImageRegistries{}, testImage); err == nil || !strings.Contains(err.Error(), "unable to look up the digest") {
+		t.Errorf("Expected an error about the digest, but got [%+v %+v]", names, err)
+	}
+	// digests of pinned images aren't looked up
+	names, err := ImageScanNames(namer, registries.ImageRegistries{}, "nginx:1.19@sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac")
+	if err != nil || names.Version != "1.19-4c0fdaa8b634" {
+		t.Errorf("Expected [1.19-4c0fdaa8b634], but got [%+v %+v]", names, err)
+	}
+}
+
+func TestStaleImages(t *testing.T) {
+	stale := NewStaleImages()
+	if err := stale.Err(100); err != nil {
+		t.Errorf("Expected no error without stale images, but got [%+v]", err)
+	}
+	stale.Add("redis:5.0", 210)
+	stale.Add("nginx:1.17", 130)
+	expected := "2 images have a staleness score above the threshold of 100: nginx:1.17 (130), redis:5.0 (210)"
+	if err := stale.Err(100); err == nil || err.Error() != expected {
+		t.Errorf("Expected [%s], but got [%v]", expected, err)
+	}
+	if err := stale.Err(100); err != nil {
+		t.Errorf("Expected the stale images to be reset, but got [%+v]", err)
+	}
+}
+
+func TestCollectImageReport(t *testing.T) {
+	_, server := newFakeBlackDuck(t, map[string]string{
+		"GET /api/projects/1/versions/1/vulnerable-bom-components": `{"totalCount": 1, "items": [
+			{"componentName": "OpenSSL", "componentVersionName": "1.1.1g", "vulnerabilityWithRemediation": {"vulnerabilityName": "CVE-2021-3449", "severity": "MEDIUM"}}]}`,
+	})
+	defer server.Close()
+	fake, cleanup := newFakeDetect(t, testStatusJSON, server.URL)
+	defer cleanup()
+	commonFlags, cleanupFlags := newTestCommonFlags(t, server.URL)
+	defer cleanupFlags()
+	commonFlags.ReportDir = filepath.Join(fake.dir, "reports")
+	collector := reportCollector
+	defer func() { reportCollector = collector }()
+
+	reportCollector = report.NewCollector()
+	row, err := runTestImageScan(t, context.Background(), fake, commonFlags)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	images := reportCollector.Report("test", "", time.Now()).Images
+	expected := []report.Vulnerability{{ID: "CVE-2021-3449", Severity: "MEDIUM", Component: "OpenSSL", Version: "1.1.1g"}}
+	if len(images) != 1 || !images[0].VulnerabilitiesKnown || !reflect.DeepEqual(images[0].Vulnerabilities, expected) {
+		t.Errorf("Expected the vulnerabilities [%+v], but got [%+v]", expected, images)
+	}
+
+	// without waiting for the BOM, it may still be empty
+	reportCollector = report.NewCollector()
+	row.BOMComplete = false
+	namer, _ := NewNamer(naming.SourceNamespace, naming.Context{Namespace: "shop"}, commonFlags)
+	CollectImageReport(namer, registries.ImageRegistries{}, testImage, row.BlackDuckURL, row, commonFlags)
+	if images := reportCollector.Report("test", "", time.Now()).Images; len(images) != 1 || images[0].VulnerabilitiesKnown || len(images[0].Vulnerabilities) > 0 {
+		t.Errorf("Expected unknown vulnerabilities, but got [%+v]", images)
+	}
+}
+
+func TestSaveReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bd-xray-reports")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+	collector := reportCollector
+	defer func() { reportCollector = collector }()
+	reportCollector = report.NewCollector()
+	reportCollector.Add(report.Image{Image: "nginx:1.19", Status: ScanStatusSucceeded, VulnerabilitiesKnown: true})
+	commonFlags := &CommonFlags{ReportDir: dir, CompareWith: report.CompareWithLast}
+	scope := report.Scope(naming.SourceNamespace, "shop")
+	store := report.NewStore(dir)
+
+	SaveReport(context.Background(), scope, nil, commonFlags)
+	last, err := store.Last(scope)
+	if err != nil || last == "" {
+		t.Fatalf("Expected a report, but got [%s %+v]", last, err)
+	}
+
+	// the images of a cancelled run may be missing, so they aren't removed since the last run
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	SaveReport(ctx, scope, nil, commonFlags)
+	if partialLast, err := store.Last(scope); err != nil || partialLast != last {
+		t.Errorf("Expected [%s], but got [%s %+v]", last, partialLast, err)
+	}
+	partials, _ := filepath.Glob(filepath.Join(filepath.Dir(last), "*.partial.json"))
+	if len(partials) != 1 {
+		t.Fatalf("Expected a partial report, but got [%v]", partials)
+	}
+	if partial, err := report.Load(partials[0]); err != nil || !partial.Partial {
+		t.Errorf("Expected a partial report, but got [%+v %+v]", partial, err)
+	}
+
+	// runs of the same second don't overwrite each other
+	SaveReport(context.Background(), scope, nil, commonFlags)
+	if newLast, err := store.Last(scope); err != nil || newLast == last || newLast == "" {
+		t.Errorf("Expected a report other than [%s], but got [%s %+v]", last, newLast, err)
+	}
+}
+
+func TestImageScanFailure(t *testing.T) {
+	_, server := newFakeBlackDuck(t, nil)
+	defer server.Close()
+	fake, cleanup := newFakeDetect(t, `{"formatVersion": "0.4.0",
+		"status": [{"key": "DOCKER", "status": "SUCCESS"}, {"key": "SIGNATURE_SCAN", "status": "FAILURE"}],
+		"overallStatus": [{"exitCode": 6, "exitCodeKey": "FAILURE_SCAN"}],
+		"issues": [{"type": "EXCEPTION", "title": "Signature scan failed", "messages": ["no files found"]}]}`, server.URL)
+	defer cleanup()
+	fake.SetExitCode(t, 6)
+	commonFlags, cleanupFlags := newTestCommonFlags(t, server.URL)
+	defer cleanupFlags()
+
+	row, err := runTestImageScan(t, context.Background(), fake, commonFlags)
+	if err == nil || !strings.Contains(err.Error(), "failed tools [SIGNATURE_SCAN] and issues [EXCEPTION: Signature scan failed (no files found)]") {
+		t.Errorf("Expected the failed tools and issues in the error, but got [%v]", err)
+	}
+	unfinishedRow := NewUnfinishedScanStatusRow(context.Background(), testImage, row)
+	if unfinishedRow.Status != ScanStatusFailed || unfinishedRow.Tools != "DOCKER: SUCCESS, SIGNATURE_SCAN: FAILURE" || unfinishedRow.Issues != 1 || unfinishedRow.LogFile == "" {
+		t.Errorf("Expected the tools and issues of the failed scan, but got [%+v]", unfinishedRow)
+	}
+}
+
+func TestImageScanRetriesTransientFailures(t *testing.T) {
+	_, server := newFakeBlackDuck(t, nil)
+	defer server.Close()
+	fake, cleanup := newFakeDetect(t, `{"formatVersion": "0.4.0", "overallStatus": [{"exitCode": 1, "exitCodeKey": "FAILURE_BLACKDUCK_CONNECTIVITY"}]}`, server.URL)
+	defer cleanup()
+	fake.SetExitCode(t, detect.ExitCodeFailureBlackDuckConnectivity)
+	commonFlags, cleanupFlags := newTestCommonFlags(t, server.URL)
+	defer cleanupFlags()
+	commonFlags.ScanRetries = 2
+	commonFlags.ScanRetryBackoff = 10 * time.Millisecond
+
+	start := time.Now()
+	if _, err := runTestImageScan(t, context.Background(), fake, commonFlags); err == nil {
+		t.Errorf("Expected the scan to fail after its retries")
+	}
+	if runs := strings.Split(strings.TrimSpace(fake.Args()), "\n"); len(runs) != 3 {
+		t.Errorf("Expected [3] runs, but got [%d]", len(runs))
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the retries to wait --%s, but they took [%s]", ScanRetryBackoffFlagName, elapsed)
+	}
+}
+
+func TestWriteScanResult(t *testing.T) {
+	_, server := newFakeBlackDuck(t, map[string]string{
+		"GET /api/projects/1/versions/1/risk-profile": `{"categories": {"VULNERABILITY": {"CRITICAL": 1, "HIGH": 2, "MEDIUM": 0, "LOW": 0}}}`,
+	})
+	defer server.Close()
+	reportPath := "/apis/bd-xray.blackducksoftware.com/v1alpha1/namespaces/shop/imagescanreports/" + kube.ReportName(testImage, "")
+	kubeServer, cli, cleanupKube := newFakeKubeClient(t, map[string]string{
+		"GET " + reportPath: `{"apiVersion": "bd-xray.blackducksoftware.com/v1alpha1", "kind": "ImageScanReport", "metadata": {"name": "report", "namespace": "shop", "resourceVersion": "42"}}`,
+	})
+	defer cleanupKube()
+	// the BOM of a scan violating a policy is complete, it only fails the build
+	fake, cleanup := newFakeDetect(t, `{"formatVersion": "0.4.0",
+		"status": [{"key": "DOCKER", "status": "SUCCESS"}, {"key": "SIGNATURE_SCAN", "status": "SUCCESS"}],
+		"overallStatus": [{"exitCode": 3, "exitCodeKey": "FAILURE_POLICY_VIOLATION"}],
+		"results": [{"location": "SERVER/api/projects/1/versions/1/components"}]}`, server.URL)
+	defer cleanup()
+	fake.SetExitCode(t, 3)
+	commonFlags, cleanupFlags := newTestCommonFlags(t, server.URL)
+	defer cleanupFlags()
+	commonFlags.WriteResults = []string{kube.WriteResultsReports}
+	writer := resultWriter
+	defer func() { resultWriter = writer }()
+	if err := SetupResultWriter(cli, commonFlags); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if _, err := runTestImageScan(t, context.Background(), fake, commonFlags); err == nil {
+		t.Fatalf("Expected the policy violation to fail the scan")
+	}
+	status := statusOfLastReport(t, kubeServer, reportPath)
+	if status["status"] != ScanStatusFailed || status["exitStatus"] != detect.ExitCodeKeyFailurePolicyViolation ||
+		!reflect.DeepEqual(status["vulnerabilities"], map[string]interface{}{"critical": 1.0, "high": 2.0, "medium": 0.0, "low": 0.0}) {
+		t.Errorf("Expected the failed status and vulnerabilities of the policy violation, but got [%+v]", status)
+	}
+
+	// other failures are written without vulnerabilities, their BOM may be incomplete
+	ioutil.WriteFile(filepath.Join(fake.dir, "status.json"), []byte(`{"formatVersion": "0.4.0",
+		"overallStatus": [{"exitCode": 6, "exitCodeKey": "FAILURE_SCAN"}]}`), 0644)
+	fake.SetExitCode(t, 6)
+	if _, err := runTestImageScan(t, context.Background(), fake, commonFlags); err == nil {
+		t.Fatalf("Expected the scan to fail")
+	}
+	status = statusOfLastReport(t, kubeServer, reportPath)
+	if status["status"] != ScanStatusFailed || status["exitStatus"] != "FAILURE_SCAN" || status["vulnerabilities"] != nil {
+		t.Errorf("Expected the failed status without vulnerabilities, but got [%+v]", status)
+	}
+
+	fake.SetExitCode(t, 0)
+	ioutil.WriteFile(filepath.Join(fake.dir, "status.json"), []byte(strings.Replace(testStatusJSON, "SERVER", server.URL, -1)), 0644)
+	if _, err := runTestImageScan(t, context.Background(), fake, commonFlags); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	status = statusOfLastReport(t, kubeServer, reportPath)
+	if status["status"] != ScanStatusSucceeded || status["exitStatus"] != "SUCCESS" || status["vulnerabilities"] == nil {
+		t.Errorf("Expected the succeeded status and vulnerabilities, but got [%+v]", status)
+	}
+}
+
+// statusOfLastReport is the status of the last update of the status of the ImageScanReport at reportPath
+func statusOfLastReport(t *testing.T, kubeServer *fakeServer, reportPath string) map[string]interface{} {
+	requests := kubeServer.Requests()
+	for i := len(requests) - 1; i >= 0; i-- {
+		prefix := "PUT " + reportPath + "/status "
+		if !strings.HasPrefix(requests[i], prefix) {
+			continue
+		}
+		var object struct {
+			Status map[string]interface{} `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(requests[i], prefix)), &object); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		return object.Status
+	}
+	t.Fatalf("Expected an update of the status of [%s], but got [%v]", reportPath, requests)
+	return nil
+}
+
+func TestLookUpLatestVersionLimit(t *testing.T) {
+	lookups := latestVersionLookups
+	defer func() { latestVersionLookups = lookups }()
+
+	// the only lookup slot is taken by another scan, so the lookup waits until the scan is cancelled
+	latestVersionLookups = make(chan struct{}, 1)
+	latestVersionLookups <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	image := remediation.Image{URL: "registry.shop.example", Name: "nginx", Version: "1.19"}
+	start := time.Now()
+	info := LookUpLatestVersion(ctx, image, registries.ImageRegistries{})
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the lookup to wait for a free slot, but it took [%s]", elapsed)
+	}
+	if info.LatestVersion != versioning.Notfound || info.Recommendation.Current != "1.19" {
+		t.Errorf("Expected the latest version not to be found, but got [%+v]", info)
+	}
+	if len(latestVersionLookups) != 1 {
+		t.Errorf("Expected the slot of the other scan to stay taken, but got [%d]", len(latestVersionLookups))
+	}
+}
@@ -2,10 +2,17 @@ package bd_xray
 
 import (
 	"context"
+	"strings"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/report"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/sbom"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
 )
 
@@ -18,8 +25,6 @@ func SetupNamespaceScanCommand() *cobra.Command {
 		BlackDuckTokenFlagName:    &commonFlags.BlackDuckToken,
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
 	command := &cobra.Command{
 		Use:   "namespace NAMESPACE_NAME",
 		Short: "scan all images in a namespace",
@@ -28,6 +33,8 @@ func SetupNamespaceScanCommand() *cobra.Command {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := utils.NewSignalContext()
+			defer cancel()
 			utils.DoOrDie(RunNamespaceScanCommand(args[0], ctx, cancel, commonFlags, detectPassThroughFlagsMap))
 		},
 	}
@@ -38,6 +45,10 @@ func SetupNamespaceScanCommand() *cobra.Command {
 	command.Flags().StringVar(&commonFlags.DetectProjectName, DetectProjectNameFlagName, "", "An override for the name to use for the Black Duck project. If not supplied, a project will be created with namespace name and image name and tag will be passed as version.")
 	command.Flags().BoolVarP(&commonFlags.CleanupPersistentDockerInspectorServices, CleanupPersistentDockerInspectorServicesName, "c", true, "Clean up the docker inspector services")
 
+	AddCommonScanFlags(command, commonFlags)
+	AddWriteResultsFlag(command, commonFlags)
+	AddReportFlags(command, commonFlags)
+
 	return command
 }
 
@@ -49,18 +60,86 @@ func RunNamespaceScanCommand(namespace string, ctx context.Context, cancellation
 	if err != nil {
 		return err
 	}
-	imageList, err = cli.GetImagesFromNamespace(context.Background(), namespace)
+	if err = SetupResultWriter(cli, commonFlags); err != nil {
+		return err
+	}
+	imageList, err = cli.GetImagesFromNamespace(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	namer, err := NewNamer(naming.SourceNamespace, naming.Context{Namespace: namespace}, commonFlags)
+	if err != nil {
+		return err
+	}
+
+	imageRegistries, err := registries.LoadImageRegistries(commonFlags.RegistryConfigPath)
+	if err != nil {
+		return err
+	}
+	AddImagePullSecretCredentials(ctx, cli, namespace, &imageRegistries)
+
+	if commonFlags.SBOMDir != "" {
+		sbomCollector = sbom.NewCollector()
+		defer func() { sbomCollector = nil }()
+	}
+	if commonFlags.SBOMDir != "" || namer.UsesWorkload() || resultWriter != nil || commonFlags.ReportDir != "" {
+		workloadsByImage, err := cli.GetWorkloadsByImage(ctx, namespace)
+		if err != nil {
+			return err
+		}
+		if sbomCollector != nil {
+			sbomCollector.SetWorkloads(workloadsByImage)
+		}
+		namer.SetWorkloads(workloadsByImage)
+	}
+
+	err = RunAndPrintMultipleImageScansConcurrentlyWithRegistries(ctx, cancellationFunc, imageRegistries, imageList, detectPassThroughFlagsMap, namer, commonFlags)
+	SaveReport(ctx, report.Scope(naming.SourceNamespace, namespace), err, commonFlags)
+
+	// export what was scanned, even if some scans failed
+	if commonFlags.SBOMDir != "" {
+		ExportNamespaceSBOM(namespace, sbomCollector.Inventories(), commonFlags)
+	}
 	if err != nil {
 		return err
 	}
+	return staleImages.Err(commonFlags.StalenessThreshold)
+}
 
-	var projectName string
-	var userSuppliedProjectName = commonFlags.DetectProjectName
-	if 0 == len(userSuppliedProjectName) {
-		projectName = namespace
-	} else {
-		projectName = userSuppliedProjectName
+// ExportNamespaceSBOM exports the aggregated SBOMs of the inventories of the images scanned in a namespace
+func ExportNamespaceSBOM(namespace string, inventories []*sbom.ImageInventory, commonFlags *CommonFlags) {
+	if len(inventories) == 0 {
+		return
+	}
+	paths, err := sbom.NewGenerator(GetCurrent()).WriteNamespace(commonFlags.SBOMDir, commonFlags.SBOMFormats, namespace, inventories)
+	if err != nil {
+		log.Errorf("unable to export SBOM of namespace '%s': %+v", namespace, err)
+		return
 	}
+	log.Infof("exported SBOM of namespace '%s' with %d images to %s", namespace, len(inventories), strings.Join(paths, ", "))
+}
 
-	return RunAndPrintMultipleImageScansConcurrently(ctx, cancellationFunc, imageList, detectPassThroughFlagsMap, projectName, commonFlags.CleanupPersistentDockerInspectorServices)
+// AddImagePullSecretCredentials adds the registry credentials from the imagePullSecrets used in the namespace,
+// so images from private registries can be pulled and looked up without extra configuration
+func AddImagePullSecretCredentials(ctx context.Context, cli *kube.Client, namespace string, imageRegistries *registries.ImageRegistries) {
+	secrets, err := cli.GetImagePullSecretsFromNamespace(ctx, namespace)
+	if err != nil {
+		log.Warnf("unable to get imagePullSecrets, continuing without their credentials: %+v", err)
+		return
+	}
+	for _, secret := range secrets {
+		var dockerConfig *registries.DockerConfig
+		if secret.Type == corev1.SecretTypeDockerConfigJson {
+			dockerConfig, err = registries.ParseDockerConfigJSON(secret.Data[corev1.DockerConfigJsonKey])
+		} else {
+			dockerConfig, err = registries.ParseDockercfg(secret.Data[corev1.DockerConfigKey])
+		}
+		if err != nil {
+			log.Warnf("skipping imagePullSecret '%s': %+v", secret.Name, err)
+			continue
+		}
+		log.Debugf("using registry credentials from imagePullSecret '%s'", secret.Name)
+		imageRegistries.AddDockerConfig(dockerConfig)
+	}
 }
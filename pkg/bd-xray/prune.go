@@ -0,0 +1,203 @@
+package bd_xray
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+type PruneFlags struct {
+	Tags          []string
+	Labels        map[string]string
+	Action        string
+	KeepNewerThan time.Duration
+	DryRun        bool
+}
+
+func SetupPruneCommand() *cobra.Command {
+	commonFlags := &CommonFlags{}
+	pruneFlags := &PruneFlags{}
+
+	command := &cobra.Command{
+		Use:   "prune [NAMESPACE...]",
+		Short: "archive or delete Black Duck project versions of images no longer running in the cluster",
+		Long:  "archive or delete the versions of the Black Duck projects with all of the given tags, which don't correspond to an image running in the namespaces (all namespaces if none are given); the project versions of the running images are named the same way as by `bd-xray namespace`, and only the projects of the given namespaces are pruned",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := utils.NewSignalContext()
+			defer cancel()
+			utils.DoOrDie(RunPruneCommand(ctx, args, commonFlags, pruneFlags))
+		},
+	}
+
+	command.Flags().StringVar(&commonFlags.BlackDuckURL, BlackDuckURLFlagName, "", "Black Duck Server URL")
+	command.Flags().StringVar(&commonFlags.BlackDuckToken, BlackDuckTokenFlagName, "", "Black Duck API Token")
+	command.Flags().StringVar(&commonFlags.DetectProjectName, DetectProjectNameFlagName, "", "The --detect.project.name the namespaces were scanned with, if any")
+	command.Flags().StringVar(&commonFlags.RegistryConfigPath, RegistryConfigFlagName, registries.DefaultRegistryConfigPath, "Path to the registry config file, used to look up digests if a naming template uses them")
+	AddNamingFlags(command, commonFlags)
+	command.Flags().StringSliceVar(&commonFlags.NamingTemplates.Tags, ProjectTagFlagName, nil, "The --project-tag templates the namespaces were scanned with; the ones using {{.Namespace}}, i.e.: 'namespace:{{.Namespace}}', tell the projects of the namespaces apart if the project template depends on the image")
+	command.Flags().StringSliceVar(&pruneFlags.Tags, "tag", nil, "Only prune projects with all of these tags, i.e.: the literal tags the namespaces were scanned with")
+	command.Flags().StringToStringVar(&pruneFlags.Labels, "label", nil, "Only prune projects with all of these labels, i.e.: cluster=prod for the tag cluster:prod")
+	command.Flags().StringVar(&pruneFlags.Action, "action", blackduck.PruneActionArchive, fmt.Sprintf("What to do with stale project versions, %s or %s", blackduck.PruneActionArchive, blackduck.PruneActionDelete))
+	command.Flags().DurationVar(&pruneFlags.KeepNewerThan, "keep-newer-than", 24*time.Hour, "Keep project versions created more recently, i.e.: by scans which are still running")
+	command.Flags().BoolVar(&pruneFlags.DryRun, "dry-run", false, "Only print which project versions would be pruned")
+	command.MarkFlagRequired(BlackDuckURLFlagName)
+	command.MarkFlagRequired(BlackDuckTokenFlagName)
+
+	return command
+}
+
+func RunPruneCommand(ctx context.Context, namespaces []string, commonFlags *CommonFlags, pruneFlags *PruneFlags) error {
+	if err := blackduck.ValidatePruneAction(pruneFlags.Action); err != nil {
+		return err
+	}
+	if len(pruneFlags.Tags) == 0 && len(pruneFlags.Labels) == 0 {
+		return errors.Errorf("at least one --tag or --label is needed to select the projects to prune")
+	}
+
+	cli, err := kube.NewDefaultClient()
+	if err != nil {
+		return err
+	}
+	return RunPruneCommandWithClient(ctx, cli, namespaces, commonFlags, pruneFlags, os.Stdout)
+}
+
+// RunPruneCommandWithClient finds and prunes the stale project versions of the namespaces of a cluster
+func RunPruneCommandWithClient(ctx context.Context, cli *kube.Client, namespaces []string, commonFlags *CommonFlags, pruneFlags *PruneFlags, out io.Writer) error {
+	tags := append(append([]string{}, pruneFlags.Tags...), LabelTags(pruneFlags.Labels)...)
+	projects, scopeTags, err := NamespaceProjectScope(namespaces, commonFlags)
+	if err != nil {
+		return err
+	}
+	imageRegistries, err := registries.LoadImageRegistries(commonFlags.RegistryConfigPath)
+	if err != nil {
+		return err
+	}
+	live, err := FindLiveProjectVersions(ctx, cli, imageRegistries, namespaces, commonFlags)
+	if err != nil {
+		return err
+	}
+
+	client := blackduck.NewClient(commonFlags.BlackDuckURL, commonFlags.BlackDuckToken)
+	staleVersions, err := client.FindStaleVersions(blackduck.PrunePolicy{
+		Tags:          tags,
+		Projects:      projects,
+		ScopeTags:     scopeTags,
+		Live:          live,
+		KeepNewerThan: pruneFlags.KeepNewerThan,
+		Action:        pruneFlags.Action,
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(staleVersions) == 0 {
+		log.Infof("no stale project versions found")
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Project", "Version", "Phase", "Created", "Action"})
+	var failed int
+	for _, staleVersion := range staleVersions {
+		action := pruneFlags.Action
+		if pruneFlags.DryRun {
+			action = "would " + action
+		} else if err := client.Prune(staleVersion, pruneFlags.Action); err != nil {
+			log.Errorf("%+v", err)
+			action = "FAILED to " + action
+			failed++
+		}
+		t.AppendRow([]interface{}{staleVersion.Project.Name, staleVersion.Version.VersionName, staleVersion.Version.Phase, staleVersion.Version.CreatedAt.Format(time.RFC3339), action})
+	}
+	fmt.Fprintf(out, "\n%s\n\n", t.Render())
+	if failed > 0 {
+		return errors.Errorf("unable to %s %d of %d project versions", pruneFlags.Action, failed, len(staleVersions))
+	}
+	return nil
+}
+
+// NamespaceProjectScope limits the projects to prune to the ones of the given namespaces, since the versions of other
+// namespaces sharing the tags aren't live: by the project names, if the project template only depends on the
+// namespace, otherwise by the --project-tag templates using the namespace; all namespaces need no limit
+func NamespaceProjectScope(namespaces []string, commonFlags *CommonFlags) (projects []string, scopeTags []string, err error) {
+	for _, namespace := range namespaces {
+		namer, err := NewNamer(naming.SourceNamespace, naming.Context{Namespace: namespace}, commonFlags)
+		if err != nil {
+			return nil, nil, err
+		}
+		project, ok, err := namer.BaseProject()
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			projects = append(projects, project)
+			continue
+		}
+		namespaceTags, err := namer.NamespaceTags()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(namespaceTags) == 0 {
+			return nil, nil, errors.Errorf("the project template '%s' depends on the image, so the projects of namespace '%s' can't be told apart from the ones of other namespaces: pass the --%s the namespaces were scanned with, i.e.: 'namespace:{{.Namespace}}', or prune all namespaces", commonFlags.NamingTemplates.Project, namespace, ProjectTagFlagName)
+		}
+		scopeTags = append(scopeTags, namespaceTags...)
+	}
+	return projects, scopeTags, nil
+}
+
+// FindLiveProjectVersions names the images running in the namespaces like `bd-xray namespace` does, and returns their
+// version names by project name; naming errors abort, since they would make live versions look stale
+func FindLiveProjectVersions(ctx context.Context, cli *kube.Client, imageRegistries registries.ImageRegistries, namespaces []string, commonFlags *CommonFlags) (map[string]map[string]bool, error) {
+	if len(namespaces) == 0 {
+		namespaceList, err := cli.ListNamespaces(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaceList.Items {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+
+	live := map[string]map[string]bool{}
+	for _, namespace := range namespaces {
+		namer, err := NewNamer(naming.SourceNamespace, naming.Context{Namespace: namespace}, commonFlags)
+		if err != nil {
+			return nil, err
+		}
+		if namer.UsesWorkload() {
+			workloadsByImage, err := cli.GetWorkloadsByImage(ctx, namespace)
+			if err != nil {
+				return nil, err
+			}
+			namer.SetWorkloads(workloadsByImage)
+		}
+		images, err := cli.GetImagesFromNamespace(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			names, err := ImageScanNames(namer, imageRegistries, image)
+			if err != nil {
+				return nil, err
+			}
+			if live[names.Project] == nil {
+				live[names.Project] = map[string]bool{}
+			}
+			live[names.Project][names.Version] = true
+			log.Debugf("live: '%s' '%s' for '%s' in '%s'", names.Project, names.Version, image, namespace)
+		}
+	}
+	return live, nil
+}
@@ -0,0 +1,95 @@
+package bd_xray
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+)
+
+// runTestPrune prunes with dry-run in a cluster with the namespaces shop and blog, which were both scanned with the
+// label cluster=prod, and where nginx:1.19 and wordpress:5.7 are running; returns what would be pruned
+func runTestPrune(t *testing.T, namespaces []string, templates func(commonFlags *CommonFlags)) (string, error) {
+	_, cli, closeKube := newFakeKubeClient(t, map[string]string{
+		"GET /api/v1/namespaces":           `{"items": [{"metadata": {"name": "shop"}}, {"metadata": {"name": "blog"}}]}`,
+		"GET /api/v1/namespaces/shop/pods": `{"items": [{"metadata": {"name": "nginx-1"}, "spec": {"containers": [{"name": "nginx", "image": "nginx:1.19"}]}}]}`,
+		"GET /api/v1/namespaces/blog/pods": `{"items": [{"metadata": {"name": "wordpress-1"}, "spec": {"containers": [{"name": "wordpress", "image": "wordpress:5.7"}]}}]}`,
+	})
+	defer closeKube()
+	blackDuck, server := newFakeBlackDuck(t, map[string]string{
+		"GET /api/projects":        `{"totalCount": 2, "items": [{"name": "shop", "_meta": {"href": "SERVER/api/projects/1"}}, {"name": "blog", "_meta": {"href": "SERVER/api/projects/2"}}]}`,
+		"GET /api/projects/1/tags": `{"totalCount": 2, "items": [{"name": "cluster:prod"}, {"name": "namespace:shop"}]}`,
+		"GET /api/projects/2/tags": `{"totalCount": 2, "items": [{"name": "cluster:prod"}, {"name": "namespace:blog"}]}`,
+		"GET /api/projects/1/versions": `{"totalCount": 2, "items": [
+			{"versionName": "nginx_1_19", "phase": "DEVELOPMENT", "createdAt": "2021-03-01T00:00:00.000Z", "_meta": {"href": "SERVER/api/projects/1/versions/1"}},
+			{"versionName": "nginx_1_18", "phase": "DEVELOPMENT", "createdAt": "2021-02-01T00:00:00.000Z", "_meta": {"href": "SERVER/api/projects/1/versions/2"}}]}`,
+		"GET /api/projects/2/versions": `{"totalCount": 2, "items": [
+			{"versionName": "wordpress_5_7", "phase": "DEVELOPMENT", "createdAt": "2021-03-01T00:00:00.000Z", "_meta": {"href": "SERVER/api/projects/2/versions/1"}},
+			{"versionName": "wordpress_5_6", "phase": "DEVELOPMENT", "createdAt": "2021-02-01T00:00:00.000Z", "_meta": {"href": "SERVER/api/projects/2/versions/2"}}]}`,
+	})
+	defer server.Close()
+	commonFlags, cleanup := newTestCommonFlags(t, server.URL)
+	defer cleanup()
+	if templates != nil {
+		templates(commonFlags)
+	}
+
+	var out bytes.Buffer
+	err := RunPruneCommandWithClient(context.Background(), cli, namespaces, commonFlags, &PruneFlags{
+		Labels:        map[string]string{"cluster": "prod"},
+		Action:        blackduck.PruneActionArchive,
+		KeepNewerThan: time.Hour,
+		DryRun:        true,
+	}, &out)
+	if requests := blackDuck.Requests(); len(requests) > 0 {
+		t.Errorf("Expected nothing to be changed by a dry run, but got [%v]", requests)
+	}
+	return prunedVersions(out.String()), err
+}
+
+// prunedVersions picks PROJECT/VERSION of the rows of the prune table
+func prunedVersions(table string) string {
+	var versions []string
+	for _, line := range strings.Split(table, "\n") {
+		fields := strings.Fields(strings.Replace(line, "|", " ", -1))
+		if len(fields) > 2 && strings.HasPrefix(line, "|") && fields[0] != "PROJECT" {
+			versions = append(versions, fields[0]+"/"+fields[1])
+		}
+	}
+	return strings.Join(versions, ",")
+}
+
+func TestPruneNamespace(t *testing.T) {
+	// blog has the same label, but its versions aren't stale just because only shop was looked at
+	pruned, err := runTestPrune(t, []string{"shop"}, nil)
+	if err != nil || pruned != "shop/nginx_1_18" {
+		t.Errorf("Expected [shop/nginx_1_18], but got [%s %+v]", pruned, err)
+	}
+
+	pruned, err = runTestPrune(t, nil, nil)
+	if err != nil || pruned != "shop/nginx_1_18,blog/wordpress_5_6" {
+		t.Errorf("Expected [shop/nginx_1_18,blog/wordpress_5_6], but got [%s %+v]", pruned, err)
+	}
+}
+
+func TestPruneNamespaceWithImageProjects(t *testing.T) {
+	perImage := func(commonFlags *CommonFlags) {
+		commonFlags.NamingTemplates.Project = "{{.Namespace}}-{{.Name}}"
+	}
+	if pruned, err := runTestPrune(t, []string{"shop"}, perImage); err == nil {
+		t.Errorf("Expected an error without a namespace tag, but got [%s]", pruned)
+	}
+
+	// shop-nginx and blog-wordpress aren't the project names of the test server, so nothing is live
+	withNamespaceTag := func(commonFlags *CommonFlags) {
+		perImage(commonFlags)
+		commonFlags.NamingTemplates.Tags = []string{"namespace:{{.Namespace}}"}
+	}
+	pruned, err := runTestPrune(t, []string{"shop"}, withNamespaceTag)
+	if err != nil || pruned != "shop/nginx_1_19,shop/nginx_1_18" {
+		t.Errorf("Expected [shop/nginx_1_19,shop/nginx_1_18], but got [%s %+v]", pruned, err)
+	}
+}
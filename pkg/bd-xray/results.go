@@ -0,0 +1,126 @@
+package bd_xray
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/results"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+type LogsFlags struct {
+	List bool
+}
+
+type GCFlags struct {
+	MaxAge  time.Duration
+	MaxSize string
+	DryRun  bool
+}
+
+func SetupLogsCommand() *cobra.Command {
+	logsFlags := &LogsFlags{}
+
+	command := &cobra.Command{
+		Use:   "logs IMAGE|RUN_ID",
+		Short: "show the detect logs of a scan",
+		Long:  "show the detect logs of the latest scan of an image, or of a specific run; an image without a tag matches all its tags",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.DoOrDie(RunLogsCommand(resultsIndex, args[0], logsFlags, os.Stdout))
+		},
+	}
+
+	command.Flags().BoolVar(&logsFlags.List, "list", false, "List all runs of the image instead of showing the logs of the latest one")
+
+	return command
+}
+
+func RunLogsCommand(index *results.Index, runIDOrImage string, logsFlags *LogsFlags, out io.Writer) error {
+	entries, err := index.Find(runIDOrImage)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.Errorf("no scans of '%s' found in %s", runIDOrImage, index.Path)
+	}
+
+	if logsFlags.List {
+		t := table.NewWriter()
+		t.AppendHeader(table.Row{"Run ID", "Image", "Started", "Duration", "Exit Code", "Error", "Logs"})
+		for _, entry := range entries {
+			t.AppendRow([]interface{}{entry.RunID, entry.Image, entry.StartedAt.Format(time.RFC3339), entry.Duration.Round(time.Second), entry.ExitCode, entry.Error, entry.LogFile})
+		}
+		_, err := fmt.Fprintf(out, "%s\n", t.Render())
+		return err
+	}
+
+	entry := entries[0]
+	log.Infof("run %s of '%s' started at %s, exit code %d", entry.RunID, entry.Image, entry.StartedAt.Format(time.RFC3339), entry.ExitCode)
+	logFile, err := os.Open(entry.LogFile)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open logs of run %s, 'bd-xray gc' may have removed them", entry.RunID)
+	}
+	defer logFile.Close()
+	_, err = io.Copy(out, logFile)
+	return errors.Wrapf(err, "unable to read logs of run %s", entry.RunID)
+}
+
+func SetupGCCommand() *cobra.Command {
+	gcFlags := &GCFlags{}
+
+	command := &cobra.Command{
+		Use:   "gc",
+		Short: "remove the output directories of old scans",
+		Long:  "remove the output directories of scans started longer than --max-age ago, and of the oldest scans until the remaining ones take up at most --max-size",
+		Args:  cobra.MaximumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.DoOrDie(RunGCCommand(resultsIndex, results.DefaultResultsDirectory, gcFlags))
+		},
+	}
+
+	command.Flags().DurationVar(&gcFlags.MaxAge, "max-age", 30*24*time.Hour, "Remove scans started longer ago; 0 disables the limit")
+	command.Flags().StringVar(&gcFlags.MaxSize, "max-size", "", "Remove the oldest scans until the remaining ones take up at most this size, i.e.: 500Mi or 10Gi; empty disables the limit")
+	command.Flags().BoolVar(&gcFlags.DryRun, "dry-run", false, "Only print which scans would be removed")
+
+	return command
+}
+
+func RunGCCommand(index *results.Index, directory string, gcFlags *GCFlags) error {
+	policy := results.GCPolicy{MaxAge: gcFlags.MaxAge}
+	if gcFlags.MaxSize != "" {
+		maxSize, err := resource.ParseQuantity(gcFlags.MaxSize)
+		if err != nil {
+			return errors.Wrapf(err, "unable to parse --max-size '%s'", gcFlags.MaxSize)
+		}
+		policy.MaxSize = maxSize.Value()
+	}
+
+	removed, err := results.GC(index, directory, policy, gcFlags.DryRun)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, run := range removed {
+		size += run.Size
+		if gcFlags.DryRun {
+			log.Infof("would remove %s (%s, started %s)", run.OutputDir, resource.NewQuantity(run.Size, resource.BinarySI), run.StartedAt.Format(time.RFC3339))
+		} else {
+			log.Debugf("removed %s", run.OutputDir)
+		}
+	}
+	if gcFlags.DryRun {
+		log.Infof("would remove %d scans, freeing %s", len(removed), resource.NewQuantity(size, resource.BinarySI))
+	} else {
+		log.Infof("removed %d scans, freed %s", len(removed), resource.NewQuantity(size, resource.BinarySI))
+	}
+	return nil
+}
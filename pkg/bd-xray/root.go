@@ -44,6 +44,16 @@ func SetupRootCommand() *cobra.Command {
 	rootCmd.AddCommand(SetupNamespaceScanCommand())
 	rootCmd.AddCommand(SetupYamlScanCommand())
 	rootCmd.AddCommand(SetupHelmScanCommand())
+	rootCmd.AddCommand(SetupDetectCommand())
+	rootCmd.AddCommand(SetupLogsCommand())
+	rootCmd.AddCommand(SetupGCCommand())
+	rootCmd.AddCommand(SetupUploadCommand())
+	rootCmd.AddCommand(SetupPruneCommand())
+	rootCmd.AddCommand(SetupWatchCommand())
+	rootCmd.AddCommand(SetupServeCommand())
+	rootCmd.AddCommand(SetupWebhookCommand())
+	rootCmd.AddCommand(SetupCRDCommand())
+	rootCmd.AddCommand(SetupDiffCommand())
 	rootCmd.AddCommand(SetupVersionCommand())
 
 	return rootCmd
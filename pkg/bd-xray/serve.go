@@ -0,0 +1,381 @@
+package bd_xray
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/detect"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/metrics"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/remediation"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/sbom"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+const (
+	// MetricsPath is where `bd-xray serve` exposes the metrics
+	MetricsPath = "/metrics"
+)
+
+type ServeFlags struct {
+	MetricsAddress string
+	Namespaces     []string
+	AllNamespaces  bool
+	Interval       time.Duration
+	Workers        int
+}
+
+func SetupServeCommand() *cobra.Command {
+	commonFlags := &CommonFlags{}
+	serveFlags := &ServeFlags{}
+
+	detectPassThroughFlagsMap := map[string]interface{}{
+		DetectOfflineModeFlagName: &commonFlags.DetectOfflineMode,
+		BlackDuckURLFlagName:      &commonFlags.BlackDuckURL,
+		BlackDuckTokenFlagName:    &commonFlags.BlackDuckToken,
+	}
+
+	command := &cobra.Command{
+		Use:   "serve",
+		Short: "periodically scan namespaces and expose the results as Prometheus metrics",
+		Long:  "periodically scan the images of namespaces, like `bd-xray namespace` does, and expose their vulnerability counts, policy violations, versions behind, scan durations, scan failures and cache hits as Prometheus metrics; image digests which were scanned before aren't scanned again, but their Black Duck results are refreshed",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := utils.NewSignalContext()
+			defer cancel()
+			utils.DoOrDie(RunServeCommand(ctx, commonFlags, serveFlags, detectPassThroughFlagsMap))
+		},
+	}
+
+	command.Flags().StringVar(&serveFlags.MetricsAddress, "metrics-addr", ":9090", "Address to expose the metrics on, at "+MetricsPath)
+	command.Flags().StringSliceVarP(&serveFlags.Namespaces, "namespace", "n", nil, "The namespaces to scan")
+	command.Flags().BoolVarP(&serveFlags.AllNamespaces, "all-namespaces", "A", false, "Scan all namespaces")
+	command.Flags().DurationVar(&serveFlags.Interval, "interval", time.Hour, "Wait between the end of a scan cycle and the start of the next one")
+	command.Flags().IntVar(&serveFlags.Workers, "workers", 2, "How many images to scan at the same time")
+	command.Flags().StringVar(&commonFlags.DetectOfflineMode, DetectOfflineModeFlagName, "false", "Enabled Offline Scanning")
+	command.Flags().StringVar(&commonFlags.BlackDuckURL, BlackDuckURLFlagName, "", "Black Duck Server URL")
+	command.Flags().StringVar(&commonFlags.BlackDuckToken, BlackDuckTokenFlagName, "", "Black Duck API Token")
+	command.Flags().StringVar(&commonFlags.DetectProjectName, DetectProjectNameFlagName, "", "An override for the name to use for the Black Duck project. If not supplied, a project will be created with namespace name and image name and tag will be passed as version.")
+	command.Flags().BoolVarP(&commonFlags.CleanupPersistentDockerInspectorServices, CleanupPersistentDockerInspectorServicesName, "c", true, "Clean up the docker inspector services")
+
+	AddCommonScanFlags(command, commonFlags)
+	AddWriteResultsFlag(command, commonFlags)
+
+	return command
+}
+
+func RunServeCommand(ctx context.Context, commonFlags *CommonFlags, serveFlags *ServeFlags, detectPassThroughFlagsMap map[string]interface{}) error {
+	if (len(serveFlags.Namespaces) == 0) == !serveFlags.AllNamespaces {
+		return errors.Errorf("either --namespace or --all-namespaces is needed")
+	}
+	if serveFlags.Workers < 1 {
+		return errors.Errorf("at least one worker is needed, got %d", serveFlags.Workers)
+	}
+	if serveFlags.Interval <= 0 {
+		return errors.Errorf("the interval has to be positive, got %s", serveFlags.Interval)
+	}
+	if commonFlags.SBOMDir != "" {
+		if err := sbom.ValidateFormats(commonFlags.SBOMFormats); err != nil {
+			return err
+		}
+	}
+	// the vulnerabilities and policy status of new scans are read right after them
+	commonFlags.WaitForResults = true
+	// fail on invalid templates before setting anything up
+	if _, err := NewNamer(naming.SourceNamespace, naming.Context{}, commonFlags); err != nil {
+		return err
+	}
+
+	cli, err := kube.NewDefaultClient()
+	if err != nil {
+		return err
+	}
+	if err = SetupResultWriter(cli, commonFlags); err != nil {
+		return err
+	}
+	detectClient, err := NewDetectClient(commonFlags)
+	if err != nil {
+		return err
+	}
+	if commonFlags.CleanupPersistentDockerInspectorServices {
+		defer detectClient.StopAndCleanupPersistentDockerInspectorServices()
+	}
+
+	registry := metrics.NewRegistry()
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, metrics.Handler(registry))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	server := &http.Server{Addr: serveFlags.MetricsAddress, Handler: mux}
+	serverCtx, cancelServer := context.WithCancel(ctx)
+	defer cancelServer()
+	serverErrChan := make(chan error, 1)
+	go func() {
+		log.Infof("exposing metrics on %s%s", serveFlags.MetricsAddress, MetricsPath)
+		err := server.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			serverErrChan <- errors.Wrapf(err, "unable to expose metrics on %s", serveFlags.MetricsAddress)
+		}
+		// stop scanning if the metrics can't be exposed
+		cancelServer()
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Warnf("unable to shut down the metrics server: %+v", err)
+		}
+	}()
+
+	scanStatusRowChan := make(chan *ScanStatusRow)
+	doneChan := make(chan bool, 1)
+	go PrintScanStatusRows(scanStatusRowChan, doneChan)
+
+	scanner := &periodicScanner{
+		cli:                       cli,
+		detectClient:              detectClient,
+		commonFlags:               commonFlags,
+		serveFlags:                serveFlags,
+		detectPassThroughFlagsMap: detectPassThroughFlagsMap,
+		scanStatusRowChan:         scanStatusRowChan,
+		metrics:                   metrics.NewScanMetrics(registry),
+		cache:                     map[string]metrics.ImageResult{},
+	}
+	if commonFlags.BlackDuckURL != "" {
+		scanner.blackDuckClient = blackduck.NewClient(commonFlags.BlackDuckURL, commonFlags.BlackDuckToken)
+	}
+	for serverCtx.Err() == nil {
+		scanner.runCycle(serverCtx)
+		select {
+		case <-serverCtx.Done():
+		case <-time.After(serveFlags.Interval):
+		}
+	}
+	close(scanStatusRowChan)
+	BlockOnDoneChan(doneChan)
+
+	select {
+	case err := <-serverErrChan:
+		return err
+	default:
+		return nil
+	}
+}
+
+// periodicScanner scans the images of the namespaces in cycles; the results of image digests scanned successfully,
+// or violating a policy, are cached, so that they're only scanned once while they're running
+type periodicScanner struct {
+	cli                       *kube.Client
+	detectClient              *detect.Client
+	commonFlags               *CommonFlags
+	serveFlags                *ServeFlags
+	detectPassThroughFlagsMap map[string]interface{}
+	scanStatusRowChan         chan *ScanStatusRow
+	metrics                   *metrics.ScanMetrics
+	// blackDuckClient reads the results of the scans, nil without a Black Duck server
+	blackDuckClient *blackduck.Client
+
+	mutex sync.Mutex
+	// cache are the results of the images by namespace, image and digest
+	cache map[string]metrics.ImageResult
+}
+
+// runCycle scans all namespaces and replaces the state of the images by the results; a cancelled cycle leaves the
+// state of the previous one
+func (s *periodicScanner) runCycle(ctx context.Context) {
+	startedAt := time.Now()
+	namespaces := s.serveFlags.Namespaces
+	if s.serveFlags.AllNamespaces {
+		namespaceList, err := s.cli.ListNamespaces(ctx)
+		if err != nil {
+			log.Errorf("unable to list the namespaces to scan: %+v", err)
+			return
+		}
+		namespaces = nil
+		for _, namespace := range namespaceList.Items {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+
+	var results []metrics.ImageResult
+	seen := map[string]bool{}
+	for _, namespace := range namespaces {
+		namespaceResults, keys := s.scanNamespace(ctx, namespace)
+		results = append(results, namespaceResults...)
+		for _, key := range keys {
+			seen[key] = true
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	// forget the digests which aren't running anymore
+	s.mutex.Lock()
+	for key := range s.cache {
+		if !seen[key] {
+			delete(s.cache, key)
+		}
+	}
+	s.mutex.Unlock()
+	s.metrics.SetImages(results, time.Now(), time.Since(startedAt))
+	log.Infof("scan cycle of %d images in %d namespaces completed in %s, next one in %s", len(results), len(namespaces), time.Since(startedAt).Round(time.Second), s.serveFlags.Interval)
+}
+
+// scanNamespace scans the images of a namespace with a pool of workers; returns their results and cache keys
+func (s *periodicScanner) scanNamespace(ctx context.Context, namespace string) ([]metrics.ImageResult, []string) {
+	imageList, err := s.cli.GetImagesFromNamespace(ctx, namespace)
+	if err != nil {
+		log.Errorf("unable to get the images of namespace '%s': %+v", namespace, err)
+		return nil, nil
+	}
+	namer, err := NewNamer(naming.SourceNamespace, naming.Context{Namespace: namespace}, s.commonFlags)
+	if err != nil {
+		log.Errorf("%+v", err)
+		return nil, nil
+	}
+	workloadsByImage, err := s.cli.GetWorkloadsByImage(ctx, namespace)
+	if err != nil {
+		log.Warnf("unable to get the workloads of namespace '%s', labeling the metrics without them: %+v", namespace, err)
+	}
+	namer.SetWorkloads(workloadsByImage)
+	imageRegistries, err := registries.LoadImageRegistries(s.commonFlags.RegistryConfigPath)
+	if err != nil {
+		log.Errorf("%+v", err)
+		return nil, nil
+	}
+	AddImagePullSecretCredentials(ctx, s.cli, namespace, &imageRegistries)
+
+	results := make([]metrics.ImageResult, len(imageList))
+	keys := make([]string, len(imageList))
+	workers := make(chan bool, s.serveFlags.Workers)
+	var waitGroup sync.WaitGroup
+	for i, image := range imageList {
+		i, image := i, image
+		workers <- true
+		waitGroup.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				waitGroup.Done()
+			}()
+			results[i], keys[i] = s.scanImage(ctx, namer, imageRegistries, namespace, image)
+		}()
+	}
+	waitGroup.Wait()
+	return results, keys
+}
+
+// scanImage scans an image unless its digest was scanned successfully before, and refreshes its Black Duck results
+func (s *periodicScanner) scanImage(ctx context.Context, namer *naming.Namer, imageRegistries registries.ImageRegistries, namespace, fullImageName string) (metrics.ImageResult, string) {
+	labels := metrics.ImageLabels{Namespace: namespace, Workloads: namer.Workloads(fullImageName), Image: fullImageName}
+	// images whose digest can't be looked up are scanned every cycle
+	digest := ImageDigest(namer, imageRegistries, fullImageName)
+	key := fmt.Sprintf("%s/%s@%s", namespace, fullImageName, digest)
+
+	s.mutex.Lock()
+	result, cached := s.cache[key]
+	s.mutex.Unlock()
+	s.metrics.ObserveCache(labels, cached)
+	if !cached {
+		var ok bool
+		if result, ok = s.runScan(ctx, namer, imageRegistries, labels); !ok {
+			return result, key
+		}
+		if digest != "" {
+			s.mutex.Lock()
+			s.cache[key] = result
+			s.mutex.Unlock()
+		}
+	}
+	// the workloads may have changed since the digest was scanned
+	result.ImageLabels = labels
+	s.refreshBlackDuckResults(&result)
+	return result, key
+}
+
+// runScan scans an image like `bd-xray namespace` does and prints the result; false if the scan failed, a scan
+// violating a policy didn't: its BOM is complete
+func (s *periodicScanner) runScan(ctx context.Context, namer *naming.Namer, imageRegistries registries.ImageRegistries, labels metrics.ImageLabels) (metrics.ImageResult, bool) {
+	scanStatusRow := &ScanStatusRow{}
+	// RunImageScanCommand sends the row only if the scan completes
+	rowChan := make(chan *ScanStatusRow, 1)
+	startedAt := time.Now()
+	err := RunImageScanCommand(ctx, s.detectClient, imageRegistries, labels.Image, s.detectPassThroughFlagsMap, scanStatusRow, rowChan, namer, s.commonFlags)
+	duration := time.Since(startedAt)
+	if err != nil {
+		log.Errorf("scan of '%s' in '%s' failed: %s", labels.Image, labels.Namespace, detect.DescribeScanError(err))
+		unfinishedScanStatusRow := NewUnfinishedScanStatusRow(ctx, labels.Image, scanStatusRow)
+		s.scanStatusRowChan <- unfinishedScanStatusRow
+		if scanStatusRow.BlackDuckURL != "" {
+			s.metrics.ObserveScan(labels, false)
+			return s.policyViolationResult(ctx, imageRegistries, labels, scanStatusRow.BlackDuckURL, duration), true
+		}
+		s.metrics.ObserveScan(labels, true)
+		return metrics.ImageResult{ImageLabels: labels, Failed: true, ScanDuration: duration}, false
+	}
+	s.scanStatusRowChan <- <-rowChan
+
+	failed := scanStatusRow.Status != ScanStatusSucceeded
+	s.metrics.ObserveScan(labels, failed)
+	return metrics.ImageResult{
+		ImageLabels:    labels,
+		Failed:         failed,
+		BlackDuckURL:   scanStatusRow.BlackDuckURL,
+		MajorsBehind:   scanStatusRow.Recommendation.MajorsBehind,
+		MinorsBehind:   scanStatusRow.Recommendation.MinorsBehind,
+		PatchesBehind:  scanStatusRow.Recommendation.PatchesBehind,
+		StalenessScore: scanStatusRow.Staleness.Score,
+		ScanDuration:   duration,
+	}, !failed
+}
+
+// policyViolationResult is the result of a scan which only failed because it violates a policy, with the latest
+// version of the image looked up like for a successful scan
+func (s *periodicScanner) policyViolationResult(ctx context.Context, imageRegistries registries.ImageRegistries, labels metrics.ImageLabels, blackDuckURL string, duration time.Duration) metrics.ImageResult {
+	result := metrics.ImageResult{ImageLabels: labels, BlackDuckURL: blackDuckURL, ScanDuration: duration}
+	image, err := remediation.NewImage(labels.Image)
+	if err != nil {
+		log.Warnf("unable to look up latest version of '%s': %+v", labels.Image, err)
+		return result
+	}
+	latestInfo := LookUpLatestVersion(ctx, image, imageRegistries)
+	result.MajorsBehind = latestInfo.Recommendation.MajorsBehind
+	result.MinorsBehind = latestInfo.Recommendation.MinorsBehind
+	result.PatchesBehind = latestInfo.Recommendation.PatchesBehind
+	result.StalenessScore = latestInfo.Staleness.Score
+	return result
+}
+
+// refreshBlackDuckResults looks up the vulnerability counts and policy status of the project version of a scan, which
+// change as new vulnerabilities are published; scans in offline mode have none
+func (s *periodicScanner) refreshBlackDuckResults(result *metrics.ImageResult) {
+	if s.blackDuckClient == nil || !strings.HasPrefix(result.BlackDuckURL, "http") {
+		return
+	}
+	counts, err := s.blackDuckClient.GetVulnerabilityCounts(result.BlackDuckURL)
+	if err != nil {
+		log.Warnf("unable to get the vulnerability counts of '%s': %+v", result.Image, err)
+	} else {
+		result.Vulnerabilities = map[string]int{"critical": counts.Critical, "high": counts.High, "medium": counts.Medium, "low": counts.Low}
+	}
+	policyStatus, err := s.blackDuckClient.GetPolicyStatus(blackduck.ProjectVersionURL(result.BlackDuckURL))
+	if err != nil {
+		log.Warnf("unable to get the policy status of '%s': %+v", result.Image, err)
+	} else {
+		result.PolicyKnown = true
+		result.InViolation = policyStatus.OverallStatus == blackduck.PolicyStatusInViolation
+	}
+}
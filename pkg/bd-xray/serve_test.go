@@ -0,0 +1,76 @@
+package bd_xray
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/metrics"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
+)
+
+// testPinnedImage is pinned to a digest, so that its results are cached; its registry refuses connections, so that
+// looking up its latest version fails
+const testPinnedImage = "127.0.0.1:1/nginx@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestScanImageKeepsPolicyViolations(t *testing.T) {
+	_, server := newFakeBlackDuck(t, map[string]string{
+		"GET /api/projects/1/versions/1/risk-profile":  `{"categories": {"VULNERABILITY": {"CRITICAL": 1, "HIGH": 2, "MEDIUM": 0, "LOW": 0}}}`,
+		"GET /api/projects/1/versions/1/policy-status": `{"overallStatus": "IN_VIOLATION"}`,
+	})
+	defer server.Close()
+	fake, cleanup := newFakeDetect(t, `{"formatVersion": "0.4.0",
+		"overallStatus": [{"exitCode": 3, "exitCodeKey": "FAILURE_POLICY_VIOLATION"}],
+		"results": [{"location": "SERVER/api/projects/1/versions/1/components"}]}`, server.URL)
+	defer cleanup()
+	fake.SetExitCode(t, 3)
+	commonFlags, cleanupFlags := newTestCommonFlags(t, server.URL)
+	defer cleanupFlags()
+	commonFlags.WaitForResults = true
+	namer, err := NewNamer(naming.SourceNamespace, naming.Context{Namespace: "shop"}, commonFlags)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	scanner := &periodicScanner{
+		detectClient:              fake.client,
+		commonFlags:               commonFlags,
+		serveFlags:                &ServeFlags{},
+		detectPassThroughFlagsMap: map[string]interface{}{},
+		scanStatusRowChan:         make(chan *ScanStatusRow, 10),
+		metrics:                   metrics.NewScanMetrics(metrics.NewRegistry()),
+		cache:                     map[string]metrics.ImageResult{},
+		blackDuckClient:           blackduck.NewClient(server.URL, commonFlags.BlackDuckToken),
+	}
+
+	// the results of a scan violating a policy are read from Black Duck and cached
+	for i := 0; i < 2; i++ {
+		result, _ := scanner.scanImage(context.Background(), namer, registries.ImageRegistries{}, "shop", testPinnedImage)
+		if result.Failed || !result.PolicyKnown || !result.InViolation || !strings.HasSuffix(result.BlackDuckURL, "/api/projects/1/versions/1/components") ||
+			!reflect.DeepEqual(result.Vulnerabilities, map[string]int{"critical": 1, "high": 2, "medium": 0, "low": 0}) {
+			t.Errorf("Expected the vulnerabilities and policy violation of the scan, but got [%+v]", result)
+		}
+	}
+	if runs := strings.Count(fake.Args(), "\n"); runs != 1 {
+		t.Errorf("Expected the image to be scanned [1] time, but it was scanned [%d] times", runs)
+	}
+
+	// other failures are scanned again in the next cycle
+	ioutil.WriteFile(filepath.Join(fake.dir, "status.json"), []byte(`{"formatVersion": "0.4.0",
+		"overallStatus": [{"exitCode": 6, "exitCodeKey": "FAILURE_SCAN"}]}`), 0644)
+	fake.SetExitCode(t, 6)
+	scanner.cache = map[string]metrics.ImageResult{}
+	for i := 0; i < 2; i++ {
+		result, _ := scanner.scanImage(context.Background(), namer, registries.ImageRegistries{}, "shop", testPinnedImage)
+		if !result.Failed || result.PolicyKnown || result.Vulnerabilities != nil {
+			t.Errorf("Expected the scan to fail without results, but got [%+v]", result)
+		}
+	}
+	if runs := strings.Count(fake.Args(), "\n"); runs != 3 {
+		t.Errorf("Expected the image to be scanned [3] times, but it was scanned [%d] times", runs)
+	}
+}
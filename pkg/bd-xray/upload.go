@@ -0,0 +1,92 @@
+package bd_xray
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/bdio"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/results"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+type UploadFlags struct {
+	BlackDuckURL   string
+	BlackDuckToken string
+}
+
+func SetupUploadCommand() *cobra.Command {
+	uploadFlags := &UploadFlags{}
+
+	command := &cobra.Command{
+		Use:   "upload IMAGE|RUN_ID|PATH...",
+		Short: "upload the BDIO files of scans in offline mode to Black Duck",
+		Long:  "upload the BDIO files of the latest scan of an image, of a specific run, or of a BDIO file or the output dir of a scan, i.e.: of scans in offline mode",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.DoOrDie(RunUploadCommand(resultsIndex, args, uploadFlags))
+		},
+	}
+
+	command.Flags().StringVar(&uploadFlags.BlackDuckURL, BlackDuckURLFlagName, "", "Black Duck Server URL")
+	command.Flags().StringVar(&uploadFlags.BlackDuckToken, BlackDuckTokenFlagName, "", "Black Duck API Token")
+	command.MarkFlagRequired(BlackDuckURLFlagName)
+	command.MarkFlagRequired(BlackDuckTokenFlagName)
+
+	return command
+}
+
+func RunUploadCommand(index *results.Index, args []string, uploadFlags *UploadFlags) error {
+	var paths []string
+	for _, arg := range args {
+		argPaths, err := FindBDIOFilesToUpload(index, arg)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, argPaths...)
+	}
+
+	client := blackduck.NewClient(uploadFlags.BlackDuckURL, uploadFlags.BlackDuckToken)
+	var failed int
+	for _, path := range paths {
+		if err := client.UploadBDIO(path); err != nil {
+			log.Errorf("%+v", err)
+			failed++
+			continue
+		}
+		log.Infof("uploaded %s", path)
+	}
+	if failed > 0 {
+		return errors.Errorf("unable to upload %d of %d BDIO files", failed, len(paths))
+	}
+	return nil
+}
+
+// FindBDIOFilesToUpload finds the BDIO files of a file or the output dir of a scan, otherwise of the latest run of an image or run ID
+func FindBDIOFilesToUpload(index *results.Index, imageRunIDOrPath string) ([]string, error) {
+	outputDir := imageRunIDOrPath
+	if info, err := os.Stat(imageRunIDOrPath); err == nil && !info.IsDir() {
+		return []string{imageRunIDOrPath}, nil
+	} else if err != nil {
+		entries, err := index.Find(imageRunIDOrPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, errors.Errorf("'%s' is neither a path nor a scan found in %s", imageRunIDOrPath, index.Path)
+		}
+		outputDir = entries[0].OutputDir
+	}
+
+	paths, err := bdio.FindBDIOFiles(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("no BDIO files found in %s", outputDir)
+	}
+	return paths, nil
+}
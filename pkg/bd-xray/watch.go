@@ -0,0 +1,197 @@
+package bd_xray
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/remediation"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/sbom"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/watch"
+)
+
+type WatchFlags struct {
+	Namespace     string
+	AllNamespaces bool
+	Workers       int
+	SkipExisting  bool
+}
+
+func SetupWatchCommand() *cobra.Command {
+	commonFlags := &CommonFlags{}
+	watchFlags := &WatchFlags{}
+
+	detectPassThroughFlagsMap := map[string]interface{}{
+		DetectOfflineModeFlagName: &commonFlags.DetectOfflineMode,
+		BlackDuckURLFlagName:      &commonFlags.BlackDuckURL,
+		BlackDuckTokenFlagName:    &commonFlags.BlackDuckToken,
+	}
+
+	command := &cobra.Command{
+		Use:   "watch",
+		Short: "continuously scan the images rolled out in a namespace",
+		Long:  "watch the pods and workloads of a namespace, or all namespaces, and scan every new image digest once as it rolls out; the scans are named like the ones of `bd-xray namespace` and printed as they complete",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := utils.NewSignalContext()
+			defer cancel()
+			utils.DoOrDie(RunWatchCommand(ctx, cancel, commonFlags, watchFlags, detectPassThroughFlagsMap))
+		},
+	}
+
+	command.Flags().StringVarP(&watchFlags.Namespace, "namespace", "n", "", "The namespace to watch")
+	command.Flags().BoolVarP(&watchFlags.AllNamespaces, "all-namespaces", "A", false, "Watch all namespaces")
+	command.Flags().IntVar(&watchFlags.Workers, "workers", 2, "How many images to scan at the same time")
+	command.Flags().BoolVar(&watchFlags.SkipExisting, "skip-existing", false, "Only scan the images rolled out after starting to watch, not the ones already running")
+	command.Flags().StringVar(&commonFlags.DetectOfflineMode, DetectOfflineModeFlagName, "false", "Enabled Offline Scanning")
+	command.Flags().StringVar(&commonFlags.BlackDuckURL, BlackDuckURLFlagName, "", "Black Duck Server URL")
+	command.Flags().StringVar(&commonFlags.BlackDuckToken, BlackDuckTokenFlagName, "", "Black Duck API Token")
+	command.Flags().StringVar(&commonFlags.DetectProjectName, DetectProjectNameFlagName, "", "An override for the name to use for the Black Duck project. If not supplied, a project will be created with namespace name and image name and tag will be passed as version.")
+	command.Flags().BoolVarP(&commonFlags.CleanupPersistentDockerInspectorServices, CleanupPersistentDockerInspectorServicesName, "c", true, "Clean up the docker inspector services")
+
+	AddCommonScanFlags(command, commonFlags)
+	AddWriteResultsFlag(command, commonFlags)
+
+	return command
+}
+
+func RunWatchCommand(ctx context.Context, cancellationFunc context.CancelFunc, commonFlags *CommonFlags, watchFlags *WatchFlags, detectPassThroughFlagsMap map[string]interface{}) error {
+	if (watchFlags.Namespace == "") == !watchFlags.AllNamespaces {
+		return errors.Errorf("either --namespace or --all-namespaces is needed")
+	}
+	if watchFlags.Workers < 1 {
+		return errors.Errorf("at least one worker is needed, got %d", watchFlags.Workers)
+	}
+	if commonFlags.SBOMDir != "" {
+		if err := sbom.ValidateFormats(commonFlags.SBOMFormats); err != nil {
+			return err
+		}
+	}
+	// fail on invalid templates before setting anything up
+	if _, err := NewNamer(naming.SourceNamespace, naming.Context{Namespace: watchFlags.Namespace}, commonFlags); err != nil {
+		return err
+	}
+
+	cli, err := kube.NewDefaultClient()
+	if err != nil {
+		return err
+	}
+	if err = SetupResultWriter(cli, commonFlags); err != nil {
+		return err
+	}
+	// fail on an invalid registry config before watching
+	if _, err := registries.LoadImageRegistries(commonFlags.RegistryConfigPath); err != nil {
+		return err
+	}
+
+	detectClient, err := NewDetectClient(commonFlags)
+	if err != nil {
+		return err
+	}
+	if commonFlags.CleanupPersistentDockerInspectorServices {
+		defer detectClient.StopAndCleanupPersistentDockerInspectorServices()
+	}
+
+	scanStatusRowChan := make(chan *ScanStatusRow)
+	doneChan := make(chan bool, 1)
+	go PrintScanStatusRows(scanStatusRowChan, doneChan)
+
+	namers := &namespaceNamers{commonFlags: commonFlags, namers: map[string]*naming.Namer{}}
+	registriesByNamespace := &namespaceRegistries{cli: cli, commonFlags: commonFlags, registries: map[string]registries.ImageRegistries{}}
+	scan := func(ctx context.Context, ref watch.ImageRef) error {
+		namer, err := namers.get(ref.Namespace)
+		if err != nil {
+			return err
+		}
+		imageRegistries, err := registriesByNamespace.get(ctx, ref.Namespace)
+		if err != nil {
+			return err
+		}
+		image := ref.Pinned()
+		if ref.Workload != "" {
+			namer.AddWorkload(image, ref.Workload)
+		}
+		scanStatusRow := &ScanStatusRow{}
+		err = RunImageScanCommand(ctx, detectClient, imageRegistries, image, detectPassThroughFlagsMap, scanStatusRow, scanStatusRowChan, namer, commonFlags)
+		if err != nil {
+			unfinishedScanStatusRow := NewUnfinishedScanStatusRow(ctx, image, scanStatusRow)
+			scanStatusRowChan <- unfinishedScanStatusRow
+		}
+		return err
+	}
+	resolve := func(ref watch.ImageRef) (string, error) {
+		image, err := remediation.NewImage(ref.Image)
+		if err != nil {
+			return "", err
+		}
+		imageRegistries, err := registriesByNamespace.get(ctx, ref.Namespace)
+		if err != nil {
+			return "", err
+		}
+		return imageRegistries.GetDigestForImage(image.Name, image.URL, image.Version)
+	}
+	queue := watch.NewQueue(scan, resolve)
+
+	err = watch.NewWatcher(cli.Clientset, watchFlags.Namespace, queue).Start(ctx, watchFlags.SkipExisting)
+	if err == nil {
+		log.Infof("watching for new images, press Ctrl-C to stop")
+		queue.Run(ctx, watchFlags.Workers)
+	}
+	// stop and clean up after the printer is done, whether watching failed or was stopped
+	cancellationFunc()
+	close(scanStatusRowChan)
+	BlockOnDoneChan(doneChan)
+	return err
+}
+
+// namespaceNamers names the scans of every namespace like `bd-xray namespace` does, with the workloads seen so far
+type namespaceNamers struct {
+	commonFlags *CommonFlags
+	mutex       sync.Mutex
+	namers      map[string]*naming.Namer
+}
+
+func (n *namespaceNamers) get(namespace string) (*naming.Namer, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if namer, ok := n.namers[namespace]; ok {
+		return namer, nil
+	}
+	namer, err := NewNamer(naming.SourceNamespace, naming.Context{Namespace: namespace}, n.commonFlags)
+	if err != nil {
+		return nil, err
+	}
+	n.namers[namespace] = namer
+	return namer, nil
+}
+
+// namespaceRegistries pull and look up the images of every namespace with the credentials of its imagePullSecrets,
+// read as the first image of the namespace arrives, so that watching all namespaces uses the secrets of each one
+type namespaceRegistries struct {
+	cli         *kube.Client
+	commonFlags *CommonFlags
+	mutex       sync.Mutex
+	registries  map[string]registries.ImageRegistries
+}
+
+func (n *namespaceRegistries) get(ctx context.Context, namespace string) (registries.ImageRegistries, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if imageRegistries, ok := n.registries[namespace]; ok {
+		return imageRegistries, nil
+	}
+	imageRegistries, err := registries.LoadImageRegistries(n.commonFlags.RegistryConfigPath)
+	if err != nil {
+		return imageRegistries, err
+	}
+	AddImagePullSecretCredentials(ctx, n.cli, namespace, &imageRegistries)
+	n.registries[namespace] = imageRegistries
+	return imageRegistries, nil
+}
@@ -0,0 +1,216 @@
+package bd_xray
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/webhook"
+)
+
+type WebhookServeFlags struct {
+	ListenAddress string
+	TLSCertFile   string
+	TLSKeyFile    string
+	OnViolation   string
+	OnFailedScan  string
+	OnUnscanned   string
+	MaxAge        time.Duration
+	CacheTTL      time.Duration
+	LookupTimeout time.Duration
+	ExemptImages  []string
+}
+
+type WebhookManifestFlags struct {
+	Name              string
+	ServiceName       string
+	ServiceNamespace  string
+	ServicePort       int32
+	CABundleFile      string
+	FailurePolicy     string
+	TimeoutSeconds    int32
+	ExcludeNamespaces []string
+}
+
+func SetupWebhookCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "webhook",
+		Short: "run a validating admission webhook, which blocks images failing policy",
+		Long:  "run a validating admission webhook, which blocks images failing policy",
+		Args:  cobra.MaximumNArgs(0),
+	}
+	command.AddCommand(SetupWebhookServeCommand())
+	command.AddCommand(SetupWebhookManifestCommand())
+	return command
+}
+
+func SetupWebhookServeCommand() *cobra.Command {
+	commonFlags := &CommonFlags{}
+	serveFlags := &WebhookServeFlags{}
+
+	command := &cobra.Command{
+		Use:   "serve",
+		Short: "serve the validating admission webhook over HTTPS",
+		Long:  "serve the validating admission webhook over HTTPS; the images of the Pods and workloads created or updated are looked up in Black Duck, named like `bd-xray namespace` names them, and in the local scan results, and denied, warned about or allowed by the result of their latest scan. The local scan results only have the scans run on the same machine, so a webhook running in the cluster only has the results of Black Duck",
+		Args:  cobra.MaximumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := utils.NewSignalContext()
+			defer cancel()
+			utils.DoOrDie(RunWebhookServeCommand(ctx, commonFlags, serveFlags))
+		},
+	}
+
+	command.Flags().StringVar(&serveFlags.ListenAddress, "listen", ":8443", "Address to serve the webhook on")
+	command.Flags().StringVar(&serveFlags.TLSCertFile, "tls-cert-file", "", "Path to the PEM encoded serving certificate")
+	command.Flags().StringVar(&serveFlags.TLSKeyFile, "tls-key-file", "", "Path to the PEM encoded key of the serving certificate")
+	command.Flags().StringVar(&serveFlags.OnViolation, "on-violation", webhook.ActionDeny, "What to do with images violating Black Duck policies: allow, warn or deny")
+	command.Flags().StringVar(&serveFlags.OnFailedScan, "on-failed-scan", webhook.ActionWarn, "What to do with images whose latest scan failed: allow, warn or deny")
+	command.Flags().StringVar(&serveFlags.OnUnscanned, "on-unscanned", webhook.ActionWarn, "What to do with images without scan results: allow, warn or deny")
+	command.Flags().DurationVar(&serveFlags.MaxAge, "max-age", 0, "Treat local scan results older than this as unscanned; 0 accepts results of any age")
+	command.Flags().DurationVar(&serveFlags.CacheTTL, "cache-ttl", 5*time.Minute, "How long to cache the results looked up for an image")
+	command.Flags().DurationVar(&serveFlags.LookupTimeout, "lookup-timeout", webhook.DefaultLookupTimeout, "How long to look up the images of a request before treating them as unscanned; keep it below the --timeout-seconds of the manifest")
+	command.Flags().StringSliceVar(&serveFlags.ExemptImages, "exempt-image", nil, "Regular expressions of images which are always allowed, i.e.: ^k8s.gcr.io/")
+	command.Flags().StringVar(&commonFlags.BlackDuckURL, BlackDuckURLFlagName, "", "Black Duck Server URL; without it only the local scan results are looked up")
+	command.Flags().StringVar(&commonFlags.BlackDuckToken, BlackDuckTokenFlagName, "", "Black Duck API Token")
+	command.Flags().StringVar(&commonFlags.DetectProjectName, DetectProjectNameFlagName, "", "The --detect.project.name the namespaces were scanned with, if any")
+	command.Flags().StringVar(&commonFlags.RegistryConfigPath, RegistryConfigFlagName, registries.DefaultRegistryConfigPath, "Path to the registry config file, used to look up digests if a naming template uses them")
+	AddNamingFlags(command, commonFlags)
+	command.MarkFlagRequired("tls-cert-file")
+	command.MarkFlagRequired("tls-key-file")
+
+	return command
+}
+
+func RunWebhookServeCommand(ctx context.Context, commonFlags *CommonFlags, serveFlags *WebhookServeFlags) error {
+	policy := webhook.Policy{
+		Violation: serveFlags.OnViolation,
+		Failed:    serveFlags.OnFailedScan,
+		Unscanned: serveFlags.OnUnscanned,
+		MaxAge:    serveFlags.MaxAge,
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	for _, exemptImage := range serveFlags.ExemptImages {
+		exempt, err := regexp.Compile(exemptImage)
+		if err != nil {
+			return errors.Wrapf(err, "invalid --exempt-image '%s'", exemptImage)
+		}
+		policy.Exempt = append(policy.Exempt, exempt)
+	}
+
+	var lookups []webhook.Lookup
+	if commonFlags.BlackDuckURL != "" {
+		if _, err := NewNamer(naming.SourceNamespace, naming.Context{}, commonFlags); err != nil {
+			return err
+		}
+		imageRegistries, err := registries.LoadImageRegistries(commonFlags.RegistryConfigPath)
+		if err != nil {
+			return err
+		}
+		namers := &namespaceNamers{commonFlags: commonFlags, namers: map[string]*naming.Namer{}}
+		lookups = append(lookups, &webhook.BlackDuckLookup{
+			Client: blackduck.NewClient(commonFlags.BlackDuckURL, commonFlags.BlackDuckToken),
+			Names: func(namespace, image string) (string, string, error) {
+				namer, err := namers.get(namespace)
+				if err != nil {
+					return "", "", err
+				}
+				names, err := ImageScanNames(namer, imageRegistries, image)
+				return names.Project, names.Version, err
+			},
+		})
+	}
+	lookups = append(lookups, &webhook.IndexLookup{Index: resultsIndex})
+
+	webhookServer := webhook.NewServer(webhook.NewCachedLookup(serveFlags.CacheTTL, lookups...), policy)
+	webhookServer.LookupTimeout = serveFlags.LookupTimeout
+	server := &http.Server{
+		Addr:    serveFlags.ListenAddress,
+		Handler: webhookServer.Handler(),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Warnf("unable to shut down the webhook server: %+v", err)
+		}
+	}()
+
+	log.Infof("serving the webhook on %s%s", serveFlags.ListenAddress, webhook.ValidatePath)
+	err := server.ListenAndServeTLS(serveFlags.TLSCertFile, serveFlags.TLSKeyFile)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return errors.Wrapf(err, "unable to serve the webhook on %s", serveFlags.ListenAddress)
+}
+
+func SetupWebhookManifestCommand() *cobra.Command {
+	manifestFlags := &WebhookManifestFlags{}
+
+	command := &cobra.Command{
+		Use:   "manifest",
+		Short: "print the ValidatingWebhookConfiguration of the webhook",
+		Long:  "print the ValidatingWebhookConfiguration sending the Pods and workloads created or updated to the webhook served by `bd-xray webhook serve` behind a service",
+		Args:  cobra.MaximumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.DoOrDie(RunWebhookManifestCommand(manifestFlags))
+		},
+	}
+
+	command.Flags().StringVar(&manifestFlags.Name, "name", "bd-xray", "Name of the ValidatingWebhookConfiguration")
+	command.Flags().StringVar(&manifestFlags.ServiceName, "service-name", "bd-xray-webhook", "Name of the service of the webhook")
+	command.Flags().StringVar(&manifestFlags.ServiceNamespace, "service-namespace", "bd-xray", "Namespace of the service of the webhook, which isn't validated")
+	command.Flags().Int32Var(&manifestFlags.ServicePort, "service-port", 443, "Port of the service of the webhook")
+	command.Flags().StringVar(&manifestFlags.CABundleFile, "ca-bundle-file", "", "Path to the PEM encoded CA which signed the serving certificate; leave it out if it's injected, i.e.: by cert-manager")
+	command.Flags().StringVar(&manifestFlags.FailurePolicy, "failure-policy", "Ignore", "What the API server does if the webhook can't be reached: Ignore or Fail")
+	command.Flags().Int32Var(&manifestFlags.TimeoutSeconds, "timeout-seconds", 10, "How long the API server waits for the webhook")
+	command.Flags().StringSliceVar(&manifestFlags.ExcludeNamespaces, "exclude-namespace", []string{"kube-system"}, "Namespaces which aren't validated")
+
+	return command
+}
+
+func RunWebhookManifestCommand(manifestFlags *WebhookManifestFlags) error {
+	var caBundle []byte
+	if manifestFlags.CABundleFile != "" {
+		var err error
+		if caBundle, err = ioutil.ReadFile(manifestFlags.CABundleFile); err != nil {
+			return errors.Wrapf(err, "unable to read CA bundle %s", manifestFlags.CABundleFile)
+		}
+	}
+	// the webhook mustn't block its own pods
+	excludeNamespaces := []string{manifestFlags.ServiceNamespace}
+	for _, namespace := range manifestFlags.ExcludeNamespaces {
+		if namespace != manifestFlags.ServiceNamespace {
+			excludeNamespaces = append(excludeNamespaces, namespace)
+		}
+	}
+
+	manifest, err := webhook.Manifest(webhook.ManifestOptions{
+		Name:              manifestFlags.Name,
+		ServiceName:       manifestFlags.ServiceName,
+		ServiceNamespace:  manifestFlags.ServiceNamespace,
+		ServicePort:       manifestFlags.ServicePort,
+		CABundle:          caBundle,
+		FailurePolicy:     manifestFlags.FailurePolicy,
+		TimeoutSeconds:    manifestFlags.TimeoutSeconds,
+		ExcludeNamespaces: excludeNamespaces,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(manifest))
+	return nil
+}
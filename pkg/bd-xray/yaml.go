@@ -3,9 +3,12 @@ package bd_xray
 import (
 	"context"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"path/filepath"
 
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/naming"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/report"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/yaml"
 )
@@ -19,8 +22,6 @@ func SetupYamlScanCommand() *cobra.Command {
 		BlackDuckTokenFlagName:    &commonFlags.BlackDuckToken,
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
 	command := &cobra.Command{
 		Use:   "yaml YAML_FILE...",
 		Short: "scan all yaml files provided",
@@ -29,6 +30,8 @@ func SetupYamlScanCommand() *cobra.Command {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := utils.NewSignalContext()
+			defer cancel()
 			utils.DoOrDie(RunYamlScanCommand(args[0], ctx, cancel, commonFlags, detectPassThroughFlagsMap))
 		},
 	}
@@ -38,6 +41,9 @@ func SetupYamlScanCommand() *cobra.Command {
 	command.Flags().StringVar(&commonFlags.BlackDuckToken, BlackDuckTokenFlagName, "", "Black Duck API Token")
 	command.Flags().StringVar(&commonFlags.DetectProjectName, DetectProjectNameFlagName, "", "An override for the name to use for the Black Duck project. If not supplied, a project will be created with yaml name and image name and tag will be passed as version.")
 
+	AddCommonScanFlags(command, commonFlags)
+	AddReportFlags(command, commonFlags)
+
 	return command
 }
 
@@ -51,13 +57,26 @@ func RunYamlScanCommand(yamlfile string, ctx context.Context, cancellationFunc c
 		return err
 	}
 
-	var projectName string
-	var userSuppliedProjectName = commonFlags.DetectProjectName
-	if 0 == len(userSuppliedProjectName) {
-		projectName = utils.SanitizeString(filepath.Base(yamlfile))
-	} else {
-		projectName = userSuppliedProjectName
+	namer, err := NewNamer(naming.SourceYaml, naming.Context{File: filepath.Base(yamlfile)}, commonFlags)
+	if err != nil {
+		return err
 	}
 
-	return RunAndPrintMultipleImageScansConcurrently(ctx, cancellationFunc, imageList, detectPassThroughFlagsMap, projectName, commonFlags.CleanupPersistentDockerInspectorServices)
+	err = RunAndPrintMultipleImageScansConcurrently(ctx, cancellationFunc, imageList, detectPassThroughFlagsMap, namer, commonFlags)
+	SaveReport(ctx, report.Scope(naming.SourceYaml, YamlReportSubject(yamlfile)), err, commonFlags)
+	if err != nil {
+		return err
+	}
+	return staleImages.Err(commonFlags.StalenessThreshold)
+}
+
+// YamlReportSubject is the absolute path of the yaml file, so that the reports of files with the same name in other
+// directories aren't compared with each other
+func YamlReportSubject(yamlfile string) string {
+	path, err := filepath.Abs(yamlfile)
+	if err != nil {
+		log.Warnf("unable to get the absolute path of %s: %+v", yamlfile, err)
+		return yamlfile
+	}
+	return path
 }
@@ -0,0 +1,209 @@
+package bdio
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Component is a component found by a scan, i.e.: musl 1.1.24-r2 from alpine
+type Component struct {
+	Name    string
+	Version string
+	// Origin is the forge or namespace of the component, i.e.: alpine, centos or maven
+	Origin     string
+	ExternalID string
+}
+
+// FindBDIOFiles finds the BDIO 1 documents (*.jsonld) and BDIO 2 archives (*.bdio) which detect wrote to the bdio
+// dirs of its runs, runs/*/bdio, under the output dir of a scan; intermediate files of the tools are skipped
+func FindBDIOFiles(outputDir string) ([]string, error) {
+	var paths []string
+	for _, pattern := range []string{"*.jsonld", "*.bdio"} {
+		matches, err := filepath.Glob(filepath.Join(outputDir, "runs", "*", "bdio", pattern))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to search for BDIO files in %s", outputDir)
+		}
+		for _, path := range matches {
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ParseBDIOFile parses the components of a BDIO 1 document or BDIO 2 archive
+func ParseBDIOFile(path string) ([]Component, error) {
+	if strings.HasSuffix(path, ".bdio") {
+		return parseBDIO2Archive(path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read BDIO file %s", path)
+	}
+	components, err := ParseBDIO(content)
+	return components, errors.Wrapf(err, "unable to parse BDIO file %s", path)
+}
+
+// parseBDIO2Archive parses every JSON-LD entry of a BDIO 2 archive, which splits large graphs over several entries
+func parseBDIO2Archive(path string) ([]Component, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open BDIO archive %s", path)
+	}
+	defer archive.Close()
+
+	var components []Component
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, ".jsonld") {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to open %s in BDIO archive %s", file.Name, path)
+		}
+		content, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read %s in BDIO archive %s", file.Name, path)
+		}
+		entryComponents, err := ParseBDIO(content)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse %s in BDIO archive %s", file.Name, path)
+		}
+		components = append(components, entryComponents...)
+	}
+	return components, nil
+}
+
+// ParseBDIO parses the components of a JSON-LD document, either BDIO 1 (an array of nodes with plain keys such as
+// name and revision) or BDIO 2 (an @graph of nodes with keys such as https://blackducksoftware.github.io/bdio#hasName)
+func ParseBDIO(content []byte) ([]Component, error) {
+	var document interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse JSON-LD")
+	}
+
+	var nodes []interface{}
+	switch typed := document.(type) {
+	case []interface{}:
+		nodes = typed
+	case map[string]interface{}:
+		graph, ok := typed["@graph"].([]interface{})
+		if !ok {
+			return nil, errors.Errorf("JSON-LD document has no @graph")
+		}
+		nodes = graph
+	default:
+		return nil, errors.Errorf("JSON-LD document is neither an array nor an object")
+	}
+
+	var components []Component
+	for _, node := range nodes {
+		fields, ok := node.(map[string]interface{})
+		if !ok || !hasType(fields, "Component") {
+			continue
+		}
+		component := Component{
+			Name:    firstValue(fields, "name", "hasName"),
+			Version: firstValue(fields, "revision", "hasVersion"),
+			Origin:  firstValue(fields, "hasNamespace"),
+			// BDIO 2 identifiers are the external ID
+			ExternalID: firstValue(fields, "hasIdentifier"),
+		}
+		if externalID, ok := fields["bdioExternalIdentifier"].(map[string]interface{}); ok {
+			component.Origin = strings.TrimPrefix(value(externalID["forge"]), "@")
+			component.ExternalID = value(externalID["externalId"])
+		}
+		components = append(components, component)
+	}
+	SortComponents(components)
+	return components, nil
+}
+
+// SortComponents sorts by origin, name and version
+func SortComponents(components []Component) {
+	sort.SliceStable(components, func(a, b int) bool {
+		if components[a].Origin != components[b].Origin {
+			return components[a].Origin < components[b].Origin
+		}
+		if components[a].Name != components[b].Name {
+			return components[a].Name < components[b].Name
+		}
+		return components[a].Version < components[b].Version
+	})
+}
+
+// UniqueComponents removes duplicate components of sorted components, i.e.: found in several BDIO files
+func UniqueComponents(components []Component) []Component {
+	var unique []Component
+	for idx, component := range components {
+		if idx > 0 && component == components[idx-1] {
+			continue
+		}
+		unique = append(unique, component)
+	}
+	return unique
+}
+
+// localName strips the vocabulary of a JSON-LD key or type, i.e.: https://blackducksoftware.github.io/bdio#hasName
+// becomes hasName
+func localName(key string) string {
+	if idx := strings.LastIndexAny(key, "#/"); idx >= 0 {
+		return key[idx+1:]
+	}
+	return key
+}
+
+func hasType(fields map[string]interface{}, name string) bool {
+	switch typed := fields["@type"].(type) {
+	case string:
+		return localName(typed) == name
+	case []interface{}:
+		for _, t := range typed {
+			if s, ok := t.(string); ok && localName(s) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// firstValue is the value of the first key present, comparing keys without their vocabulary
+func firstValue(fields map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		for key, raw := range fields {
+			if localName(key) == name {
+				if v := value(raw); v != "" {
+					return v
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// value reads a JSON-LD value, which is a plain value, a {"@value": ...} object, or an array of either
+func value(raw interface{}) string {
+	switch typed := raw.(type) {
+	case string:
+		return typed
+	case map[string]interface{}:
+		return value(typed["@value"])
+	case []interface{}:
+		for _, item := range typed {
+			if v := value(item); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package bdio
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func formatComponents(components []Component) string {
+	var formatted []string
+	for _, component := range components {
+		formatted = append(formatted, strings.Join([]string{component.Origin, component.Name, component.Version, component.ExternalID}, " "))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func TestParseBDIO1(t *testing.T) {
+	components, err := ParseBDIOFile("testdata/alpine_3_12_bdio.jsonld")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := "alpine busybox 1.31.1-r19 busybox/1.31.1-r19/x86_64, alpine musl 1.1.24-r10 musl/1.1.24-r10/x86_64"
+	if actual := formatComponents(components); actual != expected {
+		t.Errorf("Expected [%s], but got [%s]", expected, actual)
+	}
+}
+
+func TestParseBDIO2(t *testing.T) {
+	// values are either expanded ({"@value": ...} in arrays) or compacted
+	components, err := ParseBDIOFile("testdata/nginx_1_19_bdio2.jsonld")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := "debian libc6 2.28-10 libc6/2.28-10/amd64, debian openssl 1.1.1d-0+deb10u4 openssl/1.1.1d-0+deb10u4/amd64"
+	if actual := formatComponents(components); actual != expected {
+		t.Errorf("Expected [%s], but got [%s]", expected, actual)
+	}
+}
+
+func TestParseBDIOMalformed(t *testing.T) {
+	for _, content := range []string{`[{"@type": "Component"`, `{"@type": "Project"}`, `"bdio"`} {
+		if _, err := ParseBDIO([]byte(content)); err == nil {
+			t.Errorf("Expected an error for [%s]", content)
+		}
+	}
+}
+
+// writeBDIO2Archive zips JSON-LD entries the way detect writes *.bdio files
+func writeBDIO2Archive(t *testing.T, path string, entries ...string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	for idx, entry := range entries {
+		content, err := ioutil.ReadFile(entry)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		writer, err := archive.Create(filepath.Join("bdio", strings.Repeat("0", idx+1)+".jsonld"))
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if _, err := writer.Write(content); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+}
+
+func TestFindReport(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "detect-output")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	dockerInspectorDir := filepath.Join(outputDir, "runs", "2021-03-02-10-15-31-112", "tools", "docker-inspector")
+	bdioDir := filepath.Join(outputDir, "runs", "2021-03-02-10-15-31-112", "bdio")
+	for _, dir := range []string{dockerInspectorDir, bdioDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	for _, name := range []string{"alpine_3_12_bdio.jsonld", "results.json"} {
+		content, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dockerInspectorDir, name), content, 0644); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	// the intermediate BDIO of docker inspector isn't reported, only the one of detect
+	writeBDIO2Archive(t, filepath.Join(bdioDir, "library_alpine_3_12.bdio"), "testdata/nginx_1_19_bdio2.jsonld", "testdata/alpine_3_12_bdio.jsonld")
+
+	report, err := FindReport(outputDir)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if expected := filepath.Join(bdioDir, "library_alpine_3_12.bdio"); len(report.BDIOFiles) != 1 || report.BDIOFiles[0] != expected {
+		t.Errorf("Expected [%s], but got [%+v]", expected, report.BDIOFiles)
+	}
+	if report.DockerInspector == nil || !report.DockerInspector.Succeeded || report.DockerInspector.ImageRepo != "library/alpine" {
+		t.Errorf("Expected the docker inspector results, but got [%+v]", report.DockerInspector)
+	}
+	if len(report.Components) != 4 {
+		t.Errorf("Expected 4 components, but got [%s]", formatComponents(report.Components))
+	}
+
+	reportPath, err := report.Write("library/alpine:3.12")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	content, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for _, expected := range []string{"Components of library/alpine:3.12", "Docker Inspector succeeded", "openssl", "1.1.1d-0+deb10u4"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected [%s] in report, but got [%s]", expected, content)
+		}
+	}
+}
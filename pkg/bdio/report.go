@@ -0,0 +1,125 @@
+package bdio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DockerInspectorResultsFileName is the file docker inspector describes its run in
+	DockerInspectorResultsFileName = "results.json"
+	// ReportFileName is the name of the local report written to the output dir of a scan in offline mode
+	ReportFileName = "report.txt"
+)
+
+// DockerInspectorResult is the results.json of docker inspector
+type DockerInspectorResult struct {
+	Succeeded                   bool   `json:"succeeded"`
+	Message                     string `json:"message"`
+	ReturnCode                  int    `json:"returnCode"`
+	ImageRepo                   string `json:"imageRepo"`
+	ImageTag                    string `json:"imageTag"`
+	DockerTarfilename           string `json:"dockerTarfilename"`
+	BdioFilename                string `json:"bdioFilename"`
+	ContainerFileSystemFilename string `json:"containerFileSystemFilename"`
+	SquashedImageFilename       string `json:"squashedImageFilename"`
+}
+
+// Report is what a scan found locally, i.e.: in offline mode
+type Report struct {
+	OutputDir       string
+	BDIOFiles       []string
+	DockerInspector *DockerInspectorResult
+	Components      []Component
+}
+
+// FindDockerInspectorResult finds and parses the results.json of docker inspector under the output dir of a scan;
+// nil if there is none
+func FindDockerInspectorResult(outputDir string) (*DockerInspectorResult, error) {
+	var result *DockerInspectorResult
+	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || result != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != DockerInspectorResultsFileName {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read %s", path)
+		}
+		var candidate DockerInspectorResult
+		if err := json.Unmarshal(content, &candidate); err != nil {
+			log.Debugf("skipping %s, it is no docker inspector results file: %v", path, err)
+			return nil
+		}
+		// other tools may write a results.json as well
+		if candidate.ImageRepo != "" || candidate.BdioFilename != "" {
+			result = &candidate
+		}
+		return nil
+	})
+	return result, errors.Wrapf(err, "unable to search for docker inspector results in %s", outputDir)
+}
+
+// FindReport locates and parses the BDIO files and the docker inspector results under the output dir of a scan
+func FindReport(outputDir string) (*Report, error) {
+	report := &Report{OutputDir: outputDir}
+	var err error
+	report.BDIOFiles, err = FindBDIOFiles(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	report.DockerInspector, err = FindDockerInspectorResult(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range report.BDIOFiles {
+		components, err := ParseBDIOFile(path)
+		if err != nil {
+			return nil, err
+		}
+		report.Components = append(report.Components, components...)
+	}
+	SortComponents(report.Components)
+	report.Components = UniqueComponents(report.Components)
+	return report, nil
+}
+
+// Render formats the report as a table of the components, preceded by the docker inspector results and BDIO files
+func (r *Report) Render(image string) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Components of %s\n", image)
+	if r.DockerInspector != nil {
+		status := "succeeded"
+		if !r.DockerInspector.Succeeded {
+			status = fmt.Sprintf("failed with return code %d", r.DockerInspector.ReturnCode)
+		}
+		fmt.Fprintf(&out, "Docker Inspector %s: %s\n", status, r.DockerInspector.Message)
+	}
+	for _, path := range r.BDIOFiles {
+		fmt.Fprintf(&out, "BDIO: %s\n", path)
+	}
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Name", "Version", "Origin"})
+	for _, component := range r.Components {
+		t.AppendRow(table.Row{component.Name, component.Version, component.Origin})
+	}
+	t.AppendFooter(table.Row{"", "Total", len(r.Components)})
+	fmt.Fprintf(&out, "%s\n", t.Render())
+	return out.String()
+}
+
+// Write writes the rendered report to the output dir of the scan, returning its path
+func (r *Report) Write(image string) (string, error) {
+	path := filepath.Join(r.OutputDir, ReportFileName)
+	return path, errors.Wrapf(ioutil.WriteFile(path, []byte(r.Render(image)), 0644), "unable to write report %s", path)
+}
@@ -0,0 +1,243 @@
+package blackduck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// BDIO1ContentType is the content type of BDIO 1 documents, i.e.: *.jsonld
+	BDIO1ContentType = "application/ld+json"
+	// BDIO2ContentType is the content type of BDIO 2 archives, i.e.: *.bdio
+	BDIO2ContentType = "application/vnd.blackducksoftware.bdio+zip"
+
+	bomMediaType     = "application/vnd.blackducksoftware.bill-of-materials-6+json"
+	projectMediaType = "application/vnd.blackducksoftware.project-detail-4+json"
+
+	pageSize = 100
+)
+
+// Client talks to the REST API of a Black Duck server, authenticating with an API token
+type Client struct {
+	URL         string
+	Token       string
+	RestyClient *resty.Client
+
+	// ctx cancels the requests of the client, see WithContext
+	ctx  context.Context
+	auth *bearerAuth
+}
+
+// bearerAuth is the bearer token of a client, shared with the clients of WithContext
+type bearerAuth struct {
+	mutex       sync.Mutex
+	bearerToken string
+}
+
+func NewClient(url, token string) *Client {
+	return &Client{
+		URL:   strings.TrimSuffix(url, "/"),
+		Token: token,
+		RestyClient: resty.New().
+			SetHostURL(strings.TrimSuffix(url, "/")).
+			SetRetryCount(3).
+			SetTimeout(60 * time.Second),
+		auth: &bearerAuth{},
+	}
+}
+
+// WithContext is a client whose requests, including retries, are cancelled once ctx is done; it reuses the bearer
+// token of c
+func (c *Client) WithContext(ctx context.Context) *Client {
+	return &Client{URL: c.URL, Token: c.Token, RestyClient: c.RestyClient, ctx: ctx, auth: c.auth}
+}
+
+// Authenticate exchanges the API token for a bearer token, which is reused by later requests until Black Duck rejects it
+func (c *Client) Authenticate() (string, error) {
+	c.auth.mutex.Lock()
+	defer c.auth.mutex.Unlock()
+	if c.auth.bearerToken != "" {
+		return c.auth.bearerToken, nil
+	}
+
+	var auth struct {
+		BearerToken string `json:"bearerToken"`
+	}
+	resp, err := c.request().
+		SetHeader("Authorization", fmt.Sprintf("token %s", c.Token)).
+		SetResult(&auth).
+		Post("/api/tokens/authenticate")
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to authenticate with Black Duck at %s", c.URL)
+	}
+	if !resp.IsSuccess() || auth.BearerToken == "" {
+		return "", errors.Errorf("unable to authenticate with Black Duck at %s: bad status code %d", c.URL, resp.StatusCode())
+	}
+	c.auth.bearerToken = auth.BearerToken
+	return c.auth.bearerToken, nil
+}
+
+// expire forgets a bearer token Black Duck rejected, unless another request already replaced it
+func (c *Client) expire(bearerToken string) {
+	c.auth.mutex.Lock()
+	defer c.auth.mutex.Unlock()
+	if c.auth.bearerToken == bearerToken {
+		c.auth.bearerToken = ""
+	}
+}
+
+// send sends a request authenticated with the bearer token, prepared by prepare; if Black Duck rejects the token, i.e.:
+// because it expired, the client authenticates again and sends the request once more
+func (c *Client) send(method, url string, prepare func(request *resty.Request) *resty.Request) (*resty.Response, error) {
+	for attempt := 0; ; attempt++ {
+		bearerToken, err := c.Authenticate()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := prepare(c.request().SetAuthToken(bearerToken)).Execute(method, url)
+		if err != nil || resp.StatusCode() != http.StatusUnauthorized || attempt > 0 {
+			return resp, err
+		}
+		log.Debugf("Black Duck at %s rejected the bearer token, authenticating again", c.URL)
+		c.expire(bearerToken)
+	}
+}
+
+// request is an unauthenticated request, with the context of the client if it has one
+func (c *Client) request() *resty.Request {
+	request := c.RestyClient.R()
+	if c.ctx != nil {
+		request.SetContext(c.ctx)
+	}
+	return request
+}
+
+// GetVersion fetches the version of the Black Duck server, i.e.: 2020.10.0
+func (c *Client) GetVersion() (string, error) {
+	var currentVersion struct {
+		Version string `json:"version"`
+	}
+	resp, err := c.send(resty.MethodGet, "/api/current-version", func(request *resty.Request) *resty.Request {
+		return request.SetResult(&currentVersion)
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get version of Black Duck at %s", c.URL)
+	}
+	if !resp.IsSuccess() || currentVersion.Version == "" {
+		return "", errors.Errorf("unable to get version of Black Duck at %s: bad status code %d", c.URL, resp.StatusCode())
+	}
+	return currentVersion.Version, nil
+}
+
+// UploadBDIO uploads a BDIO 1 document (*.jsonld) or BDIO 2 archive (*.bdio), i.e.: of a scan in offline mode;
+// Black Duck processes it asynchronously
+func (c *Client) UploadBDIO(path string) error {
+	contentType := BDIO1ContentType
+	if filepath.Ext(path) == ".bdio" {
+		contentType = BDIO2ContentType
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read BDIO file %s", path)
+	}
+	resp, err := c.send(resty.MethodPost, "/api/scan/data/", func(request *resty.Request) *resty.Request {
+		return request.
+			SetHeader("Content-Type", contentType).
+			SetQueryParam("mode", "replace").
+			SetBody(content)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to upload %s to Black Duck at %s", path, c.URL)
+	}
+	if !resp.IsSuccess() {
+		return errors.Errorf("unable to upload %s to Black Duck at %s: bad status code %d: %s", path, c.URL, resp.StatusCode(), resp.String())
+	}
+	log.Debugf("uploaded %s to Black Duck at %s", path, c.URL)
+	return nil
+}
+
+// BOMComponent is a component of the bill of materials of a project version
+type BOMComponent struct {
+	ComponentName        string      `json:"componentName"`
+	ComponentVersionName string      `json:"componentVersionName"`
+	Origins              []BOMOrigin `json:"origins"`
+}
+
+// BOMOrigin is where a component version comes from, i.e.: alpine musl/1.1.24-r10/x86_64
+type BOMOrigin struct {
+	Name              string `json:"name"`
+	ExternalNamespace string `json:"externalNamespace"`
+	ExternalID        string `json:"externalId"`
+}
+
+// GetBOMComponents fetches all components of a project version, given the URL of the project version or its
+// components, i.e.: the location detect reports
+func (c *Client) GetBOMComponents(projectVersionURL string) ([]BOMComponent, error) {
+	componentsURL := strings.TrimSuffix(projectVersionURL, "/")
+	if !strings.HasSuffix(componentsURL, "/components") {
+		componentsURL += "/components"
+	}
+
+	var components []BOMComponent
+	err := c.getAllItems(componentsURL, bomMediaType, func(item json.RawMessage) error {
+		var component BOMComponent
+		if err := json.Unmarshal(item, &component); err != nil {
+			return errors.Wrapf(err, "unable to parse BOM component from %s", componentsURL)
+		}
+		components = append(components, component)
+		return nil
+	})
+	return components, err
+}
+
+// getAllItems fetches all pages of a collection, calling each for every item
+func (c *Client) getAllItems(url, mediaType string, each func(item json.RawMessage) error) error {
+	return c.getAllItemsWithQuery(url, mediaType, "", each)
+}
+
+// getAllItemsWithQuery fetches all pages of a collection filtered by a query, i.e.: name:nginx; the filter matches
+// substrings, so callers compare the items themselves
+func (c *Client) getAllItemsWithQuery(url, mediaType, query string, each func(item json.RawMessage) error) error {
+	for offset := 0; ; {
+		var page struct {
+			TotalCount int               `json:"totalCount"`
+			Items      []json.RawMessage `json:"items"`
+		}
+		resp, err := c.send(resty.MethodGet, url, func(request *resty.Request) *resty.Request {
+			if query != "" {
+				request.SetQueryParam("q", query)
+			}
+			return request.
+				SetHeader("Accept", mediaType).
+				SetQueryParam("offset", fmt.Sprintf("%d", offset)).
+				SetQueryParam("limit", fmt.Sprintf("%d", pageSize)).
+				SetResult(&page)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to get %s", url)
+		}
+		if !resp.IsSuccess() {
+			return errors.Errorf("unable to get %s: bad status code %d", url, resp.StatusCode())
+		}
+		for _, item := range page.Items {
+			if err := each(item); err != nil {
+				return err
+			}
+		}
+		offset += len(page.Items)
+		if len(page.Items) == 0 || offset >= page.TotalCount {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package blackduck
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newTestServer(t *testing.T, uploads map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tokens/authenticate":
+			if r.Header.Get("Authorization") != "token api-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"bearerToken": "bearer-token", "expiresInMilliseconds": 7199999}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer bearer-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/current-version":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"version": "2020.10.0"}`))
+		case "/api/projects/1/versions/2/components":
+			if r.Header.Get("Accept") != "application/vnd.blackducksoftware.bill-of-materials-6+json" {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			items := []string{
+				`{"componentName": "busybox", "componentVersionName": "1.31.1-r19", "origins": [{"externalNamespace": "alpine", "externalId": "busybox/1.31.1-r19/x86_64"}]}`,
+				`{"componentName": "musl", "componentVersionName": "1.1.24-r10", "origins": [{"externalNamespace": "alpine", "externalId": "musl/1.1.24-r10/x86_64"}]}`,
+			}
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			page := "[]"
+			if offset < len(items) {
+				page = "[" + items[offset] + "]"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(fmt.Sprintf(`{"totalCount": %d, "items": %s}`, len(items), page)))
+		case "/api/scan/data/":
+			content, _ := ioutil.ReadAll(r.Body)
+			uploads[r.Header.Get("Content-Type")] = string(content)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestGetVersion(t *testing.T) {
+	server := newTestServer(t, map[string]string{})
+	defer server.Close()
+
+	version, err := NewClient(server.URL+"/", "api-token").GetVersion()
+	if err != nil || version != "2020.10.0" {
+		t.Errorf("Expected [2020.10.0], but got [%s %+v]", version, err)
+	}
+	if _, err := NewClient(server.URL, "wrong-token").GetVersion(); err == nil {
+		t.Errorf("Expected an error for a wrong API token")
+	}
+}
+
+func TestExpiredBearerTokenIsRefreshed(t *testing.T) {
+	server := newTestServer(t, map[string]string{})
+	defer server.Close()
+
+	client := NewClient(server.URL, "api-token")
+	client.auth.bearerToken = "expired-token"
+	version, err := client.WithContext(context.Background()).GetVersion()
+	if err != nil || version != "2020.10.0" {
+		t.Errorf("Expected [2020.10.0], but got [%s %+v]", version, err)
+	}
+	if client.auth.bearerToken != "bearer-token" {
+		t.Errorf("Expected the refreshed token [bearer-token], but got [%s]", client.auth.bearerToken)
+	}
+}
+
+func TestUploadBDIO(t *testing.T) {
+	uploads := map[string]string{}
+	server := newTestServer(t, uploads)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "bdio")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{"alpine_bdio.jsonld": BDIO1ContentType, "alpine.bdio": BDIO2ContentType}
+	client := NewClient(server.URL, "api-token")
+	for name, contentType := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if err := client.UploadBDIO(path); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if uploads[contentType] != name {
+			t.Errorf("Expected [%s] uploaded as [%s], but got [%+v]", name, contentType, uploads)
+		}
+	}
+}
+
+func TestGetBOMComponents(t *testing.T) {
+	server := newTestServer(t, map[string]string{})
+	defer server.Close()
+
+	// the test server returns a single component per page, regardless of the limit
+	components, err := NewClient(server.URL, "api-token").GetBOMComponents(server.URL + "/api/projects/1/versions/2")
+	if err != nil || len(components) != 2 {
+		t.Fatalf("Expected 2 components, but got [%+v %+v]", components, err)
+	}
+	if musl := components[1]; musl.ComponentName != "musl" || musl.ComponentVersionName != "1.1.24-r10" || musl.Origins[0].ExternalID != "musl/1.1.24-r10/x86_64" {
+		t.Errorf("Expected musl 1.1.24-r10, but got [%+v]", musl)
+	}
+}
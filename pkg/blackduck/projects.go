@@ -0,0 +1,266 @@
+package blackduck
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PhaseArchived is the phase of project versions which are no longer in use
+	PhaseArchived = "ARCHIVED"
+	// PolicyStatusInViolation is the overall policy status of project versions with components violating a policy
+	PolicyStatusInViolation = "IN_VIOLATION"
+)
+
+// Meta holds the URL of a resource
+type Meta struct {
+	Href string `json:"href"`
+}
+
+// Project is a Black Duck project; the project versions are fetched separately
+type Project struct {
+	Name string `json:"name"`
+	Meta Meta   `json:"_meta"`
+}
+
+// ProjectVersion is a version of a Black Duck project, i.e.: one per image tag
+type ProjectVersion struct {
+	VersionName string    `json:"versionName"`
+	Phase       string    `json:"phase"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Meta        Meta      `json:"_meta"`
+}
+
+// ListProjects fetches all projects
+func (c *Client) ListProjects() ([]Project, error) {
+	var projects []Project
+	err := c.getAllItems("/api/projects", projectMediaType, func(item json.RawMessage) error {
+		var project Project
+		if err := json.Unmarshal(item, &project); err != nil {
+			return errors.Wrapf(err, "unable to parse project")
+		}
+		projects = append(projects, project)
+		return nil
+	})
+	return projects, err
+}
+
+// ListProjectsWithTag fetches the projects with a tag; the filter matches substrings of the tags, i.e.: cluster:prod
+// matches cluster:prod-eu, so callers compare the tags themselves
+func (c *Client) ListProjectsWithTag(tag string) ([]Project, error) {
+	var projects []Project
+	err := c.getAllItemsWithQuery("/api/projects", projectMediaType, "tag:"+tag, func(item json.RawMessage) error {
+		var project Project
+		if err := json.Unmarshal(item, &project); err != nil {
+			return errors.Wrapf(err, "unable to parse project")
+		}
+		projects = append(projects, project)
+		return nil
+	})
+	return projects, err
+}
+
+// GetProjectTags fetches the tags of a project
+func (c *Client) GetProjectTags(projectURL string) ([]string, error) {
+	var tags []string
+	err := c.getAllItems(projectURL+"/tags", projectMediaType, func(item json.RawMessage) error {
+		var tag struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(item, &tag); err != nil {
+			return errors.Wrapf(err, "unable to parse tag of project %s", projectURL)
+		}
+		tags = append(tags, tag.Name)
+		return nil
+	})
+	return tags, err
+}
+
+// ListProjectVersions fetches all versions of a project
+func (c *Client) ListProjectVersions(projectURL string) ([]ProjectVersion, error) {
+	var versions []ProjectVersion
+	err := c.getAllItems(projectURL+"/versions", projectMediaType, func(item json.RawMessage) error {
+		var version ProjectVersion
+		if err := json.Unmarshal(item, &version); err != nil {
+			return errors.Wrapf(err, "unable to parse version of project %s", projectURL)
+		}
+		versions = append(versions, version)
+		return nil
+	})
+	return versions, err
+}
+
+// DeleteProjectVersion deletes a project version together with its BOM
+func (c *Client) DeleteProjectVersion(versionURL string) error {
+	resp, err := c.send(resty.MethodDelete, versionURL, func(request *resty.Request) *resty.Request {
+		return request
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to delete project version %s", versionURL)
+	}
+	if !resp.IsSuccess() {
+		return errors.Errorf("unable to delete project version %s: bad status code %d: %s", versionURL, resp.StatusCode(), resp.String())
+	}
+	log.Debugf("deleted project version %s", versionURL)
+	return nil
+}
+
+// ArchiveProjectVersion sets the phase of a project version to ARCHIVED; the version is fetched and updated as a
+// whole, since Black Duck replaces all its settings
+func (c *Client) ArchiveProjectVersion(versionURL string) error {
+	var version map[string]interface{}
+	resp, err := c.send(resty.MethodGet, versionURL, func(request *resty.Request) *resty.Request {
+		return request.SetHeader("Accept", projectMediaType).SetResult(&version)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to get project version %s", versionURL)
+	}
+	if !resp.IsSuccess() || version == nil {
+		return errors.Errorf("unable to get project version %s: bad status code %d", versionURL, resp.StatusCode())
+	}
+
+	version["phase"] = PhaseArchived
+	resp, err = c.send(resty.MethodPut, versionURL, func(request *resty.Request) *resty.Request {
+		return request.SetHeader("Content-Type", projectMediaType).SetBody(version)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to archive project version %s", versionURL)
+	}
+	if !resp.IsSuccess() {
+		return errors.Errorf("unable to archive project version %s: bad status code %d: %s", versionURL, resp.StatusCode(), resp.String())
+	}
+	log.Debugf("archived project version %s", versionURL)
+	return nil
+}
+
+// PolicyStatus is the policy status of a project version, with the number of components by status
+type PolicyStatus struct {
+	OverallStatus                string              `json:"overallStatus"`
+	ComponentVersionStatusCounts []PolicyStatusCount `json:"componentVersionStatusCounts"`
+}
+
+// PolicyStatusCount is the number of components with a policy status, i.e.: IN_VIOLATION
+type PolicyStatusCount struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+// Count is the number of components with a policy status
+func (s *PolicyStatus) Count(status string) int {
+	for _, count := range s.ComponentVersionStatusCounts {
+		if count.Name == status {
+			return count.Value
+		}
+	}
+	return 0
+}
+
+// FindProjectVersion finds a version by the names of the project and the version; nil if either doesn't exist
+func (c *Client) FindProjectVersion(projectName, versionName string) (*ProjectVersion, error) {
+	var project *Project
+	err := c.getAllItemsWithQuery("/api/projects", projectMediaType, "name:"+projectName, func(item json.RawMessage) error {
+		var candidate Project
+		if err := json.Unmarshal(item, &candidate); err != nil {
+			return errors.Wrapf(err, "unable to parse project")
+		}
+		if candidate.Name == projectName {
+			project = &candidate
+		}
+		return nil
+	})
+	if err != nil || project == nil {
+		return nil, err
+	}
+
+	var version *ProjectVersion
+	err = c.getAllItemsWithQuery(project.Meta.Href+"/versions", projectMediaType, "versionName:"+versionName, func(item json.RawMessage) error {
+		var candidate ProjectVersion
+		if err := json.Unmarshal(item, &candidate); err != nil {
+			return errors.Wrapf(err, "unable to parse version of project %s", project.Meta.Href)
+		}
+		if candidate.VersionName == versionName {
+			version = &candidate
+		}
+		return nil
+	})
+	return version, err
+}
+
+// GetPolicyStatus fetches the policy status of a project version
+func (c *Client) GetPolicyStatus(versionURL string) (*PolicyStatus, error) {
+	policyStatus := &PolicyStatus{}
+	resp, err := c.send(resty.MethodGet, versionURL+"/policy-status", func(request *resty.Request) *resty.Request {
+		return request.SetHeader("Accept", bomMediaType).SetResult(policyStatus)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get policy status of project version %s", versionURL)
+	}
+	if !resp.IsSuccess() || policyStatus.OverallStatus == "" {
+		return nil, errors.Errorf("unable to get policy status of project version %s: bad status code %d", versionURL, resp.StatusCode())
+	}
+	return policyStatus, nil
+}
+
+// VulnerabilityCounts are the numbers of components of a project version by their highest vulnerability severity
+type VulnerabilityCounts struct {
+	Critical int `json:"CRITICAL"`
+	High     int `json:"HIGH"`
+	Medium   int `json:"MEDIUM"`
+	Low      int `json:"LOW"`
+}
+
+// ProjectVersionURL is the URL of a project version, given the URL of the version or of its components, i.e.: the
+// location detect reports
+func ProjectVersionURL(location string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(location, "/"), "/components")
+}
+
+// GetVulnerabilityCounts fetches the vulnerability risk profile of a project version, given the URL of the project
+// version or its components, i.e.: the location detect reports
+func (c *Client) GetVulnerabilityCounts(projectVersionURL string) (*VulnerabilityCounts, error) {
+	versionURL := ProjectVersionURL(projectVersionURL)
+	var riskProfile struct {
+		Categories map[string]*VulnerabilityCounts `json:"categories"`
+	}
+	resp, err := c.send(resty.MethodGet, versionURL+"/risk-profile", func(request *resty.Request) *resty.Request {
+		return request.SetHeader("Accept", bomMediaType).SetResult(&riskProfile)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get risk profile of project version %s", versionURL)
+	}
+	if !resp.IsSuccess() || riskProfile.Categories["VULNERABILITY"] == nil {
+		return nil, errors.Errorf("unable to get risk profile of project version %s: bad status code %d", versionURL, resp.StatusCode())
+	}
+	return riskProfile.Categories["VULNERABILITY"], nil
+}
+
+// VulnerableComponent is a vulnerability of a component version of a project version
+type VulnerableComponent struct {
+	ComponentName        string `json:"componentName"`
+	ComponentVersionName string `json:"componentVersionName"`
+	Vulnerability        struct {
+		VulnerabilityName string `json:"vulnerabilityName"`
+		Severity          string `json:"severity"`
+	} `json:"vulnerabilityWithRemediation"`
+}
+
+// GetVulnerableComponents fetches every vulnerability of the components of a project version, given the URL of the
+// project version or its components; a component with several vulnerabilities is listed once per vulnerability
+func (c *Client) GetVulnerableComponents(projectVersionURL string) ([]VulnerableComponent, error) {
+	vulnerableComponentsURL := ProjectVersionURL(projectVersionURL) + "/vulnerable-bom-components"
+	var vulnerableComponents []VulnerableComponent
+	err := c.getAllItems(vulnerableComponentsURL, bomMediaType, func(item json.RawMessage) error {
+		var vulnerableComponent VulnerableComponent
+		if err := json.Unmarshal(item, &vulnerableComponent); err != nil {
+			return errors.Wrapf(err, "unable to parse vulnerable component from %s", vulnerableComponentsURL)
+		}
+		vulnerableComponents = append(vulnerableComponents, vulnerableComponent)
+		return nil
+	})
+	return vulnerableComponents, err
+}
@@ -0,0 +1,60 @@
+package blackduck
+
+import (
+	"testing"
+)
+
+func TestFindProjectVersion(t *testing.T) {
+	var requests []string
+	server := newTestProjectServer(t, &requests)
+	defer server.Close()
+	client := NewClient(server.URL, "api-token")
+
+	version, err := client.FindProjectVersion("shop", "nginx_1_18")
+	if err != nil || version == nil || version.Meta.Href != server.URL+"/api/projects/1/versions/2" {
+		t.Fatalf("Expected [%s], but got [%+v %+v]", server.URL+"/api/projects/1/versions/2", version, err)
+	}
+	policyStatus, err := client.GetPolicyStatus(version.Meta.Href)
+	if err != nil || policyStatus.OverallStatus != PolicyStatusInViolation || policyStatus.Count(PolicyStatusInViolation) != 2 {
+		t.Errorf("Expected 2 components [%s], but got [%+v %+v]", PolicyStatusInViolation, policyStatus, err)
+	}
+
+	// the query matches substrings, only exact names count
+	if version, err := client.FindProjectVersion("sho", "nginx_1_18"); err != nil || version != nil {
+		t.Errorf("Expected no project version, but got [%+v %+v]", version, err)
+	}
+	if version, err := client.FindProjectVersion("shop", "nginx_1"); err != nil || version != nil {
+		t.Errorf("Expected no project version, but got [%+v %+v]", version, err)
+	}
+}
+
+func TestGetVulnerabilityCounts(t *testing.T) {
+	var requests []string
+	server := newTestProjectServer(t, &requests)
+	defer server.Close()
+	client := NewClient(server.URL, "api-token")
+
+	expected := VulnerabilityCounts{Critical: 1, High: 3, Medium: 5}
+	for _, location := range []string{server.URL + "/api/projects/1/versions/2", server.URL + "/api/projects/1/versions/2/components"} {
+		counts, err := client.GetVulnerabilityCounts(location)
+		if err != nil || *counts != expected {
+			t.Errorf("Expected [%+v] for [%s], but got [%+v %+v]", expected, location, counts, err)
+		}
+	}
+}
+
+func TestGetVulnerableComponents(t *testing.T) {
+	var requests []string
+	server := newTestProjectServer(t, &requests)
+	defer server.Close()
+	client := NewClient(server.URL, "api-token")
+
+	vulnerableComponents, err := client.GetVulnerableComponents(server.URL + "/api/projects/1/versions/2/components")
+	if err != nil || len(vulnerableComponents) != 2 {
+		t.Fatalf("Expected 2 vulnerable components, but got [%+v %+v]", vulnerableComponents, err)
+	}
+	vulnerableComponent := vulnerableComponents[1]
+	if vulnerableComponent.ComponentName != "OpenSSL" || vulnerableComponent.ComponentVersionName != "1.1.1g" || vulnerableComponent.Vulnerability.VulnerabilityName != "CVE-2021-3450" || vulnerableComponent.Vulnerability.Severity != "HIGH" {
+		t.Errorf("Expected [OpenSSL 1.1.1g CVE-2021-3450 HIGH], but got [%+v]", vulnerableComponent)
+	}
+}
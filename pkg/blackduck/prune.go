@@ -0,0 +1,119 @@
+package blackduck
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	PruneActionArchive = "archive"
+	PruneActionDelete  = "delete"
+)
+
+// PrunePolicy selects the project versions which no running image corresponds to anymore
+type PrunePolicy struct {
+	// Tags select the projects to prune, a project needs to have all of them
+	Tags []string
+	// Projects and ScopeTags limit the projects to prune to the ones named for the pruned namespaces, or with one of
+	// their namespace tags; no limit if both are empty
+	Projects  []string
+	ScopeTags []string
+	// Live are the version names of the running images, by project name
+	Live map[string]map[string]bool
+	// KeepNewerThan keeps versions created recently, i.e.: by a scan which is still running
+	KeepNewerThan time.Duration
+	// Action is archive or delete; archived versions aren't archived again
+	Action string
+}
+
+// StaleVersion is a project version which no running image corresponds to anymore
+type StaleVersion struct {
+	Project Project
+	Version ProjectVersion
+}
+
+// ValidatePruneAction checks that the action is archive or delete
+func ValidatePruneAction(action string) error {
+	if action != PruneActionArchive && action != PruneActionDelete {
+		return errors.Errorf("unsupported prune action '%s', expected %s or %s", action, PruneActionArchive, PruneActionDelete)
+	}
+	return nil
+}
+
+// FindStaleVersions finds the versions of the tagged projects which are neither live nor new; Black Duck filters the
+// projects by the first tag, so that only the tags of those are fetched
+func (c *Client) FindStaleVersions(policy PrunePolicy, now time.Time) ([]StaleVersion, error) {
+	if len(policy.Tags) == 0 {
+		return nil, errors.Errorf("at least one tag is needed to select the projects to prune")
+	}
+	projects, err := c.ListProjectsWithTag(policy.Tags[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var staleVersions []StaleVersion
+	for _, project := range projects {
+		tags, err := c.GetProjectTags(project.Meta.Href)
+		if err != nil {
+			return nil, err
+		}
+		if !containsAll(tags, policy.Tags) {
+			continue
+		}
+		if (len(policy.Projects) > 0 || len(policy.ScopeTags) > 0) && !containsAny([]string{project.Name}, policy.Projects) && !containsAny(tags, policy.ScopeTags) {
+			log.Debugf("skipping project '%s' of other namespaces", project.Name)
+			continue
+		}
+		versions, err := c.ListProjectVersions(project.Meta.Href)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			switch {
+			case policy.Live[project.Name][version.VersionName]:
+				log.Debugf("keeping live version '%s' of '%s'", version.VersionName, project.Name)
+			case now.Sub(version.CreatedAt) < policy.KeepNewerThan:
+				log.Debugf("keeping version '%s' of '%s' created at %s", version.VersionName, project.Name, version.CreatedAt)
+			case policy.Action == PruneActionArchive && version.Phase == PhaseArchived:
+				log.Debugf("version '%s' of '%s' is already archived", version.VersionName, project.Name)
+			default:
+				staleVersions = append(staleVersions, StaleVersion{Project: project, Version: version})
+			}
+		}
+	}
+	return staleVersions, nil
+}
+
+// Prune archives or deletes a stale version
+func (c *Client) Prune(staleVersion StaleVersion, action string) error {
+	if action == PruneActionDelete {
+		return c.DeleteProjectVersion(staleVersion.Version.Meta.Href)
+	}
+	return c.ArchiveProjectVersion(staleVersion.Version.Meta.Href)
+}
+
+func containsAll(values, required []string) bool {
+	found := map[string]bool{}
+	for _, value := range values {
+		found[value] = true
+	}
+	for _, value := range required {
+		if !found[value] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, value := range values {
+		for _, candidate := range candidates {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
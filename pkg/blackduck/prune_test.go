@@ -0,0 +1,170 @@
+package blackduck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestProjectServer serves three projects, of which shop and blog are tagged cluster:prod; the tags of the other
+// project aren't served, since it's filtered out by the tag query
+func newTestProjectServer(t *testing.T, requests *[]string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tokens/authenticate" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"bearerToken": "bearer-token"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer bearer-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			body, _ := ioutil.ReadAll(r.Body)
+			*requests = append(*requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, body))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		items := ""
+		switch r.URL.Path {
+		case "/api/projects":
+			items = fmt.Sprintf(`{"name": "shop", "_meta": {"href": "%[1]s/api/projects/1"}}, {"name": "other", "_meta": {"href": "%[1]s/api/projects/2"}}, {"name": "blog", "_meta": {"href": "%[1]s/api/projects/3"}}`, server.URL)
+			if r.URL.Query().Get("q") == "tag:cluster:prod" {
+				items = fmt.Sprintf(`{"name": "shop", "_meta": {"href": "%[1]s/api/projects/1"}}, {"name": "blog", "_meta": {"href": "%[1]s/api/projects/3"}}`, server.URL)
+			}
+		case "/api/projects/1/tags":
+			items = `{"name": "cluster:prod"}, {"name": "namespace:shop"}`
+		case "/api/projects/3/tags":
+			items = `{"name": "cluster:prod"}, {"name": "namespace:blog"}`
+		case "/api/projects/3/versions":
+			items = fmt.Sprintf(`{"versionName": "wordpress_5_7", "phase": "DEVELOPMENT", "createdAt": "2021-03-01T00:00:00.000Z", "_meta": {"href": "%[1]s/api/projects/3/versions/1"}}`, server.URL)
+		case "/api/projects/1/versions":
+			items = fmt.Sprintf(`{"versionName": "nginx_1_19", "phase": "DEVELOPMENT", "createdAt": "2021-03-01T00:00:00.000Z", "_meta": {"href": "%[1]s/api/projects/1/versions/1"}},
+				{"versionName": "nginx_1_18", "phase": "DEVELOPMENT", "createdAt": "2021-02-01T00:00:00.000Z", "_meta": {"href": "%[1]s/api/projects/1/versions/2"}},
+				{"versionName": "nginx_1_17", "phase": "ARCHIVED", "createdAt": "2021-01-01T00:00:00.000Z", "_meta": {"href": "%[1]s/api/projects/1/versions/3"}},
+				{"versionName": "nginx_1_20", "phase": "DEVELOPMENT", "createdAt": "2021-03-09T23:00:00.000Z", "_meta": {"href": "%[1]s/api/projects/1/versions/4"}}`, server.URL)
+		case "/api/projects/1/versions/2/risk-profile":
+			w.Header().Set("Content-Type", bomMediaType)
+			w.Write([]byte(`{"categories": {"VULNERABILITY": {"CRITICAL": 1, "HIGH": 3, "MEDIUM": 5, "LOW": 0, "OK": 40, "UNKNOWN": 0}, "LICENSE": {"HIGH": 2}}}`))
+			return
+		case "/api/projects/1/versions/2/vulnerable-bom-components":
+			items = `{"componentName": "OpenSSL", "componentVersionName": "1.1.1g", "vulnerabilityWithRemediation": {"vulnerabilityName": "CVE-2021-3449", "severity": "MEDIUM"}},
+				{"componentName": "OpenSSL", "componentVersionName": "1.1.1g", "vulnerabilityWithRemediation": {"vulnerabilityName": "CVE-2021-3450", "severity": "HIGH"}}`
+		case "/api/projects/1/versions/2/policy-status":
+			w.Header().Set("Content-Type", bomMediaType)
+			w.Write([]byte(`{"overallStatus": "IN_VIOLATION", "componentVersionStatusCounts": [{"name": "IN_VIOLATION", "value": 2}, {"name": "NOT_IN_VIOLATION", "value": 40}]}`))
+			return
+		case "/api/projects/1/versions/2":
+			w.Header().Set("Content-Type", projectMediaType)
+			w.Write([]byte(`{"versionName": "nginx_1_18", "phase": "DEVELOPMENT", "distribution": "INTERNAL"}`))
+			return
+		default:
+			t.Errorf("Unexpected request: %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var page struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal([]byte(fmt.Sprintf(`{"items": [%s]}`, items)), &page); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		w.Header().Set("Content-Type", projectMediaType)
+		json.NewEncoder(w).Encode(map[string]interface{}{"totalCount": len(page.Items), "items": page.Items})
+	}))
+	return server
+}
+
+func staleVersionNames(staleVersions []StaleVersion) string {
+	var names []string
+	for _, staleVersion := range staleVersions {
+		names = append(names, staleVersion.Project.Name+"/"+staleVersion.Version.VersionName)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestFindStaleVersions(t *testing.T) {
+	var requests []string
+	server := newTestProjectServer(t, &requests)
+	defer server.Close()
+	client := NewClient(server.URL, "api-token")
+	now := time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC)
+	policy := PrunePolicy{
+		Tags:          []string{"cluster:prod"},
+		Projects:      []string{"shop"},
+		Live:          map[string]map[string]bool{"shop": {"nginx_1_19": true}},
+		KeepNewerThan: 24 * time.Hour,
+		Action:        PruneActionArchive,
+	}
+
+	staleVersions, err := client.FindStaleVersions(policy, now)
+	if err != nil || staleVersionNames(staleVersions) != "shop/nginx_1_18" {
+		t.Errorf("Expected [shop/nginx_1_18], but got [%s %+v]", staleVersionNames(staleVersions), err)
+	}
+
+	policy.Action = PruneActionDelete
+	staleVersions, err = client.FindStaleVersions(policy, now)
+	if err != nil || staleVersionNames(staleVersions) != "shop/nginx_1_17,shop/nginx_1_18" {
+		t.Errorf("Expected [shop/nginx_1_17,shop/nginx_1_18], but got [%s %+v]", staleVersionNames(staleVersions), err)
+	}
+
+	// blog shares the label with shop, but isn't live because only shop was looked at
+	policy.Projects = nil
+	staleVersions, err = client.FindStaleVersions(policy, now)
+	if err != nil || staleVersionNames(staleVersions) != "blog/wordpress_5_7,shop/nginx_1_17,shop/nginx_1_18" {
+		t.Errorf("Expected [blog/wordpress_5_7,shop/nginx_1_17,shop/nginx_1_18], but got [%s %+v]", staleVersionNames(staleVersions), err)
+	}
+	policy.ScopeTags = []string{"namespace:shop"}
+	staleVersions, err = client.FindStaleVersions(policy, now)
+	if err != nil || staleVersionNames(staleVersions) != "shop/nginx_1_17,shop/nginx_1_18" {
+		t.Errorf("Expected [shop/nginx_1_17,shop/nginx_1_18], but got [%s %+v]", staleVersionNames(staleVersions), err)
+	}
+
+	policy.Tags = []string{"cluster:prod", "namespace:other"}
+	if staleVersions, err = client.FindStaleVersions(policy, now); err != nil || len(staleVersions) != 0 {
+		t.Errorf("Expected no stale versions, but got [%s %+v]", staleVersionNames(staleVersions), err)
+	}
+
+	policy.Tags = nil
+	if _, err = client.FindStaleVersions(policy, now); err == nil {
+		t.Errorf("Expected an error without tags")
+	}
+	if len(requests) != 0 {
+		t.Errorf("Expected nothing to be changed, but got [%v]", requests)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	var requests []string
+	server := newTestProjectServer(t, &requests)
+	defer server.Close()
+	client := NewClient(server.URL, "api-token")
+	staleVersion := StaleVersion{Project: Project{Name: "shop"}, Version: ProjectVersion{VersionName: "nginx_1_18", Meta: Meta{Href: server.URL + "/api/projects/1/versions/2"}}}
+
+	if err := client.Prune(staleVersion, PruneActionArchive); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := client.Prune(staleVersion, PruneActionDelete); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := []string{
+		`PUT /api/projects/1/versions/2 {"distribution":"INTERNAL","phase":"ARCHIVED","versionName":"nginx_1_18"}`,
+		`DELETE /api/projects/1/versions/2 `,
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected [%v], but got [%v]", expected, requests)
+	}
+
+	if err := ValidatePruneAction("purge"); err == nil {
+		t.Errorf("Expected an error for an unsupported action")
+	}
+}
@@ -1,8 +1,12 @@
 package detect
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -14,137 +18,32 @@ import (
 )
 
 const (
-	// TODO: maybe makes sense to put detect script under ~/blackduck as well (other than the bootstrap problem)
-	DefaultDetectDownloadFilePath = "./detect.sh"
-	DefaultDetectURL              = "https://detect.synopsys.com/detect.sh"
-	WindowsDetectURL              = "https://detect.synopsys.com/detect.ps1"
-	// Modified from here: https://github.com/blackducksoftware/blackduck-docker-inspector/blob/9.1.1/deployment/docker/runDetectAgainstDockerServices/setup.sh
-	// TODO: keep sync'd to runDetectAgainstDockerServices.sh and/or delete that bash script
-	RunDetectAgainstDockerServicesBashScript = `
-#!/bin/bash
-
-####################################################################
-# This script demonstrates how you can use detect / docker inspector
-# such that the image inspector services get started once, and
-# re-used by each subsequent run of Detect / Docker inspector.
-# This results in much faster performance since Detect / Docker
-# Inspector doesn't start/stop the services every time.
-####################################################################
-
-####################################################################
-# ==> Adjust the value of localSharedDirPath
-# This path cannot have any symbolic links in it
-####################################################################
-localSharedDirPath=~/blackduck/shared
-imageInspectorVersion=5.0.1
-
-####################################################################
-# This script will start the imageinspector alpine service (if
-# it's not already running).
-#
-# This script will leave the alpine imageinspector service running
-# (and will re-use it on subsequent runs)
-# For troubleshooting, you might need to do a "docker logs" on
-# the imageinspector service container.
-#
-# All three "docker run" commands (starting the services) will have
-# all 3 port numbers in them, so every service knows how to find
-# every other service.
-# This allows a service to redirect requests to the other services when necessary.
-####################################################################
-
-mkdir -p ${localSharedDirPath}/target
-
-# Make sure the alpine service is running
-
-alpineServiceIsUp=false
-
-successMsgCount=$(curl http://localhost:9000/health | grep "\"status\":\"UP\"" | wc -l)
-if [ "$successMsgCount" -eq "1" ]; then
-	echo "The alpine image inspector service is up"
-	alpineServiceIsUp=true
-else
-	# Start the image inspector service for alpine on port 9000
-	docker run -d --user 1001 -p 9000:8081 --label "app=blackduck-imageinspector" --label="os=ALPINE" -v ${localSharedDirPath}:/opt/blackduck/blackduck-imageinspector/shared --name blackduck-imageinspector-alpine blackducksoftware/blackduck-imageinspector-alpine:${imageInspectorVersion} java -jar /opt/blackduck/blackduck-imageinspector/blackduck-imageinspector.jar --server.port=8081 --current.linux.distro=alpine --inspector.url.alpine=http://localhost:9000 --inspector.url.centos=http://localhost:9001 --inspector.url.ubuntu=http://localhost:9002
-fi
-
-while [ "$alpineServiceIsUp" == "false" ]; do
-	successMsgCount=$(curl http://localhost:9000/health | grep "\"status\":\"UP\"" | wc -l)
-	if [ "$successMsgCount" -eq "1" ]; then
-		echo "The alpine service is up"
-		alpineServiceIsUp=true
-		break
-	fi
-	echo "The alpine service is not up yet"
-	sleep 15
-done
-
-# Make sure the centos service is running
-
-centosServiceIsUp=false
-
-successMsgCount=$(curl http://localhost:9001/health | grep "\"status\":\"UP\"" | wc -l)
-if [ "$successMsgCount" -eq "1" ]; then
-	echo "The centos image inspector service is up"
-	centosServiceIsUp=true
-else
-	# Start the image inspector service for centos on port 9001
-	docker run -d --user 1001 -p 9001:8081 --label "app=blackduck-imageinspector" --label="os=CENTOS" -v ${localSharedDirPath}:/opt/blackduck/blackduck-imageinspector/shared --name blackduck-imageinspector-centos blackducksoftware/blackduck-imageinspector-centos:${imageInspectorVersion} java -jar /opt/blackduck/blackduck-imageinspector/blackduck-imageinspector.jar --server.port=8081 --current.linux.distro=centos --inspector.url.alpine=http://localhost:9000 --inspector.url.centos=http://localhost:9001 --inspector.url.ubuntu=http://localhost:9002
-fi
-
-while [ "$centosServiceIsUp" == "false" ]; do
-	successMsgCount=$(curl http://localhost:9001/health | grep "\"status\":\"UP\"" | wc -l)
-	if [ "$successMsgCount" -eq "1" ]; then
-		echo "The centos service is up"
-		centosServiceIsUp=true
-		break
-	fi
-	echo "The centos service is not up yet"
-	sleep 15
-done
-
-# Make sure the ubuntu service is running
-
-ubuntuServiceIsUp=false
-
-successMsgCount=$(curl http://localhost:9002/health | grep "\"status\":\"UP\"" | wc -l)
-if [ "$successMsgCount" -eq "1" ]; then
-	echo "The ubuntu image inspector service is up"
-	ubuntuServiceIsUp=true
-else
-	# Start the image inspector service for ubuntu on port 9002
-	docker run -d --user 1001 -p 9002:8081 --label "app=blackduck-imageinspector" --label="os=UBUNTU" -v ${localSharedDirPath}:/opt/blackduck/blackduck-imageinspector/shared --name blackduck-imageinspector-ubuntu blackducksoftware/blackduck-imageinspector-ubuntu:${imageInspectorVersion} java -jar /opt/blackduck/blackduck-imageinspector/blackduck-imageinspector.jar --server.port=8081 --current.linux.distro=ubuntu --inspector.url.alpine=http://localhost:9000 --inspector.url.centos=http://localhost:9001 --inspector.url.ubuntu=http://localhost:9002
-fi
-
-while [ "$ubuntuServiceIsUp" == "false" ]; do
-	successMsgCount=$(curl http://localhost:9002/health | grep "\"status\":\"UP\"" | wc -l)
-	if [ "$successMsgCount" -eq "1" ]; then
-		echo "The ubuntu service is up"
-		ubuntuServiceIsUp=true
-		break
-	fi
-	echo "The ubuntu service is not up yet"
-	sleep 15
-done
-
-# cd run
-# curl -O https://detect.synopsys.com/detect.sh
-# chmod +x detect.sh
-
-# ./detect.sh --blackduck.offline.mode=true --detect.tools.excluded=SIGNATURE_SCAN,POLARIS --detect.docker.image=alpine:latest --detect.docker.path.required=false --detect.docker.passthrough.imageinspector.service.url=http://localhost:9002 --detect.docker.passthrough.imageinspector.service.start=false --logging.level.com.synopsys.integration=INFO --detect.docker.passthrough.shared.dir.path.local=${localSharedDirPath}
-`
+	DefaultDetectURL = "https://detect.synopsys.com/detect.sh"
+	WindowsDetectURL = "https://detect.synopsys.com/detect.ps1"
+	// DetectLogFileName is the name of the file holding the output of detect in the output dir of a scan
+	DetectLogFileName = "detect.log"
 )
 
 var (
 	DefaultDetectBlackduckDirectory = fmt.Sprintf("%s/blackduck", utils.GetHomeDir())
 	DefaultToolsDirectory           = fmt.Sprintf("%s/tools", DefaultDetectBlackduckDirectory)
+	DefaultDetectDownloadFilePath   = fmt.Sprintf("%s/detect.sh", DefaultToolsDirectory)
 )
 
 type Client struct {
-	DetectPath      string
-	DetectURL       string
+	DetectPath string
+	DetectURL  string
+	// DetectVersion pins the detect version, otherwise the one pinned by `bd-xray detect update` or the latest is used
+	DetectVersion string
+	// DetectChecksum is the expected SHA-256 checksum of the detect script, otherwise the one recorded on download is used
+	DetectChecksum  string
+	ImageInspector  ImageInspectorConfig
 	RestyClient     *resty.Client
 	DockerCLIClient *docker.DockerCLIClient
+
+	// imageInspectorContainers are the IDs of the imageinspector containers the client started, which it cleans up
+	imageInspectorContainers []string
+	imageInspectorMutex      sync.Mutex
 }
 
 func NewDefaultClient() *Client {
@@ -169,12 +68,22 @@ func NewClient(detectFilePath, detectURL string) *Client {
 	return &Client{
 		DetectPath:      detectFilePath,
 		DetectURL:       detectURL,
+		ImageInspector:  NewDefaultImageInspectorConfig(),
 		RestyClient:     restyClient,
 		DockerCLIClient: dockerCLIClient,
 	}
 }
 
+// DownloadDetect downloads the detect script, verifies it against DetectChecksum and records its checksum; no checksum
+// of detect is published, so that without DetectChecksum the downloaded script is trusted
 func (c *Client) DownloadDetect() error {
+	expected, err := c.expectedChecksum()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.DetectPath), 0755); err != nil {
+		return errors.Wrapf(err, "unable to create directory for %s", c.DetectPath)
+	}
 	request := c.RestyClient.R().
 		// see: https://github.com/go-resty/resty#save-http-response-into-file
 		SetOutput(c.DetectPath)
@@ -186,14 +95,24 @@ func (c *Client) DownloadDetect() error {
 	if !resp.IsSuccess() {
 		return errors.Errorf("bad status code to path %s: %d, response %s", c.DetectURL, statusCode, respBody)
 	}
+	if expected == "" {
+		log.Warnf("detect downloaded from %s isn't verified, trusting and recording its checksum; pass --detect-checksum to verify it", c.DetectURL)
+	} else if err := c.verifyChecksum(expected); err != nil {
+		os.Remove(c.DetectPath)
+		return errors.Wrapf(err, "downloaded detect from %s", c.DetectURL)
+	}
+	if err := c.recordChecksum(); err != nil {
+		return err
+	}
 	return os.Chmod(c.DetectPath, 0755)
 }
 
+// DownloadDetectIfNotExists downloads the detect script if it's missing and verifies its checksum otherwise;
+// `bd-xray detect update` syncs it to the latest version
 func (c *Client) DownloadDetectIfNotExists() error {
 	if _, err := os.Stat(c.DetectPath); err == nil {
-		log.Debugf("detect found at %s, not downloading again, running sync recommended", c.DetectPath)
-		// TODO: sync to latest version of the specified Black Duck server, if possible
-		return nil
+		log.Debugf("detect found at %s, not downloading again, run 'bd-xray detect update' to update it", c.DetectPath)
+		return errors.Wrapf(c.VerifyDetect(), "unable to verify detect, run 'bd-xray detect update' to download it again")
 	} else if os.IsNotExist(err) {
 		log.Debugf("detect not found at %s, downloading ...", c.DetectPath)
 		// if detect not found at path, then download a fresh copy
@@ -203,12 +122,21 @@ func (c *Client) DownloadDetectIfNotExists() error {
 	}
 }
 
-func (c *Client) RunImageScan(fullImageName, projectName, imageName, imageTag, outputDirName, userSpecifiedDetectFlags string) error {
+// Project is the Black Duck project, version and code location detect reports a scan under
+type Project struct {
+	Name             string
+	VersionName      string
+	CodeLocationName string
+	Tags             []string
+	GroupName        string
+}
+
+// RunImageScan runs detect on the image, reporting it under the project; cancelling ctx kills detect and all
+// processes it started
+func (c *Client) RunImageScan(ctx context.Context, fullImageName string, project Project, outputDirName, userSpecifiedDetectFlags string) error {
 	var err error
 	log.Infof("scanning: '%s'", fullImageName)
-
-	// a unique string, but something that's human readable, i.e.: NAME_TAG
-	uniqueSanitizedString := utils.SanitizeString(fmt.Sprintf("%s_%s", imageName, imageTag))
+	log.Debugf("project: '%s', version: '%s', code location: '%s'", project.Name, project.VersionName, project.CodeLocationName)
 
 	// UNSQUASHED
 	// unsquashedImageTarFilePath := fmt.Sprintf("unsquashed_%s.tar", uniqueSanitizedString)
@@ -230,27 +158,35 @@ func (c *Client) RunImageScan(fullImageName, projectName, imageName, imageTag, o
 	defaultGlobalFlags := fmt.Sprintf("--detect.cleanup=false --blackduck.trust.cert=true --detect.tools.output.path=%s --detect.output.path=%s", DefaultToolsDirectory, outputDirName)
 	log.Tracef("default global flags: %s", defaultGlobalFlags)
 
-	var projectVersionName string
-	if 0 == len(projectName) {
-		projectName = imageName
-		projectVersionName = imageTag
-	} else {
-		projectVersionName = uniqueSanitizedString
-	}
-	codeLocationName := projectName
-
 	var cmdStr string
-	cmdStr = fmt.Sprintf("%s %s %s %s %s %s %s", c.DetectPath, defaultGlobalFlags, userSpecifiedDetectFlags, c.GetProjectNameFlag(projectName), c.GetProjectVersionNameFlag(projectVersionName), c.GetCodeLocationNameFlag(codeLocationName), c.GetPersistentDockerInspectorServicesFlags())
+	cmdStr = fmt.Sprintf("%s %s %s %s", c.DetectPath, defaultGlobalFlags, userSpecifiedDetectFlags, c.GetPersistentDockerInspectorServicesFlags())
 	cmdStr += fmt.Sprintf(" %s", c.GetDockerInspectorAndSignatureOnlyScanFlags(fullImageName))
 	// cmdStr += fmt.Sprintf(" %s", c.GetDockerInspectorScanOnlyFlags(fullImageName))
 	// cmdStr = fmt.Sprintf(" %s", c.GetAllSquashedScanFlags(squashedImageTarFilePath, fullImageName))
+	// killed together with its children by RunCommandBasedOnLoggingLevelWithContextAndLog once ctx is done
 	cmd := utils.GetExecCommandFromString(cmdStr)
+	// passed as separate arguments, since the names may contain spaces
+	cmd.Args = append(cmd.Args, c.GetProjectFlags(project)...)
+	cmd.Env = c.DetectEnv()
 
-	// NOTE: by design, we explicitly don't print out the detect output
-	err = utils.RunCommandBasedOnLoggingLevel(cmd)
+	// NOTE: by design, we explicitly don't print out the detect output, but keep it in the output dir
+	if err = os.MkdirAll(outputDirName, 0755); err != nil {
+		return errors.Wrapf(err, "unable to create output dir %s", outputDirName)
+	}
+	logFile, err := os.Create(LogFilePath(outputDirName))
+	if err != nil {
+		return errors.Wrapf(err, "unable to create detect log file in %s", outputDirName)
+	}
+	defer logFile.Close()
+	err = utils.RunCommandBasedOnLoggingLevelWithContextAndLog(ctx, cmd, logFile)
 	return err
 }
 
+// LogFilePath is the path of the file the output of detect is written to, inside the output dir of a scan
+func LogFilePath(outputDirName string) string {
+	return filepath.Join(outputDirName, DetectLogFileName)
+}
+
 // GetDetectDockerImageDefaultScanFlags: this is the default scan that detect invokes (which is just docker-inspector + squashed signature scanner)
 func (c *Client) GetDetectDockerImageDefaultScanFlags(fullImageName string) string {
 	return fmt.Sprintf("--detect.docker.image=%s --detect.tools.excluded=DETECTOR,POLARIS", fullImageName)
@@ -267,32 +203,7 @@ func (c *Client) GetDockerInspectorAndSignatureOnlyScanFlags(fullImageName strin
 // https://github.com/blackducksoftware/blackduck-docker-inspector/blob/9.1.1/deployment/docker/runDetectAgainstDockerServices/setup.sh#L111
 // https://synopsys.atlassian.net/wiki/spaces/INTDOCS/pages/760021042/Docker+Inspector+Properties
 func (c *Client) GetPersistentDockerInspectorServicesFlags() string {
-	return fmt.Sprintf("--detect.docker.path.required=false --detect.docker.passthrough.imageinspector.service.url=http://localhost:9002 --detect.docker.passthrough.imageinspector.service.start=false --detect.docker.passthrough.shared.dir.path.local=%s/blackduck/shared", utils.GetHomeDir())
-}
-
-// SetupPersistentDockerInspectorServices: sets up persistent docker services on host; goes together with GetPersistentDockerInspectorServicesFlags
-// https://github.com/blackducksoftware/blackduck-docker-inspector/blob/9.1.1/deployment/docker/runDetectAgainstDockerServices/setup.sh
-func (c *Client) SetupPersistentDockerInspectorServices() error {
-	var err error
-	// first setup docker-inspector
-	succeeded := utils.RunBash("set up persistent docker inspector services for concurrent scanning", RunDetectAgainstDockerServicesBashScript)
-	if !succeeded {
-		return errors.Errorf("error running the runDetectAgainstDockerServices script directly from golang")
-	}
-	// cmd := utils.GetExecCommandFromString(fmt.Sprintf("sh -c ../../pkg/detect/runDetectAgainstDockerServices.sh"))
-	// err = utils.RunCommandBasedOnLoggingLevel(cmd)
-	return err
-}
-
-func (c *Client) StopAndCleanupPersistentDockerInspectorServices() error {
-	var err error
-
-	succeeded := utils.RunBash("StopAndCleanupPersistentDockerInspectorServices", "docker stop blackduck-imageinspector-ubuntu blackduck-imageinspector-centos blackduck-imageinspector-alpine && docker rm blackduck-imageinspector-ubuntu blackduck-imageinspector-centos blackduck-imageinspector-alpine")
-	if !succeeded {
-		return errors.Errorf("error stopping and removing persistent docker inspector service containers")
-	}
-
-	return err
+	return fmt.Sprintf("--detect.docker.path.required=false --detect.docker.passthrough.imageinspector.service.url=%s --detect.docker.passthrough.imageinspector.service.start=false --detect.docker.passthrough.shared.dir.path.local=%s", c.ImageInspector.ServiceURL("ubuntu"), c.ImageInspector.SharedDirectory)
 }
 
 // GetConcurrentDockerInspectorScanFlags: ask inspector not to cleanup services it spins up to re-use;
@@ -335,6 +246,18 @@ func (c *Client) GetBinaryAndSignatureScanFlags(imageTarFilePath string) string
 	return fmt.Sprintf("--detect.tools=SIGNATURE_SCAN,BINARY_SCAN --detect.blackduck.signature.scanner.paths=%s --detect.binary.scan.file.path=%s", imageTarFilePath, imageTarFilePath)
 }
 
+// GetProjectFlags sets up the flags of the project, version and code location names, tags and group
+func (c *Client) GetProjectFlags(project Project) []string {
+	flags := []string{c.GetProjectNameFlag(project.Name), c.GetProjectVersionNameFlag(project.VersionName), c.GetCodeLocationNameFlag(project.CodeLocationName)}
+	if len(project.Tags) > 0 {
+		flags = append(flags, c.GetProjectTagsFlag(project.Tags))
+	}
+	if project.GroupName != "" {
+		flags = append(flags, c.GetProjectGroupNameFlag(project.GroupName))
+	}
+	return flags
+}
+
 // GetProjectNameFlag sets up the project name flag
 func (c *Client) GetProjectNameFlag(projectName string) string {
 	return fmt.Sprintf("--detect.project.name=%s", projectName)
@@ -345,6 +268,16 @@ func (c *Client) GetProjectVersionNameFlag(projectVersionName string) string {
 	return fmt.Sprintf("--detect.project.version.name=%s", projectVersionName)
 }
 
+// GetProjectTagsFlag sets up the project tags flag; tags are added to the project, existing tags are kept
+func (c *Client) GetProjectTagsFlag(tags []string) string {
+	return fmt.Sprintf("--detect.project.tags=%s", strings.Join(tags, ","))
+}
+
+// GetProjectGroupNameFlag sets up the project group name flag; the group has to exist in Black Duck
+func (c *Client) GetProjectGroupNameFlag(groupName string) string {
+	return fmt.Sprintf("--detect.project.group.name=%s", groupName)
+}
+
 // GetCodeLocationNameFlag sets up the code location name flag
 func (c *Client) GetCodeLocationNameFlag(codeLocationName string) string {
 	return fmt.Sprintf("--detect.code.location.name=%s", codeLocationName)
@@ -0,0 +1,96 @@
+package detect
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+// exit codes of detect
+const (
+	ExitCodeSuccess                         = 0
+	ExitCodeFailureBlackDuckConnectivity    = 1
+	ExitCodeFailureTimeout                  = 2
+	ExitCodeFailurePolicyViolation          = 3
+	ExitCodeFailureProxyConnectivity        = 4
+	ExitCodeFailureDetector                 = 5
+	ExitCodeFailureScan                     = 6
+	ExitCodeFailureConfiguration            = 7
+	ExitCodeFailureDetectorRequired         = 9
+	ExitCodeFailureBlackDuckVersionNotFound = 10
+	ExitCodeFailureBlackDuckFeatureError    = 11
+	ExitCodeFailureGeneralError             = 99
+	ExitCodeFailureUnknownError             = 100
+)
+
+var (
+	// transientExitCodes are failures caused by the network or an overloaded Black Duck, which may succeed when retried
+	transientExitCodes = map[int]bool{
+		ExitCodeFailureBlackDuckConnectivity: true,
+		ExitCodeFailureTimeout:               true,
+		ExitCodeFailureProxyConnectivity:     true,
+	}
+	// transientOutputRegex matches output of otherwise failed runs which points to a transient cause: image pull
+	// errors, registry rate limits, network errors and 5xx responses of Black Duck
+	transientOutputRegex = regexp.MustCompile(`(?i)(error pulling image|error response from daemon: (get|head|pull)|toomanyrequests|` +
+		`connection reset by peer|connection refused|i/o timeout|tls handshake timeout|unexpected eof|` +
+		`\b(502|503|504)\b[^\n]*(bad gateway|service unavailable|gateway time-?out)|status code:? 5[0-9]{2}\b|` +
+		`server returned 5[0-9]{2}\b)`)
+)
+
+// IsTransientScanError is true for failures of a detect run which may succeed when retried: detect timeouts and
+// connectivity failures, image pull errors, Black Duck 5xx responses and runs killed by the scan timeout; runs
+// cancelled otherwise, invalid configurations, policy violations and other failures are permanent
+func IsTransientScanError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var commandErr *utils.CommandError
+	if !errors.As(err, &commandErr) {
+		return false
+	}
+	if transientExitCodes[commandErr.ExitCode] {
+		return true
+	}
+	switch commandErr.ExitCode {
+	case ExitCodeFailureDetector, ExitCodeFailureScan, ExitCodeFailureGeneralError, ExitCodeFailureUnknownError:
+		return transientOutputRegex.MatchString(commandErr.Output)
+	}
+	return false
+}
+
+// ExitCodeOf is the exit code of a detect run: 0 on success, the exit code of detect if it failed, otherwise -1,
+// i.e.: if detect was killed by the scan timeout or could not be started
+func ExitCodeOf(err error) int {
+	if err == nil {
+		return ExitCodeSuccess
+	}
+	var commandErr *utils.CommandError
+	if errors.As(err, &commandErr) {
+		return commandErr.ExitCode
+	}
+	return -1
+}
+
+// DescribeScanError describes why a detect run failed in a few words, without the command line holding the Black
+// Duck token or the output of detect
+func DescribeScanError(err error) string {
+	var commandErr *utils.CommandError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timed out"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.As(err, &commandErr):
+		return commandErr.Err.Error()
+	}
+	return errors.Cause(err).Error()
+}
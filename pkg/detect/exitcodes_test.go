@@ -0,0 +1,57 @@
+package detect
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+func TestIsTransientScanError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"scan timeout", errors.Wrapf(context.DeadlineExceeded, "command was cancelled"), true},
+		{"cancelled", errors.Wrapf(context.Canceled, "command was cancelled"), false},
+		{"connectivity", &utils.CommandError{ExitCode: ExitCodeFailureBlackDuckConnectivity}, true},
+		{"wrapped timeout exit code", errors.Wrap(&utils.CommandError{ExitCode: ExitCodeFailureTimeout}, "scan failed"), true},
+		{"registry rate limit", &utils.CommandError{ExitCode: ExitCodeFailureGeneralError, Output: "Error response from daemon: toomanyrequests: You have reached your pull rate limit"}, true},
+		{"black duck unavailable", &utils.CommandError{ExitCode: ExitCodeFailureScan, Output: "upload failed: status code: 503"}, true},
+		{"scan failure", &utils.CommandError{ExitCode: ExitCodeFailureScan, Output: "unable to extract image"}, false},
+		{"configuration", &utils.CommandError{ExitCode: ExitCodeFailureConfiguration, Output: "connection refused"}, false},
+		{"policy violation", &utils.CommandError{ExitCode: ExitCodeFailurePolicyViolation}, false},
+		{"other error", errors.New("unable to start command"), false},
+	}
+	for _, testCase := range testCases {
+		if actual := IsTransientScanError(testCase.err); actual != testCase.expected {
+			t.Errorf("%s: Expected [%t], but got [%t]", testCase.name, testCase.expected, actual)
+		}
+	}
+}
+
+func TestExitCodeOfAndDescribeScanError(t *testing.T) {
+	commandErr := &utils.CommandError{Command: "detect.sh --blackduck.api.token=secret", ExitCode: ExitCodeFailureScan, Output: "output", Err: errors.New("exit status 6")}
+	testCases := []struct {
+		err                 error
+		expectedExitCode    int
+		expectedDescription string
+	}{
+		{nil, ExitCodeSuccess, ""},
+		{errors.Wrap(commandErr, "scan failed"), ExitCodeFailureScan, "exit status 6"},
+		{errors.Wrapf(context.DeadlineExceeded, "command 'detect.sh --blackduck.api.token=secret' was cancelled"), -1, "timed out"},
+		{errors.Wrapf(context.Canceled, "command 'detect.sh --blackduck.api.token=secret' was cancelled"), -1, "cancelled"},
+	}
+	for _, testCase := range testCases {
+		if actual := ExitCodeOf(testCase.err); actual != testCase.expectedExitCode {
+			t.Errorf("Expected [%d], but got [%d]", testCase.expectedExitCode, actual)
+		}
+		if actual := DescribeScanError(testCase.err); actual != testCase.expectedDescription {
+			t.Errorf("Expected [%s], but got [%s]", testCase.expectedDescription, actual)
+		}
+	}
+}
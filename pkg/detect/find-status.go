@@ -4,8 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"strings"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
@@ -34,46 +35,159 @@ func FindScanStatusFile(path string) (string, error) {
 	return "", nil
 }
 
+const (
+	// StatusSuccess is the status of a tool or detector which succeeded
+	StatusSuccess = "SUCCESS"
+	// StatusFailure is the status of a tool or detector which failed
+	StatusFailure = "FAILURE"
+	// ExitCodeKeySuccess is the exit code key of a successful detect run
+	ExitCodeKeySuccess = "SUCCESS"
+	// ExitCodeKeyFailurePolicyViolation is the exit code key of a run whose BOM violates a Black Duck policy
+	ExitCodeKeyFailurePolicyViolation = "FAILURE_POLICY_VIOLATION"
+)
+
+// Status is the status.json detect writes to its output dir, describing the outcome of a run
 type Status struct {
-	FormatVersion  string        `json:"formatVersion"`
-	DetectVersion  string        `json:"detectVersion"`
-	ProjectName    string        `json:"projectName"`
-	ProjectVersion string        `json:"projectVersion"`
-	Detectors      []interface{} `json:"detectors"`
-	Status         []struct {
-		Key    string `json:"key"`
-		Status string `json:"status"`
-	} `json:"status"`
-	Issues  []interface{} `json:"issues"`
-	Results []struct {
-		Location string `json:"location"`
-		Message  string `json:"message"`
-	} `json:"results"`
-	UnrecognizedPaths struct {
-	} `json:"unrecognizedPaths"`
-	CodeLocations []struct {
-		CodeLocationName string `json:"codeLocationName"`
-	} `json:"codeLocations"`
+	FormatVersion     string              `json:"formatVersion"`
+	DetectVersion     string              `json:"detectVersion"`
+	ProjectName       string              `json:"projectName"`
+	ProjectVersion    string              `json:"projectVersion"`
+	Detectors         []DetectorStatus    `json:"detectors"`
+	Status            []ToolStatus        `json:"status"`
+	OverallStatus     []ExitCodeStatus    `json:"overallStatus"`
+	Issues            []Issue             `json:"issues"`
+	Operations        []Operation         `json:"operations"`
+	Results           []Result            `json:"results"`
+	UnrecognizedPaths map[string][]string `json:"unrecognizedPaths"`
+	CodeLocations     []CodeLocation      `json:"codeLocations"`
+	PropertyValues    map[string]string   `json:"propertyValues"`
 }
 
-func ParseStatusJSONFile(path string) (*Status, error) {
-	var status Status
+// DetectorStatus is the outcome of a detector applied to a folder, i.e.: GRADLE
+type DetectorStatus struct {
+	Folder          string   `json:"folder"`
+	DetectorType    string   `json:"detectorType"`
+	DetectorName    string   `json:"detectorName"`
+	DescriptiveName string   `json:"descriptiveName"`
+	Extracted       bool     `json:"extracted"`
+	Status          string   `json:"status"`
+	StatusCode      string   `json:"statusCode"`
+	StatusReason    string   `json:"statusReason"`
+	Explanations    []string `json:"explanations"`
+	RelevantFiles   []string `json:"relevantFiles"`
+}
+
+// ToolStatus is the outcome of a tool, i.e.: DOCKER or SIGNATURE_SCAN
+type ToolStatus struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+}
+
+// ExitCodeStatus is the exit code of the run, i.e.: FAILURE_SCAN (6)
+type ExitCodeStatus struct {
+	ExitCode    int    `json:"exitCode"`
+	ExitCodeKey string `json:"exitCodeKey"`
+}
+
+// Issue is a problem detect ran into, i.e.: an exception or a deprecated property
+type Issue struct {
+	Type     string   `json:"type"`
+	Title    string   `json:"title"`
+	Messages []string `json:"messages"`
+}
+
+// Operation is a step of the run, with its start and end timestamps
+type Operation struct {
+	StartTimestamp string `json:"startTimestamp"`
+	EndTimestamp   string `json:"endTimestamp"`
+	DescriptionKey string `json:"descriptionKey"`
+	Status         string `json:"status"`
+}
+
+// Result is a result of the run, i.e.: the Black Duck URL of the project version
+type Result struct {
+	Location    string   `json:"location"`
+	Message     string   `json:"message"`
+	SubMessages []string `json:"subMessages"`
+}
 
-	jsonFile, err := os.Open(path)
+type CodeLocation struct {
+	CodeLocationName string `json:"codeLocationName"`
+}
+
+func ParseStatusJSONFile(path string) (*Status, error) {
+	byteValue, err := ioutil.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "unable to read status file %s", path)
 	}
-	defer jsonFile.Close()
+	return ParseStatusJSON(byteValue)
+}
 
-	byteValue, _ := ioutil.ReadAll(jsonFile)
-	json.Unmarshal(byteValue, &status)
+// ParseStatusJSON parses the contents of a status.json
+func ParseStatusJSON(content []byte) (*Status, error) {
+	var status Status
+	if err := json.Unmarshal(content, &status); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse status file")
+	}
+	if status.FormatVersion == "" && status.DetectVersion == "" {
+		return nil, errors.Errorf("unable to parse status file: neither formatVersion nor detectVersion found")
+	}
 	return &status, nil
 }
 
+// ExitCodeKey is the overall exit status of the run, i.e.: SUCCESS or FAILURE_SCAN; empty if detect did not report one
+func (s *Status) ExitCodeKey() string {
+	if len(s.OverallStatus) == 0 {
+		return ""
+	}
+	return s.OverallStatus[0].ExitCodeKey
+}
+
+// FailedTools are the keys of the tools which did not succeed
+func (s *Status) FailedTools() []string {
+	var failed []string
+	for _, tool := range s.Status {
+		if tool.Status != StatusSuccess {
+			failed = append(failed, tool.Key)
+		}
+	}
+	return failed
+}
+
+// Succeeded is true if the overall exit status, if reported, and all tools are successful
+func (s *Status) Succeeded() bool {
+	key := s.ExitCodeKey()
+	return (key == "" || key == ExitCodeKeySuccess) && len(s.FailedTools()) == 0
+}
+
+// FormatToolStatuses formats the status of every tool, i.e.: DOCKER: SUCCESS, SIGNATURE_SCAN: FAILURE
+func (s *Status) FormatToolStatuses() string {
+	var tools []string
+	for _, tool := range s.Status {
+		tools = append(tools, fmt.Sprintf("%s: %s", tool.Key, tool.Status))
+	}
+	return strings.Join(tools, ", ")
+}
+
+// FormatIssues formats every issue on one line, i.e.: EXCEPTION: Signature scan failed (no files found)
+func (s *Status) FormatIssues() []string {
+	var issues []string
+	for _, issue := range s.Issues {
+		line := fmt.Sprintf("%s: %s", issue.Type, issue.Title)
+		if len(issue.Messages) > 0 {
+			line = fmt.Sprintf("%s (%s)", line, strings.Join(issue.Messages, "; "))
+		}
+		issues = append(issues, line)
+	}
+	return issues
+}
+
 func FindLocationFromStatus(status *Status) []string {
 	var locations []string
 	for _, result := range status.Results {
-		locations = append(locations, result.Location)
+		if result.Location != "" {
+			locations = append(locations, result.Location)
+		}
 	}
 	return locations
 }
@@ -0,0 +1,102 @@
+package detect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseStatusJSONFileSuccess(t *testing.T) {
+	status, err := ParseStatusJSONFile("testdata/status-success.json")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !status.Succeeded() {
+		t.Errorf("Expected the scan to have succeeded, but got [%s] [%s]", status.ExitCodeKey(), status.FormatToolStatuses())
+	}
+	if status.ExitCodeKey() != ExitCodeKeySuccess {
+		t.Errorf("Expected [%s], but got [%s]", ExitCodeKeySuccess, status.ExitCodeKey())
+	}
+	expectedTools := "DOCKER: SUCCESS, SIGNATURE_SCAN: SUCCESS, BLACKDUCK_CONNECTIVITY: SUCCESS"
+	if status.FormatToolStatuses() != expectedTools {
+		t.Errorf("Expected [%s], but got [%s]", expectedTools, status.FormatToolStatuses())
+	}
+	if len(status.CodeLocations) != 2 || status.PropertyValues["detect.tools"] != "DOCKER,SIGNATURE_SCAN" {
+		t.Errorf("Expected 2 code locations and the detect.tools property, but got [%+v] [%+v]", status.CodeLocations, status.PropertyValues)
+	}
+	locations := FindLocationFromStatus(status)
+	if len(locations) != 1 || !strings.HasPrefix(locations[0], "https://blackduck.example.com/api/projects/") {
+		t.Errorf("Expected one Black Duck location, but got [%+v]", locations)
+	}
+}
+
+func TestParseStatusJSONFileToolFailure(t *testing.T) {
+	status, err := ParseStatusJSONFile("testdata/status-signature-scan-failure.json")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if status.Succeeded() {
+		t.Errorf("Expected the scan to have failed")
+	}
+	if status.ExitCodeKey() != "FAILURE_SCAN" || status.OverallStatus[0].ExitCode != ExitCodeFailureScan {
+		t.Errorf("Expected [FAILURE_SCAN %d], but got [%+v]", ExitCodeFailureScan, status.OverallStatus)
+	}
+	failed := status.FailedTools()
+	if len(failed) != 1 || failed[0] != "SIGNATURE_SCAN" {
+		t.Errorf("Expected [SIGNATURE_SCAN], but got [%+v]", failed)
+	}
+	issues := status.FormatIssues()
+	expectedIssue := "EXCEPTION: Signature scan failed (The Black Duck Signature Scanner returned an error code of 1; Response code 503 from Black Duck)"
+	if len(issues) != 1 || issues[0] != expectedIssue {
+		t.Errorf("Expected [%s], but got [%+v]", expectedIssue, issues)
+	}
+	if len(status.Detectors) != 1 || status.Detectors[0].StatusCode != "EXECUTABLE_NOT_FOUND" || len(status.UnrecognizedPaths["GIT"]) != 1 {
+		t.Errorf("Expected a failed GIT detector with an unrecognized path, but got [%+v] [%+v]", status.Detectors, status.UnrecognizedPaths)
+	}
+}
+
+func TestParseStatusJSONFileLegacy(t *testing.T) {
+	// older detect versions do not report the overall status
+	status, err := ParseStatusJSONFile("testdata/status-legacy.json")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if status.ExitCodeKey() != "" || !status.Succeeded() {
+		t.Errorf("Expected the scan to have succeeded without an exit code key, but got [%s]", status.ExitCodeKey())
+	}
+}
+
+func TestParseStatusJSONFileMalformed(t *testing.T) {
+	if _, err := ParseStatusJSONFile("testdata/status-truncated.json"); err == nil {
+		t.Errorf("Expected an error for a truncated status file")
+	}
+	if _, err := ParseStatusJSON([]byte(`{"foo": "bar"}`)); err == nil {
+		t.Errorf("Expected an error for a file which is no status file")
+	}
+	if _, err := ParseStatusJSONFile("testdata/does-not-exist.json"); err == nil {
+		t.Errorf("Expected an error for a missing status file")
+	}
+}
+
+func TestFindScanStatusFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "detect-output")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+	runDir := filepath.Join(dir, "runs", "2021-03-02-10-15-31-112")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(runDir, "status.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	path, err := FindScanStatusFile(dir)
+	expected := filepath.Join(runDir, "status.json")
+	if err != nil || path != expected {
+		t.Errorf("Expected [%s], but got [%s %+v]", expected, path, err)
+	}
+}
@@ -0,0 +1,305 @@
+package detect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultImageInspectorVersion is the version of the blackducksoftware/blackduck-imageinspector-* images
+	DefaultImageInspectorVersion = "5.0.1"
+	// DefaultImageInspectorBasePort is the host port of the alpine service; centos and ubuntu use the next two ports
+	DefaultImageInspectorBasePort = 9000
+	// DefaultImageInspectorHealthTimeout is how long to wait for the services to become healthy
+	DefaultImageInspectorHealthTimeout = 5 * time.Minute
+	// ImageInspectorAppLabel is the value of the app label of all imageinspector containers
+	ImageInspectorAppLabel = "blackduck-imageinspector"
+
+	imageInspectorContainerPort = "8081/tcp"
+	imageInspectorSharedDir     = "/opt/blackduck/blackduck-imageinspector/shared"
+	imageInspectorUser          = "1001"
+)
+
+var (
+	DefaultImageInspectorSharedDirectory = fmt.Sprintf("%s/shared", DefaultDetectBlackduckDirectory)
+	// healthCheckInterval is the wait between health checks of a starting service
+	healthCheckInterval = 2 * time.Second
+	healthClient        = &http.Client{Timeout: 5 * time.Second}
+)
+
+// ImageInspectorConfig configures the persistent imageinspector services which docker inspector uses for scanning,
+// see https://blackducksoftware.github.io/blackduck-docker-inspector/latest/deployment/#deployment-sample-for-docker-using-persistent-image-inspector-services
+type ImageInspectorConfig struct {
+	Version         string
+	BasePort        int
+	SharedDirectory string
+	HealthTimeout   time.Duration
+}
+
+// NewDefaultImageInspectorConfig returns the default imageinspector config
+func NewDefaultImageInspectorConfig() ImageInspectorConfig {
+	return ImageInspectorConfig{
+		Version:         DefaultImageInspectorVersion,
+		BasePort:        DefaultImageInspectorBasePort,
+		SharedDirectory: DefaultImageInspectorSharedDirectory,
+		HealthTimeout:   DefaultImageInspectorHealthTimeout,
+	}
+}
+
+// ImageInspectorService is one imageinspector service, there is one per linux distro
+type ImageInspectorService struct {
+	Distro string
+	Port   int
+}
+
+// Services are the alpine, centos and ubuntu services on consecutive ports starting at BasePort
+func (c ImageInspectorConfig) Services() []ImageInspectorService {
+	return []ImageInspectorService{
+		{Distro: "alpine", Port: c.BasePort},
+		{Distro: "centos", Port: c.BasePort + 1},
+		{Distro: "ubuntu", Port: c.BasePort + 2},
+	}
+}
+
+// ServiceURL is the URL of the service for distro, i.e.: http://localhost:9002 for ubuntu
+func (c ImageInspectorConfig) ServiceURL(distro string) string {
+	for _, service := range c.Services() {
+		if service.Distro == distro {
+			return fmt.Sprintf("http://localhost:%d", service.Port)
+		}
+	}
+	return ""
+}
+
+// ContainerName is the name of the container of the service in the version of config, i.e.:
+// blackduck-imageinspector-alpine-5.0.1-9000, so that services of other versions or ports don't collide with it
+func (s ImageInspectorService) ContainerName(config ImageInspectorConfig) string {
+	return fmt.Sprintf("%s-%s-%s-%d", ImageInspectorAppLabel, s.Distro, config.Version, s.Port)
+}
+
+// Image is the image of the service in the version of config
+func (s ImageInspectorService) Image(config ImageInspectorConfig) string {
+	return fmt.Sprintf("blackducksoftware/%s-%s:%s", ImageInspectorAppLabel, s.Distro, config.Version)
+}
+
+// Labels identify the container of the service, so that running containers can be reused
+func (s ImageInspectorService) Labels() map[string]string {
+	return map[string]string{"app": ImageInspectorAppLabel, "os": strings.ToUpper(s.Distro)}
+}
+
+// containerConfig makes every service aware of all services, so that a service can redirect requests to the
+// service of the distro of the image
+func (s ImageInspectorService) containerConfig(config ImageInspectorConfig) (*container.Config, *container.HostConfig) {
+	cmd := []string{
+		"java", "-jar", "/opt/blackduck/blackduck-imageinspector/blackduck-imageinspector.jar",
+		"--server.port=8081",
+		fmt.Sprintf("--current.linux.distro=%s", s.Distro),
+	}
+	for _, service := range config.Services() {
+		cmd = append(cmd, fmt.Sprintf("--inspector.url.%s=%s", service.Distro, config.ServiceURL(service.Distro)))
+	}
+	return &container.Config{
+		Image:        s.Image(config),
+		User:         imageInspectorUser,
+		Labels:       s.Labels(),
+		Cmd:          cmd,
+		ExposedPorts: nat.PortSet{imageInspectorContainerPort: struct{}{}},
+	}, &container.HostConfig{
+		Binds:        []string{fmt.Sprintf("%s:%s", config.SharedDirectory, imageInspectorSharedDir)},
+		PortBindings: nat.PortMap{imageInspectorContainerPort: []nat.PortBinding{{HostPort: fmt.Sprintf("%d", s.Port)}}},
+	}
+}
+
+// matches is true if the container runs the image of the service and is named after or publishes the port of the
+// service; stopped containers don't publish their ports
+func (s ImageInspectorService) matches(config ImageInspectorConfig, c types.Container) bool {
+	if c.Image != s.Image(config) {
+		return false
+	}
+	for _, name := range c.Names {
+		if strings.TrimPrefix(name, "/") == s.ContainerName(config) {
+			return true
+		}
+	}
+	return s.publishes(c)
+}
+
+// publishes is true if the container publishes the port of the service
+func (s ImageInspectorService) publishes(c types.Container) bool {
+	for _, port := range c.Ports {
+		if int(port.PublicPort) == s.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupPersistentDockerInspectorServices starts the imageinspector services, reusing running containers of the same
+// version and port, and waits until all of them are healthy; goes together with GetPersistentDockerInspectorServicesFlags
+func (c *Client) SetupPersistentDockerInspectorServices() error {
+	config := c.ImageInspector
+	if err := os.MkdirAll(fmt.Sprintf("%s/target", config.SharedDirectory), 0755); err != nil {
+		return errors.Wrapf(err, "unable to create shared directory %s", config.SharedDirectory)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.HealthTimeout)
+	defer cancel()
+
+	services := config.Services()
+	errs := make([]error, len(services))
+	var wg sync.WaitGroup
+	for idx, service := range services {
+		wg.Add(1)
+		go func(idx int, service ImageInspectorService) {
+			defer wg.Done()
+			errs[idx] = c.setupImageInspectorService(ctx, service)
+		}(idx, service)
+	}
+	wg.Wait()
+
+	var failed []string
+	for idx, err := range errs {
+		if err != nil {
+			log.Errorf("imageinspector %s service failed: %+v", services[idx].Distro, err)
+			failed = append(failed, services[idx].Distro)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("imageinspector services [%s] are not healthy", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// setupImageInspectorService reuses a running container of the version and port of the service, removes a stopped one
+// and starts a new one otherwise; containers of other versions or ports are left alone, unless they take the port
+func (c *Client) setupImageInspectorService(ctx context.Context, service ImageInspectorService) error {
+	config := c.ImageInspector
+	healthURL := fmt.Sprintf("%s/health", config.ServiceURL(service.Distro))
+
+	containers, err := c.DockerCLIClient.ListContainersByLabels(ctx, service.Labels())
+	if err != nil {
+		return err
+	}
+	running := false
+	for _, existing := range containers {
+		if !service.matches(config, existing) {
+			if existing.State == "running" && service.publishes(existing) {
+				return errors.Errorf("port %d is taken by imageinspector %s container %s of image %s, stop it or use another port", service.Port, service.Distro, shortID(existing.ID), existing.Image)
+			}
+			continue
+		}
+		if existing.State == "running" {
+			log.Infof("imageinspector %s container %s is running on port %d, reusing it", service.Distro, shortID(existing.ID), service.Port)
+			running = true
+			continue
+		}
+		log.Infof("removing stale imageinspector %s container %s (%s, %s)", service.Distro, shortID(existing.ID), existing.Image, existing.State)
+		if err := c.DockerCLIClient.DeleteContainerByName(existing.ID); err != nil {
+			return err
+		}
+	}
+
+	if !running {
+		if isHealthy(healthURL) {
+			return errors.Errorf("port %d is taken by a service which isn't an imageinspector %s container of version %s, stop it or use another port", service.Port, service.Distro, config.Version)
+		}
+		if err := c.DockerCLIClient.PullDockerImageIfNotPresent(ctx, service.Image(config)); err != nil {
+			return err
+		}
+		containerConfig, hostConfig := service.containerConfig(config)
+		id, err := c.DockerCLIClient.RunContainer(ctx, service.ContainerName(config), containerConfig, hostConfig)
+		if err != nil {
+			return err
+		}
+		c.imageInspectorMutex.Lock()
+		c.imageInspectorContainers = append(c.imageInspectorContainers, id)
+		c.imageInspectorMutex.Unlock()
+		log.Infof("started imageinspector %s container %s on port %d", service.Distro, shortID(id), service.Port)
+	}
+
+	if err := waitForHealthy(ctx, healthURL); err != nil {
+		return errors.Wrapf(err, "imageinspector %s service on port %d did not become healthy", service.Distro, service.Port)
+	}
+	log.Infof("imageinspector %s service is up on port %d", service.Distro, service.Port)
+	return nil
+}
+
+// StopAndCleanupPersistentDockerInspectorServices stops and removes the imageinspector containers this client started;
+// reused containers keep running for whoever started them
+func (c *Client) StopAndCleanupPersistentDockerInspectorServices() error {
+	c.imageInspectorMutex.Lock()
+	started := c.imageInspectorContainers
+	c.imageInspectorContainers = nil
+	c.imageInspectorMutex.Unlock()
+	if len(started) == 0 {
+		log.Debugf("no imageinspector containers were started, nothing to clean up")
+		return nil
+	}
+	var failed []string
+	for _, id := range started {
+		log.Debugf("stopping and removing imageinspector container %s", shortID(id))
+		if err := c.DockerCLIClient.StopContainerByName(id); err != nil {
+			log.Warnf("%+v", err)
+		}
+		if err := c.DockerCLIClient.DeleteContainerByName(id); err != nil {
+			log.Errorf("%+v", err)
+			failed = append(failed, shortID(id))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("unable to remove imageinspector containers [%s]", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// shortID shortens a container ID the way docker does
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+func isHealthy(healthURL string) bool {
+	resp, err := healthClient.Get(healthURL)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	var health healthResponse
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&health) != nil {
+		return false
+	}
+	return health.Status == "UP"
+}
+
+// waitForHealthy polls the health endpoint until it reports UP or ctx is done
+func waitForHealthy(ctx context.Context, healthURL string) error {
+	for {
+		if isHealthy(healthURL) {
+			return nil
+		}
+		log.Debugf("%s is not up yet", healthURL)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(healthCheckInterval):
+		}
+	}
+}
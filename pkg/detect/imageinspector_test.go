@@ -0,0 +1,90 @@
+package detect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestImageInspectorContainerConfig(t *testing.T) {
+	config := ImageInspectorConfig{Version: "5.1.0", BasePort: 9100, SharedDirectory: "/tmp/shared"}
+	ubuntu := config.Services()[2]
+	containerConfig, hostConfig := ubuntu.containerConfig(config)
+	if containerConfig.Image != "blackducksoftware/blackduck-imageinspector-ubuntu:5.1.0" {
+		t.Errorf("Expected [blackducksoftware/blackduck-imageinspector-ubuntu:5.1.0], but got [%s]", containerConfig.Image)
+	}
+	if binding := hostConfig.PortBindings[imageInspectorContainerPort]; len(binding) != 1 || binding[0].HostPort != "9102" {
+		t.Errorf("Expected host port [9102], but got [%+v]", binding)
+	}
+	expectedArg := "--inspector.url.alpine=http://localhost:9100"
+	found := false
+	for _, arg := range containerConfig.Cmd {
+		found = found || arg == expectedArg
+	}
+	if !found {
+		t.Errorf("Expected [%s] in [%v]", expectedArg, containerConfig.Cmd)
+	}
+	if url := config.ServiceURL("ubuntu"); url != "http://localhost:9102" {
+		t.Errorf("Expected [http://localhost:9102], but got [%s]", url)
+	}
+}
+
+func TestImageInspectorServiceMatches(t *testing.T) {
+	config := NewDefaultImageInspectorConfig()
+	alpine := config.Services()[0]
+	existing := types.Container{Image: alpine.Image(config), Ports: []types.Port{{PrivatePort: 8081, PublicPort: 9000}}}
+	if !alpine.matches(config, existing) {
+		t.Errorf("Expected container [%+v] to match", existing)
+	}
+	stopped := types.Container{Image: alpine.Image(config), Names: []string{"/blackduck-imageinspector-alpine-5.0.1-9000"}, State: "exited"}
+	if !alpine.matches(config, stopped) {
+		t.Errorf("Expected stopped container [%+v] to match by its name", stopped)
+	}
+	existing.Image = "blackducksoftware/blackduck-imageinspector-alpine:4.0.0"
+	if alpine.matches(config, existing) || !alpine.publishes(existing) {
+		t.Errorf("Expected container of another version on the port not to match, but to publish the port")
+	}
+	otherPort := types.Container{Image: alpine.Image(config), Names: []string{"/blackduck-imageinspector-alpine-5.0.1-9100"}, Ports: []types.Port{{PrivatePort: 8081, PublicPort: 9100}}}
+	if alpine.matches(config, otherPort) || alpine.publishes(otherPort) {
+		t.Errorf("Expected container on another port not to match")
+	}
+}
+
+func TestCleanupOnlyStartedContainers(t *testing.T) {
+	// without a docker client any attempt to remove a container would panic
+	client := &Client{ImageInspector: NewDefaultImageInspectorConfig()}
+	if err := client.StopAndCleanupPersistentDockerInspectorServices(); err != nil {
+		t.Errorf("Expected nothing to clean up without started containers, but got [%+v]", err)
+	}
+}
+
+func TestWaitForHealthy(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			fmt.Fprint(w, `{"status":"DOWN"}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"UP"}`)
+	}))
+	defer server.Close()
+	interval := healthCheckInterval
+	healthCheckInterval = time.Millisecond
+	defer func() { healthCheckInterval = interval }()
+
+	if err := waitForHealthy(context.Background(), server.URL); err != nil {
+		t.Errorf("Expected the service to become healthy, but got [%+v]", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := waitForHealthy(ctx, "http://127.0.0.1:1/health"); err == nil {
+		t.Errorf("Expected a timeout for a service which never becomes healthy")
+	}
+}
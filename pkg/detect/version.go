@@ -0,0 +1,262 @@
+package detect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+)
+
+const (
+	// DetectVersionEnv makes detect.sh download and run a specific detect version instead of the latest
+	DetectVersionEnv = "DETECT_LATEST_RELEASE_VERSION"
+	// DetectVersionFileName holds the detect version pinned by `bd-xray detect update`, next to the detect script
+	DetectVersionFileName = "detect.version"
+	// ChecksumFileSuffix is appended to the detect script path for the file holding its SHA-256 checksum
+	ChecksumFileSuffix = ".sha256"
+	// DetectArtifactoryURL is where detect.sh resolves version keys like DETECT_LATEST_6 to releases
+	DetectArtifactoryURL = "https://sig-repo.synopsys.com/api/storage/bds-integrations-release/com/synopsys/integration/synopsys-detect"
+)
+
+const (
+	// minimumBlackDuckYear is the release year of the oldest supported Black Duck, which is supported by detect
+	// minimumDetectMajorVersion
+	minimumBlackDuckYear      = 2019
+	minimumDetectMajorVersion = 5
+)
+
+var (
+	detectJarVersionRegex = regexp.MustCompile(`synopsys-detect-([0-9]+\.[0-9]+\.[0-9]+)\.jar$`)
+	// detectVersionKeyRegex matches the version keys of the detect major versions, i.e.: DETECT_LATEST_6
+	detectVersionKeyRegex = regexp.MustCompile(`^DETECT_LATEST_([0-9]+)$`)
+	// checksumRegex matches a SHA-256 checksum
+	checksumRegex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+// DetectVersionPath is the path of the file holding the pinned detect version
+func (c *Client) DetectVersionPath() string {
+	return filepath.Join(filepath.Dir(c.DetectPath), DetectVersionFileName)
+}
+
+// ResolveDetectVersion is the version passed with --detect-version, otherwise the one pinned by `bd-xray detect update`;
+// empty means the latest
+func (c *Client) ResolveDetectVersion() string {
+	if c.DetectVersion != "" {
+		return c.DetectVersion
+	}
+	content, err := ioutil.ReadFile(c.DetectVersionPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("unable to read pinned detect version from %s: %+v", c.DetectVersionPath(), err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// DetectEnv is the environment detect.sh is run with, pinning the detect version if one is resolved
+func (c *Client) DetectEnv() []string {
+	env := os.Environ()
+	if version := c.ResolveDetectVersion(); version != "" {
+		log.Debugf("using detect version %s", version)
+		env = append(env, fmt.Sprintf("%s=%s", DetectVersionEnv, version))
+	}
+	return env
+}
+
+// PinDetectVersion writes the version for future scans to use, an empty version removes the pin
+func (c *Client) PinDetectVersion(version string) error {
+	if version == "" {
+		if err := os.Remove(c.DetectVersionPath()); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "unable to remove pinned detect version %s", c.DetectVersionPath())
+		}
+		return nil
+	}
+	return errors.Wrapf(ioutil.WriteFile(c.DetectVersionPath(), []byte(version+"\n"), 0644), "unable to pin detect version in %s", c.DetectVersionPath())
+}
+
+// Checksum computes the SHA-256 checksum of a file
+func Checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to open %s", path)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", errors.Wrapf(err, "unable to read %s", path)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// expectedChecksum is --detect-checksum, empty if it isn't given
+func (c *Client) expectedChecksum() (string, error) {
+	if c.DetectChecksum == "" {
+		return "", nil
+	}
+	if !checksumRegex.MatchString(c.DetectChecksum) {
+		return "", errors.Errorf("invalid SHA-256 checksum of detect '%s'", c.DetectChecksum)
+	}
+	return strings.ToLower(c.DetectChecksum), nil
+}
+
+// VerifyDetect compares the checksum of the detect script with --detect-checksum, otherwise with the one recorded
+// when it was downloaded; no checksum of detect is published, so that the checksum of a script downloaded before
+// checksums were recorded is trusted and recorded on its first use
+func (c *Client) VerifyDetect() error {
+	expected, err := c.expectedChecksum()
+	if err != nil {
+		return err
+	}
+	if expected == "" {
+		content, err := ioutil.ReadFile(c.DetectPath + ChecksumFileSuffix)
+		if os.IsNotExist(err) {
+			log.Warnf("no checksum of %s is recorded, trusting and recording its current checksum; pass --detect-checksum to verify it", c.DetectPath)
+			return c.recordChecksum()
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to read recorded checksum of %s", c.DetectPath)
+		}
+		expected = strings.TrimSpace(string(content))
+	}
+	return c.verifyChecksum(expected)
+}
+
+func (c *Client) verifyChecksum(expected string) error {
+	actual, err := Checksum(c.DetectPath)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return errors.Errorf("checksum of %s is %s, but expected %s", c.DetectPath, actual, expected)
+	}
+	return nil
+}
+
+func (c *Client) recordChecksum() error {
+	checksum, err := Checksum(c.DetectPath)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(ioutil.WriteFile(c.DetectPath+ChecksumFileSuffix, []byte(checksum+"\n"), 0644), "unable to record checksum of %s", c.DetectPath)
+}
+
+// UpdateDetect downloads the latest detect script and pins the detect version; an empty version unpins it
+func (c *Client) UpdateDetect(version string) error {
+	if err := c.DownloadDetect(); err != nil {
+		return err
+	}
+	return c.PinDetectVersion(version)
+}
+
+// GetRecommendedDetectVersion finds the detect version for the Black Duck server at blackDuckURL: the latest release
+// of the detect major version of the server's release year, or of the newest published major version if that is older
+func GetRecommendedDetectVersion(blackDuckURL, blackDuckToken string) (string, error) {
+	serverVersion, err := GetBlackDuckVersion(blackDuckURL, blackDuckToken)
+	if err != nil {
+		return "", err
+	}
+	majorVersion, err := DetectMajorVersionForBlackDuck(serverVersion)
+	if err != nil {
+		return "", err
+	}
+	properties, err := FetchDetectVersionKeys(DetectArtifactoryURL, "")
+	if err != nil {
+		return "", err
+	}
+	key, err := DetectVersionKeyFor(properties, majorVersion)
+	if err != nil {
+		return "", err
+	}
+	log.Debugf("Black Duck %s is supported by %s", serverVersion, key)
+	return detectVersionOfKey(properties, key)
+}
+
+// GetBlackDuckVersion authenticates with the API token and fetches the version of the Black Duck server
+func GetBlackDuckVersion(blackDuckURL, blackDuckToken string) (string, error) {
+	return blackduck.NewClient(blackDuckURL, blackDuckToken).GetVersion()
+}
+
+// DetectMajorVersionForBlackDuck finds the detect major version supporting a Black Duck version of the form
+// YEAR.MONTH.PATCH; detect releases a major version per Black Duck release year
+func DetectMajorVersionForBlackDuck(blackDuckVersion string) (int, error) {
+	year, err := strconv.Atoi(strings.SplitN(blackDuckVersion, ".", 2)[0])
+	if err != nil {
+		return 0, errors.Errorf("unable to parse Black Duck version '%s'", blackDuckVersion)
+	}
+	if year < minimumBlackDuckYear {
+		return 0, errors.Errorf("Black Duck version '%s' is not supported, the minimum is %d", blackDuckVersion, minimumBlackDuckYear)
+	}
+	return minimumDetectMajorVersion + year - minimumBlackDuckYear, nil
+}
+
+// DetectVersionKeyFor finds the version key of a detect major version among the published properties, falling back to
+// the newest major version published before it
+func DetectVersionKeyFor(properties map[string][]string, majorVersion int) (string, error) {
+	key, keyMajorVersion := "", 0
+	for property := range properties {
+		match := detectVersionKeyRegex.FindStringSubmatch(property)
+		if match == nil {
+			continue
+		}
+		published, err := strconv.Atoi(match[1])
+		if err != nil || published > majorVersion || published < keyMajorVersion {
+			continue
+		}
+		key, keyMajorVersion = property, published
+	}
+	if key == "" {
+		return "", errors.Errorf("no detect version key is published for detect %d", majorVersion)
+	}
+	return key, nil
+}
+
+// FetchDetectVersionKeys fetches the properties detect.sh resolves version keys with, only the one of key if it isn't
+// empty
+func FetchDetectVersionKeys(artifactoryURL, key string) (map[string][]string, error) {
+	var storage struct {
+		Properties map[string][]string `json:"properties"`
+	}
+	resp, err := resty.New().SetTimeout(60*time.Second).R().
+		SetQueryParam("properties", key).
+		SetResult(&storage).
+		Get(artifactoryURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to fetch detect version keys from %s", artifactoryURL)
+	}
+	if !resp.IsSuccess() {
+		return nil, errors.Errorf("unable to fetch detect version keys from %s: bad status code %d", artifactoryURL, resp.StatusCode())
+	}
+	return storage.Properties, nil
+}
+
+// ResolveDetectVersionKey resolves a version key, i.e.: DETECT_LATEST_6, to a release the way detect.sh does
+func ResolveDetectVersionKey(artifactoryURL, key string) (string, error) {
+	properties, err := FetchDetectVersionKeys(artifactoryURL, key)
+	if err != nil {
+		return "", err
+	}
+	return detectVersionOfKey(properties, key)
+}
+
+func detectVersionOfKey(properties map[string][]string, key string) (string, error) {
+	for _, jarURL := range properties[key] {
+		if match := detectJarVersionRegex.FindStringSubmatch(jarURL); match != nil {
+			return match[1], nil
+		}
+	}
+	return "", errors.Errorf("no detect release found for version key %s", key)
+}
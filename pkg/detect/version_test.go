@@ -0,0 +1,200 @@
+package detect
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestDetectMajorVersionForBlackDuck(t *testing.T) {
+	for blackDuckVersion, expected := range map[string]int{"2019.10.3": 5, "2020.8.0": 6, "2023.1.0": 9} {
+		majorVersion, err := DetectMajorVersionForBlackDuck(blackDuckVersion)
+		if err != nil || majorVersion != expected {
+			t.Errorf("Expected [%d], but got [%d %+v]", expected, majorVersion, err)
+		}
+	}
+	if _, err := DetectMajorVersionForBlackDuck("5.0.0"); err == nil {
+		t.Errorf("Expected an error for an unsupported Black Duck version")
+	}
+}
+
+func TestDetectVersionKeyFor(t *testing.T) {
+	properties := map[string][]string{
+		"DETECT_LATEST":   {"synopsys-detect-7.1.0.jar"},
+		"DETECT_LATEST_5": {"synopsys-detect-5.6.2.jar"},
+		"DETECT_LATEST_6": {"synopsys-detect-6.9.1.jar"},
+		"DETECT_LATEST_7": {"synopsys-detect-7.1.0.jar"},
+	}
+	// newer major versions than the published ones fall back to the newest published
+	for majorVersion, expected := range map[int]string{5: "DETECT_LATEST_5", 6: "DETECT_LATEST_6", 9: "DETECT_LATEST_7"} {
+		key, err := DetectVersionKeyFor(properties, majorVersion)
+		if err != nil || key != expected {
+			t.Errorf("Expected [%s], but got [%s %+v]", expected, key, err)
+		}
+	}
+	if _, err := DetectVersionKeyFor(properties, 4); err == nil {
+		t.Errorf("Expected an error for an unpublished major version")
+	}
+}
+
+func TestResolveDetectVersionKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("properties")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"properties": map[string][]string{key: {"https://sig-repo.synopsys.com/bds-integrations-release/com/synopsys/integration/synopsys-detect/6.5.0/synopsys-detect-6.5.0.jar"}},
+		})
+	}))
+	defer server.Close()
+
+	version, err := ResolveDetectVersionKey(server.URL, "DETECT_LATEST_6")
+	if err != nil || version != "6.5.0" {
+		t.Errorf("Expected [6.5.0], but got [%s %+v]", version, err)
+	}
+}
+
+func TestVerifyDetectAndPinnedVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "detect")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &Client{DetectPath: filepath.Join(dir, "detect.sh")}
+	if err := ioutil.WriteFile(client.DetectPath, []byte("#!/bin/bash\n"), 0755); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := client.recordChecksum(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := client.VerifyDetect(); err != nil {
+		t.Errorf("Expected the recorded checksum to match, but got [%+v]", err)
+	}
+	if err := ioutil.WriteFile(client.DetectPath, []byte("#!/bin/bash\nrm -rf /\n"), 0755); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := client.VerifyDetect(); err == nil {
+		t.Errorf("Expected a modified detect script to fail verification")
+	}
+
+	if version := client.ResolveDetectVersion(); version != "" {
+		t.Errorf("Expected no pinned version, but got [%s]", version)
+	}
+	if err := client.PinDetectVersion("6.5.0"); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if version := client.ResolveDetectVersion(); version != "6.5.0" {
+		t.Errorf("Expected [6.5.0], but got [%s]", version)
+	}
+	client.DetectVersion = "6.4.0"
+	if version := client.ResolveDetectVersion(); version != "6.4.0" {
+		t.Errorf("Expected --detect-version to take precedence, but got [%s]", version)
+	}
+}
+
+// newDetectServer serves the detect script
+func newDetectServer(script string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/detect.sh" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(script))
+	}))
+}
+
+func newChecksumClient(t *testing.T, serverURL string) (*Client, func()) {
+	dir, err := ioutil.TempDir("", "detect")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	client := &Client{
+		DetectPath:  filepath.Join(dir, "detect.sh"),
+		DetectURL:   serverURL + "/detect.sh",
+		RestyClient: resty.New(),
+	}
+	return client, func() { os.RemoveAll(dir) }
+}
+
+func TestVerifyExistingDetectWithoutRecordedChecksum(t *testing.T) {
+	script := "#!/bin/bash\n"
+	client, cleanup := newChecksumClient(t, "")
+	defer cleanup()
+	if err := ioutil.WriteFile(client.DetectPath, []byte(script), 0755); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected, err := Checksum(client.DetectPath)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// a script not matching --detect-checksum fails and nothing is recorded
+	client.DetectChecksum = strings.Repeat("0", 64)
+	if err := client.VerifyDetect(); err == nil {
+		t.Errorf("Expected a script not matching --detect-checksum to fail verification")
+	}
+	if _, err := os.Stat(client.DetectPath + ChecksumFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected no checksum to be recorded, but got [%+v]", err)
+	}
+
+	// otherwise the current checksum is trusted and recorded on first use, and verified afterwards
+	client.DetectChecksum = ""
+	err = client.VerifyDetect()
+	recorded, _ := ioutil.ReadFile(client.DetectPath + ChecksumFileSuffix)
+	if err != nil || strings.TrimSpace(string(recorded)) != expected {
+		t.Errorf("Expected the checksum [%s] to be recorded on first use, but got [%s %+v]", expected, recorded, err)
+	}
+	if err := ioutil.WriteFile(client.DetectPath, []byte(script+"rm -rf /\n"), 0755); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := client.VerifyDetect(); err == nil {
+		t.Errorf("Expected a changed script to fail verification")
+	}
+}
+
+func TestDownloadDetectVerifiesChecksum(t *testing.T) {
+	script := "#!/bin/bash\n"
+	server := newDetectServer(script)
+	defer server.Close()
+	client, cleanup := newChecksumClient(t, server.URL)
+	defer cleanup()
+
+	// without --detect-checksum the download is trusted
+	if err := client.DownloadDetect(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	checksum, err := Checksum(client.DetectPath)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := client.VerifyDetect(); err != nil {
+		t.Errorf("Expected the recorded checksum to match, but got [%+v]", err)
+	}
+
+	tampered := newDetectServer("#!/bin/bash\nrm -rf /\n")
+	defer tampered.Close()
+	client.DetectURL = tampered.URL + "/detect.sh"
+	client.DetectChecksum = strings.ToUpper(checksum)
+	if err := client.DownloadDetect(); err == nil {
+		t.Errorf("Expected a download not matching --detect-checksum to fail")
+	}
+	if _, err := os.Stat(client.DetectPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the tampered script to be removed, but got [%+v]", err)
+	}
+
+	client.DetectURL = server.URL + "/detect.sh"
+	if err := client.DownloadDetect(); err != nil {
+		t.Errorf("Expected the download to match --detect-checksum, but got [%+v]", err)
+	}
+	client.DetectChecksum = "not-a-checksum"
+	if err := client.DownloadDetect(); err == nil {
+		t.Errorf("Expected an error for an invalid --detect-checksum")
+	}
+}
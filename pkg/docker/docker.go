@@ -2,10 +2,15 @@ package docker
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 
 	"github.com/aquasecurity/fanal/image/daemon"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -105,20 +110,85 @@ func (cli *DockerCLIClient) PullDockerImage(image string) error {
 	return err
 }
 
-// TODO: use golang client instead of docker
+// PullDockerImageWithAuth pulls an image from a registry which requires credentials
+func (cli *DockerCLIClient) PullDockerImageWithAuth(ctx context.Context, image, username, password string) error {
+	authConfig, err := json.Marshal(types.AuthConfig{Username: username, Password: password})
+	if err != nil {
+		return errors.Wrapf(err, "unable to encode registry auth")
+	}
+	log.Debugf("pulling image '%s' with registry credentials", image)
+	reader, err := cli.DockerClient.ImagePull(ctx, image, types.ImagePullOptions{
+		RegistryAuth: base64.URLEncoding.EncodeToString(authConfig),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to pull image '%s'", image)
+	}
+	defer reader.Close()
+	// the pull only completes once the progress output is consumed
+	_, err = io.Copy(ioutil.Discard, reader)
+	return errors.Wrapf(err, "unable to pull image '%s'", image)
+}
+
+// PullDockerImageIfNotPresent pulls an image from a public registry unless it's already present locally
+func (cli *DockerCLIClient) PullDockerImageIfNotPresent(ctx context.Context, image string) error {
+	if _, _, err := cli.DockerClient.ImageInspectWithRaw(ctx, image); err == nil {
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return errors.Wrapf(err, "unable to inspect image '%s'", image)
+	}
+	log.Infof("pulling image '%s'", image)
+	reader, err := cli.DockerClient.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "unable to pull image '%s'", image)
+	}
+	defer reader.Close()
+	_, err = io.Copy(ioutil.Discard, reader)
+	return errors.Wrapf(err, "unable to pull image '%s'", image)
+}
+
+// ListContainersByLabels lists the containers, including stopped ones, which have all of the labels
+func (cli *DockerCLIClient) ListContainersByLabels(ctx context.Context, labels map[string]string) ([]types.Container, error) {
+	filterArgs := filters.NewArgs()
+	for key, value := range labels {
+		filterArgs.Add("label", fmt.Sprintf("%s=%s", key, value))
+	}
+	containers, err := cli.DockerClient.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: filterArgs})
+	return containers, errors.Wrapf(err, "unable to list containers with labels %v", labels)
+}
+
+// RunContainer creates and starts a container, returning its ID
+func (cli *DockerCLIClient) RunContainer(ctx context.Context, containerName string, config *container.Config, hostConfig *container.HostConfig) (string, error) {
+	created, err := cli.DockerClient.ContainerCreate(ctx, config, hostConfig, nil, containerName)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create container '%s'", containerName)
+	}
+	for _, warning := range created.Warnings {
+		log.Warnf("container '%s': %s", containerName, warning)
+	}
+	if err := cli.DockerClient.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return "", errors.Wrapf(err, "unable to start container '%s'", containerName)
+	}
+	return created.ID, nil
+}
+
+// StopContainerByName stops a container by name or ID; a container which doesn't exist is not an error
 func (cli *DockerCLIClient) StopContainerByName(containerName string) error {
-	var err error
-	cmd := utils.GetExecCommandFromString(fmt.Sprintf("docker stop %s", containerName))
-	_, err = utils.RunCommand(cmd)
-	return err
+	err := cli.DockerClient.ContainerStop(context.Background(), containerName, nil)
+	if client.IsErrNotFound(err) {
+		log.Debugf("container '%s' not found, nothing to stop", containerName)
+		return nil
+	}
+	return errors.Wrapf(err, "unable to stop container '%s'", containerName)
 }
 
-// TODO: use golang client instead of docker
+// DeleteContainerByName removes a container by name or ID; a container which doesn't exist is not an error
 func (cli *DockerCLIClient) DeleteContainerByName(containerName string) error {
-	var err error
-	cmd := utils.GetExecCommandFromString(fmt.Sprintf("docker rm %s", containerName))
-	_, err = utils.RunCommand(cmd)
-	return err
+	err := cli.DockerClient.ContainerRemove(context.Background(), containerName, types.ContainerRemoveOptions{Force: true})
+	if client.IsErrNotFound(err) {
+		log.Debugf("container '%s' not found, nothing to remove", containerName)
+		return nil
+	}
+	return errors.Wrapf(err, "unable to remove container '%s'", containerName)
 }
 
 // func SquashDockerImage() {
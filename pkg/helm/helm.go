@@ -1,10 +1,61 @@
 package helm
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	sigsyaml "sigs.k8s.io/yaml"
+
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/yaml"
 )
 
+// Repository is a single entry of `helm repo list -o json`
+type Repository struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ChartMetadata is the subset of a Chart.yaml that we care about
+type ChartMetadata struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	AppVersion string `json:"appVersion"`
+}
+
+// IndexFile is the subset of a chart repository index.yaml that we care about
+type IndexFile struct {
+	APIVersion string                     `json:"apiVersion"`
+	Entries    map[string][]ChartMetadata `json:"entries"`
+}
+
+// ReleaseMetadata is the subset of `helm get metadata -o json` of an installed release that we care about
+type ReleaseMetadata struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Chart      string `json:"chart"`
+	Version    string `json:"version"`
+	AppVersion string `json:"appVersion"`
+}
+
+// ChartUpgrade holds the upgrade remediation for a chart, together with the images the newer version would bring in;
+// Release is set for the chart of an installed release
+type ChartUpgrade struct {
+	Release        string
+	Chart          string
+	CurrentVersion string
+	LatestVersion  string
+	Status         string
+	LatestImages   []string
+}
+
 func TemplateChart(chartURL string) (string, error) {
 	cmd := utils.GetExecCommandFromString(fmt.Sprintf("helm template temp %s", chartURL))
 	template, err := utils.RunCommand(cmd)
@@ -13,3 +64,205 @@ func TemplateChart(chartURL string) (string, error) {
 	}
 	return template, nil
 }
+
+// TemplateChartVersion renders a specific version of a chart, or the latest one if no version is given
+func TemplateChartVersion(chartURL, chartVersion string) (string, error) {
+	if chartVersion == "" {
+		return TemplateChart(chartURL)
+	}
+	cmd := utils.GetExecCommandFromString(fmt.Sprintf("helm template temp %s --version %s", chartURL, chartVersion))
+	return utils.RunCommand(cmd)
+}
+
+// ShowChart returns the Chart.yaml metadata of a chart, as resolved by helm
+func ShowChart(chartURL, chartVersion string) (*ChartMetadata, error) {
+	cmdStr := fmt.Sprintf("helm show chart %s", chartURL)
+	if chartVersion != "" {
+		cmdStr += fmt.Sprintf(" --version %s", chartVersion)
+	}
+	cmd := utils.GetExecCommandFromString(cmdStr)
+	output, err := utils.RunCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var metadata ChartMetadata
+	if err := sigsyaml.Unmarshal([]byte(output), &metadata); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse chart metadata of '%s'", chartURL)
+	}
+	return &metadata, nil
+}
+
+// GetReleaseManifest returns the manifest of an installed release; the namespace of helm is used if namespace is empty
+func GetReleaseManifest(release, namespace string) (string, error) {
+	cmd := utils.GetExecCommandFromString(fmt.Sprintf("helm get manifest %s%s", release, namespaceFlag(namespace)))
+	return utils.RunCommand(cmd)
+}
+
+// GetReleaseMetadata returns the chart and chart version of an installed release, needs helm 3.13 or later
+func GetReleaseMetadata(release, namespace string) (*ReleaseMetadata, error) {
+	cmd := utils.GetExecCommandFromString(fmt.Sprintf("helm get metadata %s -o json%s", release, namespaceFlag(namespace)))
+	output, err := utils.RunCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var metadata ReleaseMetadata
+	if err := json.Unmarshal([]byte(output), &metadata); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse the metadata of release '%s'", release)
+	}
+	if metadata.Chart == "" || metadata.Version == "" {
+		return nil, errors.Errorf("no chart found in the metadata of release '%s'", release)
+	}
+	return &metadata, nil
+}
+
+func namespaceFlag(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return fmt.Sprintf(" --namespace %s", namespace)
+}
+
+// ListRepositories returns the chart repositories configured in helm
+func ListRepositories() ([]Repository, error) {
+	cmd := utils.GetExecCommandFromString("helm repo list -o json")
+	output, err := utils.RunCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var repositories []Repository
+	if err := json.Unmarshal([]byte(output), &repositories); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse helm repositories")
+	}
+	return repositories, nil
+}
+
+// SplitChartReference splits a chart reference of the form REPO/CHART into its repository and chart name
+func SplitChartReference(chart string) (string, string, bool) {
+	parts := strings.Split(chart, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// FetchIndex downloads and parses the index.yaml of a chart repository
+func FetchIndex(repositoryURL string) (*IndexFile, error) {
+	indexURL := fmt.Sprintf("%s/index.yaml", strings.TrimSuffix(repositoryURL, "/"))
+	log.Debugf("fetching chart repository index from %s", indexURL)
+	resp, err := resty.New().SetTimeout(60 * time.Second).R().Get(indexURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "issue GET request to %s", indexURL)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, errors.Errorf("bad status code to path %s: %d", indexURL, resp.StatusCode())
+	}
+	var index IndexFile
+	if err := sigsyaml.Unmarshal(resp.Body(), &index); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse chart repository index from %s", indexURL)
+	}
+	return &index, nil
+}
+
+// FindLatestChartVersion finds the highest version of a chart in a chart repository index or returns NOTFOUND
+func (index *IndexFile) FindLatestChartVersion(chartName string) string {
+	var versions []string
+	for _, entry := range index.Entries[chartName] {
+		versions = append(versions, entry.Version)
+	}
+	return versioning.FindHighestVersionInList(versions, false)
+}
+
+// GetChartUpgrade looks up newer versions of a REPO/CHART chart reference in its repository
+// and lists the images the newest version would bring in
+func GetChartUpgrade(chart, chartVersion string, repositories []Repository) (*ChartUpgrade, error) {
+	repositoryName, chartName, ok := SplitChartReference(chart)
+	if !ok {
+		return nil, errors.Errorf("chart '%s' is not of the form REPO/CHART, unable to look up newer versions", chart)
+	}
+	var repositoryURL string
+	for _, repository := range repositories {
+		if repository.Name == repositoryName {
+			repositoryURL = repository.URL
+		}
+	}
+	if repositoryURL == "" {
+		return nil, errors.Errorf("helm repository '%s' not found, run 'helm repo add' first", repositoryName)
+	}
+
+	metadata, err := ShowChart(chart, chartVersion)
+	if err != nil {
+		return nil, err
+	}
+	index, err := FetchIndex(repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	upgrade := &ChartUpgrade{Chart: chart, CurrentVersion: metadata.Version}
+	if err := upgrade.lookUpLatestVersion(index, chartName); err != nil {
+		return nil, err
+	}
+	return upgrade, nil
+}
+
+// GetReleaseUpgrade looks up newer versions of the chart of an installed release and lists the images the newest
+// version would bring in; a release doesn't record the repository of its chart, so the chart is looked up in the
+// repositories, preferring the ones which have its installed version
+func GetReleaseUpgrade(release, namespace string, repositories []Repository) (*ChartUpgrade, error) {
+	metadata, err := GetReleaseMetadata(release, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var repositoryName string
+	var index *IndexFile
+	for _, repository := range repositories {
+		repositoryIndex, err := FetchIndex(repository.URL)
+		if err != nil {
+			log.Warnf("unable to look up chart '%s' of release '%s' in repository '%s': %+v", metadata.Chart, release, repository.Name, err)
+			continue
+		}
+		if repositoryIndex.hasChartVersion(metadata.Chart, metadata.Version) {
+			repositoryName, index = repository.Name, repositoryIndex
+			break
+		}
+		if index == nil && len(repositoryIndex.Entries[metadata.Chart]) > 0 {
+			repositoryName, index = repository.Name, repositoryIndex
+		}
+	}
+	if index == nil {
+		return nil, errors.Errorf("chart '%s' of release '%s' not found in the helm repositories, run 'helm repo add' first", metadata.Chart, release)
+	}
+	upgrade := &ChartUpgrade{Release: release, Chart: fmt.Sprintf("%s/%s", repositoryName, metadata.Chart), CurrentVersion: metadata.Version}
+	if err := upgrade.lookUpLatestVersion(index, metadata.Chart); err != nil {
+		return nil, err
+	}
+	return upgrade, nil
+}
+
+func (index *IndexFile) hasChartVersion(chartName, chartVersion string) bool {
+	for _, entry := range index.Entries[chartName] {
+		if entry.Version == chartVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// lookUpLatestVersion sets the latest version of the chart in its repository index and the images it would bring in
+func (upgrade *ChartUpgrade) lookUpLatestVersion(index *IndexFile, chartName string) error {
+	upgrade.LatestVersion = index.FindLatestChartVersion(chartName)
+	if upgrade.LatestVersion == versioning.Notfound {
+		upgrade.Status = versioning.Notfound
+		return nil
+	}
+	upgrade.Status = versioning.DetermineLifeCycleStatus(upgrade.LatestVersion, upgrade.CurrentVersion)
+	if upgrade.Status == versioning.Same {
+		return nil
+	}
+
+	template, err := TemplateChartVersion(upgrade.Chart, upgrade.LatestVersion)
+	if err != nil {
+		return err
+	}
+	upgrade.LatestImages = yaml.GetImageFromYamlString(template)
+	return nil
+}
@@ -0,0 +1,206 @@
+package helm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
+)
+
+const testIndex = `apiVersion: v1
+entries:
+  nginx:
+  - name: nginx
+    version: 2.1.0
+    appVersion: 1.21.0
+  - name: nginx
+    version: 1.2.0
+    appVersion: 1.20.0
+  - name: nginx
+    version: 1.0.0
+    appVersion: 1.19.0
+  current:
+  - name: current
+    version: 1.0.0
+`
+
+// fakeHelm shows every chart at version 1.0.0, templates a deployment of the image nginx:VERSION and has the release
+// web of the chart nginx at version 1.2.0; its arguments are appended to the returned file
+const fakeHelm = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args"
+case "$1 $2 $3" in
+"get metadata web")
+  echo '{"name": "web", "namespace": "shop", "chart": "nginx", "version": "1.2.0", "appVersion": "1.20.0"}'
+  exit 0
+  ;;
+"get manifest web")
+  printf 'apiVersion: apps/v1\nkind: Deployment\nspec:\n  template:\n    spec:\n      containers:\n      - name: nginx\n        image: nginx:1.20.0\n'
+  exit 0
+  ;;
+esac
+case "$1" in
+show)
+  printf 'apiVersion: v2\nname: %s\nversion: 1.0.0\n' "$(basename "$3")"
+  ;;
+template)
+  printf 'apiVersion: apps/v1\nkind: Deployment\nspec:\n  template:\n    spec:\n      containers:\n      - name: nginx\n        image: nginx:%s\n' "$5"
+  ;;
+*)
+  exit 1
+  ;;
+esac
+`
+
+// newTestRepository serves testIndex under /charts, and counts the requests of the index
+func newTestRepository(requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/charts/index.yaml":
+			*requests++
+			w.Write([]byte(testIndex))
+		case "/broken/index.yaml":
+			w.Write([]byte("entries: [not: a map"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// useFakeHelm puts fakeHelm first on the PATH; returns the file of its arguments and a func restoring the PATH
+func useFakeHelm(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "helm")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "helm"), []byte(fakeHelm), 0755); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return filepath.Join(dir, "args"), func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFetchIndex(t *testing.T) {
+	var requests int
+	server := newTestRepository(&requests)
+	defer server.Close()
+
+	// helm lists repository URLs with or without trailing slash
+	for _, url := range []string{server.URL + "/charts", server.URL + "/charts/"} {
+		index, err := FetchIndex(url)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if len(index.Entries["nginx"]) != 3 || index.Entries["nginx"][0].AppVersion != "1.21.0" {
+			t.Errorf("Expected the 3 versions of nginx, but got [%+v]", index.Entries)
+		}
+		if latest := index.FindLatestChartVersion("nginx"); latest != "2.1.0" {
+			t.Errorf("Expected [2.1.0], but got [%s]", latest)
+		}
+		if latest := index.FindLatestChartVersion("redis"); latest != versioning.Notfound {
+			t.Errorf("Expected [%s], but got [%s]", versioning.Notfound, latest)
+		}
+	}
+
+	for _, url := range []string{server.URL + "/missing", server.URL + "/broken"} {
+		if index, err := FetchIndex(url); err == nil {
+			t.Errorf("Expected an error for %s, but got [%+v]", url, index)
+		}
+	}
+}
+
+func TestGetChartUpgrade(t *testing.T) {
+	var requests int
+	server := newTestRepository(&requests)
+	defer server.Close()
+	argsFile, restore := useFakeHelm(t)
+	defer restore()
+	repositories := []Repository{{Name: "stable", URL: "https://charts.example"}, {Name: "bitnami", URL: server.URL + "/charts"}}
+
+	upgrade, err := GetChartUpgrade("bitnami/nginx", "", repositories)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := &ChartUpgrade{Chart: "bitnami/nginx", CurrentVersion: "1.0.0", LatestVersion: "2.1.0", Status: versioning.Major, LatestImages: []string{"nginx:2.1.0"}}
+	if !reflect.DeepEqual(upgrade, expected) {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, upgrade)
+	}
+	args, err := ioutil.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expectedArgs := "show chart bitnami/nginx\ntemplate temp bitnami/nginx --version 2.1.0\n"
+	if string(args) != expectedArgs {
+		t.Errorf("Expected [%s], but got [%s]", expectedArgs, args)
+	}
+
+	// the latest version isn't templated
+	upgrade, err = GetChartUpgrade("bitnami/current", "1.0.0", repositories)
+	if err != nil || upgrade.Status != versioning.Same || len(upgrade.LatestImages) != 0 {
+		t.Errorf("Expected [%s] without images, but got [%+v %+v]", versioning.Same, upgrade, err)
+	}
+	upgrade, err = GetChartUpgrade("bitnami/redis", "", repositories)
+	if err != nil || upgrade.Status != versioning.Notfound {
+		t.Errorf("Expected [%s], but got [%+v %+v]", versioning.Notfound, upgrade, err)
+	}
+	if args, _ := ioutil.ReadFile(argsFile); strings.Count(string(args), "template") != 1 {
+		t.Errorf("Expected only bitnami/nginx to be templated, but got [%s]", args)
+	}
+	if requests != 3 {
+		t.Errorf("Expected the index to be fetched [3] times, but it was fetched [%d] times", requests)
+	}
+
+	for _, chart := range []string{"nginx", "unknown/nginx"} {
+		if upgrade, err := GetChartUpgrade(chart, "", repositories); err == nil {
+			t.Errorf("Expected an error for %s, but got [%+v]", chart, upgrade)
+		}
+	}
+}
+
+func TestGetReleaseUpgrade(t *testing.T) {
+	var requests int
+	server := newTestRepository(&requests)
+	defer server.Close()
+	argsFile, restore := useFakeHelm(t)
+	defer restore()
+	// the repository with the installed version of the chart is preferred
+	repositories := []Repository{{Name: "broken", URL: server.URL + "/broken"}, {Name: "bitnami", URL: server.URL + "/charts"}}
+
+	upgrade, err := GetReleaseUpgrade("web", "shop", repositories)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := &ChartUpgrade{Release: "web", Chart: "bitnami/nginx", CurrentVersion: "1.2.0", LatestVersion: "2.1.0", Status: versioning.Major, LatestImages: []string{"nginx:2.1.0"}}
+	if !reflect.DeepEqual(upgrade, expected) {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, upgrade)
+	}
+	args, err := ioutil.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expectedArgs := "get metadata web -o json --namespace shop\ntemplate temp bitnami/nginx --version 2.1.0\n"
+	if string(args) != expectedArgs {
+		t.Errorf("Expected [%s], but got [%s]", expectedArgs, args)
+	}
+
+	manifest, err := GetReleaseManifest("web", "")
+	if err != nil || !strings.Contains(manifest, "image: nginx:1.20.0") {
+		t.Errorf("Expected the manifest of the release, but got [%s %+v]", manifest, err)
+	}
+
+	if upgrade, err := GetReleaseUpgrade("web", "shop", repositories[:1]); err == nil {
+		t.Errorf("Expected an error for a chart in no repository, but got [%+v]", upgrade)
+	}
+	if upgrade, err := GetReleaseUpgrade("missing", "shop", repositories); err == nil {
+		t.Errorf("Expected an error for a missing release, but got [%+v]", upgrade)
+	}
+}
@@ -0,0 +1,88 @@
+package kube
+
+import "fmt"
+
+// ImageScanReportCRD is the CustomResourceDefinition of the ImageScanReports written by --write-results reports
+var ImageScanReportCRD = fmt.Sprintf(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: %[1]s.%[2]s
+spec:
+  group: %[2]s
+  scope: Namespaced
+  names:
+    kind: %[3]s
+    listKind: %[3]sList
+    plural: %[1]s
+    singular: %[4]s
+    shortNames:
+    - isr
+  versions:
+  - name: %[5]s
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              image:
+                type: string
+              digest:
+                type: string
+              workloads:
+                type: array
+                items:
+                  type: string
+          status:
+            type: object
+            properties:
+              status:
+                type: string
+              exitStatus:
+                type: string
+              blackDuckURL:
+                type: string
+              vulnerabilities:
+                type: object
+                properties:
+                  critical:
+                    type: integer
+                  high:
+                    type: integer
+                  medium:
+                    type: integer
+                  low:
+                    type: integer
+              latestTag:
+                type: string
+              scannedAt:
+                type: string
+                format: date-time
+    additionalPrinterColumns:
+    - name: Image
+      type: string
+      jsonPath: .spec.image
+    - name: Status
+      type: string
+      jsonPath: .status.status
+    - name: Exit Status
+      type: string
+      jsonPath: .status.exitStatus
+    - name: Critical
+      type: integer
+      jsonPath: .status.vulnerabilities.critical
+    - name: High
+      type: integer
+      jsonPath: .status.vulnerabilities.high
+    - name: Latest
+      type: string
+      jsonPath: .status.latestTag
+    - name: Scanned
+      type: date
+      jsonPath: .status.scannedAt
+`, ImageScanReportPlural, ResultsGroup, ImageScanReportKind, "imagescanreport", ResultsVersion)
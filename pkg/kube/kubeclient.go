@@ -2,7 +2,9 @@ package kube
 
 import (
 	"context"
+	"fmt"
 	"path"
+	"sort"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -10,8 +12,10 @@ import (
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth" // required for auth, see: https://github.com/kubernetes/client-go/tree/v0.17.3/plugin/pkg/client/auth
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
@@ -19,6 +23,7 @@ import (
 
 type Client struct {
 	Clientset *kubernetes.Clientset
+	Dynamic   dynamic.Interface
 }
 
 func PathToKubeConfig() (string, error) {
@@ -40,12 +45,22 @@ func NewClient(kubeConfigPath string) (*Client, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to build config from flags")
 	}
+	return NewClientForConfig(kubeConfig)
+}
+
+// NewClientForConfig instantiates the typed and the dynamic client, the latter for custom resources
+func NewClientForConfig(kubeConfig *rest.Config) (*Client, error) {
 	client, err := kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to instantiate client")
 	}
+	dynamicClient, err := dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to instantiate dynamic client")
+	}
 	return &Client{
 		Clientset: client,
+		Dynamic:   dynamicClient,
 	}, nil
 }
 
@@ -138,6 +153,129 @@ func (kc *Client) GetImagesFromNamespace(ctx context.Context, namespace string)
 	return imageList, nil
 }
 
+func (kc *Client) ListReplicaSets(ctx context.Context, namespace string) (*appsv1.ReplicaSetList, error) {
+	replicaSetList, err := kc.Clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	return replicaSetList, errors.Wrapf(err, "could not get a list of replicasets in namespace: '%s'", namespace)
+}
+
+// GetWorkloadsByImage finds which workloads use which image in a namespace, i.e.: Deployment/nginx; pods are
+// attributed to the workload owning them
+func (kc *Client) GetWorkloadsByImage(ctx context.Context, namespace string) (map[string][]string, error) {
+	pods, err := kc.ListPods(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	deployments, err := kc.ListDeployments(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	replicaSets, err := kc.ListReplicaSets(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return WorkloadsByImage(pods.Items, deployments.Items, replicaSets.Items), nil
+}
+
+// WorkloadsByImage maps images to the workloads using them; pods are attributed to their workload by PodWorkload
+func WorkloadsByImage(pods []corev1.Pod, deployments []appsv1.Deployment, replicaSets []appsv1.ReplicaSet) map[string][]string {
+	replicaSetOwners := map[string]string{}
+	for i := range replicaSets {
+		if owner := ControllerName(&replicaSets[i]); owner != "" {
+			replicaSetOwners[replicaSets[i].Name] = owner
+		}
+	}
+
+	workloadsByImage := map[string][]string{}
+	add := func(workload string, spec corev1.PodSpec) {
+		for _, container := range spec.Containers {
+			workloadsByImage[container.Image] = append(workloadsByImage[container.Image], workload)
+		}
+		for _, initContainer := range spec.InitContainers {
+			workloadsByImage[initContainer.Image] = append(workloadsByImage[initContainer.Image], workload)
+		}
+	}
+	for _, deployment := range deployments {
+		add(fmt.Sprintf("Deployment/%s", deployment.Name), deployment.Spec.Template.Spec)
+	}
+	for i := range pods {
+		add(PodWorkload(&pods[i], func(name string) string { return replicaSetOwners[name] }), pods[i].Spec)
+	}
+
+	for image, workloads := range workloadsByImage {
+		workloads = unique(workloads)
+		sort.Strings(workloads)
+		workloadsByImage[image] = workloads
+	}
+	return workloadsByImage
+}
+
+// ControllerName is the controller of an object as Kind/name, i.e.: Deployment/nginx, or empty if it has none
+func ControllerName(object metav1.Object) string {
+	if owner := metav1.GetControllerOf(object); owner != nil {
+		return fmt.Sprintf("%s/%s", owner.Kind, owner.Name)
+	}
+	return ""
+}
+
+// PodWorkload is the workload of a pod; pods of a ReplicaSet owned by a Deployment belong to the Deployment, other
+// owned pods to their owner, and pods without owner to themselves; replicaSetOwner looks up the owner of a ReplicaSet
+func PodWorkload(pod *corev1.Pod, replicaSetOwner func(name string) string) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return fmt.Sprintf("Pod/%s", pod.Name)
+	}
+	if owner.Kind == "ReplicaSet" {
+		if workload := replicaSetOwner(owner.Name); workload != "" {
+			return workload
+		}
+	}
+	return fmt.Sprintf("%s/%s", owner.Kind, owner.Name)
+}
+
+func (kc *Client) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	secret, err := kc.Clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	return secret, errors.Wrapf(err, "unable to get secret '%s' in ns '%s'", name, namespace)
+}
+
+// GetImagePullSecretsFromNamespace gets the docker config secrets referenced as imagePullSecrets by pods and deployments;
+// secrets that can't be read are skipped
+func (kc *Client) GetImagePullSecretsFromNamespace(ctx context.Context, namespace string) ([]*corev1.Secret, error) {
+	var secretNames []string
+	pods, err := kc.ListPods(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		for _, pullSecret := range pod.Spec.ImagePullSecrets {
+			secretNames = append(secretNames, pullSecret.Name)
+		}
+	}
+	deployments, err := kc.ListDeployments(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments.Items {
+		for _, pullSecret := range deployment.Spec.Template.Spec.ImagePullSecrets {
+			secretNames = append(secretNames, pullSecret.Name)
+		}
+	}
+
+	var secrets []*corev1.Secret
+	for _, secretName := range unique(secretNames) {
+		secret, err := kc.GetSecret(ctx, namespace, secretName)
+		if err != nil {
+			log.Warnf("skipping imagePullSecret: %+v", err)
+			continue
+		}
+		if secret.Type != corev1.SecretTypeDockerConfigJson && secret.Type != corev1.SecretTypeDockercfg {
+			log.Debugf("skipping imagePullSecret '%s' of type '%s'", secretName, secret.Type)
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
 func unique(intSlice []string) []string {
 	keys := make(map[string]bool)
 	list := []string{}
@@ -0,0 +1,51 @@
+package kube
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newOwnerReference(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func newPodSpec(images ...string) corev1.PodSpec {
+	spec := corev1.PodSpec{InitContainers: []corev1.Container{{Name: "init", Image: "busybox:1.32"}}}
+	for _, image := range images {
+		spec.Containers = append(spec.Containers, corev1.Container{Name: "main", Image: image})
+	}
+	return spec
+}
+
+func TestWorkloadsByImage(t *testing.T) {
+	deployments := []appsv1.Deployment{{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: newPodSpec("nginx:1.19")}},
+	}}
+	replicaSets := []appsv1.ReplicaSet{{ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f7", OwnerReferences: newOwnerReference("Deployment", "web")}}}
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f7-x2k9q", OwnerReferences: newOwnerReference("ReplicaSet", "web-5d8f7")}, Spec: newPodSpec("nginx:1.19")},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cache-0", OwnerReferences: newOwnerReference("StatefulSet", "cache")}, Spec: newPodSpec("redis:6.0")},
+		{ObjectMeta: metav1.ObjectMeta{Name: "debug"}, Spec: newPodSpec("nginx:1.19")},
+	}
+
+	workloadsByImage := WorkloadsByImage(pods, deployments, replicaSets)
+	expected := map[string]string{
+		"nginx:1.19":   "Deployment/web,Pod/debug",
+		"redis:6.0":    "StatefulSet/cache",
+		"busybox:1.32": "Deployment/web,Pod/debug,StatefulSet/cache",
+	}
+	if len(workloadsByImage) != len(expected) {
+		t.Errorf("Expected [%v], but got [%v]", expected, workloadsByImage)
+	}
+	for image, workloads := range expected {
+		if actual := strings.Join(workloadsByImage[image], ","); actual != workloads {
+			t.Errorf("Expected [%s] for [%s], but got [%s]", workloads, image, actual)
+		}
+	}
+}
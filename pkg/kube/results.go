@@ -0,0 +1,291 @@
+package kube
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ResultsGroup is the API group of the ImageScanReports
+	ResultsGroup          = "bd-xray.blackducksoftware.com"
+	ResultsVersion        = "v1alpha1"
+	ImageScanReportKind   = "ImageScanReport"
+	ImageScanReportPlural = "imagescanreports"
+
+	// ResultAnnotationPrefix prefixes the annotations with the results of the images of a workload
+	ResultAnnotationPrefix = "scan." + ResultsGroup + "/"
+	// ImageLabel is set on the ImageScanReports to the image they are about, made a valid label value
+	ImageLabel = ResultsGroup + "/image"
+
+	// WriteResultsAnnotations annotates the workloads with the results of their images
+	WriteResultsAnnotations = "annotations"
+	// WriteResultsReports creates an ImageScanReport per image digest and namespace
+	WriteResultsReports = "reports"
+)
+
+var (
+	// ImageScanReportResource is the resource of the ImageScanReport custom resource
+	ImageScanReportResource = schema.GroupVersionResource{Group: ResultsGroup, Version: ResultsVersion, Resource: ImageScanReportPlural}
+
+	invalidKeyCharsRegexp  = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	invalidNameCharsRegexp = regexp.MustCompile(`[^a-z0-9.-]+`)
+)
+
+// VulnerabilityCounts are the numbers of components by their highest vulnerability severity
+type VulnerabilityCounts struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+}
+
+// ScanResult is the result of the scan of an image, as it's written back to the cluster
+type ScanResult struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest,omitempty"`
+	Status string `json:"status"`
+	// ExitStatus is what detect reported, i.e.: FAILURE_POLICY_VIOLATION, or why it failed otherwise
+	ExitStatus   string `json:"exitStatus,omitempty"`
+	BlackDuckURL string `json:"blackDuckURL,omitempty"`
+	// Vulnerabilities are only known for scans uploaded to Black Duck
+	Vulnerabilities *VulnerabilityCounts `json:"vulnerabilities,omitempty"`
+	LatestTag       string               `json:"latestTag,omitempty"`
+	ScannedAt       time.Time            `json:"scannedAt"`
+	// Workloads use the image, i.e.: Deployment/nginx
+	Workloads []string `json:"workloads,omitempty"`
+}
+
+// ImageScanReportSpec is what an ImageScanReport is about: an image digest and the workloads using it
+type ImageScanReportSpec struct {
+	Image     string   `json:"image"`
+	Digest    string   `json:"digest,omitempty"`
+	Workloads []string `json:"workloads,omitempty"`
+}
+
+// ImageScanReportStatus is the result of the latest scan of the image of an ImageScanReport
+type ImageScanReportStatus struct {
+	Status          string               `json:"status"`
+	ExitStatus      string               `json:"exitStatus,omitempty"`
+	BlackDuckURL    string               `json:"blackDuckURL,omitempty"`
+	Vulnerabilities *VulnerabilityCounts `json:"vulnerabilities,omitempty"`
+	LatestTag       string               `json:"latestTag,omitempty"`
+	ScannedAt       time.Time            `json:"scannedAt"`
+}
+
+// ReportSpec is the spec of the ImageScanReport of the result
+func (r ScanResult) ReportSpec() ImageScanReportSpec {
+	return ImageScanReportSpec{Image: r.Image, Digest: r.Digest, Workloads: r.Workloads}
+}
+
+// ReportStatus is the status of the ImageScanReport of the result
+func (r ScanResult) ReportStatus() ImageScanReportStatus {
+	return ImageScanReportStatus{
+		Status:          r.Status,
+		ExitStatus:      r.ExitStatus,
+		BlackDuckURL:    r.BlackDuckURL,
+		Vulnerabilities: r.Vulnerabilities,
+		LatestTag:       r.LatestTag,
+		ScannedAt:       r.ScannedAt,
+	}
+}
+
+// ValidateWriteResults checks that the modes are annotations or reports
+func ValidateWriteResults(modes []string) error {
+	for _, mode := range modes {
+		if mode != WriteResultsAnnotations && mode != WriteResultsReports {
+			return errors.Errorf("unsupported mode '%s' to write results, expected %s or %s", mode, WriteResultsAnnotations, WriteResultsReports)
+		}
+	}
+	return nil
+}
+
+// ResultWriter writes scan results back to the cluster, as annotations of the workloads and/or ImageScanReports
+type ResultWriter struct {
+	client      *Client
+	annotations bool
+	reports     bool
+}
+
+func NewResultWriter(client *Client, modes []string) (*ResultWriter, error) {
+	if err := ValidateWriteResults(modes); err != nil {
+		return nil, err
+	}
+	writer := &ResultWriter{client: client}
+	for _, mode := range modes {
+		writer.annotations = writer.annotations || mode == WriteResultsAnnotations
+		writer.reports = writer.reports || mode == WriteResultsReports
+	}
+	return writer, nil
+}
+
+// Write annotates every workload using the image and/or creates or updates the ImageScanReport of the image; it
+// tries all of them before returning the errors
+func (w *ResultWriter) Write(ctx context.Context, namespace string, result ScanResult) error {
+	var failures []string
+	if w.annotations {
+		for _, workload := range result.Workloads {
+			if err := w.annotateWorkload(ctx, namespace, workload, result); err != nil {
+				failures = append(failures, fmt.Sprintf("%v", err))
+			}
+		}
+	}
+	if w.reports {
+		if err := w.writeReport(ctx, namespace, result); err != nil {
+			failures = append(failures, fmt.Sprintf("%v", err))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("unable to write the results of '%s' to namespace '%s': %s", result.Image, namespace, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// AnnotationKey is the key of the annotation with the result of an image; long images are shortened to fit
+func AnnotationKey(image string) string {
+	return ResultAnnotationPrefix + labelSafe(image)
+}
+
+// ReportName is the name of the ImageScanReport of an image digest, i.e.: nginx-1.19-4c0fdaa8b634
+func ReportName(image, digest string) string {
+	name := strings.Trim(invalidNameCharsRegexp.ReplaceAllString(strings.ToLower(image), "-"), "-.")
+	if digest = strings.TrimPrefix(digest, "sha256:"); len(digest) > 12 {
+		digest = digest[:12]
+	}
+	// DNS subdomains are at most 253 characters
+	if len(name) > 240 {
+		name = strings.Trim(name[len(name)-240:], "-.")
+	}
+	if digest != "" {
+		name = fmt.Sprintf("%s-%s", name, digest)
+	}
+	return name
+}
+
+// labelSafe makes a value fit the name of an annotation key or a label value: at most 63 alphanumeric characters,
+// '-', '_' or '.', starting and ending with an alphanumeric character; longer values keep their start and a hash of
+// the whole value, so they stay unique
+func labelSafe(value string) string {
+	value = strings.Trim(invalidKeyCharsRegexp.ReplaceAllString(value, "_"), "-_.")
+	if len(value) > 63 {
+		sum := sha256.Sum256([]byte(value))
+		value = strings.TrimRight(value[:50], "-_.") + "-" + hex.EncodeToString(sum[:])[:12]
+	}
+	return value
+}
+
+func (w *ResultWriter) annotateWorkload(ctx context.Context, namespace, workload string, result ScanResult) error {
+	annotated := result
+	annotated.Workloads = nil
+	value, err := json.Marshal(annotated)
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal result of '%s'", result.Image)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{AnnotationKey(result.Image): string(value)},
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal annotation patch")
+	}
+
+	parts := strings.SplitN(workload, "/", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("invalid workload '%s', expected KIND/NAME", workload)
+	}
+	kind, name := parts[0], parts[1]
+	options := metav1.PatchOptions{}
+	clientset := w.client.Clientset
+	switch kind {
+	case "Deployment":
+		_, err = clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.MergePatchType, patch, options)
+	case "StatefulSet":
+		_, err = clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.MergePatchType, patch, options)
+	case "DaemonSet":
+		_, err = clientset.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.MergePatchType, patch, options)
+	case "ReplicaSet":
+		_, err = clientset.AppsV1().ReplicaSets(namespace).Patch(ctx, name, types.MergePatchType, patch, options)
+	case "Job":
+		_, err = clientset.BatchV1().Jobs(namespace).Patch(ctx, name, types.MergePatchType, patch, options)
+	case "CronJob":
+		_, err = clientset.BatchV1beta1().CronJobs(namespace).Patch(ctx, name, types.MergePatchType, patch, options)
+	case "Pod":
+		_, err = clientset.CoreV1().Pods(namespace).Patch(ctx, name, types.MergePatchType, patch, options)
+	default:
+		return errors.Errorf("unable to annotate workload '%s', unsupported kind", workload)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "unable to annotate %s", workload)
+	}
+	log.Debugf("annotated %s in '%s' with the result of '%s'", workload, namespace, result.Image)
+	return nil
+}
+
+// writeReport creates or updates the spec of the ImageScanReport of the image, then its status, which the status
+// subresource only accepts separately
+func (w *ResultWriter) writeReport(ctx context.Context, namespace string, result ScanResult) error {
+	spec, err := toUnstructuredContent(result.ReportSpec())
+	if err != nil {
+		return errors.Wrapf(err, "unable to convert the spec of the result of '%s'", result.Image)
+	}
+	status, err := toUnstructuredContent(result.ReportStatus())
+	if err != nil {
+		return errors.Wrapf(err, "unable to convert the status of the result of '%s'", result.Image)
+	}
+
+	name := ReportName(result.Image, result.Digest)
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": ResultsGroup + "/" + ResultsVersion,
+		"kind":       ImageScanReportKind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{ImageLabel: labelSafe(result.Image)},
+		},
+		"spec": spec,
+	}}
+
+	reports := w.client.Dynamic.Resource(ImageScanReportResource).Namespace(namespace)
+	existing, err := reports.Get(ctx, name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		if object, err = reports.Create(ctx, object, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "unable to create %s '%s'", ImageScanReportKind, name)
+		}
+	} else if err != nil {
+		return errors.Wrapf(err, "unable to get %s '%s'", ImageScanReportKind, name)
+	} else {
+		object.SetResourceVersion(existing.GetResourceVersion())
+		if object, err = reports.Update(ctx, object, metav1.UpdateOptions{}); err != nil {
+			return errors.Wrapf(err, "unable to update %s '%s'", ImageScanReportKind, name)
+		}
+	}
+
+	object.Object["status"] = status
+	_, err = reports.UpdateStatus(ctx, object, metav1.UpdateOptions{})
+	return errors.Wrapf(err, "unable to update the status of %s '%s'", ImageScanReportKind, name)
+}
+
+// toUnstructuredContent converts a struct to the content of an unstructured object, by its JSON
+func toUnstructuredContent(value interface{}) (map[string]interface{}, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var unstructuredContent map[string]interface{}
+	err = json.Unmarshal(content, &unstructuredContent)
+	return unstructuredContent, err
+}
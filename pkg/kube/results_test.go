@@ -0,0 +1,211 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// fakeAPIServer records the requests it receives and answers them like an API server with one ImageScanReport
+type fakeAPIServer struct {
+	mutex    sync.Mutex
+	requests []string
+	bodies   map[string]map[string]interface{}
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	request := r.Method + " " + r.URL.Path
+	s.requests = append(s.requests, request)
+	body, _ := ioutil.ReadAll(r.Body)
+	if len(body) > 0 {
+		var object map[string]interface{}
+		json.Unmarshal(body, &object)
+		s.bodies[request] = object
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch request {
+	case "GET /apis/bd-xray.blackducksoftware.com/v1alpha1/namespaces/shop/imagescanreports/nginx-1.19-4c0fdaa8b634":
+		w.Write([]byte(`{"apiVersion":"bd-xray.blackducksoftware.com/v1alpha1","kind":"ImageScanReport","metadata":{"name":"nginx-1.19-4c0fdaa8b634","namespace":"shop","resourceVersion":"42"}}`))
+	case "GET /apis/bd-xray.blackducksoftware.com/v1alpha1/namespaces/shop/imagescanreports/redis-6.0-1f2e3d4c5b6a":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+	case "PATCH /apis/apps/v1/namespaces/shop/deployments/gone":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+	default:
+		w.Write(body)
+	}
+}
+
+func newFakeAPIServer(t *testing.T) (*fakeAPIServer, *Client, func()) {
+	fake := &fakeAPIServer{bodies: map[string]map[string]interface{}{}}
+	server := httptest.NewServer(fake)
+	client, err := NewClientForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		server.Close()
+		t.Fatalf("%+v", err)
+	}
+	return fake, client, server.Close
+}
+
+func TestResultWriterAnnotations(t *testing.T) {
+	fake, client, closeServer := newFakeAPIServer(t)
+	defer closeServer()
+	writer, err := NewResultWriter(client, []string{WriteResultsAnnotations})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	result := ScanResult{
+		Image:           "nginx:1.19",
+		Digest:          "sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac",
+		Status:          "SUCCESS",
+		BlackDuckURL:    "https://blackduck.example.com/api/projects/1/versions/2/components",
+		Vulnerabilities: &VulnerabilityCounts{Critical: 1, High: 2},
+		LatestTag:       "1.21",
+		ScannedAt:       time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+		Workloads:       []string{"Deployment/web", "CronJob/cleanup", "Pod/debug"},
+	}
+	if err := writer.Write(context.Background(), "shop", result); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	expectedRequests := []string{
+		"PATCH /apis/apps/v1/namespaces/shop/deployments/web",
+		"PATCH /apis/batch/v1beta1/namespaces/shop/cronjobs/cleanup",
+		"PATCH /api/v1/namespaces/shop/pods/debug",
+	}
+	if !reflect.DeepEqual(fake.requests, expectedRequests) {
+		t.Errorf("Expected [%v], but got [%v]", expectedRequests, fake.requests)
+	}
+	annotations := fake.bodies[expectedRequests[0]]["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	expected := `{"image":"nginx:1.19","digest":"sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac","status":"SUCCESS","blackDuckURL":"https://blackduck.example.com/api/projects/1/versions/2/components","vulnerabilities":{"critical":1,"high":2,"medium":0,"low":0},"latestTag":"1.21","scannedAt":"2021-03-01T00:00:00Z"}`
+	if annotation := annotations["scan.bd-xray.blackducksoftware.com/nginx_1.19"]; annotation != expected {
+		t.Errorf("Expected [%s], but got [%v]", expected, annotations)
+	}
+
+	// the other workloads are annotated even if one can't be
+	fake.requests = nil
+	result.Workloads = []string{"Deployment/gone", "Service/web", "StatefulSet/db"}
+	if err := writer.Write(context.Background(), "shop", result); err == nil {
+		t.Errorf("Expected an error for the missing and the unsupported workload")
+	}
+	if expected := []string{"PATCH /apis/apps/v1/namespaces/shop/deployments/gone", "PATCH /apis/apps/v1/namespaces/shop/statefulsets/db"}; !reflect.DeepEqual(fake.requests, expected) {
+		t.Errorf("Expected [%v], but got [%v]", expected, fake.requests)
+	}
+}
+
+func TestResultWriterReports(t *testing.T) {
+	fake, client, closeServer := newFakeAPIServer(t)
+	defer closeServer()
+	writer, err := NewResultWriter(client, []string{WriteResultsReports})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	scannedAt := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	results := []ScanResult{
+		{Image: "nginx:1.19", Digest: "sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac", Status: "SUCCESS", ScannedAt: scannedAt, Workloads: []string{"Deployment/web"}},
+		{Image: "redis:6.0", Digest: "sha256:1f2e3d4c5b6a7980", Status: "FAILURE_POLICY_VIOLATION", ScannedAt: scannedAt},
+	}
+	for _, result := range results {
+		if err := writer.Write(context.Background(), "shop", result); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	reports := "/apis/bd-xray.blackducksoftware.com/v1alpha1/namespaces/shop/imagescanreports"
+	expectedRequests := []string{
+		"GET " + reports + "/nginx-1.19-4c0fdaa8b634",
+		"PUT " + reports + "/nginx-1.19-4c0fdaa8b634",
+		"PUT " + reports + "/nginx-1.19-4c0fdaa8b634/status",
+		"GET " + reports + "/redis-6.0-1f2e3d4c5b6a",
+		"POST " + reports,
+		"PUT " + reports + "/redis-6.0-1f2e3d4c5b6a/status",
+	}
+	if !reflect.DeepEqual(fake.requests, expectedRequests) {
+		t.Fatalf("Expected [%v], but got [%v]", expectedRequests, fake.requests)
+	}
+
+	updated := fake.bodies[expectedRequests[1]]
+	metadata := updated["metadata"].(map[string]interface{})
+	if metadata["resourceVersion"] != "42" || metadata["labels"].(map[string]interface{})[ImageLabel] != "nginx_1.19" {
+		t.Errorf("Expected the resource version and image label to be set, but got [%v]", metadata)
+	}
+	if spec := updated["spec"].(map[string]interface{}); spec["image"] != "nginx:1.19" || !reflect.DeepEqual(spec["workloads"], []interface{}{"Deployment/web"}) || updated["status"] != nil {
+		t.Errorf("Expected the spec of nginx:1.19 without status, but got [%v]", updated)
+	}
+	if status := fake.bodies[expectedRequests[2]]["status"].(map[string]interface{}); status["status"] != "SUCCESS" || status["scannedAt"] != "2021-03-01T00:00:00Z" {
+		t.Errorf("Expected the status of nginx:1.19, but got [%v]", status)
+	}
+	created := fake.bodies[expectedRequests[4]]
+	if created["kind"] != ImageScanReportKind || created["metadata"].(map[string]interface{})["name"] != "redis-6.0-1f2e3d4c5b6a" {
+		t.Errorf("Expected the ImageScanReport of redis:6.0 to be created, but got [%v]", created)
+	}
+	if status := fake.bodies[expectedRequests[5]]["status"].(map[string]interface{}); status["status"] != "FAILURE_POLICY_VIOLATION" {
+		t.Errorf("Expected the status of redis:6.0, but got [%v]", status)
+	}
+}
+
+func TestResultNames(t *testing.T) {
+	if _, err := NewResultWriter(nil, []string{"annotations", "events"}); err == nil {
+		t.Errorf("Expected an error for an unsupported mode")
+	}
+
+	expectedKeys := map[string]string{
+		"nginx:1.19": "scan.bd-xray.blackducksoftware.com/nginx_1.19",
+		"docker.io/library/nginx@sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac": "scan.bd-xray.blackducksoftware.com/docker.io_library_nginx_sha256_4c0fdaa8b6341bfdeca-c652d48e32c6",
+	}
+	for image, expected := range expectedKeys {
+		if key := AnnotationKey(image); key != expected {
+			t.Errorf("Expected [%s], but got [%s]", expected, key)
+		}
+	}
+
+	expectedNames := map[[2]string]string{
+		{"nginx:1.19", ""}: "nginx-1.19",
+		{"gcr.io/Google-Samples/hello-app:2.0", "sha256:4c0fdaa8b6341bfdeca5"}: "gcr.io-google-samples-hello-app-2.0-4c0fdaa8b634",
+	}
+	for imageAndDigest, expected := range expectedNames {
+		if name := ReportName(imageAndDigest[0], imageAndDigest[1]); name != expected {
+			t.Errorf("Expected [%s], but got [%s]", expected, name)
+		}
+	}
+}
+
+func TestImageScanReportCRD(t *testing.T) {
+	var crd struct {
+		Kind     string
+		Metadata struct{ Name string }
+		Spec     struct {
+			Group    string
+			Versions []struct {
+				Name         string
+				Subresources struct {
+					Status *struct{} `json:"status"`
+				}
+			}
+		}
+	}
+	if err := sigsyaml.Unmarshal([]byte(ImageScanReportCRD), &crd); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if crd.Kind != "CustomResourceDefinition" || crd.Metadata.Name != "imagescanreports.bd-xray.blackducksoftware.com" || crd.Spec.Group != ResultsGroup || len(crd.Spec.Versions) != 1 || crd.Spec.Versions[0].Name != ResultsVersion {
+		t.Fatalf("Expected the CustomResourceDefinition of %s, but got [%+v]", ImageScanReportResource, crd)
+	}
+	if crd.Spec.Versions[0].Subresources.Status == nil {
+		t.Errorf("Expected the status subresource")
+	}
+}
@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// prefix namespaces the names of the metrics
+const prefix = "bd_xray"
+
+// Severities are the severities of the vulnerability counts, in the order they're exported
+var Severities = []string{"critical", "high", "medium", "low"}
+
+// imageLabelNames label every metric of an image
+var imageLabelNames = []string{"namespace", "workload", "image"}
+
+// ImageLabels identify an image running in a namespace; every metric of the image is exported once per workload using
+// it, or with an empty workload if there is none
+type ImageLabels struct {
+	Namespace string
+	Workloads []string
+	Image     string
+}
+
+func (l ImageLabels) each(f func(labelValues ...string)) {
+	if len(l.Workloads) == 0 {
+		f(l.Namespace, "", l.Image)
+		return
+	}
+	for _, workload := range l.Workloads {
+		f(l.Namespace, workload, l.Image)
+	}
+}
+
+// ImageResult is the state of an image after its latest scan, or the scan cached for its digest
+type ImageResult struct {
+	ImageLabels
+	// Failed is true if the latest scan failed; the other fields are then unknown
+	Failed bool
+	// BlackDuckURL is where the scan was uploaded to, not exported
+	BlackDuckURL string
+	// Vulnerabilities counts the components by the severity of their highest vulnerability; nil if the scan wasn't
+	// uploaded to Black Duck
+	Vulnerabilities map[string]int
+	// InViolation is only known if PolicyKnown, i.e.: for scans uploaded to Black Duck
+	InViolation bool
+	PolicyKnown bool
+	// MajorsBehind, MinorsBehind and PatchesBehind are the newer releases of the image
+	MajorsBehind   int
+	MinorsBehind   int
+	PatchesBehind  int
+	StalenessScore int
+	ScanDuration   time.Duration
+}
+
+// ScanMetrics are the metrics of the images scanned by `bd-xray serve`
+type ScanMetrics struct {
+	vulnerabilities *prometheus.GaugeVec
+	policyViolation *prometheus.GaugeVec
+	versionsBehind  *prometheus.GaugeVec
+	staleness       *prometheus.GaugeVec
+	scanDuration    *prometheus.GaugeVec
+	lastScanFailed  *prometheus.GaugeVec
+
+	scans        *prometheus.CounterVec
+	scanFailures *prometheus.CounterVec
+	cacheHits    *prometheus.CounterVec
+	cacheMisses  *prometheus.CounterVec
+
+	cycleDuration  prometheus.Gauge
+	cycleTimestamp prometheus.Gauge
+
+	// counted are the label values of the counter series by their key, so that the series of images which aren't
+	// running anymore can be deleted
+	mutex   sync.Mutex
+	counted map[string][]string
+}
+
+// NewScanMetrics registers the metrics of the scanned images in the registry
+func NewScanMetrics(registerer prometheus.Registerer) *ScanMetrics {
+	withLabels := func(names ...string) []string {
+		return append(append([]string{}, imageLabelNames...), names...)
+	}
+	newGaugeVec := func(name, help string, labelNames ...string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: prefix + name, Help: help}, labelNames)
+	}
+	newCounterVec := func(name, help string, labelNames ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: prefix + name, Help: help}, labelNames)
+	}
+	m := &ScanMetrics{
+		vulnerabilities: newGaugeVec("_image_vulnerabilities", "Components of the image by the severity of their highest vulnerability, of the Black Duck project version of its latest scan", withLabels("severity")...),
+		policyViolation: newGaugeVec("_image_policy_violation", "1 if the Black Duck project version of the latest scan of the image violates a policy, 0 otherwise", imageLabelNames...),
+		versionsBehind:  newGaugeVec("_image_versions_behind", "Newer releases of the image by level: major, minor or patch", withLabels("level")...),
+		staleness:       newGaugeVec("_image_staleness_score", "Staleness score of the image, weighing the releases it's behind and their age", imageLabelNames...),
+		scanDuration:    newGaugeVec("_image_scan_duration_seconds", "Duration of the latest scan of the image", imageLabelNames...),
+		lastScanFailed:  newGaugeVec("_image_last_scan_failed", "1 if the latest scan of the image failed, 0 otherwise", imageLabelNames...),
+
+		scans:        newCounterVec("_image_scans_total", "Scans of the image", imageLabelNames...),
+		scanFailures: newCounterVec("_image_scan_failures_total", "Failed scans of the image", imageLabelNames...),
+		cacheHits:    newCounterVec("_scan_cache_hits_total", "Scan cycles which reused the scan of the image digest instead of scanning it again", imageLabelNames...),
+		cacheMisses:  newCounterVec("_scan_cache_misses_total", "Scan cycles which had to scan the image digest", imageLabelNames...),
+
+		cycleDuration:  prometheus.NewGauge(prometheus.GaugeOpts{Name: prefix + "_scan_cycle_duration_seconds", Help: "Duration of the latest completed scan cycle"}),
+		cycleTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{Name: prefix + "_scan_cycle_timestamp_seconds", Help: "Unix time of the end of the latest completed scan cycle"}),
+
+		counted: map[string][]string{},
+	}
+	registerer.MustRegister(m.vulnerabilities, m.policyViolation, m.versionsBehind, m.staleness, m.scanDuration, m.lastScanFailed,
+		m.scans, m.scanFailures, m.cacheHits, m.cacheMisses, m.cycleDuration, m.cycleTimestamp)
+	return m
+}
+
+// ObserveScan counts a scan of an image
+func (m *ScanMetrics) ObserveScan(labels ImageLabels, failed bool) {
+	labels.each(func(labelValues ...string) {
+		m.count(labelValues)
+		m.scans.WithLabelValues(labelValues...).Inc()
+		if failed {
+			m.scanFailures.WithLabelValues(labelValues...).Inc()
+		}
+	})
+}
+
+// ObserveCache counts whether the scan of an image digest was reused
+func (m *ScanMetrics) ObserveCache(labels ImageLabels, hit bool) {
+	labels.each(func(labelValues ...string) {
+		m.count(labelValues)
+		if hit {
+			m.cacheHits.WithLabelValues(labelValues...).Inc()
+		} else {
+			m.cacheMisses.WithLabelValues(labelValues...).Inc()
+		}
+	})
+}
+
+func (m *ScanMetrics) count(labelValues []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counted[strings.Join(labelValues, "\xff")] = labelValues
+}
+
+// SetImages replaces the state of all images by the results of a scan cycle, so that images which aren't running
+// anymore disappear; their counters are deleted too, so that the series of every image ever scanned don't pile up
+func (m *ScanMetrics) SetImages(results []ImageResult, completedAt time.Time, cycleDuration time.Duration) {
+	for _, vec := range []*prometheus.GaugeVec{m.vulnerabilities, m.policyViolation, m.versionsBehind, m.staleness, m.scanDuration, m.lastScanFailed} {
+		vec.Reset()
+	}
+	running := map[string]bool{}
+	for _, result := range results {
+		result.each(func(labelValues ...string) {
+			running[strings.Join(labelValues, "\xff")] = true
+			m.lastScanFailed.WithLabelValues(labelValues...).Set(boolValue(result.Failed))
+			if result.Failed {
+				return
+			}
+			m.scanDuration.WithLabelValues(labelValues...).Set(result.ScanDuration.Seconds())
+			m.staleness.WithLabelValues(labelValues...).Set(float64(result.StalenessScore))
+			m.versionsBehind.WithLabelValues(append(labelValues, "major")...).Set(float64(result.MajorsBehind))
+			m.versionsBehind.WithLabelValues(append(labelValues, "minor")...).Set(float64(result.MinorsBehind))
+			m.versionsBehind.WithLabelValues(append(labelValues, "patch")...).Set(float64(result.PatchesBehind))
+			if result.PolicyKnown {
+				m.policyViolation.WithLabelValues(labelValues...).Set(boolValue(result.InViolation))
+			}
+			if result.Vulnerabilities != nil {
+				for _, severity := range Severities {
+					m.vulnerabilities.WithLabelValues(append(labelValues, severity)...).Set(float64(result.Vulnerabilities[severity]))
+				}
+			}
+		})
+	}
+	m.deleteCounters(running)
+	m.cycleDuration.Set(cycleDuration.Seconds())
+	m.cycleTimestamp.Set(float64(completedAt.Unix()))
+}
+
+// deleteCounters deletes the counter series of the images which aren't running
+func (m *ScanMetrics) deleteCounters(running map[string]bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key, labelValues := range m.counted {
+		if running[key] {
+			continue
+		}
+		for _, vec := range []*prometheus.CounterVec{m.scans, m.scanFailures, m.cacheHits, m.cacheMisses} {
+			vec.DeleteLabelValues(labelValues...)
+		}
+		delete(m.counted, key)
+	}
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScanMetrics(t *testing.T) {
+	registry := NewRegistry()
+	scanMetrics := NewScanMetrics(registry)
+	nginx := ImageLabels{Namespace: "shop", Workloads: []string{"Deployment/web", "Deployment/admin"}, Image: "nginx:1.19"}
+	redis := ImageLabels{Namespace: "shop", Image: "redis:6.0"}
+
+	scanMetrics.ObserveCache(nginx, false)
+	scanMetrics.ObserveScan(nginx, false)
+	scanMetrics.ObserveCache(nginx, true)
+	scanMetrics.ObserveCache(redis, false)
+	scanMetrics.ObserveScan(redis, true)
+	completedAt := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	scanMetrics.SetImages([]ImageResult{
+		{
+			ImageLabels:     nginx,
+			Vulnerabilities: map[string]int{"critical": 1, "high": 3},
+			InViolation:     true,
+			PolicyKnown:     true,
+			MinorsBehind:    2,
+			StalenessScore:  20,
+			ScanDuration:    90 * time.Second,
+		},
+		{ImageLabels: redis, Failed: true},
+	}, completedAt, 2*time.Minute)
+
+	output := scrape(t, registry)
+	expectedLines := []string{
+		`bd_xray_image_vulnerabilities{image="nginx:1.19",namespace="shop",severity="critical",workload="Deployment/web"} 1`,
+		`bd_xray_image_vulnerabilities{image="nginx:1.19",namespace="shop",severity="low",workload="Deployment/admin"} 0`,
+		`bd_xray_image_policy_violation{image="nginx:1.19",namespace="shop",workload="Deployment/admin"} 1`,
+		`bd_xray_image_versions_behind{image="nginx:1.19",level="minor",namespace="shop",workload="Deployment/web"} 2`,
+		`bd_xray_image_staleness_score{image="nginx:1.19",namespace="shop",workload="Deployment/web"} 20`,
+		`bd_xray_image_scan_duration_seconds{image="nginx:1.19",namespace="shop",workload="Deployment/web"} 90`,
+		`bd_xray_image_last_scan_failed{image="redis:6.0",namespace="shop",workload=""} 1`,
+		`bd_xray_image_last_scan_failed{image="nginx:1.19",namespace="shop",workload="Deployment/web"} 0`,
+		`bd_xray_image_scans_total{image="nginx:1.19",namespace="shop",workload="Deployment/admin"} 1`,
+		`bd_xray_image_scan_failures_total{image="redis:6.0",namespace="shop",workload=""} 1`,
+		`bd_xray_scan_cache_hits_total{image="nginx:1.19",namespace="shop",workload="Deployment/web"} 1`,
+		`bd_xray_scan_cache_misses_total{image="redis:6.0",namespace="shop",workload=""} 1`,
+		`bd_xray_scan_cycle_duration_seconds 120`,
+		`bd_xray_scan_cycle_timestamp_seconds 1.6145568e+09`,
+		`# TYPE bd_xray_image_scans_total counter`,
+		`# TYPE go_goroutines gauge`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected [%s], but got [%s]", line, output)
+		}
+	}
+	// failed scans have no state besides the failure
+	if strings.Contains(output, `bd_xray_image_vulnerabilities{image="redis:6.0"`) || strings.Contains(output, `bd_xray_image_scan_duration_seconds{image="redis:6.0",namespace="shop",workload=""}`) {
+		t.Errorf("Expected no state of the failed scan of redis:6.0, but got [%s]", output)
+	}
+
+	// images which aren't running anymore disappear, with their counters
+	scanMetrics.SetImages([]ImageResult{{ImageLabels: nginx, Failed: true}}, completedAt.Add(time.Hour), time.Minute)
+	output = scrape(t, registry)
+	if strings.Contains(output, "bd_xray_image_vulnerabilities") || strings.Contains(output, `image="redis:6.0"`) {
+		t.Errorf("Expected the state and counters of redis:6.0 to be deleted, but got [%s]", output)
+	}
+	if !strings.Contains(output, `bd_xray_image_scans_total{image="nginx:1.19",namespace="shop",workload="Deployment/web"} 1`+"\n") {
+		t.Errorf("Expected the counters of the running nginx:1.19 to stay, but got [%s]", output)
+	}
+	scanMetrics.SetImages(nil, completedAt.Add(2*time.Hour), time.Minute)
+	if output := scrape(t, registry); strings.Contains(output, "bd_xray_image_") || strings.Contains(output, "bd_xray_scan_cache_") {
+		t.Errorf("Expected no series of images, but got [%s]", output)
+	}
+}
+
+// scrape gets the metrics of the registry like Prometheus does
+func scrape(t *testing.T, registry *prometheus.Registry) string {
+	recorder := httptest.NewRecorder()
+	Handler(registry).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected [%d], but got [%d %s]", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	return recorder.Body.String()
+}
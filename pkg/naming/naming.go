@@ -0,0 +1,379 @@
+package naming
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/remediation"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+const (
+	SourceImages    = "images"
+	SourceNamespace = "namespace"
+	SourceYaml      = "yaml"
+	SourceHelm      = "helm"
+
+	// DefaultCodeLocationTemplate keeps code locations unique per project version, instead of sharing the project name
+	DefaultCodeLocationTemplate = "{{.Project}}/{{.Version}}"
+
+	defaultPerImageVersionTemplate = `{{printf "%s_%s" .Name .Tag | sanitize}}`
+)
+
+// Context is what project, version and code location names can be built from, i.e.:
+// --project-template '{{.Namespace}}-{{.Workload}}' or --version-template '{{.Tag}}-{{.Digest | short}}'
+type Context struct {
+	// Source is the command the image was found by: images, namespace, yaml or helm
+	Source string
+	// ProjectName is the value of --detect.project.name, if any
+	ProjectName string
+	Namespace   string
+	// Workload is the name of the first workload using the image, i.e.: nginx for Deployment/nginx; only set for namespace scans
+	Workload     string
+	WorkloadKind string
+	// File is the base name of the scanned yaml file
+	File string
+	// Chart is the helm chart the image was templated from
+	Chart string
+
+	// Image is the full image, i.e.: docker.io/library/nginx:1.19
+	Image string
+	// Registry is the registry host, i.e.: index.docker.io
+	Registry string
+	// Repository is the path of the image within the registry, i.e.: library/nginx
+	Repository string
+	// Name is the last component of the repository, i.e.: nginx
+	Name   string
+	Tag    string
+	Digest string
+
+	// Project and Version are only set for the code location template
+	Project string
+	Version string
+}
+
+// Names are the names detect reports a scan under, with the tags and group of the project
+type Names struct {
+	Project      string
+	Version      string
+	CodeLocation string
+	Tags         []string
+	Group        string
+}
+
+// Templates are the Go templates of the names; empty templates use the defaults of the source
+type Templates struct {
+	Project      string
+	Version      string
+	CodeLocation string
+	Tags         []string
+	Group        string
+}
+
+// DefaultTemplates name projects and versions the way bd-xray always did, so that rescans end up in the same
+// projects: per namespace or yaml file with NAME_TAG versions, otherwise per image with the tag as version, unless
+// --detect.project.name is set
+func DefaultTemplates(source string) Templates {
+	templates := Templates{Version: defaultPerImageVersionTemplate, CodeLocation: DefaultCodeLocationTemplate}
+	switch source {
+	case SourceNamespace:
+		templates.Project = "{{.ProjectName | default .Namespace}}"
+	case SourceYaml:
+		templates.Project = "{{.ProjectName | default (sanitize .File)}}"
+	default:
+		templates.Project = "{{.ProjectName | default .Name}}"
+		templates.Version = `{{if .ProjectName}}` + defaultPerImageVersionTemplate + `{{else}}{{.Tag}}{{end}}`
+	}
+	return templates
+}
+
+var templateFuncs = template.FuncMap{
+	// short abbreviates a digest to 12 hex characters, i.e.: sha256:4c0fdaa8b634... to 4c0fdaa8b634
+	"short": func(digest string) string {
+		if idx := strings.Index(digest, ":"); idx >= 0 {
+			digest = digest[idx+1:]
+		}
+		if len(digest) > 12 {
+			return digest[:12]
+		}
+		return digest
+	},
+	"sanitize": utils.SanitizeString,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+	"trunc": func(length int, s string) string {
+		if len(s) > length {
+			return s[:length]
+		}
+		return s
+	},
+	"default": func(defaultValue, value string) string {
+		if value == "" {
+			return defaultValue
+		}
+		return value
+	},
+}
+
+// imageFieldsRegexp matches the fields of a context which differ between the images of a namespace, file or chart
+var imageFieldsRegexp = regexp.MustCompile(`\.(Image|Registry|Repository|Name|Tag|Digest|Workload|WorkloadKind|Chart)\b`)
+
+// namespaceFieldsRegexp matches the fields of a context which are only known when scanning a namespace
+var namespaceFieldsRegexp = regexp.MustCompile(`\.(Namespace|Workload|WorkloadKind)\b`)
+
+// sampleContext is used to check templates for unknown fields and functions before any scan runs
+var sampleContext = Context{
+	Source:       SourceNamespace,
+	Namespace:    "default",
+	Workload:     "nginx",
+	WorkloadKind: "Deployment",
+	File:         "nginx.yaml",
+	Chart:        "bitnami/nginx",
+	Image:        "docker.io/library/nginx:1.19",
+	Registry:     "index.docker.io",
+	Repository:   "library/nginx",
+	Name:         "nginx",
+	Tag:          "1.19",
+	Digest:       "sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac",
+	Project:      "default",
+	Version:      "nginx_1_19",
+}
+
+// Namer derives the names of the scans of a command from its templates
+type Namer struct {
+	templates    Templates
+	base         Context
+	project      *template.Template
+	version      *template.Template
+	codeLocation *template.Template
+	tags         []*template.Template
+	group        *template.Template
+
+	// mutex guards the workloads and charts, which `bd-xray watch` adds to while scanning
+	mutex            sync.RWMutex
+	workloadsByImage map[string][]string
+	chartsByImage    map[string]string
+}
+
+// NewNamer parses the templates, with the base context shared by all images of a command; templates of other sources
+// than namespace must not use the namespace or workload, which are never set for them
+func NewNamer(templates Templates, base Context) (*Namer, error) {
+	defaults := DefaultTemplates(base.Source)
+	if templates.Project == "" {
+		templates.Project = defaults.Project
+	}
+	if templates.Version == "" {
+		templates.Version = defaults.Version
+	}
+	if templates.CodeLocation == "" {
+		templates.CodeLocation = defaults.CodeLocation
+	}
+
+	if base.Source != SourceNamespace {
+		for _, text := range append([]string{templates.Project, templates.Version, templates.CodeLocation, templates.Group}, templates.Tags...) {
+			if field := namespaceFieldsRegexp.FindString(text); field != "" {
+				return nil, errors.Errorf("template '%s' uses %s, which is only known when scanning a namespace", text, field)
+			}
+		}
+	}
+
+	namer := &Namer{templates: templates, base: base}
+	var err error
+	if namer.project, err = parse("project", templates.Project); err != nil {
+		return nil, err
+	}
+	if namer.version, err = parse("version", templates.Version); err != nil {
+		return nil, err
+	}
+	if namer.codeLocation, err = parse("code location", templates.CodeLocation); err != nil {
+		return nil, err
+	}
+	for _, text := range templates.Tags {
+		tmpl, err := parse("tag", text)
+		if err != nil {
+			return nil, err
+		}
+		namer.tags = append(namer.tags, tmpl)
+	}
+	if namer.group, err = parse("group", templates.Group); err != nil {
+		return nil, err
+	}
+	for _, tmpl := range append([]*template.Template{namer.project, namer.version, namer.codeLocation, namer.group}, namer.tags...) {
+		if _, err := execute(tmpl, sampleContext); err != nil {
+			return nil, err
+		}
+	}
+	return namer, nil
+}
+
+func parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	return tmpl, errors.Wrapf(err, "unable to parse %s template '%s'", name, text)
+}
+
+func execute(tmpl *template.Template, context Context) (string, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, context); err != nil {
+		return "", errors.Wrapf(err, "unable to render %s template", tmpl.Name())
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// UsesDigest is true if a template needs the digest, which has to be looked up in the registry for tagged images
+func (n *Namer) UsesDigest() bool {
+	return n.uses(".Digest")
+}
+
+// UsesWorkload is true if a template needs the workloads using the images
+func (n *Namer) UsesWorkload() bool {
+	return n.uses(".Workload")
+}
+
+func (n *Namer) uses(field string) bool {
+	return strings.Contains(strings.Join(append([]string{n.templates.Project, n.templates.Version, n.templates.CodeLocation, n.templates.Group}, n.templates.Tags...), " "), field)
+}
+
+// BaseProject renders the project name of the base context, i.e.: of the namespace; ok is false if the project
+// template depends on the image, so that the projects of images which aren't running anymore can't be named
+func (n *Namer) BaseProject() (project string, ok bool, err error) {
+	if imageFieldsRegexp.MatchString(n.templates.Project) {
+		return "", false, nil
+	}
+	project, err = execute(n.project, n.base)
+	return project, project != "", err
+}
+
+// NamespaceTags renders the tag templates which use the namespace but not the image, i.e.: namespace:{{.Namespace}}
+func (n *Namer) NamespaceTags() ([]string, error) {
+	var tags []string
+	for i, text := range n.templates.Tags {
+		if !strings.Contains(text, ".Namespace") || imageFieldsRegexp.MatchString(text) {
+			continue
+		}
+		tag, err := execute(n.tags[i], n.base)
+		if err != nil {
+			return nil, err
+		}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// SetWorkloads records which workloads use which image, i.e.: Deployment/nginx
+func (n *Namer) SetWorkloads(workloadsByImage map[string][]string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.workloadsByImage = workloadsByImage
+}
+
+// AddWorkload records that a workload uses an image, in addition to the workloads already recorded
+func (n *Namer) AddWorkload(fullImageName, workload string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.workloadsByImage == nil {
+		n.workloadsByImage = map[string][]string{}
+	}
+	for _, known := range n.workloadsByImage[fullImageName] {
+		if known == workload {
+			return
+		}
+	}
+	n.workloadsByImage[fullImageName] = append(n.workloadsByImage[fullImageName], workload)
+}
+
+// Workloads are all the workloads recorded for an image, sorted
+func (n *Namer) Workloads(fullImageName string) []string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	workloads := append([]string{}, n.workloadsByImage[fullImageName]...)
+	sort.Strings(workloads)
+	return workloads
+}
+
+// SetCharts records which chart each image was templated from
+func (n *Namer) SetCharts(chartsByImage map[string]string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.chartsByImage = chartsByImage
+}
+
+// ContextFor is the context of an image; the workload is the first one in alphabetical order, so that the names
+// stay the same across runs
+func (n *Namer) ContextFor(fullImageName string) Context {
+	context := n.base
+	context.Image = fullImageName
+	context.Name = utils.ParseImageName(fullImageName)
+	context.Tag = utils.ParseImageTag(fullImageName)
+	if image, err := remediation.NewImage(fullImageName); err == nil {
+		context.Registry = image.URL
+		context.Repository = image.Name
+		context.Digest = image.Digest
+		if context.Tag == "" {
+			context.Tag = image.Version
+		}
+	}
+
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	if workloads := append([]string{}, n.workloadsByImage[fullImageName]...); len(workloads) > 0 {
+		sort.Strings(workloads)
+		if parts := strings.SplitN(workloads[0], "/", 2); len(parts) == 2 {
+			context.WorkloadKind, context.Workload = parts[0], parts[1]
+		} else {
+			context.Workload = workloads[0]
+		}
+	}
+	if chart, ok := n.chartsByImage[fullImageName]; ok {
+		context.Chart = chart
+	}
+	return context
+}
+
+// Names renders the project and version names, and then the code location name, which can use both, and the tags
+// and group of the project; empty tags are left out
+func (n *Namer) Names(context Context) (Names, error) {
+	var names Names
+	var err error
+	if names.Project, err = execute(n.project, context); err != nil {
+		return names, err
+	}
+	if names.Version, err = execute(n.version, context); err != nil {
+		return names, err
+	}
+	context.Project, context.Version = names.Project, names.Version
+	if names.CodeLocation, err = execute(n.codeLocation, context); err != nil {
+		return names, err
+	}
+	if names.Project == "" || names.Version == "" || names.CodeLocation == "" {
+		return names, errors.Errorf("empty project, version or code location name for '%s': '%s' '%s' '%s'", context.Image, names.Project, names.Version, names.CodeLocation)
+	}
+
+	for _, tmpl := range n.tags {
+		tag, err := execute(tmpl, context)
+		if err != nil {
+			return names, err
+		}
+		// detect takes the tags as a comma separated list
+		if strings.Contains(tag, ",") {
+			return names, errors.Errorf("tag '%s' of '%s' contains a comma", tag, context.Image)
+		}
+		if tag != "" {
+			names.Tags = append(names.Tags, tag)
+		}
+	}
+	if names.Group, err = execute(n.group, context); err != nil {
+		return names, err
+	}
+	return names, nil
+}
@@ -0,0 +1,140 @@
+package naming
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultNames(t *testing.T) {
+	testCases := []struct {
+		base     Context
+		image    string
+		expected Names
+	}{
+		{Context{Source: SourceImages}, "docker.io/library/nginx:1.19", Names{Project: "nginx", Version: "1.19", CodeLocation: "nginx/1.19"}},
+		{Context{Source: SourceImages, ProjectName: "shop"}, "nginx:1.19", Names{Project: "shop", Version: "nginx_1_19", CodeLocation: "shop/nginx_1_19"}},
+		{Context{Source: SourceHelm}, "quay.io/prometheus/node-exporter:v1.0.1", Names{Project: "node-exporter", Version: "v1.0.1", CodeLocation: "node-exporter/v1.0.1"}},
+		{Context{Source: SourceNamespace, Namespace: "default"}, "nginx:1.19", Names{Project: "default", Version: "nginx_1_19", CodeLocation: "default/nginx_1_19"}},
+		{Context{Source: SourceNamespace, Namespace: "default", ProjectName: "shop"}, "nginx:1.19", Names{Project: "shop", Version: "nginx_1_19", CodeLocation: "shop/nginx_1_19"}},
+		{Context{Source: SourceYaml, File: "deployment.yaml"}, "nginx:1.19", Names{Project: "deployment_yaml", Version: "nginx_1_19", CodeLocation: "deployment_yaml/nginx_1_19"}},
+	}
+	for _, testCase := range testCases {
+		namer, err := NewNamer(Templates{}, testCase.base)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		names, err := namer.Names(namer.ContextFor(testCase.image))
+		if err != nil || !reflect.DeepEqual(names, testCase.expected) {
+			t.Errorf("Expected [%+v], but got [%+v %+v]", testCase.expected, names, err)
+		}
+	}
+}
+
+func TestTemplatedNames(t *testing.T) {
+	namer, err := NewNamer(Templates{
+		Project:      "{{.Namespace}}-{{.Workload}}",
+		Version:      "{{.Tag}}-{{.Digest | short}}",
+		CodeLocation: "{{.Project}}/{{.Repository}}/{{.Version}}",
+		Tags:         []string{"cluster:prod", "namespace:{{.Namespace}}", "{{.Chart}}"},
+		Group:        "{{.Namespace | upper}}",
+	}, Context{Source: SourceNamespace, Namespace: "shop"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !namer.UsesDigest() || !namer.UsesWorkload() {
+		t.Errorf("Expected the templates to use the digest and workload")
+	}
+	namer.SetWorkloads(map[string][]string{"nginx:1.19": {"StatefulSet/web", "Deployment/frontend"}})
+
+	context := namer.ContextFor("nginx:1.19")
+	if context.Workload != "frontend" || context.WorkloadKind != "Deployment" || context.Registry != "index.docker.io" || context.Repository != "library/nginx" {
+		t.Errorf("Expected the first workload and the repository of nginx, but got [%+v]", context)
+	}
+	context.Digest = "sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac"
+	names, err := namer.Names(context)
+	expected := Names{
+		Project:      "shop-frontend",
+		Version:      "1.19-4c0fdaa8b634",
+		CodeLocation: "shop-frontend/library/nginx/1.19-4c0fdaa8b634",
+		Tags:         []string{"cluster:prod", "namespace:shop"},
+		Group:        "SHOP",
+	}
+	if err != nil || !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected [%+v], but got [%+v %+v]", expected, names, err)
+	}
+
+	// workloads added while watching are attributed the same way
+	namer.AddWorkload("redis:6.0", "StatefulSet/cache")
+	namer.AddWorkload("redis:6.0", "Deployment/api")
+	namer.AddWorkload("redis:6.0", "StatefulSet/cache")
+	if context := namer.ContextFor("redis:6.0"); context.Workload != "api" || context.WorkloadKind != "Deployment" {
+		t.Errorf("Expected the workload [Deployment/api], but got [%s/%s]", context.WorkloadKind, context.Workload)
+	}
+	if workloads := namer.Workloads("redis:6.0"); !reflect.DeepEqual(workloads, []string{"Deployment/api", "StatefulSet/cache"}) {
+		t.Errorf("Expected [Deployment/api StatefulSet/cache], but got [%v]", workloads)
+	}
+
+	// images pinned by digest don't need a registry lookup
+	if context := namer.ContextFor("nginx@sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac"); context.Digest == "" {
+		t.Errorf("Expected the digest of the image reference, but got [%+v]", context)
+	}
+	// the tag of an image pinned by tag and digest, like the images scanned while watching, still names the scan
+	if context := namer.ContextFor("nginx:1.19@sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac"); context.Name != "nginx" || context.Tag != "1.19" || context.Digest == "" {
+		t.Errorf("Expected the name [nginx], tag [1.19] and the digest, but got [%+v]", context)
+	}
+}
+
+func TestInvalidTemplates(t *testing.T) {
+	testCases := []Templates{
+		{Project: "{{.Namespace"},
+		{Version: "{{.Hash}}"},
+		{CodeLocation: "{{.Project | unknown}}"},
+		{Tags: []string{"{{.Label}}"}},
+		// only known when scanning a namespace
+		{Project: "{{.Namespace}}"},
+		{Tags: []string{"kind:{{.WorkloadKind}}"}},
+		{Group: "{{.Workload | upper}}"},
+	}
+	for _, testCase := range testCases {
+		if _, err := NewNamer(testCase, Context{Source: SourceImages}); err == nil {
+			t.Errorf("Expected an error for [%+v]", testCase)
+		}
+	}
+
+	namer, err := NewNamer(Templates{Project: "{{.Chart}}"}, Context{Source: SourceImages})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if names, err := namer.Names(namer.ContextFor("nginx:1.19")); err == nil {
+		t.Errorf("Expected an error for an empty project name, but got [%+v]", names)
+	}
+
+	namer, err = NewNamer(Templates{Tags: []string{"{{.Namespace}},{{.Name}}"}}, Context{Source: SourceNamespace, Namespace: "shop"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if names, err := namer.Names(namer.ContextFor("nginx:1.19")); err == nil {
+		t.Errorf("Expected an error for a tag with a comma, but got [%+v]", names)
+	}
+}
+
+func TestBaseProjectAndNamespaceTags(t *testing.T) {
+	namer, err := NewNamer(Templates{Tags: []string{"cluster:prod", "namespace:{{.Namespace}}", "{{.Namespace}}-{{.Name}}"}}, Context{Source: SourceNamespace, Namespace: "shop"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if project, ok, err := namer.BaseProject(); err != nil || !ok || project != "shop" {
+		t.Errorf("Expected [shop], but got [%s %t %+v]", project, ok, err)
+	}
+	if tags, err := namer.NamespaceTags(); err != nil || !reflect.DeepEqual(tags, []string{"namespace:shop"}) {
+		t.Errorf("Expected [namespace:shop], but got [%v %+v]", tags, err)
+	}
+
+	namer, err = NewNamer(Templates{Project: "{{.Namespace}}-{{.Workload}}"}, Context{Source: SourceNamespace, Namespace: "shop"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if project, ok, err := namer.BaseProject(); err != nil || ok {
+		t.Errorf("Expected the project to depend on the image, but got [%s %t %+v]", project, ok, err)
+	}
+}
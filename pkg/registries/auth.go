@@ -0,0 +1,294 @@
+package registries
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// minimumTokenExpiry is the lifetime of a token which doesn't specify one, see https://docs.docker.com/registry/spec/auth/token/
+	minimumTokenExpiry = 60 * time.Second
+	// tokenExpiryLeeway makes sure a token isn't used right before it expires
+	tokenExpiryLeeway = 10 * time.Second
+	// tokenClientID identifies bd-xray to token servers when exchanging identity tokens
+	tokenClientID = "bd-xray"
+)
+
+// challenge is a single auth challenge of a WWW-Authenticate header, see https://tools.ietf.org/html/rfc7235#section-4.1
+type challenge struct {
+	Scheme string
+	Params map[string]string
+}
+
+// pullScope is the token scope needed to list the tags of and pull a repository
+func pullScope(repository string) string {
+	return fmt.Sprintf("repository:%s:pull", repository)
+}
+
+// parseChallenges parses all WWW-Authenticate headers, each of which may contain several challenges, i.e.:
+//
+//	Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/ubuntu:pull"
+func parseChallenges(headers http.Header) []challenge {
+	var challenges []challenge
+	for _, header := range headers[http.CanonicalHeaderKey("WWW-Authenticate")] {
+		log.WithField("header", header).Debug("Incoming auth header")
+		challenges = append(challenges, parseChallengeHeader(header)...)
+	}
+	return challenges
+}
+
+func parseChallengeHeader(header string) []challenge {
+	var challenges []challenge
+	var current *challenge
+	s := header
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+		var token string
+		token, s = readToken(s)
+		if token == "" {
+			// not a token, skip the offending character
+			s = s[1:]
+			continue
+		}
+		rest := strings.TrimLeft(s, " ")
+		if current != nil && strings.HasPrefix(rest, "=") {
+			var value string
+			value, s = readValue(strings.TrimLeft(rest[1:], " "))
+			current.Params[strings.ToLower(token)] = value
+			continue
+		}
+		// a token which isn't followed by '=' starts a new challenge
+		challenges = append(challenges, challenge{Scheme: strings.ToLower(token), Params: map[string]string{}})
+		current = &challenges[len(challenges)-1]
+	}
+	return challenges
+}
+
+func readToken(s string) (string, string) {
+	i := 0
+	for i < len(s) && !strings.ContainsRune(" \t,=\"", rune(s[i])) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// readValue reads either a quoted string, handling backslash escapes, or a token
+func readValue(s string) (string, string) {
+	if !strings.HasPrefix(s, "\"") {
+		return readToken(s)
+	}
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return value.String(), ""
+}
+
+// answerChallenges authorizes the request according to the challenges; bearer is preferred over basic. A cached
+// token equal to rejected, which the registry refused, isn't reused
+func (r ImageRegistry) answerChallenges(req *http.Request, challenges []challenge, scope string, auth authn.AuthConfig, rejected string) error {
+	for _, c := range challenges {
+		if c.Scheme != "bearer" {
+			continue
+		}
+		// a registry token of the docker config is a bearer token already
+		token := auth.RegistryToken
+		var err error
+		if token == "" {
+			token, err = r.getToken(c, scope, auth, rejected)
+		}
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		return nil
+	}
+	for _, c := range challenges {
+		if c.Scheme == "basic" {
+			if auth.Username == "" && auth.Password == "" {
+				return errors.Errorf("registry '%s' requires basic auth, but no credentials are configured", r.URL)
+			}
+			req.SetBasicAuth(auth.Username, auth.Password)
+			return nil
+		}
+	}
+	return errors.Errorf("registry '%s' returned no supported auth challenge: %+v", r.URL, challenges)
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+}
+
+// getToken fetches a bearer token from the realm of the challenge and caches it per registry, scope and user until it
+// expires or is rejected; an identity token is exchanged with the OAuth2 refresh token grant, like docker does, other
+// credentials are sent as basic auth
+func (r ImageRegistry) getToken(c challenge, scope string, auth authn.AuthConfig, rejected string) (string, error) {
+	if challengeScope, ok := c.Params["scope"]; ok && challengeScope != "" {
+		scope = challengeScope
+	}
+	user := tokenUser(auth)
+	if token, ok := defaultTokenCache.get(r.URL, scope, user); ok && token != rejected {
+		return token, nil
+	}
+
+	realm := c.Params["realm"]
+	if realm == "" {
+		return "", errors.Errorf("bearer challenge of registry '%s' has no realm", r.URL)
+	}
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid realm '%s'", realm)
+	}
+	query := url.Values{}
+	if service := c.Params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+
+	var req *http.Request
+	if auth.IdentityToken != "" {
+		query.Set("grant_type", "refresh_token")
+		query.Set("refresh_token", auth.IdentityToken)
+		query.Set("client_id", tokenClientID)
+		log.WithField("url", tokenURL.String()).Debug("Token url")
+		req, err = http.NewRequest(http.MethodPost, tokenURL.String(), strings.NewReader(query.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		tokenQuery := tokenURL.Query()
+		for key, values := range query {
+			tokenQuery[key] = values
+		}
+		tokenURL.RawQuery = tokenQuery.Encode()
+		log.WithField("url", tokenURL.String()).Debug("Token url")
+		req, err = http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if auth.Username != "" || auth.Password != "" {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+	}
+	resp, err := doRequest(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get token from %s", realm)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("Response code of token server %s was not OK but [%v]", realm, resp.StatusCode)
+	}
+
+	var response tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", errors.Wrapf(err, "unable to parse token response from %s", realm)
+	}
+	token := response.Token
+	if token == "" {
+		token = response.AccessToken
+	}
+	if token == "" {
+		return "", errors.Errorf("token server %s returned no token", realm)
+	}
+
+	defaultTokenCache.set(r.URL, scope, user, token, response.expiry(time.Now()))
+	return token, nil
+}
+
+func (t tokenResponse) expiry(now time.Time) time.Time {
+	issuedAt := now
+	if t.IssuedAt != "" {
+		if parsed, err := time.Parse(time.RFC3339, t.IssuedAt); err == nil {
+			issuedAt = parsed
+		}
+	}
+	expiresIn := time.Duration(t.ExpiresIn) * time.Second
+	if expiresIn < minimumTokenExpiry {
+		expiresIn = minimumTokenExpiry
+	}
+	return issuedAt.Add(expiresIn)
+}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenUser identifies the credentials a token was fetched with, so that tokens of different users aren't shared; an
+// identity token without username is identified by its hash
+func tokenUser(auth authn.AuthConfig) string {
+	if auth.Username == "" && auth.IdentityToken != "" {
+		hash := sha256.Sum256([]byte(auth.IdentityToken))
+		return "identity:" + hex.EncodeToString(hash[:8])
+	}
+	return auth.Username
+}
+
+// tokenCache holds bearer tokens per registry, scope and user
+type tokenCache struct {
+	mutex  sync.Mutex
+	tokens map[string]cachedToken
+}
+
+var defaultTokenCache = newTokenCache()
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: map[string]cachedToken{}}
+}
+
+func tokenCacheKey(registry, scope, user string) string {
+	return registry + "|" + scope + "|" + user
+}
+
+func (c *tokenCache) get(registry, scope, user string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached, ok := c.tokens[tokenCacheKey(registry, scope, user)]
+	if !ok || time.Now().Add(tokenExpiryLeeway).After(cached.expires) {
+		return "", false
+	}
+	return cached.token, true
+}
+
+func (c *tokenCache) set(registry, scope, user, token string, expires time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tokens[tokenCacheKey(registry, scope, user)] = cachedToken{token: token, expires: expires}
+}
+
+// evict removes a token the registry rejected, i.e.: because it was revoked
+func (c *tokenCache) evict(registry, scope, user string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.tokens, tokenCacheKey(registry, scope, user))
+}
@@ -0,0 +1,238 @@
+package registries
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseChallenges(t *testing.T) {
+	headers := http.Header{}
+	headers.Add("WWW-Authenticate", `Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:team/app:pull,push"`)
+	headers.Add("WWW-Authenticate", `Basic realm="registry \"example\"", Bearer realm=https://other.example.com/token`)
+
+	challenges := parseChallenges(headers)
+	if len(challenges) != 3 {
+		t.Fatalf("Expected [3] challenges, but got [%d]: %+v", len(challenges), challenges)
+	}
+	if challenges[0].Scheme != "bearer" || challenges[0].Params["scope"] != "repository:team/app:pull,push" || challenges[0].Params["service"] != "registry.example.com" {
+		t.Errorf("Unexpected first challenge: %+v", challenges[0])
+	}
+	if challenges[1].Scheme != "basic" || challenges[1].Params["realm"] != `registry "example"` {
+		t.Errorf("Unexpected second challenge: %+v", challenges[1])
+	}
+	if challenges[2].Scheme != "bearer" || challenges[2].Params["realm"] != "https://other.example.com/token" {
+		t.Errorf("Unexpected third challenge: %+v", challenges[2])
+	}
+}
+
+func TestParseChallengesWithoutHeader(t *testing.T) {
+	if challenges := parseChallenges(http.Header{}); len(challenges) != 0 {
+		t.Errorf("Expected no challenges, but got %+v", challenges)
+	}
+}
+
+// newTestRegistry stands in for a registry with a token server; the tags are served on two pages. The returned function
+// stops the server and restores the package globals
+func newTestRegistry(t *testing.T, tokenRequests *int32) (ImageRegistry, func()) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			atomic.AddInt32(tokenRequests, 1)
+			username, password, _ := r.BasicAuth()
+			if username != "robot" || password != "s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("service") != "test-registry" || r.URL.Query().Get("scope") != "repository:team/app:pull" {
+				t.Errorf("Unexpected token request: %s", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "the-token", "expires_in": 300})
+		case "/v2/team/app/tags/list":
+			if r.Header.Get("Authorization") != "Bearer the-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:team/app:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/team/app/tags/list?n=2&last=1.1.0>; rel="next"`)
+				json.NewEncoder(w).Encode(tagsResponse{Tags: []string{"1.0.0", "1.1.0"}})
+				return
+			}
+			json.NewEncoder(w).Encode(tagsResponse{Tags: []string{"1.2.0", "latest"}})
+		case "/v2/team/app/manifests/1.2.0":
+			if r.Header.Get("Authorization") != "Bearer the-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:team/app:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			// digests are looked up without downloading the manifest
+			if r.Method != http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	restore := useTestClient(server)
+	registry := ImageRegistry{
+		Name:     "test",
+		URL:      strings.TrimPrefix(server.URL, "https://"),
+		AuthType: AuthTypeToken,
+		Username: "robot",
+		Password: "s3cret",
+	}
+	return registry, func() {
+		restore()
+		server.Close()
+	}
+}
+
+func TestBearerTokenIsFetchedAndCachedPerScope(t *testing.T) {
+	var tokenRequests int32
+	registry, cleanup := newTestRegistry(t, &tokenRequests)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		if version := registry.GetLatestVersion("team/app"); version != "1.2.0" {
+			t.Errorf("Expected [1.2.0], but got [%s]", version)
+		}
+	}
+	if tokenRequests != 1 {
+		t.Errorf("Expected the token to be fetched [1] time, but it was fetched [%d] times", tokenRequests)
+	}
+}
+
+func TestGetDigest(t *testing.T) {
+	var tokenRequests int32
+	registry, cleanup := newTestRegistry(t, &tokenRequests)
+	defer cleanup()
+
+	digest, err := registry.GetDigest("team/app", "1.2.0")
+	if err != nil || digest != "sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac" {
+		t.Errorf("Expected the digest of 1.2.0, but got [%s %+v]", digest, err)
+	}
+	if _, err := registry.GetDigest("team/app", "9.9.9"); err == nil {
+		t.Errorf("Expected an error for an unknown tag")
+	}
+}
+
+func TestBearerTokenWithWrongCredentials(t *testing.T) {
+	var tokenRequests int32
+	registry, cleanup := newTestRegistry(t, &tokenRequests)
+	defer cleanup()
+
+	registry.Password = "wrong"
+	if _, err := registry.fetch("team/app"); err == nil {
+		t.Errorf("Expected an error for wrong credentials")
+	}
+}
+
+// newRevokingRegistry stands in for a registry which only accepts the token it issued last; the token server issues a
+// token per user
+func newRevokingRegistry(t *testing.T, tokenRequests *int32) *httptest.Server {
+	var server *httptest.Server
+	var mutex sync.Mutex
+	lastToken := ""
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.URL.Path {
+		case "/token":
+			username, _, _ := r.BasicAuth()
+			lastToken = fmt.Sprintf("%s-token-%d", username, atomic.AddInt32(tokenRequests, 1))
+			json.NewEncoder(w).Encode(map[string]interface{}{"token": lastToken, "expires_in": 300})
+		case "/v2/team/app/manifests/1.0.0":
+			if r.Header.Get("Authorization") != "Bearer "+lastToken {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestRejectedTokenIsEvicted(t *testing.T) {
+	var tokenRequests int32
+	server := newRevokingRegistry(t, &tokenRequests)
+	defer server.Close()
+	defer useTestClient(server)()
+
+	registry := ImageRegistry{URL: strings.TrimPrefix(server.URL, "https://"), AuthType: AuthTypeToken, Username: "robot", Password: "s3cret"}
+	other := registry
+	other.Username = "other"
+	// other's token revokes robot's, so that robot's cached token is rejected
+	for _, r := range []ImageRegistry{registry, other, registry} {
+		if _, err := r.GetDigest("team/app", "1.0.0"); err != nil {
+			t.Errorf("Expected the digest for %s, but got [%+v]", r.Username, err)
+		}
+	}
+	if tokenRequests != 3 {
+		t.Errorf("Expected a token per user and one after the rejection, [3], but got [%d]", tokenRequests)
+	}
+	if _, ok := defaultTokenCache.get(registry.URL, "repository:team/app:pull", "robot"); !ok {
+		t.Errorf("Expected the new token of robot to be cached")
+	}
+}
+
+func TestBasicChallenge(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "robot" || password != "s3cret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(tagsResponse{Tags: []string{"2.0.0", "2.0.1"}})
+	}))
+	defer server.Close()
+	defer useTestClient(server)()
+
+	registry := ImageRegistry{URL: strings.TrimPrefix(server.URL, "https://"), AuthType: AuthTypeToken, Username: "robot", Password: "s3cret"}
+	if version := registry.GetLatestVersion("team/app"); version != "2.0.1" {
+		t.Errorf("Expected [2.0.1], but got [%s]", version)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	if expiry := (tokenResponse{}).expiry(now); !expiry.Equal(now.Add(minimumTokenExpiry)) {
+		t.Errorf("Expected the minimum expiry, but got [%s]", expiry)
+	}
+	if expiry := (tokenResponse{ExpiresIn: 300, IssuedAt: "2020-09-01T11:59:00Z"}).expiry(now); !expiry.Equal(now.Add(4 * time.Minute)) {
+		t.Errorf("Expected expiry relative to issued_at, but got [%s]", expiry)
+	}
+
+	cache := newTokenCache()
+	cache.set("registry", "scope", "robot", "expired", time.Now().Add(time.Second))
+	if _, ok := cache.get("registry", "scope", "robot"); ok {
+		t.Errorf("Expected a token about to expire not to be used")
+	}
+	cache.set("registry", "scope", "robot", "valid", time.Now().Add(time.Hour))
+	if token, ok := cache.get("registry", "scope", "robot"); !ok || token != "valid" {
+		t.Errorf("Expected [valid], but got [%s]", token)
+	}
+	if _, ok := cache.get("registry", "other-scope", "robot"); ok {
+		t.Errorf("Expected no token for another scope")
+	}
+	if _, ok := cache.get("registry", "scope", "other"); ok {
+		t.Errorf("Expected no token for another user")
+	}
+	cache.evict("registry", "scope", "robot")
+	if _, ok := cache.get("registry", "scope", "robot"); ok {
+		t.Errorf("Expected no token after eviction")
+	}
+}
@@ -0,0 +1,182 @@
+package registries
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// RequestTimeout is the timeout of a single request against a registry or token server, including reading the body
+	RequestTimeout = 30 * time.Second
+	// RequestsPerSecond is the sustained rate of requests per registry host
+	RequestsPerSecond = 5
+	// RequestBurst is the number of requests per registry host which may be sent at once
+	RequestBurst = 10
+	// MaxRetries is how often a request is retried on 429, 5xx or network errors
+	MaxRetries = 3
+	// TagCacheExpiry is how long fetched tag lists are reused
+	TagCacheExpiry = 10 * time.Minute
+)
+
+var (
+	// httpClient is used for all requests against registries and token servers
+	httpClient = &http.Client{
+		Timeout: RequestTimeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConnsPerHost:   RequestBurst,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+	// retryBackoff is the wait before the first retry, doubled for every further retry
+	retryBackoff = time.Second
+	// maxRetryAfter caps the wait requested by a Retry-After header
+	maxRetryAfter = time.Minute
+
+	defaultHostLimiters = newHostLimiters()
+	defaultTagCache     = newTagCache()
+)
+
+// doRequest sends a request, waiting for the rate limit of its host and retrying on 429, 5xx and network errors; the
+// wait honors the Retry-After header, otherwise it backs off exponentially. The body of a retried request is rewound
+// with GetBody, which http.NewRequest sets for in-memory bodies
+func doRequest(req *http.Request) (*http.Response, error) {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		if err := defaultHostLimiters.wait(req.Context(), req.URL.Host); err != nil {
+			return nil, err
+		}
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, errors.Errorf("unable to retry request to %s, its body can't be rewound", req.URL)
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to rewind the body of the request to %s", req.URL)
+			}
+			req.Body = body
+		}
+		resp, err := httpClient.Do(req)
+		if attempt >= MaxRetries || !isRetryable(resp, err) {
+			return resp, err
+		}
+
+		wait := backoff
+		if err != nil {
+			log.WithError(err).WithField("url", req.URL.String()).Debugf("request failed, retrying in %s", wait)
+		} else {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				wait = retryAfter
+			}
+			resp.Body.Close()
+			log.WithField("url", req.URL.String()).Debugf("response code [%v], retrying in %s", resp.StatusCode, wait)
+		}
+		if wait > maxRetryAfter {
+			wait = maxRetryAfter
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header of either seconds or an HTTP date
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if date.Before(now) {
+		return 0, true
+	}
+	return date.Sub(now), true
+}
+
+// hostLimiters holds a rate limiter per registry host, shared by all lookups
+type hostLimiters struct {
+	mutex    sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newHostLimiters() *hostLimiters {
+	return &hostLimiters{limiters: map[string]*rate.Limiter{}}
+}
+
+func (h *hostLimiters) wait(ctx context.Context, host string) error {
+	h.mutex.Lock()
+	limiter, ok := h.limiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(RequestsPerSecond, RequestBurst)
+		h.limiters[host] = limiter
+	}
+	h.mutex.Unlock()
+	return limiter.Wait(ctx)
+}
+
+type cachedTags struct {
+	tags    []string
+	expires time.Time
+}
+
+// tagCache holds the tags per registry and image, so that images used by several workloads are only looked up once
+type tagCache struct {
+	mutex sync.Mutex
+	tags  map[string]cachedTags
+}
+
+func newTagCache() *tagCache {
+	return &tagCache{tags: map[string]cachedTags{}}
+}
+
+func (c *tagCache) get(registry, name string) ([]string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached, ok := c.tags[registry+"|"+name]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+	return cached.tags, true
+}
+
+func (c *tagCache) set(registry, name string, tags []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tags[registry+"|"+name] = cachedTags{tags: tags, expires: time.Now().Add(TagCacheExpiry)}
+}
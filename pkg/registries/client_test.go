@@ -0,0 +1,83 @@
+package registries
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	if wait, ok := parseRetryAfter("7", now); !ok || wait != 7*time.Second {
+		t.Errorf("Expected [7s], but got [%s %t]", wait, ok)
+	}
+	if wait, ok := parseRetryAfter("Tue, 01 Sep 2020 12:00:30 GMT", now); !ok || wait != 30*time.Second {
+		t.Errorf("Expected [30s], but got [%s %t]", wait, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Errorf("Expected an invalid Retry-After to be ignored")
+	}
+}
+
+// useTestClient sends the requests against registries to server and starts with empty caches, returning a function
+// which restores the package globals
+func useTestClient(server *httptest.Server) func() {
+	client, tokens, tags, auths := httpClient, defaultTokenCache, defaultTagCache, defaultAuthCache
+	httpClient, defaultTokenCache, defaultTagCache, defaultAuthCache = server.Client(), newTokenCache(), newTagCache(), newAuthCache()
+	return func() {
+		httpClient, defaultTokenCache, defaultTagCache, defaultAuthCache = client, tokens, tags, auths
+	}
+}
+
+func TestRetryOnTooManyRequestsAndTagCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(tagsResponse{Tags: []string{"1.0.0", "1.0.1"}})
+	}))
+	defer server.Close()
+	defer useTestClient(server)()
+
+	registry := ImageRegistry{URL: strings.TrimPrefix(server.URL, "https://"), AuthType: AuthTypeNone}
+	for i := 0; i < 2; i++ {
+		tags, err := registry.GetTags("team/app")
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if len(tags) != 2 {
+			t.Errorf("Expected [2] tags, but got [%d]", len(tags))
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Expected [2] requests, one rate limited and one cached, but got [%d]", requests)
+	}
+}
+
+func TestRetriesAreLimited(t *testing.T) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer useTestClient(server)()
+	backoff := retryBackoff
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = backoff }()
+
+	registry := ImageRegistry{URL: strings.TrimPrefix(server.URL, "https://"), AuthType: AuthTypeNone}
+	if _, err := registry.GetTags("team/app"); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if requests != MaxRetries+1 {
+		t.Errorf("Expected [%d] requests, but got [%d]", MaxRetries+1, requests)
+	}
+}
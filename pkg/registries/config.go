@@ -0,0 +1,113 @@
+package registries
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
+)
+
+var (
+	// DefaultRegistryConfigPath is used when no registry config is specified; it's fine for it not to exist
+	DefaultRegistryConfigPath = fmt.Sprintf("%s/blackduck/registries.yaml", utils.GetHomeDir())
+)
+
+// LoadImageRegistries reads the registry config from path, falls back to DefaultRegistries for anything
+// not configured and resolves the credentials of every registry
+func LoadImageRegistries(path string) (ImageRegistries, error) {
+	imageRegistries := ImageRegistries{}
+
+	if path == "" {
+		path = DefaultRegistryConfigPath
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && path == DefaultRegistryConfigPath {
+		log.Debugf("no registry config found at %s, using default registries", path)
+	} else if err != nil {
+		return imageRegistries, errors.Wrapf(err, "unable to read registry config %s", path)
+	} else {
+		log.Debugf("loading registry config from %s", path)
+		if err := yaml.UnmarshalStrict(content, &imageRegistries); err != nil {
+			return imageRegistries, errors.Wrapf(err, "unable to parse registry config %s", path)
+		}
+	}
+
+	imageRegistries.DefaultRegistries()
+	if err := imageRegistries.resolveCredentials(); err != nil {
+		return imageRegistries, err
+	}
+	if err := imageRegistries.validateVersionSchemes(); err != nil {
+		return imageRegistries, err
+	}
+	return imageRegistries, nil
+}
+
+// validateVersionSchemes makes sure bad schemes and patterns are reported on load rather than per image
+func (i ImageRegistries) validateVersionSchemes() error {
+	for _, versionScheme := range i.VersionSchemes {
+		for _, image := range versionScheme.Images {
+			if _, err := regexp.Compile(image); err != nil {
+				return errors.Wrapf(err, "version scheme image regexp '%s' not valid", image)
+			}
+		}
+		if _, err := versioning.NewScheme(versionScheme.Scheme, versionScheme.Pattern); err != nil {
+			return errors.Wrapf(err, "invalid version scheme for images %v", versionScheme.Images)
+		}
+	}
+	return nil
+}
+
+func (i *ImageRegistries) resolveCredentials() error {
+	registries := []*ImageRegistry{&i.DockerHub, &i.Quay, &i.Gcr, &i.GcrK8s, &i.Zalando, &i.Gitlab}
+	for idx := range i.Registries {
+		registries = append(registries, &i.Registries[idx])
+	}
+	for idx := range i.OverrideImages {
+		registries = append(registries, &i.OverrideImages[idx].Registry)
+	}
+	for idx := range i.OverrideRegistries {
+		registries = append(registries, &i.OverrideRegistries[idx].Registry)
+	}
+
+	for _, registry := range registries {
+		if err := registry.resolveCredentials(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveCredentials fills in Username and Password from UsernameEnv, PasswordEnv and PasswordFile
+func (r *ImageRegistry) resolveCredentials() error {
+	if r.AuthType != "" && r.AuthType != AuthTypeBasic && r.AuthType != AuthTypeToken && r.AuthType != AuthTypeNone {
+		return errors.Errorf("registry '%s' has invalid auth type '%s'; one of [%s, %s, %s]", r.Name, r.AuthType, AuthTypeBasic, AuthTypeToken, AuthTypeNone)
+	}
+	if r.UsernameEnv != "" {
+		r.Username = os.Getenv(r.UsernameEnv)
+		if r.Username == "" {
+			log.Warnf("environment variable %s for the username of registry '%s' is empty", r.UsernameEnv, r.Name)
+		}
+	}
+	if r.PasswordEnv != "" {
+		r.Password = os.Getenv(r.PasswordEnv)
+		if r.Password == "" {
+			log.Warnf("environment variable %s for the password of registry '%s' is empty", r.PasswordEnv, r.Name)
+		}
+	}
+	if r.PasswordFile != "" {
+		content, err := ioutil.ReadFile(r.PasswordFile)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read password file for registry '%s'", r.Name)
+		}
+		r.Password = strings.TrimSpace(string(content))
+	}
+	return nil
+}
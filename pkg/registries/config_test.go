@@ -0,0 +1,112 @@
+package registries
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
+)
+
+func TestLoadImageRegistries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registries")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("secret-from-file\n"), 0600); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	os.Setenv("BD_XRAY_TEST_REGISTRY_USER", "robot")
+	defer os.Unsetenv("BD_XRAY_TEST_REGISTRY_USER")
+
+	config := `
+quay:
+  authType: basic
+  username: quay-user
+  passwordEnv: BD_XRAY_TEST_REGISTRY_USER
+registries:
+  - url: registry.example.com
+    usernameEnv: BD_XRAY_TEST_REGISTRY_USER
+    passwordFile: ` + passwordFile + `
+overrideImageNames:
+  team/app: team/app-renamed
+`
+	configFile := filepath.Join(dir, "registries.yaml")
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	imageRegistries, err := LoadImageRegistries(configFile)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if imageRegistries.DockerHub.URL != "registry.hub.docker.com" {
+		t.Errorf("Expected default DockerHub URL, but got [%s]", imageRegistries.DockerHub.URL)
+	}
+	if imageRegistries.Quay.AuthType != AuthTypeBasic || imageRegistries.Quay.Password != "robot" {
+		t.Errorf("Expected [%s robot], but got [%s %s]", AuthTypeBasic, imageRegistries.Quay.AuthType, imageRegistries.Quay.Password)
+	}
+
+	registry := imageRegistries.determinRegistry("team/app", "registry.example.com")
+	if registry.Name != "registry.example.com" || registry.AuthType != AuthTypeToken || registry.Username != "robot" || registry.Password != "secret-from-file" {
+		t.Errorf("Expected [registry.example.com %s robot secret-from-file], but got [%s %s %s %s]", AuthTypeToken, registry.Name, registry.AuthType, registry.Username, registry.Password)
+	}
+	if name := imageRegistries.findImageNameOverride("team/app"); name != "team/app-renamed" {
+		t.Errorf("Expected [team/app-renamed], but got [%s]", name)
+	}
+}
+
+func TestLoadImageRegistriesMissingFile(t *testing.T) {
+	if _, err := LoadImageRegistries("/does/not/exist.yaml"); err == nil {
+		t.Errorf("Expected an error for a missing registry config")
+	}
+}
+
+func TestLoadImageRegistriesVersionSchemes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registries")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := `
+versionSchemes:
+  - images: ["^minio/minio$"]
+    scheme: calver
+  - images: ["^team/"]
+    scheme: regex
+    pattern: 'build-(\d+)'
+`
+	configFile := filepath.Join(dir, "registries.yaml")
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	imageRegistries, err := LoadImageRegistries(configFile)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	scheme, err := imageRegistries.FindVersionScheme("minio/minio")
+	if _, ok := scheme.(versioning.CalverScheme); err != nil || !ok {
+		t.Errorf("Expected [%s], but got [%T %+v]", versioning.SchemeCalver, scheme, err)
+	}
+	scheme, err = imageRegistries.FindVersionScheme("team/app")
+	if _, ok := scheme.(versioning.RegexScheme); err != nil || !ok {
+		t.Errorf("Expected [%s], but got [%T %+v]", versioning.SchemeRegex, scheme, err)
+	}
+	scheme, err = imageRegistries.FindVersionScheme("library/nginx")
+	if _, ok := scheme.(versioning.SemverScheme); err != nil || !ok {
+		t.Errorf("Expected [%s], but got [%T %+v]", versioning.SchemeSemver, scheme, err)
+	}
+
+	if err := ioutil.WriteFile(configFile, []byte("versionSchemes:\n  - images: [\"^app$\"]\n    scheme: regex\n"), 0600); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err := LoadImageRegistries(configFile); err == nil {
+		t.Errorf("Expected an error for a regex scheme without a pattern")
+	}
+}
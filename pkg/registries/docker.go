@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
@@ -28,11 +29,11 @@ const (
 	Zalando = "Zalando"
 	// Gitlab is the default name for the Gitlab registry
 	Gitlab = "Gitlab"
-	// AuthTypeBasic is the basic auth type
+	// AuthTypeBasic is the basic auth type, credentials are sent with every request
 	AuthTypeBasic = "basic"
-	// AuthTypeToken is the token auth type
+	// AuthTypeToken is the token auth type, the registry's auth challenge is answered with the credentials, if any
 	AuthTypeToken = "token"
-	// AuthTypeNone is no auth
+	// AuthTypeNone is no auth, the registry's auth challenge is answered anonymously
 	AuthTypeNone = "none"
 )
 
@@ -43,44 +44,61 @@ type tagsResponse struct {
 	Tags []string `json:"tags"`
 }
 
-// ImageRegistry contains all the information about the registry
+// ImageRegistry contains all the information about the registry; UsernameEnv, PasswordEnv and PasswordFile
+// allow reading the credentials from the environment or a file instead of storing them in the config
 type ImageRegistry struct {
-	Name             string `koanf:"name"`
-	URL              string `koanf:"url"`
-	AuthType         string `koanf:"authType"`
-	Username         string `koanf:"username"`
-	Password         string `koanf:"password"`
-	Default          bool   `koanf:"default"`
+	Name             string `koanf:"name" json:"name,omitempty"`
+	URL              string `koanf:"url" json:"url,omitempty"`
+	AuthType         string `koanf:"authType" json:"authType,omitempty"`
+	Username         string `koanf:"username" json:"username,omitempty"`
+	Password         string `koanf:"password" json:"password,omitempty"`
+	Default          bool   `koanf:"default" json:"default,omitempty"`
+	UsernameEnv      string `koanf:"usernameEnv" json:"usernameEnv,omitempty"`
+	PasswordEnv      string `koanf:"passwordEnv" json:"passwordEnv,omitempty"`
+	PasswordFile     string `koanf:"passwordFile" json:"passwordFile,omitempty"`
 	AllowAllReleases bool
 }
 
 // GetLatestVersion fetches the latest version of the docker image from Docker registry
 func (r ImageRegistry) GetLatestVersion(name string) string {
-	log.WithField("registry", r.Name).WithField("image", name).Debug("Get latest version for Docker image")
+	tags, err := r.GetTags(name)
+	if err != nil {
+		log.WithError(err).WithField("name", name).Error("Could not fetch tags")
+		return versioning.Notfound
+	}
+	return versioning.FindHighestVersionInList(tags, r.AllowAllReleases)
+}
+
+// GetTags fetches all tags of the docker image from Docker registry; tags are cached for TagCacheExpiry
+func (r ImageRegistry) GetTags(name string) ([]string, error) {
+	log.WithField("registry", r.Name).WithField("image", name).Debug("Get tags for Docker image")
 
 	// If docker hub and single name (without /) add library/ to it
 	if r.Name == DockerHub && !strings.Contains(name, "/") {
 		name = "library/" + name
 	}
 
-	cacheToken := "" // reset the token
-
-	pathSuffix := fmt.Sprintf("/v2/%s/tags/list", name)
-	tags, err := r.fetch(pathSuffix, cacheToken)
+	if tags, ok := defaultTagCache.get(r.URL, name); ok {
+		log.WithField("registry", r.Name).WithField("image", name).Debug("Using cached tags")
+		return tags, nil
+	}
+	tags, err := r.fetch(name)
 	if err != nil {
-		log.WithError(err).WithField("name", name).Error("Could not fetch tags")
-		return versioning.Notfound
+		return nil, err
 	}
-	return versioning.FindHighestVersionInList(tags, r.AllowAllReleases)
+	defaultTagCache.set(r.URL, name, tags)
+	return tags, nil
 }
 
-func (r ImageRegistry) fetch(pathSuffix string, cacheToken string) ([]string, error) {
+func (r ImageRegistry) fetch(name string) ([]string, error) {
 	tags := []string{}
+	url := r.urlFor(fmt.Sprintf("/v2/%s/tags/list", name))
+	scope := pullScope(name)
 
 	for {
 		var response tagsResponse
 		var err error
-		pathSuffix, err = r.getPaginatedJSON(pathSuffix, &response, cacheToken)
+		url, err = r.getPaginatedJSON(url, scope, &response)
 		switch err {
 		case ErrNoMorePages:
 			tags = append(tags, response.Tags...)
@@ -94,53 +112,101 @@ func (r ImageRegistry) fetch(pathSuffix string, cacheToken string) ([]string, er
 	}
 }
 
-func (r ImageRegistry) getPaginatedJSON(pathSuffix string, response interface{}, cacheToken string) (string, error) {
-	client, req, err := r.getClientAndRequest(pathSuffix, cacheToken)
-	if err != nil {
-		return "", err
+// urlFor turns a path, or an absolute URL as returned in Link headers, into a URL of the registry
+func (r ImageRegistry) urlFor(pathOrURL string) string {
+	if strings.HasPrefix(pathOrURL, "https://") || strings.HasPrefix(pathOrURL, "http://") {
+		return pathOrURL
 	}
+	return fmt.Sprintf("https://%s%s", r.URL, pathOrURL)
+}
 
-	resp, err := client.Do(req)
+func (r ImageRegistry) getPaginatedJSON(url string, scope string, response interface{}) (string, error) {
+	resp, err := r.get(url, scope, nil)
 	if err != nil {
 		return "", err
-	} else if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Response code was not 200 but [%v]", resp.StatusCode)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Response code was not 200 but [%v]", resp.StatusCode)
+	}
 
 	decoder := json.NewDecoder(resp.Body)
 	err = decoder.Decode(response)
 	if err != nil {
 		return "", err
 	}
-	return getNextLink(resp)
-}
-
-func (r ImageRegistry) getClientAndRequest(pathSuffix string, cacheToken string) (*http.Client, *http.Request, error) {
-	url := fmt.Sprintf("https://%s%s", r.URL, pathSuffix)
-	log.WithField("url", url).Debugf("Try fetching url")
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	next, err := getNextLink(resp)
 	if err != nil {
-		return nil, nil, err
+		return "", err
 	}
+	return r.urlFor(next), nil
+}
 
-	if r.AuthType == AuthTypeBasic {
-		req.SetBasicAuth(r.Username, r.Password)
-	}
+// get issues an authorized GET request against the registry
+func (r ImageRegistry) get(url string, scope string, header http.Header) (*http.Response, error) {
+	return r.request(http.MethodGet, url, scope, header)
+}
+
+// head issues an authorized HEAD request against the registry, i.e.: to read the headers of a manifest without
+// downloading it
+func (r ImageRegistry) head(url string, scope string, header http.Header) (*http.Response, error) {
+	return r.request(http.MethodHead, url, scope, header)
+}
 
-	if r.AuthType == AuthTypeToken && cacheToken == "" {
-		log.Debug("Need to fetch the auth token")
-		cacheToken, err = r.getToken(url)
+// request issues an authorized request against the registry; a cached token for the scope and user is sent along,
+// and on a 401 the rejected token is evicted, the WWW-Authenticate challenge is answered and the request retried once
+func (r ImageRegistry) request(method, url string, scope string, header http.Header) (*http.Response, error) {
+	log.WithField("method", method).WithField("url", url).Debugf("Try fetching url")
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(method, url, nil)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
+		}
+		for key, values := range header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
 		}
+		return req, nil
 	}
-	if cacheToken != "" {
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	var auth authn.AuthConfig
+	if r.AuthType != AuthTypeNone {
+		auth = r.Auth()
+	}
+	user := tokenUser(auth)
+	sentToken := ""
+	if r.AuthType == AuthTypeBasic {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	} else if token, ok := defaultTokenCache.get(r.URL, scope, user); ok {
 		log.Debug("Using cached token")
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cacheToken))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		sentToken = token
+	}
+
+	resp, err := doRequest(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenges := parseChallenges(resp.Header)
+	resp.Body.Close()
+	if sentToken != "" {
+		log.Debug("Cached token was rejected")
+		defaultTokenCache.evict(r.URL, scope, user)
+	}
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.answerChallenges(req, challenges, scope, auth, sentToken); err != nil {
+		return nil, err
 	}
-	return client, req, nil
+	return doRequest(req)
 }
 
 // Matches an RFC 5988 (https://tools.ietf.org/html/rfc5988#section-5)
@@ -162,74 +228,3 @@ func getNextLink(resp *http.Response) (string, error) {
 	}
 	return "", ErrNoMorePages
 }
-
-func (r ImageRegistry) getToken(url string) (cacheToken string, err error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	// Check if we need to login and find out the token url
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	} else if resp.StatusCode != http.StatusUnauthorized {
-		return "", fmt.Errorf("Response code was not Unauthorized but [%v]", resp.StatusCode)
-	}
-	defer resp.Body.Close()
-
-	// Get token url and login to get the token
-	tokenURL, err := parsHeaders(resp.Header)
-	if err != nil {
-		return "", err
-	}
-
-	log.WithField("url", tokenURL).Debug("Token url")
-	client = &http.Client{}
-	req, err = http.NewRequest("GET", tokenURL, nil)
-	if err != nil {
-		return "", err
-	}
-
-	if r.Username != "" || r.Password != "" {
-		req.SetBasicAuth(r.Username, r.Password)
-	}
-
-	resp, err = client.Do(req)
-	if err != nil {
-		return "", err
-	} else if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Response code was not Oke but [%v]", resp.StatusCode)
-	}
-	defer resp.Body.Close()
-
-	var authToken authToken
-	decoder := json.NewDecoder(resp.Body)
-	err = decoder.Decode(&authToken)
-	if err != nil {
-		return "", err
-	}
-
-	cacheToken = authToken.Token
-	return cacheToken, nil
-}
-
-type authToken struct {
-	Token string `json:"token"`
-}
-
-// example: Www-Authenticate: Bearer realm="https://auth.docker.io/token",service="r.docker.io",scope="repository:library/ubuntu:pull"
-func parsHeaders(headers http.Header) (string, error) {
-	authHeader := headers[http.CanonicalHeaderKey("WWW-Authenticate")]
-	if len(authHeader) > 1 {
-		return "", fmt.Errorf("Not expecting more than one auth header [%v]", authHeader)
-	}
-	log.WithField("header", authHeader[0]).Debug("Incoming auth header]")
-	url := strings.ReplaceAll(authHeader[0], "Bearer realm=", "") // Default registries
-	url = strings.ReplaceAll(url, "Basic realm=", "")             // ECR
-	url = strings.Replace(url, ",", "?", 1)
-	url = strings.ReplaceAll(url, ",", "&")
-	url = strings.ReplaceAll(url, "\"", "")
-	return url, nil
-}
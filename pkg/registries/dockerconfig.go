@@ -0,0 +1,120 @@
+package registries
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DockerConfig is the format of ~/.docker/config.json and of kubernetes.io/dockerconfigjson secrets
+type DockerConfig struct {
+	Auths       map[string]DockerAuth `json:"auths"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+}
+
+// DockerAuth holds the credentials of a single registry, either as username and password or as base64 encoded 'username:password'
+type DockerAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// ParseDockerConfigJSON parses the content of a kubernetes.io/dockerconfigjson secret or a docker config.json
+func ParseDockerConfigJSON(data []byte) (*DockerConfig, error) {
+	var config DockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse docker config json")
+	}
+	return &config, nil
+}
+
+// ParseDockercfg parses the content of a legacy kubernetes.io/dockercfg secret, which holds the auths without the wrapping object
+func ParseDockercfg(data []byte) (*DockerConfig, error) {
+	var auths map[string]DockerAuth
+	if err := json.Unmarshal(data, &auths); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse dockercfg")
+	}
+	return &DockerConfig{Auths: auths}, nil
+}
+
+// Credentials returns the username and password, decoding Auth if they are not set explicitly
+func (a DockerAuth) Credentials() (string, string, error) {
+	if a.Username != "" || a.Password != "" || a.Auth == "" {
+		return a.Username, a.Password, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "unable to decode auth")
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", errors.Errorf("auth is not of the form 'username:password'")
+	}
+	return parts[0], parts[1], nil
+}
+
+// NormalizeRegistryHost turns a docker config key, i.e.: https://index.docker.io/v1/, into a registry host
+func NormalizeRegistryHost(host string) string {
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	if idx := strings.Index(host, "/"); idx != -1 {
+		host = host[:idx]
+	}
+	return host
+}
+
+// AddDockerConfig adds the credentials of every registry in a docker config, see AddCredentials
+func (i *ImageRegistries) AddDockerConfig(config *DockerConfig) {
+	for host, auth := range config.Auths {
+		username, password, err := auth.Credentials()
+		if err != nil {
+			log.Warnf("skipping credentials for registry '%s': %+v", host, err)
+			continue
+		}
+		i.AddCredentials(host, username, password)
+	}
+}
+
+// AddCredentials sets the credentials of the registry at host, adding a registry for it if none is configured;
+// credentials which are already configured take precedence
+func (i *ImageRegistries) AddCredentials(host, username, password string) {
+	host = NormalizeRegistryHost(host)
+	if username == "" && password == "" {
+		return
+	}
+
+	var registry *ImageRegistry
+	for _, builtin := range []*ImageRegistry{&i.Quay, &i.Gcr, &i.GcrK8s, &i.Zalando, &i.Gitlab} {
+		if builtin.URL == host {
+			registry = builtin
+		}
+	}
+	if dockerHubURLs[host] {
+		registry = &i.DockerHub
+	}
+	for idx := range i.Registries {
+		if i.Registries[idx].URL == host {
+			registry = &i.Registries[idx]
+		}
+	}
+	if registry == nil {
+		log.Debugf("adding registry '%s' with credentials", host)
+		i.Registries = append(i.Registries, ImageRegistry{Name: host, URL: host, AuthType: AuthTypeToken, Username: username, Password: password})
+		return
+	}
+
+	if registry.Username != "" || registry.Password != "" {
+		log.Debugf("registry '%s' already has credentials configured, not overriding them", host)
+		return
+	}
+	log.Debugf("setting credentials of registry '%s'", host)
+	registry.Username = username
+	registry.Password = password
+	if registry.AuthType == AuthTypeNone || registry.AuthType == "" {
+		registry.AuthType = AuthTypeToken
+	}
+}
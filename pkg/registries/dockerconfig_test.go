@@ -0,0 +1,41 @@
+package registries
+
+import "testing"
+
+func TestAddDockerConfig(t *testing.T) {
+	// auth is base64 of 'robot:s3cret'
+	config, err := ParseDockerConfigJSON([]byte(`{"auths": {
+		"https://index.docker.io/v1/": {"username": "hub-user", "password": "hub-password"},
+		"quay.io": {"auth": "cm9ib3Q6czNjcmV0"},
+		"registry.example.com:5000": {"auth": "cm9ib3Q6czNjcmV0"}
+	}}`))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	imageRegistries := ImageRegistries{}
+	imageRegistries.DefaultRegistries()
+	imageRegistries.AddDockerConfig(config)
+
+	if imageRegistries.DockerHub.Username != "hub-user" || imageRegistries.DockerHub.Password != "hub-password" {
+		t.Errorf("Expected [hub-user hub-password], but got [%s %s]", imageRegistries.DockerHub.Username, imageRegistries.DockerHub.Password)
+	}
+	if imageRegistries.Quay.Username != "robot" || imageRegistries.Quay.AuthType != AuthTypeToken {
+		t.Errorf("Expected [robot %s], but got [%s %s]", AuthTypeToken, imageRegistries.Quay.Username, imageRegistries.Quay.AuthType)
+	}
+	registry := imageRegistries.FindRegistryByURL("registry.example.com:5000")
+	if registry.Username != "robot" || registry.Password != "s3cret" {
+		t.Errorf("Expected [robot s3cret], but got [%s %s]", registry.Username, registry.Password)
+	}
+}
+
+func TestAddCredentialsDoesNotOverrideConfigured(t *testing.T) {
+	imageRegistries := ImageRegistries{Registries: []ImageRegistry{{URL: "registry.example.com", Username: "configured", Password: "configured"}}}
+	imageRegistries.DefaultRegistries()
+	imageRegistries.AddCredentials("registry.example.com", "from-secret", "from-secret")
+
+	registry := imageRegistries.FindRegistryByURL("registry.example.com")
+	if registry.Username != "configured" {
+		t.Errorf("Expected [configured], but got [%s]", registry.Username)
+	}
+}
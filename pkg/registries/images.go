@@ -2,37 +2,52 @@ package registries
 
 import (
 	"regexp"
+	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
 )
 
 // ImageRegistries contains all the information regarding image registries
 type ImageRegistries struct {
-	DockerHub          ImageRegistry      `koanf:"dockerHub"`
-	Quay               ImageRegistry      `koanf:"quay"`
-	Gcr                ImageRegistry      `koanf:"gcr"`
-	GcrK8s             ImageRegistry      `koanf:"gcrK8s"`
-	Zalando            ImageRegistry      `koanf:"zalando"`
-	Gitlab             ImageRegistry      `koanf:"gitlab"`
-	OverrideImages     []OverrideImage    `koanf:"override"`
-	OverrideRegistries []OverrideRegistry `koanf:"overrideRegistries"`
-	OverrideImageNames map[string]string  `koanf:"overrideImageNames"`
+	DockerHub          ImageRegistry      `koanf:"dockerHub" json:"dockerHub,omitempty"`
+	Quay               ImageRegistry      `koanf:"quay" json:"quay,omitempty"`
+	Gcr                ImageRegistry      `koanf:"gcr" json:"gcr,omitempty"`
+	GcrK8s             ImageRegistry      `koanf:"gcrK8s" json:"gcrK8s,omitempty"`
+	Zalando            ImageRegistry      `koanf:"zalando" json:"zalando,omitempty"`
+	Gitlab             ImageRegistry      `koanf:"gitlab" json:"gitlab,omitempty"`
+	OverrideImages     []OverrideImage    `koanf:"override" json:"override,omitempty"`
+	OverrideRegistries []OverrideRegistry `koanf:"overrideRegistries" json:"overrideRegistries,omitempty"`
+	OverrideImageNames map[string]string  `koanf:"overrideImageNames" json:"overrideImageNames,omitempty"`
+	// Registries are additional registries, i.e.: private registries, looked up by URL or name
+	Registries []ImageRegistry `koanf:"registries" json:"registries,omitempty"`
+	// VersionSchemes select how the tags of images are parsed, semver is used for all other images
+	VersionSchemes []ImageVersionScheme `koanf:"versionSchemes" json:"versionSchemes,omitempty"`
+}
+
+// ImageVersionScheme selects the version scheme, see versioning.NewScheme, for images matching any of the regular expressions
+type ImageVersionScheme struct {
+	Images  []string `koanf:"images" json:"images,omitempty"`
+	Scheme  string   `koanf:"scheme" json:"scheme,omitempty"`
+	Pattern string   `koanf:"pattern" json:"pattern,omitempty"`
 }
 
 // OverrideImage contains information about which registry to use, it overrides the URL used in kubernetes
 type OverrideImage struct {
-	Images           []string      `koanf:"images"`
-	Registry         ImageRegistry `koanf:"registry"`
-	RegistryName     string        `koanf:"registryName"`
-	AllowAllReleases bool          `koanf:"allowAllReleases"`
+	Images           []string      `koanf:"images" json:"images,omitempty"`
+	Registry         ImageRegistry `koanf:"registry" json:"registry,omitempty"`
+	RegistryName     string        `koanf:"registryName" json:"registryName,omitempty"`
+	AllowAllReleases bool          `koanf:"allowAllReleases" json:"allowAllReleases,omitempty"`
 }
 
 // OverrideRegistry contains information about which registry to use, it overrides the URL used in kubernetes
 type OverrideRegistry struct {
-	Urls             []string      `koanf:"urls"`
-	Registry         ImageRegistry `koanf:"registry"`
-	RegistryName     string        `koanf:"registryName"`
-	AllowAllReleases bool          `koanf:"allowAllReleases"`
+	Urls             []string      `koanf:"urls" json:"urls,omitempty"`
+	Registry         ImageRegistry `koanf:"registry" json:"registry,omitempty"`
+	RegistryName     string        `koanf:"registryName" json:"registryName,omitempty"`
+	AllowAllReleases bool          `koanf:"allowAllReleases" json:"allowAllReleases,omitempty"`
 }
 
 // DefaultRegistries sets default values for registries
@@ -44,31 +59,40 @@ func (i *ImageRegistries) DefaultRegistries() {
 	i.Quay.Name = Quay
 	i.Quay.URL = "quay.io"
 	if i.Quay.AuthType == "" {
-		i.Quay.AuthType = AuthTypeNone
+		i.Quay.AuthType = AuthTypeToken
 	}
 
 	i.Gcr.Name = Gcr
 	i.Gcr.URL = "gcr.io"
 	if i.Gcr.AuthType == "" {
-		i.Gcr.AuthType = AuthTypeNone
+		i.Gcr.AuthType = AuthTypeToken
 	}
 
 	i.GcrK8s.Name = GcrK8s
 	i.GcrK8s.URL = "k8s.gcr.io"
 	if i.GcrK8s.AuthType == "" {
-		i.GcrK8s.AuthType = AuthTypeNone
+		i.GcrK8s.AuthType = AuthTypeToken
 	}
 
 	i.Zalando.Name = Zalando
 	i.Zalando.URL = "registry.opensource.zalan.do"
 	if i.Zalando.AuthType == "" {
-		i.Zalando.AuthType = AuthTypeNone
+		i.Zalando.AuthType = AuthTypeToken
 	}
 
 	i.Gitlab.Name = Gitlab
 	i.Gitlab.URL = "registry.gitlab.com"
 	if i.Gitlab.AuthType == "" {
-		i.Gitlab.AuthType = AuthTypeNone
+		i.Gitlab.AuthType = AuthTypeToken
+	}
+
+	for idx := range i.Registries {
+		if i.Registries[idx].Name == "" {
+			i.Registries[idx].Name = i.Registries[idx].URL
+		}
+		if i.Registries[idx].AuthType == "" {
+			i.Registries[idx].AuthType = AuthTypeToken
+		}
 	}
 }
 
@@ -79,6 +103,28 @@ func (i ImageRegistries) GetLatestVersionForImage(name, url string) string {
 	return registry.GetLatestVersion(name)
 }
 
+// GetTagsForImage gets all tags for image together with the registry they were fetched from
+func (i ImageRegistries) GetTagsForImage(name, url string) ([]string, ImageRegistry, error) {
+	registry := i.determinRegistry(name, url)
+	name = i.findImageNameOverride(name)
+	tags, err := registry.GetTags(name)
+	return tags, registry, err
+}
+
+// GetCreatedForImage gets the creation date of the image config of a tag or digest of image
+func (i ImageRegistries) GetCreatedForImage(name, url, reference string) (time.Time, error) {
+	registry := i.determinRegistry(name, url)
+	name = i.findImageNameOverride(name)
+	return registry.GetCreated(name, reference)
+}
+
+// GetDigestForImage resolves a tag of image to its digest
+func (i ImageRegistries) GetDigestForImage(name, url, reference string) (string, error) {
+	registry := i.determinRegistry(name, url)
+	name = i.findImageNameOverride(name)
+	return registry.GetDigest(name, reference)
+}
+
 func (i ImageRegistries) determinRegistry(name, url string) ImageRegistry {
 	registry, exists := i.FindRegistryByOverrideByImage(name)
 	if exists {
@@ -98,6 +144,22 @@ func (i ImageRegistries) determinRegistry(name, url string) ImageRegistry {
 	return i.FindRegistryByURL(url)
 }
 
+// FindVersionScheme finds the version scheme configured for the image, default is semver
+func (i ImageRegistries) FindVersionScheme(name string) (versioning.Scheme, error) {
+	for _, versionScheme := range i.VersionSchemes {
+		for _, image := range versionScheme.Images {
+			match, err := regexp.MatchString(image, name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "version scheme image regexp '%s' not valid", image)
+			}
+			if match {
+				return versioning.NewScheme(versionScheme.Scheme, versionScheme.Pattern)
+			}
+		}
+	}
+	return versioning.SemverScheme{}, nil
+}
+
 func (i ImageRegistries) findImageNameOverride(name string) string {
 	overrideName := i.OverrideImageNames[name]
 	if overrideName == "" {
@@ -162,7 +224,17 @@ func (i ImageRegistries) GetDefaultRegistry() (ImageRegistry, bool) {
 	return ImageRegistry{}, false
 }
 
-// FindRegistryByURL finds the configured registry by URL, default is DockerHub
+// dockerHubURLs are the hosts under which Docker Hub images are referenced
+var dockerHubURLs = map[string]bool{
+	"":                        true,
+	"docker.io":               true,
+	"index.docker.io":         true,
+	"registry-1.docker.io":    true,
+	"registry.hub.docker.com": true,
+}
+
+// FindRegistryByURL finds the configured registry by URL, Docker Hub hosts resolve to DockerHub
+// and any other host resolves to a registry at that URL
 func (i ImageRegistries) FindRegistryByURL(url string) ImageRegistry {
 	if i.Quay.URL == url {
 		return i.Quay
@@ -174,8 +246,15 @@ func (i ImageRegistries) FindRegistryByURL(url string) ImageRegistry {
 		return i.Zalando
 	} else if i.Gitlab.URL == url {
 		return i.Gitlab
+	} else if dockerHubURLs[url] {
+		return i.DockerHub
 	}
-	return i.DockerHub
+	for _, registry := range i.Registries {
+		if registry.URL == url {
+			return registry
+		}
+	}
+	return ImageRegistry{Name: url, URL: url, AuthType: AuthTypeToken}
 }
 
 // FindRegistryByName finds the configured registry by name, default is DockerHub
@@ -191,5 +270,10 @@ func (i ImageRegistries) FindRegistryByName(name string) ImageRegistry {
 	} else if i.Gitlab.Name == name {
 		return i.Gitlab
 	}
+	for _, registry := range i.Registries {
+		if registry.Name == name {
+			return registry
+		}
+	}
 	return i.DockerHub
 }
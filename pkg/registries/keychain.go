@@ -0,0 +1,79 @@
+package registries
+
+import (
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultKeychain resolves credentials the way `docker pull` does, from the docker config.json in $DOCKER_CONFIG or
+// ~/.docker including credHelpers, credsStore and identity tokens
+var DefaultKeychain = authn.DefaultKeychain
+
+// authCache holds the credentials resolved from DefaultKeychain per registry host, so that config.json isn't read and
+// credential helpers aren't run again for every request; failed lookups are cached as anonymous
+type authCache struct {
+	mutex sync.Mutex
+	auths map[string]authn.AuthConfig
+}
+
+var defaultAuthCache = newAuthCache()
+
+func newAuthCache() *authCache {
+	return &authCache{auths: map[string]authn.AuthConfig{}}
+}
+
+func (c *authCache) get(host string) authn.AuthConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if auth, ok := c.auths[host]; ok {
+		return auth
+	}
+	var auth authn.AuthConfig
+	resolved, err := resolveAuth(host)
+	if err != nil {
+		log.Warnf("unable to resolve credentials for registry '%s', continuing anonymously: %+v", host, err)
+	} else {
+		auth = *resolved
+	}
+	c.auths[host] = auth
+	return auth
+}
+
+// resolveAuth looks up the credentials of a registry host in DefaultKeychain
+func resolveAuth(host string) (*authn.AuthConfig, error) {
+	host = NormalizeRegistryHost(host)
+	if dockerHubURLs[host] {
+		host = name.DefaultRegistry
+	}
+	registry, err := name.NewRegistry(host, name.WeakValidation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid registry '%s'", host)
+	}
+	authenticator, err := DefaultKeychain.Resolve(registry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to resolve credentials of '%s'", host)
+	}
+	return authenticator.Authorization()
+}
+
+// Auth returns the configured credentials of the registry, or the ones from DefaultKeychain if none are configured,
+// which are resolved once per registry host
+func (r ImageRegistry) Auth() authn.AuthConfig {
+	if r.Username != "" || r.Password != "" {
+		return authn.AuthConfig{Username: r.Username, Password: r.Password}
+	}
+	if DefaultKeychain == nil || r.URL == "" {
+		return authn.AuthConfig{}
+	}
+	return defaultAuthCache.get(r.URL)
+}
+
+// Credentials returns the username and password of Auth
+func (r ImageRegistry) Credentials() (string, string) {
+	auth := r.Auth()
+	return auth.Username, auth.Password
+}
@@ -0,0 +1,142 @@
+package registries
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// withDockerConfig points DOCKER_CONFIG to a temporary directory holding config and starts with an empty credentials
+// cache, returning a function which restores both
+func withDockerConfig(t *testing.T, config string) (string, func()) {
+	dir, err := ioutil.TempDir("", "keychain")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	dockerConfig, ok := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	auths := defaultAuthCache
+	defaultAuthCache = newAuthCache()
+	return dir, func() {
+		defaultAuthCache = auths
+		if ok {
+			os.Setenv("DOCKER_CONFIG", dockerConfig)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDefaultKeychain(t *testing.T) {
+	dir, restore := withDockerConfig(t, `{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "aHViLXVzZXI6aHViLXBhc3N3b3Jk"},
+			"harbor.example.com": {"identitytoken": "harbor-identity-token"}
+		},
+		"credHelpers": {"gcr.io": "fake"}
+	}`)
+	defer restore()
+
+	// a fake credential helper which only knows about gcr.io, and counts its runs
+	helper := `#!/bin/sh
+read server
+echo "$server" >> "$(dirname "$0")/runs"
+if [ "$server" = "gcr.io" ]; then
+  echo '{"ServerURL":"gcr.io","Username":"oauth2accesstoken","Secret":"gcr-token"}'
+else
+  echo "credentials not found in native keychain"
+  exit 1
+fi
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(helper), 0755); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	expectations := map[string]authn.AuthConfig{
+		"registry.hub.docker.com": {Username: "hub-user", Password: "hub-password"},
+		"gcr.io":                  {Username: "oauth2accesstoken", Password: "gcr-token"},
+		"harbor.example.com":      {IdentityToken: "harbor-identity-token"},
+		"quay.io":                 {},
+	}
+	for i := 0; i < 2; i++ {
+		for host, expected := range expectations {
+			auth := ImageRegistry{URL: host}.Auth()
+			if auth.Username != expected.Username || auth.Password != expected.Password || auth.IdentityToken != expected.IdentityToken {
+				t.Errorf("Expected [%+v] for %s, but got [%+v]", expected, host, auth)
+			}
+		}
+	}
+	// the credentials are resolved once per host
+	if runs, err := ioutil.ReadFile(filepath.Join(dir, "runs")); err != nil || strings.Count(string(runs), "gcr.io") != 1 {
+		t.Errorf("Expected the credential helper to run once for gcr.io, but got [%s %+v]", runs, err)
+	}
+
+	configured := ImageRegistry{URL: "gcr.io", Username: "robot", Password: "s3cret"}.Auth()
+	if configured.Username != "robot" || configured.Password != "s3cret" {
+		t.Errorf("Expected the configured credentials [robot s3cret], but got [%+v]", configured)
+	}
+}
+
+func TestIdentityTokenIsExchanged(t *testing.T) {
+	var server *httptest.Server
+	var tokenRequests int32
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			r.ParseForm()
+			// the retried exchange sends the form again
+			if atomic.AddInt32(&tokenRequests, 1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Method != http.MethodPost || r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != "the-identity-token" ||
+				r.PostForm.Get("service") != "test-registry" || r.PostForm.Get("scope") != "repository:team/app:pull" || r.PostForm.Get("client_id") != tokenClientID {
+				t.Errorf("Unexpected token request: %s %+v", r.Method, r.PostForm)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "the-token", "expires_in": 300})
+		case "/v2/team/app/tags/list":
+			if r.Header.Get("Authorization") != "Bearer the-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:team/app:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(tagsResponse{Tags: []string{"1.0.0", "1.1.0"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	_, restore := withDockerConfig(t, fmt.Sprintf(`{"auths": {"%s": {"identitytoken": "the-identity-token"}}}`, host))
+	defer restore()
+
+	defer useTestClient(server)()
+
+	registry := ImageRegistry{Name: "test", URL: host, AuthType: AuthTypeToken}
+	if version := registry.GetLatestVersion("team/app"); version != "1.1.0" {
+		t.Errorf("Expected [1.1.0], but got [%s]", version)
+	}
+	if tokenRequests != 2 {
+		t.Errorf("Expected the token to be requested [2] times, but it was requested [%d] times", tokenRequests)
+	}
+}
@@ -0,0 +1,130 @@
+package registries
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// manifest covers both image manifests and manifest lists / indexes
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+type imageConfig struct {
+	Created time.Time `json:"created"`
+}
+
+// GetCreated fetches the creation date from the image config of the tag or digest; for multi-platform
+// images the linux/amd64 image is used
+func (r ImageRegistry) GetCreated(name, reference string) (time.Time, error) {
+	// If docker hub and single name (without /) add library/ to it
+	if r.Name == DockerHub && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	scope := pullScope(name)
+
+	m, err := r.getManifest(name, reference, scope)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(m.Manifests) > 0 {
+		platformDigest := m.Manifests[0].Digest
+		for _, platformManifest := range m.Manifests {
+			if platformManifest.Platform.OS == "linux" && platformManifest.Platform.Architecture == "amd64" {
+				platformDigest = platformManifest.Digest
+				break
+			}
+		}
+		m, err = r.getManifest(name, platformDigest, scope)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	if m.Config.Digest == "" {
+		return time.Time{}, errors.Errorf("manifest of '%s:%s' has no config, media type '%s' is not supported", name, reference, m.MediaType)
+	}
+
+	resp, err := r.get(r.urlFor(fmt.Sprintf("/v2/%s/blobs/%s", name, m.Config.Digest)), scope, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("Response code was not 200 but [%v]", resp.StatusCode)
+	}
+	var config imageConfig
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return time.Time{}, errors.Wrapf(err, "unable to parse image config of '%s:%s'", name, reference)
+	}
+	log.WithField("image", name).WithField("reference", reference).Debugf("created at %s", config.Created)
+	return config.Created, nil
+}
+
+// GetDigest resolves a tag to the digest of its manifest (or manifest list), as reported by the registry in the
+// Docker-Content-Digest header of a HEAD request, so that the manifest isn't downloaded; HEAD requests of Docker Hub
+// don't count against its pull rate limit
+func (r ImageRegistry) GetDigest(name, reference string) (string, error) {
+	// If docker hub and single name (without /) add library/ to it
+	if r.Name == DockerHub && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	resp, err := r.head(r.urlFor(fmt.Sprintf("/v2/%s/manifests/%s", name, reference)), pullScope(name), manifestHeader())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Response code was not 200 but [%v]", resp.StatusCode)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.Errorf("registry returned no digest for '%s:%s'", name, reference)
+	}
+	log.WithField("image", name).WithField("reference", reference).Debugf("digest %s", digest)
+	return digest, nil
+}
+
+func manifestHeader() http.Header {
+	header := http.Header{}
+	header.Set("Accept", strings.Join([]string{mediaTypeDockerManifest, mediaTypeDockerManifestList, mediaTypeOCIManifest, mediaTypeOCIIndex}, ", "))
+	return header
+}
+
+func (r ImageRegistry) getManifest(name, reference, scope string) (*manifest, error) {
+	resp, err := r.get(r.urlFor(fmt.Sprintf("/v2/%s/manifests/%s", name, reference)), scope, manifestHeader())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Response code was not 200 but [%v]", resp.StatusCode)
+	}
+	var m manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse manifest of '%s:%s'", name, reference)
+	}
+	return &m, nil
+}
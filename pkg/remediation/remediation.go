@@ -2,55 +2,117 @@ package remediation
 
 import (
 	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/blackducksoftware/kubectl-bd-xray/pkg/registries"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
 )
 
 // Image holds the Docker image information of the container running in the cluster
 type Image struct {
 	FullPath string
-	URL      string
-	Name     string
-	Version  string
+	// URL is the registry host, i.e.: index.docker.io, quay.io
+	URL string
+	// Name is the full repository path within the registry, i.e.: library/ubuntu, prometheus/node-exporter
+	Name    string
+	Version string
+	Digest  string
+}
+
+// NewImage parses an image reference, i.e.: quay.io/prometheus/node-exporter:v1.0.1, into its registry, repository, tag and digest
+func NewImage(fullImageName string) (Image, error) {
+	image := Image{FullPath: fullImageName}
+
+	base := fullImageName
+	if parts := strings.SplitN(fullImageName, "@", 2); len(parts) == 2 {
+		base = parts[0]
+		digest, err := name.NewDigest(fullImageName, name.WeakValidation)
+		if err != nil {
+			return image, errors.Wrapf(err, "unable to parse image digest of '%s'", fullImageName)
+		}
+		image.Digest = digest.DigestStr()
+	}
+
+	// a tag is only present if the last path component has a ':', otherwise the ':' belongs to the registry port
+	hasTag := strings.Contains(base[strings.LastIndex(base, "/")+1:], ":")
+	if hasTag || image.Digest == "" {
+		tag, err := name.NewTag(base, name.WeakValidation)
+		if err != nil {
+			return image, errors.Wrapf(err, "unable to parse image reference '%s'", fullImageName)
+		}
+		image.URL = tag.Context().RegistryStr()
+		image.Name = tag.Context().RepositoryStr()
+		image.Version = tag.TagStr()
+		return image, nil
+	}
+
+	repository, err := name.NewRepository(base, name.WeakValidation)
+	if err != nil {
+		return image, errors.Wrapf(err, "unable to parse image repository of '%s'", fullImageName)
+	}
+	image.URL = repository.RegistryStr()
+	image.Name = repository.RepositoryStr()
+	return image, nil
 }
 
 // ContainerInfo contains pod information about the container, its version info, and security
 type ContainerInfo struct {
 	Container                  Image
 	LatestVersion              string
+	Recommendation             versioning.Recommendation
+	Staleness                  Staleness
 	Fetched                    bool
 	VulnerabilitiesNotAccepted int
 }
 
-// GetLatestVersionsForImages contains gets the latest version of images
+// Staleness holds how far behind the latest major recommendation an image is; the score is 100 points per
+// major, 10 per minor and 1 per patch release behind, plus 1 point per 30 days between the creation dates
+type Staleness struct {
+	CurrentCreated time.Time
+	LatestCreated  time.Time
+	AgeGap         time.Duration
+	Score          int
+}
+
+// NewStaleness computes the staleness of an image from its recommendation and the creation dates, which may be unknown
+func NewStaleness(recommendation versioning.Recommendation, currentCreated, latestCreated time.Time) Staleness {
+	staleness := Staleness{
+		CurrentCreated: currentCreated,
+		LatestCreated:  latestCreated,
+		Score:          100*recommendation.MajorsBehind + 10*recommendation.MinorsBehind + recommendation.PatchesBehind,
+	}
+	if !currentCreated.IsZero() && latestCreated.After(currentCreated) {
+		staleness.AgeGap = latestCreated.Sub(currentCreated)
+		staleness.Score += int(staleness.AgeGap.Hours() / 24 / 30)
+	}
+	return staleness
+}
+
+// AgeGapDays is the gap between the creation dates in days
+func (s Staleness) AgeGapDays() int {
+	return int(s.AgeGap.Hours() / 24)
+}
+
+// GetLatestVersionsForImages gets the latest version of images, looking them up at once; callers scanning images
+// concurrently limit the lookups themselves
 func GetLatestVersionsForImages(containers []Image, registries registries.ImageRegistries) []ContainerInfo {
 	var wg sync.WaitGroup
-	var containerInfo []ContainerInfo
-	queue := make(chan ContainerInfo, 1)
-	wg.Add(len(containers))
+	containerInfo := make([]ContainerInfo, len(containers))
 	log.WithField("lcm", "getLatestVersionsForContainers").Debugf("all containers slice is %+v", containers)
-	for _, container := range containers {
+	for idx, container := range containers {
 		log.WithField("lcm", "getLatestVersionsForContainers").Debugf("current container is %+v", container)
-		go func(container Image) {
-			version := registries.GetLatestVersionForImage(container.Name, container.URL)
-			newContainerInfo := ContainerInfo{
-				Container:     container,
-				LatestVersion: version,
-			}
-			queue <- newContainerInfo
-		}(container)
-	}
-
-	go func() {
-		for t := range queue {
-			containerInfo = append(containerInfo, t)
-			wg.Done()
-		}
-	}()
-
+		wg.Add(1)
+		go func(idx int, container Image) {
+			defer wg.Done()
+			containerInfo[idx] = GetLatestVersionForImage(container, registries)
+		}(idx, container)
+	}
 	wg.Wait()
 	log.WithField("lcm", "getLatestVersionsForContainers").Debugf("containerInfo slice is %+v", containerInfo)
 
@@ -59,3 +121,52 @@ func GetLatestVersionsForImages(containers []Image, registries registries.ImageR
 	})
 	return containerInfo
 }
+
+// GetLatestVersionForImage gets the latest version of an image and the recommended patch, minor and major upgrades
+func GetLatestVersionForImage(container Image, registries registries.ImageRegistries) ContainerInfo {
+	containerInfo := ContainerInfo{
+		Container:      container,
+		LatestVersion:  versioning.Notfound,
+		Recommendation: versioning.NewRecommendation(container.Version),
+	}
+	tags, registry, err := registries.GetTagsForImage(container.Name, container.URL)
+	if err != nil {
+		log.WithError(err).WithField("name", container.Name).Error("Could not fetch tags")
+		return containerInfo
+	}
+	scheme, err := registries.FindVersionScheme(container.Name)
+	if err != nil {
+		log.WithError(err).WithField("name", container.Name).Error("Could not find version scheme")
+		return containerInfo
+	}
+	containerInfo.Fetched = true
+	containerInfo.Recommendation = versioning.FindRecommendationWithScheme(container.Version, tags, registry.AllowAllReleases, scheme)
+	if _, ok := scheme.(versioning.SemverScheme); ok {
+		containerInfo.LatestVersion = versioning.FindHighestVersionInList(tags, registry.AllowAllReleases)
+	} else if containerInfo.Recommendation.MajorStatus != versioning.Notfound {
+		containerInfo.LatestVersion = containerInfo.Recommendation.LatestMajor
+	}
+	containerInfo.Staleness = GetStaleness(container, containerInfo.Recommendation, registries)
+	return containerInfo
+}
+
+// GetStaleness fetches the creation dates of the current and latest major tags to compute the staleness of an image
+func GetStaleness(container Image, recommendation versioning.Recommendation, registries registries.ImageRegistries) Staleness {
+	var currentCreated, latestCreated time.Time
+	if recommendation.MajorStatus != versioning.Same && recommendation.MajorStatus != versioning.Notfound {
+		var err error
+		currentReference := container.Version
+		if container.Digest != "" {
+			currentReference = container.Digest
+		}
+		currentCreated, err = registries.GetCreatedForImage(container.Name, container.URL, currentReference)
+		if err != nil {
+			log.WithError(err).WithField("name", container.Name).Warn("Could not fetch creation date of current tag")
+		}
+		latestCreated, err = registries.GetCreatedForImage(container.Name, container.URL, recommendation.LatestMajor)
+		if err != nil {
+			log.WithError(err).WithField("name", container.Name).Warn("Could not fetch creation date of latest tag")
+		}
+	}
+	return NewStaleness(recommendation, currentCreated, latestCreated)
+}
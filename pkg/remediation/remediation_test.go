@@ -0,0 +1,67 @@
+package remediation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/versioning"
+)
+
+func TestNewImageQuay(t *testing.T) {
+	image, err := NewImage("quay.io/prometheus/node-exporter:v1.0.1")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if image.URL != "quay.io" || image.Name != "prometheus/node-exporter" || image.Version != "v1.0.1" {
+		t.Errorf("Expected [quay.io prometheus/node-exporter v1.0.1], but got [%s %s %s]", image.URL, image.Name, image.Version)
+	}
+}
+
+func TestNewImageDockerHubShortName(t *testing.T) {
+	image, err := NewImage("ubuntu")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if image.URL != "index.docker.io" || image.Name != "library/ubuntu" || image.Version != "latest" {
+		t.Errorf("Expected [index.docker.io library/ubuntu latest], but got [%s %s %s]", image.URL, image.Name, image.Version)
+	}
+}
+
+func TestNewImagePrivateRegistryWithPortAndDigest(t *testing.T) {
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	image, err := NewImage("registry.example.com:5000/team/app:1.2.3@" + digest)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if image.URL != "registry.example.com:5000" || image.Name != "team/app" || image.Version != "1.2.3" || image.Digest != digest {
+		t.Errorf("Expected [registry.example.com:5000 team/app 1.2.3 %s], but got [%s %s %s %s]", digest, image.URL, image.Name, image.Version, image.Digest)
+	}
+}
+
+func TestNewImageDigestOnly(t *testing.T) {
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	image, err := NewImage("registry.example.com:5000/app@" + digest)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if image.URL != "registry.example.com:5000" || image.Name != "app" || image.Version != "" || image.Digest != digest {
+		t.Errorf("Expected [registry.example.com:5000 app  %s], but got [%s %s %s %s]", digest, image.URL, image.Name, image.Version, image.Digest)
+	}
+}
+
+func TestNewStaleness(t *testing.T) {
+	recommendation := versioning.Recommendation{MajorsBehind: 1, MinorsBehind: 2, PatchesBehind: 3}
+	current := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	staleness := NewStaleness(recommendation, current, current.Add(90*24*time.Hour))
+	if staleness.Score != 126 || staleness.AgeGapDays() != 90 {
+		t.Errorf("Expected [126 90], but got [%d %d]", staleness.Score, staleness.AgeGapDays())
+	}
+}
+
+func TestNewStalenessUnknownCreated(t *testing.T) {
+	recommendation := versioning.Recommendation{PatchesBehind: 2}
+	staleness := NewStaleness(recommendation, time.Time{}, time.Now())
+	if staleness.Score != 2 || staleness.AgeGapDays() != 0 {
+		t.Errorf("Expected [2 0], but got [%d %d]", staleness.Score, staleness.AgeGapDays())
+	}
+}
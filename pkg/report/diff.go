@@ -0,0 +1,253 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/table"
+)
+
+// TagChange is an image which runs with another tag or digest than before
+type TagChange struct {
+	Repository string
+	Old        Image
+	New        Image
+}
+
+// VulnerabilityChange is a vulnerability introduced or fixed in the images of a repository
+type VulnerabilityChange struct {
+	Repository    string
+	Image         string
+	Vulnerability Vulnerability
+}
+
+// Diff is what changed between two reports
+type Diff struct {
+	Old *Report
+	New *Report
+
+	AddedImages   []Image
+	RemovedImages []Image
+	TagChanges    []TagChange
+	Introduced    []VulnerabilityChange
+	Fixed         []VulnerabilityChange
+	// Incomparable are the repositories whose vulnerabilities aren't known in either report, i.e.: because a scan
+	// failed
+	Incomparable []string
+}
+
+// Compare finds the images added, removed and running with other tags, and the vulnerabilities introduced and fixed,
+// by repository: the vulnerabilities of added images are introduced, the ones of removed images fixed
+func Compare(old, new *Report) *Diff {
+	diff := &Diff{Old: old, New: new}
+
+	oldByImage := map[string]Image{}
+	for _, image := range old.Images {
+		oldByImage[image.Image] = image
+	}
+	newByImage := map[string]Image{}
+	for _, image := range new.Images {
+		newByImage[image.Image] = image
+	}
+
+	// images which don't run anymore with the same name are paired by repository, in order of their names
+	unmatchedOld := map[string][]Image{}
+	for _, image := range old.Images {
+		if _, ok := newByImage[image.Image]; !ok {
+			unmatchedOld[image.Repository] = append(unmatchedOld[image.Repository], image)
+		}
+	}
+	for _, image := range new.Images {
+		if _, ok := oldByImage[image.Image]; ok {
+			continue
+		}
+		if candidates := unmatchedOld[image.Repository]; len(candidates) > 0 {
+			diff.TagChanges = append(diff.TagChanges, TagChange{Repository: image.Repository, Old: candidates[0], New: image})
+			unmatchedOld[image.Repository] = candidates[1:]
+		} else {
+			diff.AddedImages = append(diff.AddedImages, image)
+		}
+	}
+	for _, image := range old.Images {
+		for _, candidate := range unmatchedOld[image.Repository] {
+			if candidate.Image == image.Image {
+				diff.RemovedImages = append(diff.RemovedImages, image)
+			}
+		}
+	}
+	for _, image := range old.Images {
+		if newImage, ok := newByImage[image.Image]; ok && image.Digest != "" && newImage.Digest != "" && image.Digest != newImage.Digest {
+			diff.TagChanges = append(diff.TagChanges, TagChange{Repository: image.Repository, Old: image, New: newImage})
+		}
+	}
+	sort.Slice(diff.TagChanges, func(a, b int) bool {
+		return diff.TagChanges[a].New.Image < diff.TagChanges[b].New.Image
+	})
+
+	diff.compareVulnerabilities(old, new)
+	return diff
+}
+
+// repositoryVulnerabilities are the vulnerabilities of all images of a repository, by key; known is false if any
+// image of the repository has unknown vulnerabilities
+type repositoryVulnerabilities struct {
+	known           bool
+	vulnerabilities map[string]VulnerabilityChange
+}
+
+func vulnerabilitiesByRepository(report *Report) map[string]*repositoryVulnerabilities {
+	repositories := map[string]*repositoryVulnerabilities{}
+	for _, image := range report.Images {
+		repository, ok := repositories[image.Repository]
+		if !ok {
+			repository = &repositoryVulnerabilities{known: true, vulnerabilities: map[string]VulnerabilityChange{}}
+			repositories[image.Repository] = repository
+		}
+		repository.known = repository.known && image.VulnerabilitiesKnown
+		for _, vulnerability := range image.Vulnerabilities {
+			if _, ok := repository.vulnerabilities[vulnerability.key()]; !ok {
+				repository.vulnerabilities[vulnerability.key()] = VulnerabilityChange{Repository: image.Repository, Image: image.Image, Vulnerability: vulnerability}
+			}
+		}
+	}
+	return repositories
+}
+
+func (d *Diff) compareVulnerabilities(old, new *Report) {
+	oldRepositories := vulnerabilitiesByRepository(old)
+	newRepositories := vulnerabilitiesByRepository(new)
+	empty := &repositoryVulnerabilities{known: true, vulnerabilities: map[string]VulnerabilityChange{}}
+
+	names := map[string]bool{}
+	for name := range oldRepositories {
+		names[name] = true
+	}
+	for name := range newRepositories {
+		names[name] = true
+	}
+	for name := range names {
+		oldRepository, ok := oldRepositories[name]
+		if !ok {
+			oldRepository = empty
+		}
+		newRepository, ok := newRepositories[name]
+		if !ok {
+			newRepository = empty
+		}
+		if !oldRepository.known || !newRepository.known {
+			d.Incomparable = append(d.Incomparable, name)
+			continue
+		}
+		for key, change := range newRepository.vulnerabilities {
+			if _, ok := oldRepository.vulnerabilities[key]; !ok {
+				d.Introduced = append(d.Introduced, change)
+			}
+		}
+		for key, change := range oldRepository.vulnerabilities {
+			if _, ok := newRepository.vulnerabilities[key]; !ok {
+				d.Fixed = append(d.Fixed, change)
+			}
+		}
+	}
+	sort.Strings(d.Incomparable)
+	sortVulnerabilityChanges(d.Introduced)
+	sortVulnerabilityChanges(d.Fixed)
+}
+
+// sortVulnerabilityChanges sorts by repository, then by severity, the most severe first, then by ID
+func sortVulnerabilityChanges(changes []VulnerabilityChange) {
+	sort.Slice(changes, func(a, b int) bool {
+		if changes[a].Repository != changes[b].Repository {
+			return changes[a].Repository < changes[b].Repository
+		}
+		if rankA, rankB := severityRank(changes[a].Vulnerability.Severity), severityRank(changes[b].Vulnerability.Severity); rankA != rankB {
+			return rankA < rankB
+		}
+		if changes[a].Vulnerability.ID != changes[b].Vulnerability.ID {
+			return changes[a].Vulnerability.ID < changes[b].Vulnerability.ID
+		}
+		return changes[a].Vulnerability.Component < changes[b].Vulnerability.Component
+	})
+}
+
+func severityRank(severity string) int {
+	for i, known := range []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"} {
+		if strings.EqualFold(severity, known) {
+			return i
+		}
+	}
+	return 4
+}
+
+// IsEmpty is true if nothing changed
+func (d *Diff) IsEmpty() bool {
+	return len(d.AddedImages) == 0 && len(d.RemovedImages) == 0 && len(d.TagChanges) == 0 && len(d.Introduced) == 0 && len(d.Fixed) == 0
+}
+
+// Render renders the changes as tables, leaving out the empty ones
+func (d *Diff) Render() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Changes of %s from %s to %s\n", d.New.Scope, d.Old.CreatedAt.Format(time.RFC3339), d.New.CreatedAt.Format(time.RFC3339))
+	if d.IsEmpty() {
+		fmt.Fprintf(&out, "No changes\n")
+	}
+
+	if len(d.AddedImages) > 0 || len(d.RemovedImages) > 0 {
+		t := table.NewWriter()
+		t.AppendHeader(table.Row{"Change", "Image", "Workloads", "Vulnerabilities"})
+		for _, image := range d.AddedImages {
+			t.AppendRow(table.Row{"ADDED", image.Image, strings.Join(image.Workloads, ", "), vulnerabilityCount(image)})
+		}
+		for _, image := range d.RemovedImages {
+			t.AppendRow(table.Row{"REMOVED", image.Image, strings.Join(image.Workloads, ", "), vulnerabilityCount(image)})
+		}
+		fmt.Fprintf(&out, "%s\n", t.Render())
+	}
+
+	if len(d.TagChanges) > 0 {
+		t := table.NewWriter()
+		t.AppendHeader(table.Row{"Repository", "Old", "New", "Latest"})
+		for _, change := range d.TagChanges {
+			t.AppendRow(table.Row{change.Repository, tagAndDigest(change.Old), tagAndDigest(change.New), change.New.LatestTag})
+		}
+		fmt.Fprintf(&out, "%s\n", t.Render())
+	}
+
+	if len(d.Introduced) > 0 || len(d.Fixed) > 0 {
+		t := table.NewWriter()
+		t.AppendHeader(table.Row{"Change", "Image", "Vulnerability", "Severity", "Component"})
+		for _, change := range d.Introduced {
+			t.AppendRow(table.Row{"INTRODUCED", change.Image, change.Vulnerability.ID, change.Vulnerability.Severity, change.Vulnerability.Component + " " + change.Vulnerability.Version})
+		}
+		for _, change := range d.Fixed {
+			t.AppendRow(table.Row{"FIXED", change.Image, change.Vulnerability.ID, change.Vulnerability.Severity, change.Vulnerability.Component + " " + change.Vulnerability.Version})
+		}
+		t.AppendFooter(table.Row{"", "", fmt.Sprintf("%d introduced", len(d.Introduced)), fmt.Sprintf("%d fixed", len(d.Fixed)), ""})
+		fmt.Fprintf(&out, "%s\n", t.Render())
+	}
+
+	if len(d.Incomparable) > 0 {
+		fmt.Fprintf(&out, "Vulnerabilities not compared, unknown in either report: %s\n", strings.Join(d.Incomparable, ", "))
+	}
+	return out.String()
+}
+
+func vulnerabilityCount(image Image) string {
+	if !image.VulnerabilitiesKnown {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d", len(image.Vulnerabilities))
+}
+
+func tagAndDigest(image Image) string {
+	digest := strings.TrimPrefix(image.Digest, "sha256:")
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+	if digest == "" {
+		return image.Tag
+	}
+	return fmt.Sprintf("%s@%s", image.Tag, digest)
+}
@@ -0,0 +1,87 @@
+package report
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newImage(image, digest string, vulnerabilities ...Vulnerability) Image {
+	return Image{
+		Image:                image,
+		Repository:           Repository(image),
+		Tag:                  strings.TrimPrefix(image, Repository(image)+":"),
+		Digest:               digest,
+		Status:               "SUCCEEDED",
+		VulnerabilitiesKnown: true,
+		Vulnerabilities:      vulnerabilities,
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cve3449 := Vulnerability{ID: "CVE-2021-3449", Severity: "MEDIUM", Component: "OpenSSL", Version: "1.1.1g"}
+	cve3450 := Vulnerability{ID: "CVE-2021-3450", Severity: "HIGH", Component: "OpenSSL", Version: "1.1.1g"}
+	cve23017 := Vulnerability{ID: "CVE-2021-23017", Severity: "CRITICAL", Component: "nginx", Version: "1.19.0"}
+	cve3449Upgraded := cve3449
+	cve3449Upgraded.Version = "1.1.1h"
+
+	unknown := newImage("postgres:13", "")
+	unknown.VulnerabilitiesKnown = false
+	old := &Report{Scope: "namespace/shop", CreatedAt: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), Images: []Image{
+		newImage("nginx:1.18", "sha256:aaa", cve3449, cve3450),
+		newImage("redis:6.0", "sha256:bbb", cve23017),
+		newImage("memcached:1.6", "sha256:ccc", cve3450),
+		newImage("postgres:13", "sha256:ddd"),
+	}}
+	new := &Report{Scope: "namespace/shop", CreatedAt: time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC), Images: []Image{
+		newImage("nginx:1.19", "sha256:eee", cve3449Upgraded, cve23017),
+		newImage("redis:6.0", "sha256:fff", cve23017),
+		newImage("busybox:1.32", "sha256:ggg", cve3450),
+		unknown,
+	}}
+
+	diff := Compare(old, new)
+	if len(diff.AddedImages) != 1 || diff.AddedImages[0].Image != "busybox:1.32" {
+		t.Errorf("Expected [busybox:1.32] to be added, but got [%+v]", diff.AddedImages)
+	}
+	if len(diff.RemovedImages) != 1 || diff.RemovedImages[0].Image != "memcached:1.6" {
+		t.Errorf("Expected [memcached:1.6] to be removed, but got [%+v]", diff.RemovedImages)
+	}
+	var tagChanges []string
+	for _, change := range diff.TagChanges {
+		tagChanges = append(tagChanges, tagAndDigest(change.Old)+" -> "+tagAndDigest(change.New))
+	}
+	if expected := []string{"1.18@aaa -> 1.19@eee", "6.0@bbb -> 6.0@fff"}; !reflect.DeepEqual(tagChanges, expected) {
+		t.Errorf("Expected [%v], but got [%v]", expected, tagChanges)
+	}
+
+	describe := func(changes []VulnerabilityChange) []string {
+		var descriptions []string
+		for _, change := range changes {
+			descriptions = append(descriptions, change.Image+" "+change.Vulnerability.ID)
+		}
+		return descriptions
+	}
+	// upgrading OpenSSL didn't fix CVE-2021-3449, the vulnerabilities of added and removed images count as well
+	if expected := []string{"busybox:1.32 CVE-2021-3450", "nginx:1.19 CVE-2021-23017"}; !reflect.DeepEqual(describe(diff.Introduced), expected) {
+		t.Errorf("Expected [%v], but got [%v]", expected, describe(diff.Introduced))
+	}
+	if expected := []string{"memcached:1.6 CVE-2021-3450", "nginx:1.18 CVE-2021-3450"}; !reflect.DeepEqual(describe(diff.Fixed), expected) {
+		t.Errorf("Expected [%v], but got [%v]", expected, describe(diff.Fixed))
+	}
+	if expected := []string{"postgres"}; !reflect.DeepEqual(diff.Incomparable, expected) {
+		t.Errorf("Expected [%v], but got [%v]", expected, diff.Incomparable)
+	}
+
+	rendered := diff.Render()
+	for _, expected := range []string{"Changes of namespace/shop from 2021-03-01T00:00:00Z to 2021-03-08T00:00:00Z", "ADDED", "REMOVED", "INTRODUCED", "FIXED", "2 INTRODUCED", "Vulnerabilities not compared, unknown in either report: postgres"} {
+		if !strings.Contains(rendered, expected) {
+			t.Errorf("Expected [%s] in [%s]", expected, rendered)
+		}
+	}
+
+	if diff := Compare(old, old); !diff.IsEmpty() || !strings.Contains(diff.Render(), "No changes") {
+		t.Errorf("Expected no changes, but got [%s]", diff.Render())
+	}
+}
@@ -0,0 +1,253 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+const (
+	// SchemaVersion is the version of the report format; reports of newer versions can't be read
+	SchemaVersion = 1
+
+	// CompareWithLast compares a report with the previous one of the same scope
+	CompareWithLast = "last"
+
+	// reportTimeFormat names the report files, so that they sort by time
+	reportTimeFormat = "20060102T150405Z"
+	// partialSuffix ends the file names of partial reports, which aren't compared with
+	partialSuffix = ".partial.json"
+)
+
+var (
+	DefaultReportsDirectory = filepath.Join(utils.GetHomeDir(), "blackduck", "reports")
+
+	invalidScopeCharsRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// Report are the results of one run of a scan command, i.e.: of `bd-xray namespace shop`
+type Report struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Scope is what was scanned, i.e.: namespace/shop; runs of the same scope are compared with each other
+	Scope         string    `json:"scope"`
+	CreatedAt     time.Time `json:"createdAt"`
+	BDXrayVersion string    `json:"bdXrayVersion,omitempty"`
+	// Partial is true if the run was cancelled or failed, so that images may be missing; it isn't the last report of
+	// its scope
+	Partial bool    `json:"partial,omitempty"`
+	Images  []Image `json:"images"`
+}
+
+// Image is the result of the scan of an image
+type Image struct {
+	Image string `json:"image"`
+	// Repository is the image without tag and digest, i.e.: docker.io/library/nginx; tag changes are found by it
+	Repository   string   `json:"repository"`
+	Tag          string   `json:"tag,omitempty"`
+	Digest       string   `json:"digest,omitempty"`
+	Status       string   `json:"status"`
+	BlackDuckURL string   `json:"blackDuckURL,omitempty"`
+	LatestTag    string   `json:"latestTag,omitempty"`
+	Workloads    []string `json:"workloads,omitempty"`
+	// VulnerabilitiesKnown is false if the scan failed or wasn't uploaded to Black Duck, so that its vulnerabilities
+	// aren't reported as fixed
+	VulnerabilitiesKnown bool            `json:"vulnerabilitiesKnown"`
+	Vulnerabilities      []Vulnerability `json:"vulnerabilities,omitempty"`
+}
+
+// Vulnerability is a vulnerability of a component of an image
+type Vulnerability struct {
+	ID        string `json:"id"`
+	Severity  string `json:"severity"`
+	Component string `json:"component"`
+	Version   string `json:"version"`
+}
+
+// key identifies a vulnerability across runs; upgrading the component to a version which is still vulnerable doesn't
+// fix it
+func (v Vulnerability) key() string {
+	return v.ID + "\xff" + v.Component
+}
+
+// Scope builds the scope of a run from the source and what was scanned, i.e.: namespace and shop
+func Scope(source string, subjects ...string) string {
+	return strings.Join(append([]string{source}, subjects...), "/")
+}
+
+// SetScope is the scope of a run of a set of subjects in any order, i.e.: of images; it is the source and a hash of
+// the sorted subjects, so that only runs of the same set are compared
+func SetScope(source string, subjects []string) string {
+	sorted := append([]string{}, subjects...)
+	sort.Strings(sorted)
+	hash := sha256.New()
+	for _, subject := range sorted {
+		hash.Write([]byte(subject + "\n"))
+	}
+	return Scope(source, hex.EncodeToString(hash.Sum(nil))[:16])
+}
+
+// Repository strips the tag and digest of an image, i.e.: docker.io/library/nginx for docker.io/library/nginx:1.19
+func Repository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// Collector collects the results of concurrently scanned images; the latest result of an image wins
+type Collector struct {
+	mutex  sync.Mutex
+	images map[string]Image
+}
+
+func NewCollector() *Collector {
+	return &Collector{images: map[string]Image{}}
+}
+
+func (c *Collector) Add(image Image) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if image.Repository == "" {
+		image.Repository = Repository(image.Image)
+	}
+	c.images[image.Image] = image
+}
+
+// Report is a report of the collected images, sorted by image
+func (c *Collector) Report(scope, version string, createdAt time.Time) *Report {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	report := &Report{SchemaVersion: SchemaVersion, Scope: scope, CreatedAt: createdAt.UTC(), BDXrayVersion: version, Images: []Image{}}
+	for _, image := range c.images {
+		report.Images = append(report.Images, image)
+	}
+	sort.Slice(report.Images, func(a, b int) bool {
+		return report.Images[a].Image < report.Images[b].Image
+	})
+	return report
+}
+
+// Store keeps the reports of every scope in a directory of its own, named by their creation time
+type Store struct {
+	Directory string
+}
+
+func NewStore(directory string) *Store {
+	return &Store{Directory: directory}
+}
+
+func (s *Store) scopeDirectory(scope string) string {
+	return filepath.Join(s.Directory, strings.Trim(invalidScopeCharsRegexp.ReplaceAllString(scope, "_"), "_"))
+}
+
+// Save writes a report, returning its path; reports created in the same second are numbered, i.e.:
+// 20210301T100000Z_1.json, rather than overwriting each other
+func (s *Store) Save(report *Report) (string, error) {
+	directory := s.scopeDirectory(report.Scope)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return "", errors.Wrapf(err, "unable to create reports directory %s", directory)
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to marshal report of %s", report.Scope)
+	}
+	suffix := ".json"
+	if report.Partial {
+		suffix = partialSuffix
+	}
+	name := report.CreatedAt.UTC().Format(reportTimeFormat)
+	for i := 0; ; i++ {
+		path := filepath.Join(directory, name+suffix)
+		if i > 0 {
+			path = filepath.Join(directory, fmt.Sprintf("%s_%d%s", name, i, suffix))
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return path, errors.Wrapf(err, "unable to create report %s", path)
+		}
+		_, err = file.Write(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return path, errors.Wrapf(err, "unable to write report %s", path)
+	}
+}
+
+// reportOrder is the creation time and number of a report file, by which reports are ordered; ok is false for
+// files which aren't complete reports
+func reportOrder(fileName string) (createdAt string, number int, ok bool) {
+	if !strings.HasSuffix(fileName, ".json") || strings.HasSuffix(fileName, partialSuffix) {
+		return "", 0, false
+	}
+	createdAt = strings.TrimSuffix(fileName, ".json")
+	if i := strings.Index(createdAt, "_"); i >= 0 {
+		var err error
+		if number, err = strconv.Atoi(createdAt[i+1:]); err != nil {
+			return "", 0, false
+		}
+		createdAt = createdAt[:i]
+	}
+	return createdAt, number, true
+}
+
+// Last is the path of the latest complete report of a scope, empty if there is none
+func (s *Store) Last(scope string) (string, error) {
+	directory := s.scopeDirectory(scope)
+	files, err := ioutil.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to list reports in %s", directory)
+	}
+	last, lastCreatedAt, lastNumber := "", "", 0
+	for _, file := range files {
+		createdAt, number, ok := reportOrder(file.Name())
+		if file.IsDir() || !ok {
+			continue
+		}
+		if createdAt > lastCreatedAt || (createdAt == lastCreatedAt && number > lastNumber) {
+			last, lastCreatedAt, lastNumber = file.Name(), createdAt, number
+		}
+	}
+	if last == "" {
+		return "", nil
+	}
+	return filepath.Join(directory, last), nil
+}
+
+// Load reads a report, failing on reports of a newer schema version
+func Load(path string) (*Report, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read report %s", path)
+	}
+	report := &Report{}
+	if err := json.Unmarshal(content, report); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse report %s", path)
+	}
+	if report.SchemaVersion < 1 || report.SchemaVersion > SchemaVersion {
+		return nil, errors.Errorf("report %s has schema version %d, only versions up to %d are supported", path, report.SchemaVersion, SchemaVersion)
+	}
+	return report, nil
+}
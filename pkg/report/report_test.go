@@ -0,0 +1,107 @@
+package report
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	expected := map[string]string{
+		"nginx":                               "nginx",
+		"nginx:1.19":                          "nginx",
+		"docker.io/library/nginx:1.19":        "docker.io/library/nginx",
+		"localhost:5000/shop/api":             "localhost:5000/shop/api",
+		"localhost:5000/shop/api:2.0":         "localhost:5000/shop/api",
+		"nginx@sha256:4c0fdaa8b6341bfdeca5f1": "nginx",
+		"nginx:1.19@sha256:4c0fdaa8b6341bfde": "nginx",
+	}
+	for image, repository := range expected {
+		if actual := Repository(image); actual != repository {
+			t.Errorf("Expected [%s], but got [%s]", repository, actual)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewStore(dir)
+	scope := Scope("namespace", "shop")
+
+	if last, err := store.Last(scope); err != nil || last != "" {
+		t.Errorf("Expected no report, but got [%s %+v]", last, err)
+	}
+
+	collector := NewCollector()
+	collector.Add(Image{Image: "redis:6.0", Status: "SUCCEEDED"})
+	collector.Add(Image{Image: "nginx:1.19", Status: "FAILED"})
+	collector.Add(Image{Image: "nginx:1.19", Status: "SUCCEEDED", VulnerabilitiesKnown: true, Vulnerabilities: []Vulnerability{{ID: "CVE-2021-3449", Severity: "MEDIUM", Component: "OpenSSL", Version: "1.1.1g"}}})
+	createdAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if _, err := store.Save(collector.Report(scope, "v0.1.0", createdAt.Add(time.Duration(i)*24*time.Hour))); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	if _, err := store.Save(collector.Report(Scope("namespace", "blog"), "v0.1.0", createdAt.Add(48*time.Hour))); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// reports of the same second don't overwrite each other
+	if path, err := store.Save(collector.Report(scope, "v0.1.0", createdAt.Add(24*time.Hour))); err != nil || filepath.Base(path) != "20210302T100000Z_1.json" {
+		t.Fatalf("Expected [20210302T100000Z_1.json], but got [%s %+v]", path, err)
+	}
+
+	// a cancelled run isn't compared with
+	partial := collector.Report(scope, "v0.1.0", createdAt.Add(48*time.Hour))
+	partial.Partial = true
+	if path, err := store.Save(partial); err != nil || filepath.Base(path) != "20210303T100000Z.partial.json" {
+		t.Fatalf("Expected [20210303T100000Z.partial.json], but got [%s %+v]", path, err)
+	}
+
+	last, err := store.Last(scope)
+	if expected := filepath.Join(dir, "namespace_shop", "20210302T100000Z_1.json"); err != nil || last != expected {
+		t.Fatalf("Expected [%s], but got [%s %+v]", expected, last, err)
+	}
+	report, err := Load(last)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := &Report{
+		SchemaVersion: SchemaVersion,
+		Scope:         "namespace/shop",
+		CreatedAt:     createdAt.Add(24 * time.Hour),
+		BDXrayVersion: "v0.1.0",
+		Images: []Image{
+			{Image: "nginx:1.19", Repository: "nginx", Status: "SUCCEEDED", VulnerabilitiesKnown: true, Vulnerabilities: []Vulnerability{{ID: "CVE-2021-3449", Severity: "MEDIUM", Component: "OpenSSL", Version: "1.1.1g"}}},
+			{Image: "redis:6.0", Repository: "redis", Status: "SUCCEEDED"},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, report)
+	}
+
+	newer := filepath.Join(dir, "newer.json")
+	if err := ioutil.WriteFile(newer, []byte(`{"schemaVersion": 2, "scope": "namespace/shop"}`), 0644); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err := Load(newer); err == nil {
+		t.Errorf("Expected an error for a newer schema version")
+	}
+}
+
+func TestSetScope(t *testing.T) {
+	scope := SetScope("images", []string{"nginx:1.19", "redis:6.0"})
+	if other := SetScope("images", []string{"redis:6.0", "nginx:1.19"}); other != scope {
+		t.Errorf("Expected [%s], but got [%s]", scope, other)
+	}
+	if other := SetScope("images", []string{"nginx:1.19"}); other == scope {
+		t.Errorf("Expected another scope than [%s] for other images", scope)
+	}
+}
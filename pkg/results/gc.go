@@ -0,0 +1,136 @@
+package results
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// outputDirRegex matches the output dirs of scans, i.e.: 20210302101531_nginx_1_19_RANDOMSTRING
+var outputDirRegex = regexp.MustCompile(`^[0-9]{14}_`)
+
+// GCPolicy selects output dirs for removal; a zero MaxAge or MaxSize disables that limit
+type GCPolicy struct {
+	// MaxAge removes runs started longer ago
+	MaxAge time.Duration
+	// MaxSize removes the oldest runs until the output dirs of the remaining ones are at most this many bytes
+	MaxSize int64
+}
+
+// Run is an entry of the index, or an output dir missing from it, together with the size of its output dir
+type Run struct {
+	Entry
+	Size    int64
+	Indexed bool
+}
+
+// FindRuns lists the runs of the index together with output dirs under directory which are not indexed, i.e.: of
+// scans before the index existed; runs are sorted oldest first
+func FindRuns(index *Index, directory string) ([]Run, error) {
+	entries, err := index.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var runs []Run
+	indexed := map[string]bool{}
+	for _, entry := range entries {
+		indexed[filepath.Clean(entry.OutputDir)] = true
+		size, err := DirSize(entry.OutputDir)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			log.Warnf("unable to compute size of %s: %+v", entry.OutputDir, err)
+		}
+		runs = append(runs, Run{Entry: entry, Size: size, Indexed: true})
+	}
+
+	files, err := ioutil.ReadDir(directory)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "unable to list %s", directory)
+	}
+	for _, file := range files {
+		outputDir := filepath.Join(directory, file.Name())
+		if !file.IsDir() || !outputDirRegex.MatchString(file.Name()) || indexed[outputDir] {
+			continue
+		}
+		size, err := DirSize(outputDir)
+		if err != nil {
+			log.Warnf("unable to compute size of %s: %+v", outputDir, err)
+		}
+		runs = append(runs, Run{Entry: Entry{RunID: file.Name(), OutputDir: outputDir, StartedAt: file.ModTime()}, Size: size})
+	}
+	sort.SliceStable(runs, func(a, b int) bool {
+		return runs[a].StartedAt.Before(runs[b].StartedAt)
+	})
+	return runs, nil
+}
+
+// SelectForRemoval splits runs, sorted oldest first, into the ones to keep and the ones to remove under the policy
+func SelectForRemoval(runs []Run, policy GCPolicy, now time.Time) (keep []Run, remove []Run) {
+	var size int64
+	tooLarge := false
+	// walk from the newest run, so that the oldest runs exceed the size limit, and all runs older than the first one
+	// exceeding it are removed as well
+	for idx := len(runs) - 1; idx >= 0; idx-- {
+		run := runs[idx]
+		tooOld := policy.MaxAge > 0 && now.Sub(run.StartedAt) > policy.MaxAge
+		tooLarge = tooLarge || (policy.MaxSize > 0 && size+run.Size > policy.MaxSize)
+		if tooOld || tooLarge {
+			remove = append([]Run{run}, remove...)
+			continue
+		}
+		size += run.Size
+		keep = append([]Run{run}, keep...)
+	}
+	return keep, remove
+}
+
+// GC removes the output dirs of the runs selected by the policy and drops them from the index; with dryRun nothing
+// is removed. Returns the removed runs
+func GC(index *Index, directory string, policy GCPolicy, dryRun bool) ([]Run, error) {
+	runs, err := FindRuns(index, directory)
+	if err != nil {
+		return nil, err
+	}
+	_, remove := SelectForRemoval(runs, policy, time.Now())
+	if dryRun || len(remove) == 0 {
+		return remove, nil
+	}
+
+	var removed []Run
+	for _, run := range remove {
+		if err := os.RemoveAll(run.OutputDir); err != nil {
+			// its entry stays in the index, so that a later gc retries
+			log.Errorf("unable to remove %s: %+v", run.OutputDir, err)
+			continue
+		}
+		removed = append(removed, run)
+	}
+
+	var runIDs []string
+	for _, run := range removed {
+		if run.Indexed {
+			runIDs = append(runIDs, run.RunID)
+		}
+	}
+	return removed, index.Remove(runIDs)
+}
+
+// DirSize is the total size of the files under path
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, errors.Wrapf(err, "unable to walk %s", path)
+}
@@ -0,0 +1,107 @@
+package results
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectForRemoval(t *testing.T) {
+	now := time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)
+	runs := []Run{
+		{Entry: Entry{RunID: "old", StartedAt: now.Add(-40 * 24 * time.Hour)}, Size: 10},
+		{Entry: Entry{RunID: "older-than-size", StartedAt: now.Add(-3 * 24 * time.Hour)}, Size: 50},
+		{Entry: Entry{RunID: "recent", StartedAt: now.Add(-2 * 24 * time.Hour)}, Size: 60},
+		{Entry: Entry{RunID: "newest", StartedAt: now.Add(-time.Hour)}, Size: 30},
+	}
+
+	testCases := []struct {
+		policy         GCPolicy
+		expectedRemove string
+	}{
+		{GCPolicy{}, ""},
+		{GCPolicy{MaxAge: 30 * 24 * time.Hour}, "old"},
+		{GCPolicy{MaxSize: 100}, "old,older-than-size"},
+		{GCPolicy{MaxAge: 30 * 24 * time.Hour, MaxSize: 90}, "old,older-than-size"},
+		{GCPolicy{MaxSize: 10}, "old,older-than-size,recent,newest"},
+	}
+	for _, testCase := range testCases {
+		keep, remove := SelectForRemoval(runs, testCase.policy, now)
+		var removed []string
+		for _, run := range remove {
+			removed = append(removed, run.RunID)
+		}
+		if actual := strings.Join(removed, ","); actual != testCase.expectedRemove {
+			t.Errorf("%+v: Expected [%s], but got [%s]", testCase.policy, testCase.expectedRemove, actual)
+		}
+		if len(keep)+len(remove) != len(runs) {
+			t.Errorf("Expected [%d] runs, but got [%d]", len(runs), len(keep)+len(remove))
+		}
+	}
+}
+
+func TestGC(t *testing.T) {
+	index, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+
+	makeOutputDir := func(name string, size int, modTime time.Time) string {
+		outputDir := filepath.Join(dir, name)
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(outputDir, "detect.log"), make([]byte, size), 0644); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if err := os.Chtimes(outputDir, modTime, modTime); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		return outputDir
+	}
+	now := time.Now()
+	oldDir := makeOutputDir("20200101000000_nginx_1_17_a", 100, now)
+	newDir := makeOutputDir("20210302101531_nginx_1_19_b", 100, now)
+	// an output dir of a scan before the index existed
+	orphanDir := makeOutputDir("20200102000000_redis_5_c", 100, now.Add(-60*24*time.Hour))
+	// not an output dir of a scan
+	makeOutputDir("tools", 100, now.Add(-60*24*time.Hour))
+
+	for _, entry := range []Entry{
+		{RunID: "a", OutputDir: oldDir, StartedAt: now.Add(-45 * 24 * time.Hour)},
+		{RunID: "b", OutputDir: newDir, StartedAt: now.Add(-time.Hour)},
+	} {
+		if err := index.Add(entry); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	policy := GCPolicy{MaxAge: 30 * 24 * time.Hour}
+	removed, err := GC(index, dir, policy, true)
+	if err != nil || len(removed) != 2 {
+		t.Fatalf("Expected 2 runs to be removed, but got [%+v %+v]", removed, err)
+	}
+	if _, err := os.Stat(oldDir); err != nil {
+		t.Errorf("Expected dry run to keep %s, but got [%+v]", oldDir, err)
+	}
+
+	removed, err = GC(index, dir, policy, false)
+	if err != nil || len(removed) != 2 || removed[0].Size != 100 {
+		t.Fatalf("Expected 2 runs of 100 bytes to be removed, but got [%+v %+v]", removed, err)
+	}
+	for _, path := range []string{oldDir, orphanDir} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, but got [%+v]", path, err)
+		}
+	}
+	for _, path := range []string{newDir, filepath.Join(dir, "tools")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be kept, but got [%+v]", path, err)
+		}
+	}
+	entries, err := index.Entries()
+	if err != nil || len(entries) != 1 || entries[0].RunID != "b" {
+		t.Errorf("Expected [b], but got [%+v %+v]", entries, err)
+	}
+}
@@ -0,0 +1,231 @@
+package results
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/utils"
+)
+
+const (
+	// IndexFileName is the name of the results index, one JSON entry per line
+	IndexFileName = "results.jsonl"
+	// lockFileSuffix names the file next to the index which is locked while writing it; the index itself can't be
+	// locked, since Replace renames another file over it
+	lockFileSuffix = ".lock"
+)
+
+var (
+	DefaultResultsDirectory = fmt.Sprintf("%s/blackduck", utils.GetHomeDir())
+	DefaultIndexPath        = filepath.Join(DefaultResultsDirectory, IndexFileName)
+)
+
+// Entry is one detect run against an image; every retry of a scan is a run of its own
+type Entry struct {
+	RunID string `json:"runId"`
+	Image string `json:"image"`
+	// Namespace is the namespace the image was scanned in, empty for scans of images, yaml files and charts
+	Namespace string        `json:"namespace,omitempty"`
+	OutputDir string        `json:"outputDir"`
+	LogFile   string        `json:"logFile"`
+	ExitCode  int           `json:"exitCode"`
+	Error     string        `json:"error,omitempty"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Index is the list of runs under ~/blackduck, so that their logs and output dirs can be found afterwards; writes
+// are serialized by a mutex within the process and by a file lock across processes, i.e.: a scan and a gc
+type Index struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+func NewIndex(path string) *Index {
+	return &Index{Path: path}
+}
+
+func NewDefaultIndex() *Index {
+	return NewIndex(DefaultIndexPath)
+}
+
+// lock takes the mutex and the file lock of the index, creating its directory; the returned func releases both
+func (i *Index) lock() (func(), error) {
+	i.mutex.Lock()
+	if err := os.MkdirAll(filepath.Dir(i.Path), 0755); err != nil {
+		i.mutex.Unlock()
+		return nil, errors.Wrapf(err, "unable to create directory of results index %s", i.Path)
+	}
+	lockPath := i.Path + lockFileSuffix
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		i.mutex.Unlock()
+		return nil, errors.Wrapf(err, "unable to open lock of results index %s", lockPath)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		i.mutex.Unlock()
+		return nil, errors.Wrapf(err, "unable to lock results index %s", lockPath)
+	}
+	return func() {
+		if err := unlockFile(file); err != nil {
+			log.Warnf("unable to unlock results index %s: %v", lockPath, err)
+		}
+		file.Close()
+		i.mutex.Unlock()
+	}, nil
+}
+
+// Add appends an entry to the index, concurrent scans, also of other processes, may add entries at the same time
+func (i *Index) Add(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal results index entry for run %s", entry.RunID)
+	}
+	unlock, err := i.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	file, err := os.OpenFile(i.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open results index %s", i.Path)
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return errors.Wrapf(err, "unable to write results index %s", i.Path)
+}
+
+// Entries reads all entries, oldest first; a missing index has no entries and malformed lines are skipped
+func (i *Index) Entries() ([]Entry, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.read()
+}
+
+// read reads all entries, oldest first; the index is only ever appended to or renamed over, so that it can be read
+// without the file lock
+func (i *Index) read() ([]Entry, error) {
+	file, err := os.Open(i.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to open results index %s", i.Path)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Warnf("skipping malformed line %d of results index %s: %v", lineNumber, i.Path, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "unable to read results index %s", i.Path)
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].StartedAt.Before(entries[b].StartedAt)
+	})
+	return entries, nil
+}
+
+// Find returns the entries of a run ID or of an image, newest first; an image without a tag matches all its tags, and
+// a name without a repository, i.e.: nginx, matches the image in all repositories
+func (i *Index) Find(runIDOrImage string) ([]Entry, error) {
+	entries, err := i.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var found []Entry
+	for idx := len(entries) - 1; idx >= 0; idx-- {
+		entry := entries[idx]
+		if entry.RunID == runIDOrImage {
+			return []Entry{entry}, nil
+		}
+		if entry.Image == runIDOrImage || imageWithoutTag(entry.Image) == runIDOrImage || utils.ParseImageName(entry.Image) == runIDOrImage {
+			found = append(found, entry)
+		}
+	}
+	return found, nil
+}
+
+// Replace rewrites the index with entries
+func (i *Index) Replace(entries []Entry) error {
+	unlock, err := i.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return i.write(entries)
+}
+
+// Remove drops the entries of run IDs from the index, i.e.: after their output dirs were removed; the index is read
+// again under its lock, so that entries added meanwhile by running scans are kept
+func (i *Index) Remove(runIDs []string) error {
+	unlock, err := i.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := i.read()
+	if err != nil {
+		return err
+	}
+	removed := map[string]bool{}
+	for _, runID := range runIDs {
+		removed[runID] = true
+	}
+	var kept []Entry
+	for _, entry := range entries {
+		if !removed[entry.RunID] {
+			kept = append(kept, entry)
+		}
+	}
+	return i.write(kept)
+}
+
+// write replaces the index by a file with entries, the lock must be held
+func (i *Index) write(entries []Entry) error {
+	var content strings.Builder
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrapf(err, "unable to marshal results index entry for run %s", entry.RunID)
+		}
+		content.Write(line)
+		content.WriteString("\n")
+	}
+	tmpPath := i.Path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, []byte(content.String()), 0644); err != nil {
+		return errors.Wrapf(err, "unable to write results index %s", tmpPath)
+	}
+	return errors.Wrapf(os.Rename(tmpPath, i.Path), "unable to replace results index %s", i.Path)
+}
+
+// imageWithoutTag strips the tag and digest of an image, i.e.: docker.io/library/nginx:1.19 becomes docker.io/library/nginx
+func imageWithoutTag(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		return image[:idx]
+	}
+	return image
+}
@@ -0,0 +1,146 @@
+package results
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestIndex(t *testing.T) (*Index, string) {
+	dir, err := ioutil.TempDir("", "results")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return NewIndex(filepath.Join(dir, IndexFileName)), dir
+}
+
+func TestIndexAddAndFind(t *testing.T) {
+	index, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+
+	started := time.Date(2021, 3, 2, 10, 15, 31, 0, time.UTC)
+	for idx, entry := range []Entry{
+		{RunID: "20210302101531_nginx_1_19_a", Image: "docker.io/library/nginx:1.19", ExitCode: 0},
+		{RunID: "20210302101531_redis_6_0_b", Image: "bitnami/redis:6.0", ExitCode: 6, Error: "exit status 6"},
+		{RunID: "20210302111531_nginx_1_20_c", Image: "docker.io/library/nginx:1.20", ExitCode: 0},
+	} {
+		entry.StartedAt = started.Add(time.Duration(idx) * time.Hour)
+		if err := index.Add(entry); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	entries, err := index.Entries()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, but got [%+v %+v]", entries, err)
+	}
+
+	for query, expected := range map[string][]string{
+		"20210302101531_redis_6_0_b":   {"20210302101531_redis_6_0_b"},
+		"docker.io/library/nginx:1.19": {"20210302101531_nginx_1_19_a"},
+		"docker.io/library/nginx":      {"20210302111531_nginx_1_20_c", "20210302101531_nginx_1_19_a"},
+		"nginx":                        {"20210302111531_nginx_1_20_c", "20210302101531_nginx_1_19_a"},
+		"alpine":                       {},
+	} {
+		found, err := index.Find(query)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		var actual []string
+		for _, entry := range found {
+			actual = append(actual, entry.RunID)
+		}
+		if len(actual) != len(expected) {
+			t.Errorf("%s: Expected [%v], but got [%v]", query, expected, actual)
+			continue
+		}
+		for idx := range expected {
+			if actual[idx] != expected[idx] {
+				t.Errorf("%s: Expected [%v], but got [%v]", query, expected, actual)
+			}
+		}
+	}
+}
+
+func TestIndexSkipsMalformedLines(t *testing.T) {
+	index, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+
+	content := `{"runId":"a","image":"nginx:1.19","exitCode":0}
+not json
+
+{"runId":"b","image":"nginx:1.20","exitCode":1}
+`
+	if err := ioutil.WriteFile(index.Path, []byte(content), 0644); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	entries, err := index.Entries()
+	if err != nil || len(entries) != 2 || entries[1].ExitCode != 1 {
+		t.Errorf("Expected 2 entries, but got [%+v %+v]", entries, err)
+	}
+}
+
+func TestIndexMissing(t *testing.T) {
+	index := NewIndex(filepath.Join(os.TempDir(), "does-not-exist", IndexFileName))
+	entries, err := index.Entries()
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries, but got [%+v %+v]", entries, err)
+	}
+}
+
+func TestIndexReplace(t *testing.T) {
+	index, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+
+	if err := index.Add(Entry{RunID: "a"}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := index.Replace([]Entry{{RunID: "b"}, {RunID: "c"}}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	entries, err := index.Entries()
+	if err != nil || len(entries) != 2 || entries[0].RunID != "b" {
+		t.Errorf("Expected [b c], but got [%+v %+v]", entries, err)
+	}
+}
+
+func TestIndexRemoveKeepsConcurrentlyAddedEntries(t *testing.T) {
+	index, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+	for _, runID := range []string{"a", "b"} {
+		if err := index.Add(Entry{RunID: runID}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	// another index of the same file, like a scan running next to a gc, only shares the file lock
+	scans := NewIndex(index.Path)
+	var wg sync.WaitGroup
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			if err := scans.Add(Entry{RunID: fmt.Sprintf("scan-%d", n)}); err != nil {
+				t.Errorf("%+v", err)
+			}
+		}(n)
+	}
+	if err := index.Remove([]string{"a"}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	wg.Wait()
+
+	entries, err := index.Entries()
+	if err != nil || len(entries) != 21 {
+		t.Fatalf("Expected [b] and the 20 scans, but got [%+v %+v]", entries, err)
+	}
+	for _, entry := range entries {
+		if entry.RunID == "a" {
+			t.Errorf("Expected [a] to be removed, but got [%+v]", entries)
+		}
+	}
+}
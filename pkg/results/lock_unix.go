@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package results
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock of the file, waiting for other processes to release it
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
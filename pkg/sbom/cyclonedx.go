@@ -0,0 +1,157 @@
+package sbom
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	CycloneDXSpecVersion = "1.4"
+
+	propertyOrigin     = "bd-xray:origin"
+	propertyExternalID = "bd-xray:externalId"
+	propertySource     = "bd-xray:source"
+	propertyWorkload   = "bd-xray:workload"
+)
+
+// CycloneDXDocument is a CycloneDX JSON BOM, see https://cyclonedx.org/docs/1.4/json/
+type CycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     CycloneDXMetadata     `json:"metadata"`
+	Components   []CycloneDXComponent  `json:"components"`
+	Dependencies []CycloneDXDependency `json:"dependencies,omitempty"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp string              `json:"timestamp"`
+	Tools     []CycloneDXTool     `json:"tools"`
+	Component *CycloneDXComponent `json:"component,omitempty"`
+}
+
+type CycloneDXTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type CycloneDXComponent struct {
+	BOMRef     string               `json:"bom-ref,omitempty"`
+	Type       string               `json:"type"`
+	Name       string               `json:"name"`
+	Version    string               `json:"version,omitempty"`
+	Purl       string               `json:"purl,omitempty"`
+	Properties []CycloneDXProperty  `json:"properties,omitempty"`
+	Components []CycloneDXComponent `json:"components,omitempty"`
+}
+
+type CycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type CycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+func (g *Generator) newCycloneDXDocument(component *CycloneDXComponent) *CycloneDXDocument {
+	return &CycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  CycloneDXSpecVersion,
+		SerialNumber: fmt.Sprintf("urn:uuid:%s", newUUID()),
+		Version:      1,
+		Metadata: CycloneDXMetadata{
+			Timestamp: g.Created.UTC().Format(time.RFC3339),
+			Tools:     []CycloneDXTool{{Vendor: ToolVendor, Name: ToolName, Version: g.ToolVersion}},
+			Component: component,
+		},
+		Components: []CycloneDXComponent{},
+	}
+}
+
+// cycloneDXImage is the container component of an image with its components nested, bom-refs are prefixed with
+// refPrefix to keep them unique across images
+func cycloneDXImage(inventory *ImageInventory, refPrefix string) (CycloneDXComponent, []string) {
+	name, tag := splitImage(inventory.Image)
+	image := CycloneDXComponent{
+		BOMRef:     refPrefix + inventory.Image,
+		Type:       "container",
+		Name:       name,
+		Version:    tag,
+		Properties: []CycloneDXProperty{{Name: propertySource, Value: inventory.Source}},
+	}
+	for _, workload := range inventory.Workloads {
+		image.Properties = append(image.Properties, CycloneDXProperty{Name: propertyWorkload, Value: workload})
+	}
+
+	var refs []string
+	seen := map[string]int{}
+	for _, component := range inventory.Components {
+		ref := refPrefix + component.Purl
+		if seen[ref]++; seen[ref] > 1 {
+			ref = fmt.Sprintf("%s#%d", ref, seen[ref])
+		}
+		refs = append(refs, ref)
+		cycloneDXComponent := CycloneDXComponent{
+			BOMRef:  ref,
+			Type:    "library",
+			Name:    component.Name,
+			Version: component.Version,
+			Purl:    component.Purl,
+		}
+		if component.Origin != "" {
+			cycloneDXComponent.Properties = append(cycloneDXComponent.Properties, CycloneDXProperty{Name: propertyOrigin, Value: component.Origin})
+		}
+		if component.ExternalID != "" {
+			cycloneDXComponent.Properties = append(cycloneDXComponent.Properties, CycloneDXProperty{Name: propertyExternalID, Value: component.ExternalID})
+		}
+		image.Components = append(image.Components, cycloneDXComponent)
+	}
+	return image, refs
+}
+
+// CycloneDXImage is the SBOM of an image: the image is the subject of the BOM and depends on all its components
+func (g *Generator) CycloneDXImage(inventory *ImageInventory) *CycloneDXDocument {
+	image, refs := cycloneDXImage(inventory, "")
+	components := image.Components
+	image.Components = nil
+	document := g.newCycloneDXDocument(&image)
+	if components != nil {
+		document.Components = components
+	}
+	document.Dependencies = []CycloneDXDependency{{Ref: image.BOMRef, DependsOn: refs}}
+	return document
+}
+
+// CycloneDXNamespace is the aggregated SBOM of a namespace: every image is a container component with its components
+// nested and the workloads using it as properties
+func (g *Generator) CycloneDXNamespace(namespace string, inventories []*ImageInventory) *CycloneDXDocument {
+	document := g.newCycloneDXDocument(&CycloneDXComponent{BOMRef: "namespace/" + namespace, Type: "application", Name: "namespace/" + namespace})
+	var imageRefs []string
+	for _, inventory := range inventories {
+		image, refs := cycloneDXImage(inventory, inventory.Image+"#")
+		// the image itself keeps its plain name as bom-ref
+		image.BOMRef = inventory.Image
+		document.Components = append(document.Components, image)
+		document.Dependencies = append(document.Dependencies, CycloneDXDependency{Ref: image.BOMRef, DependsOn: refs})
+		imageRefs = append(imageRefs, image.BOMRef)
+	}
+	document.Dependencies = append([]CycloneDXDependency{{Ref: document.Metadata.Component.BOMRef, DependsOn: imageRefs}}, document.Dependencies...)
+	return document
+}
+
+// splitImage splits an image into its name and tag or digest, i.e.: docker.io/library/nginx:1.19 into
+// docker.io/library/nginx and 1.19
+func splitImage(image string) (string, string) {
+	if idx := strings.Index(image, "@"); idx >= 0 {
+		return image[:idx], image[idx+1:]
+	}
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		return image[:idx], image[idx+1:]
+	}
+	return image, "latest"
+}
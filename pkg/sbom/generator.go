@@ -0,0 +1,58 @@
+package sbom
+
+import (
+	"path/filepath"
+	"time"
+)
+
+const (
+	ToolVendor = "Synopsys"
+	ToolName   = "bd-xray"
+)
+
+// Generator creates CycloneDX and SPDX documents, all created at the same time by the same tool version
+type Generator struct {
+	ToolVersion string
+	Created     time.Time
+}
+
+func NewGenerator(toolVersion string) *Generator {
+	if toolVersion == "" {
+		toolVersion = "dev"
+	}
+	return &Generator{ToolVersion: toolVersion, Created: time.Now()}
+}
+
+// WriteImage writes the SBOMs of an image in all formats to dir, returning their paths
+func (g *Generator) WriteImage(dir string, formats []string, inventory *ImageInventory) ([]string, error) {
+	var paths []string
+	for _, format := range formats {
+		path := filepath.Join(dir, FileName(inventory.Image, format))
+		var document interface{} = g.CycloneDXImage(inventory)
+		if format == FormatSPDX {
+			document = g.SPDXImage(inventory)
+		}
+		if err := writeJSON(path, document); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// WriteNamespace writes the aggregated SBOMs of a namespace in all formats to dir, returning their paths
+func (g *Generator) WriteNamespace(dir string, formats []string, namespace string, inventories []*ImageInventory) ([]string, error) {
+	var paths []string
+	for _, format := range formats {
+		path := filepath.Join(dir, FileName("namespace-"+namespace, format))
+		var document interface{} = g.CycloneDXNamespace(namespace, inventories)
+		if format == FormatSPDX {
+			document = g.SPDXNamespace(namespace, inventories)
+		}
+		if err := writeJSON(path, document); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,239 @@
+package sbom
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/bdio"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+)
+
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+
+	// SourceBlackDuck means the components are from the Black Duck BOM of the project version
+	SourceBlackDuck = "blackduck"
+	// SourceBDIO means the components are from the local BDIO files of an offline scan
+	SourceBDIO = "bdio"
+)
+
+// Formats are the supported SBOM formats
+var Formats = []string{FormatCycloneDX, FormatSPDX}
+
+// Component is a component of an image, i.e.: musl 1.1.24-r10 from alpine
+type Component struct {
+	Name    string
+	Version string
+	// Origin is the forge or namespace of the component, i.e.: alpine, debian or maven
+	Origin     string
+	ExternalID string
+	Purl       string
+}
+
+// ImageInventory is what an image consists of, and which workloads use it
+type ImageInventory struct {
+	Image      string
+	Source     string
+	Workloads  []string
+	Components []Component
+}
+
+// NewComponent creates a component with the purl derived from its origin
+func NewComponent(name, version, origin, externalID string) Component {
+	return Component{
+		Name:       name,
+		Version:    version,
+		Origin:     origin,
+		ExternalID: externalID,
+		Purl:       Purl(origin, name, version, externalID),
+	}
+}
+
+// ComponentsFromBDIO converts the components of local BDIO files
+func ComponentsFromBDIO(bdioComponents []bdio.Component) []Component {
+	var components []Component
+	for _, component := range bdioComponents {
+		components = append(components, NewComponent(component.Name, component.Version, component.Origin, component.ExternalID))
+	}
+	sortComponents(components)
+	return components
+}
+
+// ComponentsFromBOM converts the components of a Black Duck BOM; a component with several origins is listed once per origin
+func ComponentsFromBOM(bomComponents []blackduck.BOMComponent) []Component {
+	var components []Component
+	for _, component := range bomComponents {
+		if len(component.Origins) == 0 {
+			components = append(components, NewComponent(component.ComponentName, component.ComponentVersionName, "", ""))
+			continue
+		}
+		for _, origin := range component.Origins {
+			components = append(components, NewComponent(component.ComponentName, component.ComponentVersionName, origin.ExternalNamespace, origin.ExternalID))
+		}
+	}
+	sortComponents(components)
+	return components
+}
+
+func sortComponents(components []Component) {
+	sort.SliceStable(components, func(a, b int) bool {
+		if components[a].Name != components[b].Name {
+			return components[a].Name < components[b].Name
+		}
+		if components[a].Version != components[b].Version {
+			return components[a].Version < components[b].Version
+		}
+		return components[a].Purl < components[b].Purl
+	})
+}
+
+// purlTypesByOrigin maps Black Duck forges to purl types, see https://github.com/package-url/purl-spec
+var purlTypesByOrigin = map[string]string{
+	"alpine":    "apk",
+	"debian":    "deb",
+	"ubuntu":    "deb",
+	"centos":    "rpm",
+	"redhat":    "rpm",
+	"fedora":    "rpm",
+	"opensuse":  "rpm",
+	"maven":     "maven",
+	"npmjs":     "npm",
+	"pypi":      "pypi",
+	"rubygems":  "gem",
+	"golang":    "golang",
+	"nuget":     "nuget",
+	"packagist": "composer",
+	"crates":    "cargo",
+}
+
+// Purl derives the package URL of a component, i.e.: pkg:apk/alpine/musl@1.1.24-r10?arch=x86_64 for the alpine
+// component with the external ID musl/1.1.24-r10/x86_64; unknown origins get a pkg:generic purl
+func Purl(origin, name, version, externalID string) string {
+	purlType, ok := purlTypesByOrigin[strings.ToLower(origin)]
+	if !ok {
+		return fmt.Sprintf("pkg:generic/%s@%s", escape(name), escape(version))
+	}
+	switch purlType {
+	case "apk", "deb", "rpm":
+		purl := fmt.Sprintf("pkg:%s/%s/%s@%s", purlType, strings.ToLower(origin), escape(name), escape(version))
+		// Linux package external IDs are NAME/VERSION/ARCH
+		if parts := strings.Split(externalID, "/"); len(parts) == 3 && parts[2] != "" {
+			purl += "?arch=" + escape(parts[2])
+		}
+		return purl
+	case "maven":
+		// maven external IDs are GROUP:ARTIFACT:VERSION
+		if parts := strings.Split(externalID, ":"); len(parts) == 3 {
+			return fmt.Sprintf("pkg:maven/%s/%s@%s", escape(parts[0]), escape(parts[1]), escape(parts[2]))
+		}
+	case "npm":
+		// scoped packages keep their scope as namespace, i.e.: pkg:npm/%40angular/core@11.0.0
+		if strings.HasPrefix(name, "@") && strings.Contains(name, "/") {
+			parts := strings.SplitN(name, "/", 2)
+			return fmt.Sprintf("pkg:npm/%%40%s/%s@%s", escape(parts[0][1:]), escape(parts[1]), escape(version))
+		}
+	case "pypi":
+		name = strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	case "golang":
+		// go module paths keep their slashes
+		return fmt.Sprintf("pkg:golang/%s@%s", name, escape(version))
+	}
+	return fmt.Sprintf("pkg:%s/%s@%s", purlType, escape(name), escape(version))
+}
+
+func escape(segment string) string {
+	return url.PathEscape(segment)
+}
+
+// Collector collects the inventories of concurrently scanned images, together with the workloads using them
+type Collector struct {
+	mutex       sync.Mutex
+	inventories map[string]*ImageInventory
+	workloads   map[string][]string
+}
+
+func NewCollector() *Collector {
+	return &Collector{inventories: map[string]*ImageInventory{}, workloads: map[string][]string{}}
+}
+
+// SetWorkloads records which workloads use which image, i.e.: Deployment/nginx
+func (c *Collector) SetWorkloads(workloadsByImage map[string][]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.workloads = workloadsByImage
+}
+
+// Add adds the inventory of an image, filling in the workloads using it
+func (c *Collector) Add(inventory *ImageInventory) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	inventory.Workloads = c.workloads[inventory.Image]
+	c.inventories[inventory.Image] = inventory
+}
+
+// Inventories are the collected inventories, sorted by image
+func (c *Collector) Inventories() []*ImageInventory {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var inventories []*ImageInventory
+	for _, inventory := range c.inventories {
+		inventories = append(inventories, inventory)
+	}
+	sort.Slice(inventories, func(a, b int) bool {
+		return inventories[a].Image < inventories[b].Image
+	})
+	return inventories
+}
+
+// FileName is the file name of the SBOM of an image or namespace in a format, i.e.: docker.io_library_nginx_1.19.cdx.json
+func FileName(name, format string) string {
+	sanitized := strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(name)
+	if format == FormatSPDX {
+		return sanitized + ".spdx.json"
+	}
+	return sanitized + ".cdx.json"
+}
+
+// ValidateFormats checks that all formats are supported
+func ValidateFormats(formats []string) error {
+	for _, format := range formats {
+		if format != FormatCycloneDX && format != FormatSPDX {
+			return errors.Errorf("unsupported SBOM format '%s', expected one of [%s]", format, strings.Join(Formats, ", "))
+		}
+	}
+	return nil
+}
+
+// writeJSON writes an SBOM document as indented JSON
+func writeJSON(path string, document interface{}) error {
+	content, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal SBOM %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "unable to create directory of SBOM %s", path)
+	}
+	return errors.Wrapf(ioutil.WriteFile(path, append(content, '\n'), 0644), "unable to write SBOM %s", path)
+}
+
+// newUUID generates a random (version 4) UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.Wrapf(err, "unable to generate UUID"))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
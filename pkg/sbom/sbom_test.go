@@ -0,0 +1,187 @@
+package sbom
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/bdio"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+)
+
+func TestPurl(t *testing.T) {
+	testCases := []struct {
+		origin, name, version, externalID string
+		expected                          string
+	}{
+		{"alpine", "musl", "1.1.24-r10", "musl/1.1.24-r10/x86_64", "pkg:apk/alpine/musl@1.1.24-r10?arch=x86_64"},
+		{"debian", "openssl", "1.1.1d-0+deb10u4", "openssl/1.1.1d-0+deb10u4/amd64", "pkg:deb/debian/openssl@1.1.1d-0+deb10u4?arch=amd64"},
+		{"centos", "bash", "4.2.46-34.el7", "bash/4.2.46-34.el7", "pkg:rpm/centos/bash@4.2.46-34.el7"},
+		{"maven", "Jackson Databind", "2.10.0", "com.fasterxml.jackson.core:jackson-databind:2.10.0", "pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.10.0"},
+		{"npmjs", "@angular/core", "11.0.0", "@angular/core/11.0.0", "pkg:npm/%40angular/core@11.0.0"},
+		{"pypi", "Django_Extensions", "3.1.0", "Django_Extensions/3.1.0", "pkg:pypi/django-extensions@3.1.0"},
+		{"golang", "github.com/pkg/errors", "v0.9.1", "github.com/pkg/errors:v0.9.1", "pkg:golang/github.com/pkg/errors@v0.9.1"},
+		{"", "OpenSSL", "1.1.1", "", "pkg:generic/OpenSSL@1.1.1"},
+	}
+	for _, testCase := range testCases {
+		if actual := Purl(testCase.origin, testCase.name, testCase.version, testCase.externalID); actual != testCase.expected {
+			t.Errorf("Expected [%s], but got [%s]", testCase.expected, actual)
+		}
+	}
+}
+
+func TestComponentsFromBOM(t *testing.T) {
+	components := ComponentsFromBOM([]blackduck.BOMComponent{
+		{ComponentName: "musl", ComponentVersionName: "1.1.24-r10", Origins: []blackduck.BOMOrigin{{ExternalNamespace: "alpine", ExternalID: "musl/1.1.24-r10/x86_64"}}},
+		{ComponentName: "busybox", ComponentVersionName: "1.31.1-r19"},
+	})
+	if len(components) != 2 || components[0].Purl != "pkg:generic/busybox@1.31.1-r19" || components[1].Purl != "pkg:apk/alpine/musl@1.1.24-r10?arch=x86_64" {
+		t.Errorf("Expected busybox and musl, but got [%+v]", components)
+	}
+}
+
+func newTestInventories() []*ImageInventory {
+	return []*ImageInventory{
+		{
+			Image:     "docker.io/library/alpine:3.12",
+			Source:    SourceBDIO,
+			Workloads: []string{"Deployment/api", "StatefulSet/cache"},
+			Components: ComponentsFromBDIO([]bdio.Component{
+				{Name: "musl", Version: "1.1.24-r10", Origin: "alpine", ExternalID: "musl/1.1.24-r10/x86_64"},
+				{Name: "busybox", Version: "1.31.1-r19", Origin: "alpine", ExternalID: "busybox/1.31.1-r19/x86_64"},
+			}),
+		},
+		{
+			Image:      "nginx:1.19",
+			Source:     SourceBlackDuck,
+			Workloads:  []string{"Deployment/web"},
+			Components: []Component{NewComponent("openssl", "1.1.1d-0+deb10u4", "debian", "openssl/1.1.1d-0+deb10u4/amd64")},
+		},
+	}
+}
+
+func newTestGenerator() *Generator {
+	return &Generator{ToolVersion: "v0.2.0", Created: time.Date(2021, 3, 2, 10, 15, 31, 0, time.UTC)}
+}
+
+func TestCycloneDXImage(t *testing.T) {
+	document := newTestGenerator().CycloneDXImage(newTestInventories()[0])
+
+	if document.BOMFormat != "CycloneDX" || document.SpecVersion != CycloneDXSpecVersion || !strings.HasPrefix(document.SerialNumber, "urn:uuid:") {
+		t.Errorf("Expected a CycloneDX %s BOM, but got [%s %s %s]", CycloneDXSpecVersion, document.BOMFormat, document.SpecVersion, document.SerialNumber)
+	}
+	if document.Metadata.Timestamp != "2021-03-02T10:15:31Z" || document.Metadata.Tools[0].Version != "v0.2.0" {
+		t.Errorf("Expected the creation time and tool version, but got [%+v]", document.Metadata)
+	}
+	image := document.Metadata.Component
+	if image == nil || image.Type != "container" || image.Name != "docker.io/library/alpine" || image.Version != "3.12" {
+		t.Fatalf("Expected the alpine container as subject, but got [%+v]", image)
+	}
+	if len(document.Components) != 2 || document.Components[0].Name != "busybox" || document.Components[1].Purl != "pkg:apk/alpine/musl@1.1.24-r10?arch=x86_64" {
+		t.Errorf("Expected busybox and musl, but got [%+v]", document.Components)
+	}
+	if len(document.Dependencies) != 1 || document.Dependencies[0].Ref != image.BOMRef || len(document.Dependencies[0].DependsOn) != 2 {
+		t.Errorf("Expected the image to depend on both components, but got [%+v]", document.Dependencies)
+	}
+}
+
+func TestCycloneDXNamespace(t *testing.T) {
+	document := newTestGenerator().CycloneDXNamespace("shop", newTestInventories())
+
+	if document.Metadata.Component.Name != "namespace/shop" || len(document.Components) != 2 {
+		t.Fatalf("Expected the namespace with 2 images, but got [%+v]", document)
+	}
+	var workloads []string
+	for _, property := range document.Components[0].Properties {
+		if property.Name == propertyWorkload {
+			workloads = append(workloads, property.Value)
+		}
+	}
+	if strings.Join(workloads, ",") != "Deployment/api,StatefulSet/cache" {
+		t.Errorf("Expected [Deployment/api,StatefulSet/cache], but got [%v]", workloads)
+	}
+	refs := map[string]bool{}
+	for _, image := range document.Components {
+		for _, component := range image.Components {
+			if refs[component.BOMRef] {
+				t.Errorf("Expected unique bom-refs, but got [%s] twice", component.BOMRef)
+			}
+			refs[component.BOMRef] = true
+		}
+	}
+	if len(refs) != 3 || len(document.Dependencies) != 3 || len(document.Dependencies[0].DependsOn) != 2 {
+		t.Errorf("Expected 3 components and the namespace to depend on both images, but got [%+v]", document.Dependencies)
+	}
+}
+
+var spdxIDRegex = regexp.MustCompile(`^SPDXRef-[a-zA-Z0-9.-]+$`)
+
+func TestSPDXNamespace(t *testing.T) {
+	document := newTestGenerator().SPDXNamespace("shop", newTestInventories())
+
+	if document.SPDXVersion != SPDXVersion || document.DataLicense != "CC0-1.0" || !strings.HasPrefix(document.DocumentNamespace, spdxNamespaceURL+"/namespace-shop-") {
+		t.Errorf("Expected an %s document, but got [%s %s %s]", SPDXVersion, document.SPDXVersion, document.DataLicense, document.DocumentNamespace)
+	}
+	if len(document.Packages) != 5 {
+		t.Fatalf("Expected 2 images and 3 components, but got [%+v]", document.Packages)
+	}
+	ids := map[string]bool{}
+	for _, spdxPackage := range document.Packages {
+		if !spdxIDRegex.MatchString(spdxPackage.SPDXID) || ids[spdxPackage.SPDXID] {
+			t.Errorf("Expected a valid and unique SPDX ID, but got [%s]", spdxPackage.SPDXID)
+		}
+		ids[spdxPackage.SPDXID] = true
+	}
+	if image := document.Packages[0]; image.PrimaryPackagePurpose != "CONTAINER" || !strings.Contains(image.Comment, "used by workloads: Deployment/api, StatefulSet/cache") {
+		t.Errorf("Expected the alpine image used by 2 workloads, but got [%+v]", image)
+	}
+	if musl := document.Packages[2]; musl.Name != "musl" || musl.ExternalRefs[0].ReferenceLocator != "pkg:apk/alpine/musl@1.1.24-r10?arch=x86_64" {
+		t.Errorf("Expected musl with its purl, but got [%+v]", musl)
+	}
+	var describes, contains int
+	for _, relationship := range document.Relationships {
+		if !ids[relationship.RelatedSPDXElement] {
+			t.Errorf("Expected relationships between packages, but got [%+v]", relationship)
+		}
+		switch relationship.RelationshipType {
+		case "DESCRIBES":
+			describes++
+		case "CONTAINS":
+			contains++
+		}
+	}
+	if describes != 2 || contains != 3 {
+		t.Errorf("Expected 2 DESCRIBES and 3 CONTAINS relationships, but got [%d %d]", describes, contains)
+	}
+}
+
+func TestWriteImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sbom")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths, err := newTestGenerator().WriteImage(dir, Formats, newTestInventories()[1])
+	expected := []string{filepath.Join(dir, "nginx_1.19.cdx.json"), filepath.Join(dir, "nginx_1.19.spdx.json")}
+	if err != nil || strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected [%v], but got [%v %+v]", expected, paths, err)
+	}
+	content, err := ioutil.ReadFile(paths[1])
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var document SPDXDocument
+	if err := json.Unmarshal(content, &document); err != nil || document.Name != "nginx:1.19" || len(document.Packages) != 2 {
+		t.Errorf("Expected the SPDX document of nginx:1.19, but got [%s %+v]", content, err)
+	}
+
+	if err := ValidateFormats([]string{"cyclonedx", "swid"}); err == nil {
+		t.Errorf("Expected an error for an unsupported format")
+	}
+}
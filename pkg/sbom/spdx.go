@@ -0,0 +1,138 @@
+package sbom
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	SPDXVersion = "SPDX-2.3"
+
+	spdxNoAssertion  = "NOASSERTION"
+	spdxDocumentID   = "SPDXRef-DOCUMENT"
+	spdxNamespaceURL = "https://github.com/blackducksoftware/kubectl-bd-xray/spdx"
+)
+
+var spdxIDInvalidCharsRegex = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// SPDXDocument is an SPDX JSON document, see https://spdx.github.io/spdx-spec/v2.3/
+type SPDXDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      SPDXCreationInfo   `json:"creationInfo"`
+	Packages          []SPDXPackage      `json:"packages"`
+	Relationships     []SPDXRelationship `json:"relationships"`
+}
+
+type SPDXCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type SPDXPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	LicenseConcluded      string            `json:"licenseConcluded"`
+	LicenseDeclared       string            `json:"licenseDeclared"`
+	CopyrightText         string            `json:"copyrightText"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	Comment               string            `json:"comment,omitempty"`
+	ExternalRefs          []SPDXExternalRef `json:"externalRefs,omitempty"`
+}
+
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func (g *Generator) newSPDXDocument(name string) *SPDXDocument {
+	return &SPDXDocument{
+		SPDXVersion:       SPDXVersion,
+		DataLicense:       "CC0-1.0",
+		SPDXID:            spdxDocumentID,
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("%s/%s-%s", spdxNamespaceURL, spdxIDInvalidCharsRegex.ReplaceAllString(name, "-"), newUUID()),
+		CreationInfo: SPDXCreationInfo{
+			Created:  g.Created.UTC().Format(time.RFC3339),
+			Creators: []string{fmt.Sprintf("Tool: %s-%s", ToolName, g.ToolVersion), fmt.Sprintf("Organization: %s", ToolVendor)},
+		},
+		Packages:      []SPDXPackage{},
+		Relationships: []SPDXRelationship{},
+	}
+}
+
+func newSPDXPackage(spdxID, name, version, purpose string) SPDXPackage {
+	return SPDXPackage{
+		SPDXID:                spdxID,
+		Name:                  name,
+		VersionInfo:           version,
+		DownloadLocation:      spdxNoAssertion,
+		LicenseConcluded:      spdxNoAssertion,
+		LicenseDeclared:       spdxNoAssertion,
+		CopyrightText:         spdxNoAssertion,
+		PrimaryPackagePurpose: purpose,
+	}
+}
+
+// addSPDXImage adds the package of an image, containing a package per component; idPrefix keeps SPDX IDs unique
+// across images
+func (d *SPDXDocument) addSPDXImage(inventory *ImageInventory, idPrefix string) string {
+	name, tag := splitImage(inventory.Image)
+	imageID := fmt.Sprintf("SPDXRef-%sImage", idPrefix)
+	image := newSPDXPackage(imageID, name, tag, "CONTAINER")
+	image.Comment = fmt.Sprintf("image %s, components from %s", inventory.Image, inventory.Source)
+	if len(inventory.Workloads) > 0 {
+		image.Comment += fmt.Sprintf("; used by workloads: %s", strings.Join(inventory.Workloads, ", "))
+	}
+	d.Packages = append(d.Packages, image)
+
+	for idx, component := range inventory.Components {
+		packageID := fmt.Sprintf("SPDXRef-%sPackage-%d-%s", idPrefix, idx+1, spdxIDInvalidCharsRegex.ReplaceAllString(component.Name, "-"))
+		spdxPackage := newSPDXPackage(packageID, component.Name, component.Version, "LIBRARY")
+		if component.Origin != "" {
+			spdxPackage.Comment = fmt.Sprintf("origin %s %s", component.Origin, component.ExternalID)
+		}
+		if component.Purl != "" {
+			spdxPackage.ExternalRefs = []SPDXExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: component.Purl}}
+		}
+		d.Packages = append(d.Packages, spdxPackage)
+		d.Relationships = append(d.Relationships, SPDXRelationship{SPDXElementID: imageID, RelationshipType: "CONTAINS", RelatedSPDXElement: packageID})
+	}
+	return imageID
+}
+
+// SPDXImage is the SBOM of an image: the document describes the image package, which contains all its components
+func (g *Generator) SPDXImage(inventory *ImageInventory) *SPDXDocument {
+	document := g.newSPDXDocument(inventory.Image)
+	imageID := document.addSPDXImage(inventory, "")
+	document.Relationships = append([]SPDXRelationship{{SPDXElementID: spdxDocumentID, RelationshipType: "DESCRIBES", RelatedSPDXElement: imageID}}, document.Relationships...)
+	return document
+}
+
+// SPDXNamespace is the aggregated SBOM of a namespace: the document describes every image package, and the comment
+// of each image lists the workloads using it
+func (g *Generator) SPDXNamespace(namespace string, inventories []*ImageInventory) *SPDXDocument {
+	document := g.newSPDXDocument("namespace/" + namespace)
+	var describes []SPDXRelationship
+	for idx, inventory := range inventories {
+		imageID := document.addSPDXImage(inventory, fmt.Sprintf("%d-", idx+1))
+		describes = append(describes, SPDXRelationship{SPDXElementID: spdxDocumentID, RelationshipType: "DESCRIBES", RelatedSPDXElement: imageID})
+	}
+	document.Relationships = append(describes, document.Relationships...)
+	return document
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group, so that its children can be killed along with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessTree kills the process group of the command, i.e.: detect.sh together with the java process it started
+func killProcessTree(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
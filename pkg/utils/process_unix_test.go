@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRunCommandWithContextKillsProcessTree(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// the child sleep holds the output pipe open, so the command only returns once the whole tree is killed
+	cmd := exec.Command("sh", "-c", "sleep 30 & sleep 30")
+	start := time.Now()
+	err := RunCommandBasedOnLoggingLevelWithContext(ctx, cmd)
+	if err == nil {
+		t.Errorf("Expected an error for a cancelled command")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the command to be killed on cancellation, but it took [%s]", elapsed)
+	}
+}
+
+func TestCommandErrorKeepsSecretsAndOutputOut(t *testing.T) {
+	logFile, err := ioutil.TempFile("", "detect.log")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.Remove(logFile.Name())
+	defer logFile.Close()
+
+	cmd := exec.Command("sh", "-c", "printf 'l%sts of output\\n' o; exit 6", "detect.sh", "--blackduck.api.token=s3cret", "--detect.project.name=shop")
+	err = RunCommandBasedOnLoggingLevelWithContextAndLog(context.Background(), cmd, logFile)
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) || commandErr.ExitCode != 6 || !strings.Contains(commandErr.Output, "lots of output") {
+		t.Fatalf("Expected a command error with exit code 6 and the output, but got [%+v]", err)
+	}
+	message := err.Error()
+	if strings.Contains(message, "s3cret") || strings.Contains(message, "lots of output") {
+		t.Errorf("Expected neither the token nor the output in the error, but got [%s]", message)
+	}
+	if !strings.Contains(message, "--blackduck.api.token=REDACTED --detect.project.name=shop") || !strings.Contains(message, logFile.Name()) {
+		t.Errorf("Expected the redacted command and the log file in the error, but got [%s]", message)
+	}
+	if content, _ := ioutil.ReadFile(logFile.Name()); !strings.Contains(string(content), "lots of output") {
+		t.Errorf("Expected the output in the log file, but got [%s]", content)
+	}
+}
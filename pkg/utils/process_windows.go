@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessTree kills the command together with its children
+func killProcessTree(cmd *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", fmt.Sprintf("%d", cmd.Process.Pid)).Run()
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NewSignalContext returns a context which is cancelled on the first SIGINT or SIGTERM; a second signal exits immediately
+func NewSignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warnf("received %s, cancelling running scans; send it again to exit immediately", sig)
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+		sig := <-signals
+		log.Errorf("received %s again, exiting", sig)
+		os.Exit(130)
+	}()
+	return ctx, cancel
+}
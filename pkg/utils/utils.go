@@ -2,7 +2,9 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -52,6 +54,40 @@ func GetExecCommandFromString(fullCmd string) *exec.Cmd {
 	return exec.Command(cmdName, cmdArgs...)
 }
 
+// secretArgRegexp matches --KEY=VALUE arguments whose value is a secret, i.e.: --blackduck.api.token=TOKEN
+var secretArgRegexp = regexp.MustCompile(`(?i)^(--?[^=]*(token|password|secret)[^=]*=).+$`)
+
+// RedactCommand is the command line of cmd with the values of secret arguments replaced, so that it can be logged
+func RedactCommand(cmd *exec.Cmd) string {
+	args := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		args[i] = secretArgRegexp.ReplaceAllString(arg, "${1}REDACTED")
+	}
+	return strings.Join(args, " ")
+}
+
+// CommandError is the error of a command which ran, but failed; Command is redacted by RedactCommand and Output is
+// the combined stdout and stderr, which is kept out of the message, since it may be huge. LogFile is where the output
+// was written to, if it was written to a file
+type CommandError struct {
+	Command  string
+	ExitCode int
+	Output   string
+	LogFile  string
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	if e.LogFile != "" {
+		return fmt.Sprintf("unable to run command '%s': %v, see %s", e.Command, e.Err, e.LogFile)
+	}
+	return fmt.Sprintf("unable to run command '%s': %v", e.Command, e.Err)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
 func RunCommandBasedOnLoggingLevel(cmd *exec.Cmd) error {
 	var err error
 	if log.GetLevel() == log.TraceLevel {
@@ -101,6 +137,69 @@ func RunCommandAndCaptureProgress(cmd *exec.Cmd) error {
 	return errors.Wrapf(cmd.Run(), "unable to run command '%s'", cmd.String())
 }
 
+// RunCommandBasedOnLoggingLevelWithContext runs the command like RunCommandBasedOnLoggingLevel, but kills the command
+// together with all processes it started once ctx is done; a failed command returns a *CommandError
+func RunCommandBasedOnLoggingLevelWithContext(ctx context.Context, cmd *exec.Cmd) error {
+	return RunCommandBasedOnLoggingLevelWithContextAndLog(ctx, cmd, ioutil.Discard)
+}
+
+// RunCommandBasedOnLoggingLevelWithContextAndLog runs the command like RunCommandBasedOnLoggingLevelWithContext, and
+// additionally writes its output to logWriter, i.e.: a log file kept for later inspection, which the error of a failed
+// command points to; secret arguments are redacted in the logs and errors
+func RunCommandBasedOnLoggingLevelWithContextAndLog(ctx context.Context, cmd *exec.Cmd, logWriter io.Writer) error {
+	var output bytes.Buffer
+	if log.GetLevel() == log.TraceLevel {
+		log.Tracef("since trace level is enabled, will forward progress in stdout as subcommand executes")
+		cmd.Stdout = io.MultiWriter(os.Stdout, &output, logWriter)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &output, logWriter)
+	} else {
+		cmd.Stdout = io.MultiWriter(&output, logWriter)
+		cmd.Stderr = cmd.Stdout
+	}
+	setProcessGroup(cmd)
+	command := RedactCommand(cmd)
+
+	log.Debugf("executing subcommand: '%s'", command)
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "unable to start command '%s'", command)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debugf("killing command '%s'", command)
+				if err := killProcessTree(cmd); err != nil {
+					log.Warnf("unable to kill command '%s': %+v", command, err)
+				}
+				return
+			case <-done:
+				return
+			case <-time.After(30 * time.Second):
+				log.Debugf("waiting for command '%s' ...", command)
+			}
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	log.Tracef("command: '%s' output:\n%s", command, output.String())
+	if ctx.Err() != nil {
+		return errors.Wrapf(ctx.Err(), "command '%s' was cancelled", command)
+	}
+	if err == nil {
+		return nil
+	}
+	exitCode := -1
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	}
+	commandErr := &CommandError{Command: command, ExitCode: exitCode, Output: output.String(), Err: err}
+	if logFile, ok := logWriter.(*os.File); ok {
+		commandErr.LogFile = logFile.Name()
+	}
+	return commandErr
+}
+
 // RunAndCaptureProgress runs a long running command and continuously streams its output
 // func RunAndCaptureProgress(cmd *exec.Cmd) error {
 // 	var stdoutBuf, stderrBuf bytes.Buffer
@@ -197,12 +296,20 @@ func ValidateImageVersion(version string) bool {
 	return false
 }
 
+// stripImageDigest strips the digest of an image pinned by it, i.e.: nginx:1.19 of nginx:1.19@sha256:4c0f...
+func stripImageDigest(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i]
+	}
+	return image
+}
+
 // ParseImageTag takes a docker image string and returns the tag
 // image := "docker.io/blackducksoftware/synopsys-operator:latest"
 // subMatch = [blackducksoftware/synopsys-operator:latest latest]
 func ParseImageTag(image string) string {
 	imageTagRegexp := regexp.MustCompile(`[0-9a-zA-Z-_:\/.]*:([a-zA-Z0-9-\\._]+)$`)
-	tagSubstringSubmatch := imageTagRegexp.FindStringSubmatch(image)
+	tagSubstringSubmatch := imageTagRegexp.FindStringSubmatch(stripImageDigest(image))
 	if len(tagSubstringSubmatch) == 2 {
 		return tagSubstringSubmatch[1]
 	}
@@ -214,7 +321,7 @@ func ParseImageTag(image string) string {
 // subMatch = [blackducksoftware/synopsys-operator:latest docker.io/blackducksoftware/ synopsys-operator :latest]
 func ParseImageName(image string) string {
 	imageNameRegexp := regexp.MustCompile(`([0-9a-zA-Z-_:\/.]+\/)*([0-9a-zA-Z-_\.]+):?[a-zA-Z0-9-\\._]*$`)
-	nameSubstringSubmatch := imageNameRegexp.FindStringSubmatch(image)
+	nameSubstringSubmatch := imageNameRegexp.FindStringSubmatch(stripImageDigest(image))
 	if len(nameSubstringSubmatch) < 2 {
 		return ""
 	}
@@ -226,7 +333,7 @@ func ParseImageName(image string) string {
 // subMatch = [blackducksoftware/synopsys-operator:latest docker.io/blackducksoftware/ synopsys-operator :latest]
 func ParseImageRepo(image string) string {
 	repoRegexp := regexp.MustCompile(`([0-9a-zA-Z-_:\/.]+)\/[0-9a-zA-Z-_\.]+:?[a-zA-Z0-9-\\._]*$`)
-	repoSubstringSubmatch := repoRegexp.FindStringSubmatch(image)
+	repoSubstringSubmatch := repoRegexp.FindStringSubmatch(stripImageDigest(image))
 	if len(repoSubstringSubmatch) != 2 {
 		return ""
 	}
@@ -0,0 +1,203 @@
+package versioning
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mcuadros/go-version"
+)
+
+var (
+	tagRegex        = regexp.MustCompile(`^(v?)([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?([-_+.].*)?$`)
+	prereleaseRegex = regexp.MustCompile(`(?i)^[-_+.]?(alpha|beta|rc|pre|preview|dev|snapshot|nightly)`)
+	variantRegex    = regexp.MustCompile(`[0-9.]+`)
+)
+
+// Tag is an image tag split into its numeric version and its variant suffix, i.e.: 1.19.2-alpine3.12 is [1 19 2] and -alpine3.12;
+// Prefix is set by schemes for which the text before the version is part of the variant, i.e.: RELEASE.
+type Tag struct {
+	Original string
+	Prefix   string
+	Numbers  []int
+	Suffix   string
+}
+
+// ParseTag parses a tag of the form v?X(.Y(.Z))?(suffix)?
+func ParseTag(tag string) (Tag, bool) {
+	match := tagRegex.FindStringSubmatch(tag)
+	if match == nil {
+		return Tag{}, false
+	}
+	parsed := Tag{Original: tag, Suffix: match[5]}
+	for _, number := range match[2:5] {
+		if number == "" {
+			break
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return Tag{}, false
+		}
+		parsed.Numbers = append(parsed.Numbers, n)
+	}
+	return parsed, true
+}
+
+// IsPrerelease is true for suffixes like -rc1, -beta.2 or -SNAPSHOT
+func (t Tag) IsPrerelease() bool {
+	return prereleaseRegex.MatchString(t.Suffix)
+}
+
+// Variant is the family of the suffix without its versions, i.e.: -alpine3.12 and -alpine3.11 are both -alpine;
+// pre-releases belong to the family of their release
+func (t Tag) Variant() string {
+	if t.IsPrerelease() {
+		return t.Prefix
+	}
+	return t.Prefix + variantRegex.ReplaceAllString(t.Suffix, "")
+}
+
+// NumericVersion is the version without prefix and suffix, i.e.: 1.19.2
+func (t Tag) NumericVersion() string {
+	var parts []string
+	for _, n := range t.Numbers {
+		parts = append(parts, strconv.Itoa(n))
+	}
+	return strings.Join(parts, ".")
+}
+
+// Compare returns 1, 0 or -1 if t is higher, equal or lower than other; on equal numbers
+// a release is higher than a pre-release, otherwise the versions within the suffixes are compared
+func (t Tag) Compare(other Tag) int {
+	for i := 0; i < len(t.Numbers) && i < len(other.Numbers); i++ {
+		if t.Numbers[i] != other.Numbers[i] {
+			if t.Numbers[i] > other.Numbers[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	if t.IsPrerelease() != other.IsPrerelease() {
+		if other.IsPrerelease() {
+			return 1
+		}
+		return -1
+	}
+	suffixVersion := strings.Join(variantRegex.FindAllString(t.Suffix, -1), ".")
+	otherSuffixVersion := strings.Join(variantRegex.FindAllString(other.Suffix, -1), ".")
+	if suffixVersion == "" || otherSuffixVersion == "" {
+		return 0
+	}
+	return version.CompareSimple(version.Normalize(suffixVersion), version.Normalize(otherSuffixVersion))
+}
+
+// Recommendation holds the highest tag within the same minor (patch upgrade), within the same major
+// (minor upgrade) and overall (major upgrade) together with the status of the gap to the current tag
+type Recommendation struct {
+	Current     string
+	LatestPatch string
+	PatchStatus string
+	LatestMinor string
+	MinorStatus string
+	LatestMajor string
+	MajorStatus string
+	// PatchesBehind, MinorsBehind and MajorsBehind count the distinct newer releases at each level, i.e.: 1.18.0 is
+	// 2 minors behind if 1.19.x and 1.20.x exist
+	PatchesBehind int
+	MinorsBehind  int
+	MajorsBehind  int
+}
+
+// NewRecommendation returns a recommendation for current for which no upgrades were found
+func NewRecommendation(current string) Recommendation {
+	return Recommendation{
+		Current:     current,
+		LatestPatch: Notfound,
+		PatchStatus: Notfound,
+		LatestMinor: Notfound,
+		MinorStatus: Notfound,
+		LatestMajor: Notfound,
+		MajorStatus: Notfound,
+	}
+}
+
+// FindRecommendation finds the upgrades for current in versions using the semver scheme
+func FindRecommendation(current string, versions []string, allowAllReleases bool) Recommendation {
+	return FindRecommendationWithScheme(current, versions, allowAllReleases, SemverScheme{})
+}
+
+// FindRecommendationWithScheme finds the upgrades for current in versions; only versions of the same variant and with
+// the same number of components are considered, pre-releases only if allowAllReleases is set
+func FindRecommendationWithScheme(current string, versions []string, allowAllReleases bool, scheme Scheme) Recommendation {
+	recommendation := NewRecommendation(current)
+	currentTag, ok := scheme.Parse(current)
+	if !ok || len(versions) == 0 {
+		return recommendation
+	}
+
+	newerPatches, newerMinors, newerMajors := map[int]bool{}, map[int]bool{}, map[int]bool{}
+	latestPatch, latestMinor, latestMajor := currentTag, currentTag, currentTag
+	for _, v := range versions {
+		candidate, ok := scheme.Parse(v)
+		if !ok || len(candidate.Numbers) != len(currentTag.Numbers) || candidate.Variant() != currentTag.Variant() {
+			continue
+		}
+		if candidate.IsPrerelease() && !allowAllReleases {
+			continue
+		}
+		if candidate.Compare(latestMajor) > 0 {
+			latestMajor = candidate
+		}
+		if candidate.Numbers[0] > currentTag.Numbers[0] {
+			newerMajors[candidate.Numbers[0]] = true
+		}
+		if candidate.Numbers[0] != currentTag.Numbers[0] {
+			continue
+		}
+		if candidate.Compare(latestMinor) > 0 {
+			latestMinor = candidate
+		}
+		if len(currentTag.Numbers) < 2 {
+			continue
+		}
+		if candidate.Numbers[1] > currentTag.Numbers[1] {
+			newerMinors[candidate.Numbers[1]] = true
+		}
+		if candidate.Numbers[1] != currentTag.Numbers[1] {
+			continue
+		}
+		if candidate.Compare(latestPatch) > 0 {
+			latestPatch = candidate
+		}
+		if len(currentTag.Numbers) >= 3 && candidate.Numbers[2] > currentTag.Numbers[2] {
+			newerPatches[candidate.Numbers[2]] = true
+		}
+	}
+	recommendation.PatchesBehind, recommendation.MinorsBehind, recommendation.MajorsBehind = len(newerPatches), len(newerMinors), len(newerMajors)
+
+	recommendation.LatestPatch, recommendation.PatchStatus = latestPatch.Original, determineTagStatus(latestPatch, currentTag)
+	recommendation.LatestMinor, recommendation.MinorStatus = latestMinor.Original, determineTagStatus(latestMinor, currentTag)
+	recommendation.LatestMajor, recommendation.MajorStatus = latestMajor.Original, determineTagStatus(latestMajor, currentTag)
+	return recommendation
+}
+
+// determineTagStatus compares the numbers of the tags with DetermineLifeCycleStatus; tags with the same numbers but a
+// newer variant, i.e.: a newer base image or a release of a pre-release, are a patch
+func determineTagStatus(latest Tag, current Tag) string {
+	if latest.Original == current.Original {
+		return Same
+	}
+	if status := DetermineLifeCycleStatus(latest.NumericVersion(), current.NumericVersion()); status != Same {
+		return status
+	}
+	return Patch
+}
+
+// FormatUpgrade formats an upgrade as 'TAG (STATUS)'
+func FormatUpgrade(tag, status string) string {
+	if tag == Notfound || status == Same {
+		return status
+	}
+	return fmt.Sprintf("%s (%s)", tag, status)
+}
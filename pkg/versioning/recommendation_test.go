@@ -0,0 +1,64 @@
+package versioning
+
+import "testing"
+
+var nginxTags = []string{
+	"latest", "alpine", "1.18", "1.18.0", "1.18.0-alpine", "1.19", "1.19.1", "1.19.2", "1.19.2-alpine",
+	"1.19.3-alpine", "1.19.3-perl", "2.0.0-rc1", "1.20.0", "1.20.1-alpine", "2.0.0", "2.1.0-alpine",
+}
+
+func TestFindRecommendation(t *testing.T) {
+	recommendation := FindRecommendation("1.18.0", nginxTags, false)
+	expected := Recommendation{
+		Current:     "1.18.0",
+		LatestPatch: "1.18.0", PatchStatus: Same,
+		LatestMinor: "1.20.0", MinorStatus: Minor,
+		LatestMajor: "2.0.0", MajorStatus: Major,
+		PatchesBehind: 0, MinorsBehind: 2, MajorsBehind: 1,
+	}
+	if recommendation != expected {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, recommendation)
+	}
+}
+
+func TestFindRecommendationKeepsVariant(t *testing.T) {
+	recommendation := FindRecommendation("1.19.2-alpine", nginxTags, false)
+	expected := Recommendation{
+		Current:     "1.19.2-alpine",
+		LatestPatch: "1.19.3-alpine", PatchStatus: Patch,
+		LatestMinor: "1.20.1-alpine", MinorStatus: Minor,
+		LatestMajor: "2.1.0-alpine", MajorStatus: Major,
+		PatchesBehind: 1, MinorsBehind: 1, MajorsBehind: 1,
+	}
+	if recommendation != expected {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, recommendation)
+	}
+}
+
+func TestFindRecommendationPrereleases(t *testing.T) {
+	recommendation := FindRecommendation("1.20.0", []string{"1.20.0", "2.0.0-rc1"}, false)
+	if recommendation.LatestMajor != "1.20.0" || recommendation.MajorStatus != Same {
+		t.Errorf("Expected pre-releases to be skipped, but got [%s %s]", recommendation.LatestMajor, recommendation.MajorStatus)
+	}
+	recommendation = FindRecommendation("1.20.0", []string{"1.20.0", "2.0.0-rc1"}, true)
+	if recommendation.LatestMajor != "2.0.0-rc1" || recommendation.MajorStatus != Major {
+		t.Errorf("Expected [2.0.0-rc1 %s], but got [%s %s]", Major, recommendation.LatestMajor, recommendation.MajorStatus)
+	}
+}
+
+func TestFindRecommendationNewerBaseImage(t *testing.T) {
+	recommendation := FindRecommendation("3.8-alpine3.11", []string{"3.8-alpine3.11", "3.8-alpine3.12", "3.9-alpine3.12"}, false)
+	if recommendation.LatestPatch != "3.8-alpine3.12" || recommendation.PatchStatus != Patch {
+		t.Errorf("Expected [3.8-alpine3.12 %s], but got [%s %s]", Patch, recommendation.LatestPatch, recommendation.PatchStatus)
+	}
+	if recommendation.LatestMinor != "3.9-alpine3.12" || recommendation.MinorStatus != Minor {
+		t.Errorf("Expected [3.9-alpine3.12 %s], but got [%s %s]", Minor, recommendation.LatestMinor, recommendation.MinorStatus)
+	}
+}
+
+func TestFindRecommendationUnparseableTag(t *testing.T) {
+	recommendation := FindRecommendation("latest", nginxTags, false)
+	if recommendation.LatestMajor != Notfound {
+		t.Errorf("Expected [%s], but got [%s]", Notfound, recommendation.LatestMajor)
+	}
+}
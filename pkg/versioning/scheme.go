@@ -0,0 +1,175 @@
+package versioning
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SchemeSemver parses tags of the form v?X(.Y(.Z))?(suffix)?, i.e.: 1.19.2-alpine
+	SchemeSemver = "semver"
+	// SchemeCalver parses date tags, i.e.: 2024.03.01, 20240301 or RELEASE.2023-09-07T02-05-02Z; year, month and day are
+	// treated as major, minor and patch
+	SchemeCalver = "calver"
+	// SchemeNumeric parses build numbers with an optional prefix, i.e.: 1234 or build-1234
+	SchemeNumeric = "numeric"
+	// SchemeRegex parses tags with a regular expression, see RegexScheme
+	SchemeRegex = "regex"
+)
+
+var (
+	calverRegex  = regexp.MustCompile(`^([^0-9]*)((?:19|20)[0-9]{2})(?:[-_.]?(0[1-9]|1[0-2]))?(?:[-_.]?(0[1-9]|[12][0-9]|3[01]))?(?:[-_.T]([0-9]{2})[-_:.]?([0-9]{2})[-_:.]?([0-9]{2})Z?)?([-_+].*)?$`)
+	numericRegex = regexp.MustCompile(`^([^0-9]*)([0-9]+)([-_+].*)?$`)
+)
+
+// Scheme parses tags into comparable versions
+type Scheme interface {
+	Parse(tag string) (Tag, bool)
+}
+
+// NewScheme returns the scheme of the given name, pattern is only used by the regex scheme; an empty name is semver
+func NewScheme(name string, pattern string) (Scheme, error) {
+	switch name {
+	case "", SchemeSemver:
+		return SemverScheme{}, nil
+	case SchemeCalver:
+		return CalverScheme{}, nil
+	case SchemeNumeric:
+		return NumericScheme{}, nil
+	case SchemeRegex:
+		return NewRegexScheme(pattern)
+	}
+	return nil, errors.Errorf("unknown version scheme '%s'; one of [%s, %s, %s, %s]", name, SchemeSemver, SchemeCalver, SchemeNumeric, SchemeRegex)
+}
+
+// SemverScheme is the default scheme, see ParseTag
+type SemverScheme struct{}
+
+// Parse parses a semver tag
+func (SemverScheme) Parse(tag string) (Tag, bool) {
+	return ParseTag(tag)
+}
+
+// CalverScheme parses date tags; the text before the date is part of the variant
+type CalverScheme struct{}
+
+// Parse parses a date tag
+func (CalverScheme) Parse(tag string) (Tag, bool) {
+	match := calverRegex.FindStringSubmatch(tag)
+	if match == nil {
+		return Tag{}, false
+	}
+	return newTag(tag, match[1], match[2:8], match[8])
+}
+
+// NumericScheme parses build numbers; the text before the number is part of the variant
+type NumericScheme struct{}
+
+// Parse parses a build number tag
+func (NumericScheme) Parse(tag string) (Tag, bool) {
+	match := numericRegex.FindStringSubmatch(tag)
+	if match == nil {
+		return Tag{}, false
+	}
+	return newTag(tag, match[1], match[2:3], match[3])
+}
+
+// RegexScheme parses tags with a regular expression which must match the whole tag; the groups named major, minor
+// and patch are the version, a missing or unmatched minor or patch is 0, or all unnamed groups in order if there are
+// none. A group named variant keeps upgrades within tags of the same variant
+type RegexScheme struct {
+	regex *regexp.Regexp
+}
+
+// NewRegexScheme compiles pattern into a RegexScheme
+func NewRegexScheme(pattern string) (RegexScheme, error) {
+	if pattern == "" {
+		return RegexScheme{}, errors.Errorf("version scheme '%s' requires a pattern", SchemeRegex)
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return RegexScheme{}, errors.Wrapf(err, "invalid version scheme pattern '%s'", pattern)
+	}
+	if regex.NumSubexp() == 0 {
+		return RegexScheme{}, errors.Errorf("version scheme pattern '%s' has no capture groups", pattern)
+	}
+	scheme := RegexScheme{regex: regex}
+	if len(scheme.slots()) > 0 && regex.SubexpIndex("major") < 0 {
+		return RegexScheme{}, errors.Errorf("version scheme pattern '%s' has a minor or patch group, but no major group", pattern)
+	}
+	return scheme, nil
+}
+
+// Parse parses a tag matching the pattern
+func (s RegexScheme) Parse(tag string) (Tag, bool) {
+	indexes := s.regex.FindStringSubmatchIndex(tag)
+	if indexes == nil || indexes[0] != 0 || indexes[1] != len(tag) {
+		return Tag{}, false
+	}
+	match := s.regex.FindStringSubmatch(tag)
+
+	var numbers []string
+	var variant string
+	named := map[string]string{}
+	for i, name := range s.regex.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		switch name {
+		case "major", "minor", "patch":
+			named[name] = match[i]
+		case "variant":
+			variant = match[i]
+		case "":
+			numbers = append(numbers, match[i])
+		}
+	}
+	if len(named) > 0 {
+		if named["major"] == "" {
+			return Tag{}, false
+		}
+		// the named groups keep their slots, so that a pattern without minor doesn't turn the patch into the minor
+		numbers = nil
+		for _, name := range s.slots() {
+			number := named[name]
+			if number == "" {
+				number = "0"
+			}
+			numbers = append(numbers, number)
+		}
+	}
+	return newTag(tag, variant, numbers, "")
+}
+
+// slots are the names of the version numbers up to the last named group of the pattern, i.e.: major, minor and patch
+// for a pattern with major and patch
+func (s RegexScheme) slots() []string {
+	slots := []string{"major", "minor", "patch"}
+	for last := len(slots); last > 0; last-- {
+		if s.regex.SubexpIndex(slots[last-1]) >= 0 {
+			return slots[:last]
+		}
+	}
+	return nil
+}
+
+// newTag builds a tag from its number strings, stopping at the first empty one
+func newTag(original string, prefix string, numbers []string, suffix string) (Tag, bool) {
+	parsed := Tag{Original: original, Prefix: prefix, Suffix: suffix}
+	for _, number := range numbers {
+		if number == "" {
+			break
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return Tag{}, false
+		}
+		parsed.Numbers = append(parsed.Numbers, n)
+	}
+	if len(parsed.Numbers) == 0 {
+		return Tag{}, false
+	}
+	return parsed, true
+}
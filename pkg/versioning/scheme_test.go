@@ -0,0 +1,81 @@
+package versioning
+
+import "testing"
+
+func TestFindRecommendationCalver(t *testing.T) {
+	tags := []string{"2023.09.01", "2023.09.15", "2023.11.02", "2024.03.01", "2024.03.01-alpine", "latest"}
+	recommendation := FindRecommendationWithScheme("2023.09.01", tags, false, CalverScheme{})
+	expected := Recommendation{
+		Current:     "2023.09.01",
+		LatestPatch: "2023.09.15", PatchStatus: Patch,
+		LatestMinor: "2023.11.02", MinorStatus: Minor,
+		LatestMajor: "2024.03.01", MajorStatus: Major,
+		PatchesBehind: 1, MinorsBehind: 1, MajorsBehind: 1,
+	}
+	if recommendation != expected {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, recommendation)
+	}
+}
+
+func TestFindRecommendationCalverMinio(t *testing.T) {
+	tags := []string{"RELEASE.2023-09-07T02-05-02Z", "RELEASE.2023-09-07T20-11-00Z", "RELEASE.2023-10-25T06-33-25Z", "RELEASE.2023-10-25T06-33-25Z.fips"}
+	recommendation := FindRecommendationWithScheme("RELEASE.2023-09-07T02-05-02Z", tags, false, CalverScheme{})
+	if recommendation.LatestPatch != "RELEASE.2023-09-07T20-11-00Z" || recommendation.PatchStatus != Patch {
+		t.Errorf("Expected [RELEASE.2023-09-07T20-11-00Z %s], but got [%s %s]", Patch, recommendation.LatestPatch, recommendation.PatchStatus)
+	}
+	if recommendation.LatestMinor != "RELEASE.2023-10-25T06-33-25Z" || recommendation.MinorStatus != Minor {
+		t.Errorf("Expected [RELEASE.2023-10-25T06-33-25Z %s], but got [%s %s]", Minor, recommendation.LatestMinor, recommendation.MinorStatus)
+	}
+}
+
+func TestFindRecommendationNumeric(t *testing.T) {
+	tags := []string{"build-41", "build-42", "build-100", "100", "1.2.3"}
+	recommendation := FindRecommendationWithScheme("build-41", tags, false, NumericScheme{})
+	if recommendation.LatestMajor != "build-100" || recommendation.MajorStatus != Major || recommendation.MajorsBehind != 2 {
+		t.Errorf("Expected [build-100 %s 2], but got [%s %s %d]", Major, recommendation.LatestMajor, recommendation.MajorStatus, recommendation.MajorsBehind)
+	}
+}
+
+func TestFindRecommendationRegex(t *testing.T) {
+	scheme, err := NewScheme(SchemeRegex, `(?P<variant>[a-z]+)-r(?P<major>[0-9]+)p(?P<patch>[0-9]+)`)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tags := []string{"focal-r1p0", "focal-r1p2", "focal-r2p0", "jammy-r3p0", "focal-r2p0-extra"}
+	recommendation := FindRecommendationWithScheme("focal-r1p0", tags, false, scheme)
+	if recommendation.LatestMajor != "focal-r2p0" || recommendation.MajorStatus != Major {
+		t.Errorf("Expected [focal-r2p0 %s], but got [%s %s]", Major, recommendation.LatestMajor, recommendation.MajorStatus)
+	}
+	// the pattern has no minor, so focal-r1p2 is a patch of focal-r1p0 rather than a minor upgrade
+	if recommendation.LatestPatch != "focal-r1p2" || recommendation.PatchStatus != Patch || recommendation.PatchesBehind != 1 {
+		t.Errorf("Expected [focal-r1p2 %s 1], but got [%s %s %d]", Patch, recommendation.LatestPatch, recommendation.PatchStatus, recommendation.PatchesBehind)
+	}
+	if recommendation.MinorStatus == Minor || recommendation.MinorsBehind != 0 {
+		t.Errorf("Expected no minor upgrade, but got [%s %s %d]", recommendation.LatestMinor, recommendation.MinorStatus, recommendation.MinorsBehind)
+	}
+}
+
+func TestRegexSchemeKeepsSlots(t *testing.T) {
+	scheme, err := NewRegexScheme(`r(?P<major>[0-9]+)(?:\.(?P<minor>[0-9]+))?p(?P<patch>[0-9]+)`)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for tag, expected := range map[string]string{"r1p2": "1.0.2", "r1.3p2": "1.3.2"} {
+		parsed, ok := scheme.Parse(tag)
+		if !ok || parsed.NumericVersion() != expected {
+			t.Errorf("Expected [%s], but got [%s %t]", expected, parsed.NumericVersion(), ok)
+		}
+	}
+}
+
+func TestNewSchemeInvalid(t *testing.T) {
+	if _, err := NewScheme("unknown", ""); err == nil {
+		t.Errorf("Expected an error for an unknown scheme")
+	}
+	if _, err := NewScheme(SchemeRegex, "[0-9]+"); err == nil {
+		t.Errorf("Expected an error for a pattern without capture groups")
+	}
+	if _, err := NewScheme(SchemeRegex, "(?P<minor>[0-9]+)"); err == nil {
+		t.Errorf("Expected an error for a pattern without major group")
+	}
+}
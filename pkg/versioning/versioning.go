@@ -2,6 +2,7 @@ package versioning
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -74,32 +75,78 @@ func FindHighestVersionInList(versions []string, allowAllReleases bool) string {
 	return Notfound
 }
 
-// DetermineLifeCycleStatus compares two versions to determin the status of the difference
+// DetermineLifeCycleStatus compares two versions to determin the status of the difference; the versions are compared
+// number by number, so that versions with more than three numbers, i.e.: calver with a time, are supported, and
+// everything after the minor counts as a patch. Unknown if the current version is newer or the versions can't be compared
 func DetermineLifeCycleStatus(latestVersion string, currentVersion string) string {
 	log.WithField("version", currentVersion).WithField("latestVersion", latestVersion).Debug("Determin status for version")
-	latest := strings.Split(version.Normalize(latestVersion), ".")
-	curr := strings.Split(version.Normalize(currentVersion), ".")
-
-	if version.Compare(currentVersion, latestVersion, "=") {
-		return Same
-	}
-	if version.Compare(curr[0], latest[0], "<") {
-		return Major
+	latest, latestNumeric := versionNumbers(latestVersion)
+	curr, currNumeric := versionNumbers(currentVersion)
+	if !latestNumeric || !currNumeric {
+		// versions with suffixes are normalized by go-version, which doesn't know about calver
+		if version.Compare(currentVersion, latestVersion, "=") {
+			return Same
+		}
+		latest = strings.Split(version.Normalize(latestVersion), ".")
+		curr = strings.Split(version.Normalize(currentVersion), ".")
 	}
 
-	// has minor
-	if len(latest) >= 2 && len(curr) >= 2 {
-		if version.Compare(curr[1], latest[1], "<") {
+	for i := 0; i < len(latest) || i < len(curr); i++ {
+		// missing numbers are 0, i.e.: 1.2 is 1.2.0
+		latestNumber, currNumber := "0", "0"
+		if i < len(latest) {
+			latestNumber = latest[i]
+		}
+		if i < len(curr) {
+			currNumber = curr[i]
+		}
+		comparison := compareVersionNumbers(currNumber, latestNumber)
+		if comparison == 0 {
+			continue
+		}
+		if comparison > 0 {
+			return Unknown
+		}
+		switch i {
+		case 0:
+			return Major
+		case 1:
 			return Minor
+		default:
+			return Patch
 		}
 	}
+	if latestNumeric && currNumeric {
+		return Same
+	}
+	return Unknown
+}
 
-	// has patch
-	if len(latest) >= 3 && len(curr) >= 3 {
-		if version.Compare(curr[2], latest[2], "<") {
-			return Patch
-		}
+// compareVersionNumbers returns 1, 0 or -1 if the number of a version is higher, equal or lower than the other one;
+// numbers are compared as integers, so that go-version doesn't take 2023 for a date
+func compareVersionNumbers(number, other string) int {
+	n, err := strconv.Atoi(number)
+	o, otherErr := strconv.Atoi(other)
+	if err != nil || otherErr != nil {
+		return version.CompareSimple(number, other)
 	}
+	switch {
+	case n > o:
+		return 1
+	case n < o:
+		return -1
+	}
+	return 0
+}
 
-	return Unknown
+// versionNumbers splits a version of only numbers, i.e.: v1.19.2 or 2023.09.01, into its numbers; false if it has
+// anything else
+func versionNumbers(v string) ([]string, bool) {
+	numbers := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	for _, number := range numbers {
+		if _, err := strconv.Atoi(number); err != nil {
+			return nil, false
+		}
+	}
+	return numbers, true
 }
@@ -43,3 +43,24 @@ func TestLatestVersionExtra(t *testing.T) {
 		t.Errorf("Expected [%s], but got [%s]", Unknown, status)
 	}
 }
+
+func TestCalverVersionHigher(t *testing.T) {
+	status := DetermineLifeCycleStatus("2023.11.2", "2023.9.1")
+	if status != Minor {
+		t.Errorf("Expected [%s], but got [%s]", Minor, status)
+	}
+}
+
+func TestFourthNumberHigher(t *testing.T) {
+	status := DetermineLifeCycleStatus("2023.9.1.1230", "2023.9.1.945")
+	if status != Patch {
+		t.Errorf("Expected [%s], but got [%s]", Patch, status)
+	}
+}
+
+func TestMissingNumbersAreZero(t *testing.T) {
+	status := DetermineLifeCycleStatus("1.2.0", "v1.2")
+	if status != Same {
+		t.Errorf("Expected [%s], but got [%s]", Same, status)
+	}
+}
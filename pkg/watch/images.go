@@ -0,0 +1,86 @@
+package watch
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ImageRef is an image rolled out in a namespace, with the digest it runs with if already known
+type ImageRef struct {
+	Namespace string
+	Image     string
+	Digest    string
+	// Workload uses the image, i.e.: Deployment/nginx
+	Workload string
+}
+
+// Key identifies the scan of an image; the same image and digest is scanned once per namespace, since the namespace
+// is part of the default project name
+func (r ImageRef) Key() string {
+	return fmt.Sprintf("%s/%s@%s", r.Namespace, r.Image, r.Digest)
+}
+
+func (r ImageRef) String() string {
+	if r.Digest == "" {
+		return fmt.Sprintf("'%s' in '%s'", r.Image, r.Namespace)
+	}
+	return fmt.Sprintf("'%s' (%s) in '%s'", r.Image, r.Digest, r.Namespace)
+}
+
+// Pinned is the image pinned to its digest, if known, i.e.: nginx:1.19@sha256:4c0f...; the tag is kept for the names
+// of the scan, the digest decides what is pulled, so that the scan is of the digest which runs and not of what the tag
+// points to by now
+func (r ImageRef) Pinned() string {
+	if r.Digest == "" || strings.Contains(r.Image, "@") {
+		return r.Image
+	}
+	return r.Image + "@" + r.Digest
+}
+
+// DigestFromImageID is the repo digest of a container status imageID, i.e.: sha256:4c0f... of
+// docker-pullable://nginx@sha256:4c0f...; imageIDs without repo digest, like the ID of a local image, have none
+func DigestFromImageID(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		return imageID[i+1:]
+	}
+	return ""
+}
+
+// PodImageRefs are the images of the containers of a pod which already run, with the digests they were pulled with;
+// containers which haven't been pulled yet are left out, the next status update of the pod has them
+func PodImageRefs(pod *corev1.Pod, workload string) []ImageRef {
+	imageIDs := map[string]string{}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		imageIDs[status.Name] = status.ImageID
+	}
+
+	var refs []ImageRef
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		imageID := imageIDs[container.Name]
+		if imageID == "" {
+			continue
+		}
+		refs = append(refs, ImageRef{Namespace: pod.Namespace, Image: container.Image, Digest: DigestFromImageID(imageID), Workload: workload})
+	}
+	return refs
+}
+
+// PodSpecImageRefs are the images of the pod template of a workload; only images pinned by digest have one
+func PodSpecImageRefs(namespace, workload string, spec corev1.PodSpec) []ImageRef {
+	var refs []ImageRef
+	for _, image := range PodSpecImages(spec) {
+		refs = append(refs, ImageRef{Namespace: namespace, Image: image, Digest: DigestFromImageID(image), Workload: workload})
+	}
+	return refs
+}
+
+// PodSpecImages are the images of the init containers and containers of a pod spec, in order
+func PodSpecImages(spec corev1.PodSpec) []string {
+	var images []string
+	for _, container := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+		images = append(images, container.Image)
+	}
+	return images
+}
@@ -0,0 +1,97 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const nginxDigest = "sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac"
+
+func TestDigestFromImageID(t *testing.T) {
+	testCases := map[string]string{
+		"docker-pullable://nginx@" + nginxDigest:       nginxDigest,
+		"docker.io/library/nginx@" + nginxDigest:       nginxDigest,
+		"nginx@" + nginxDigest:                         nginxDigest,
+		"sha256:0d493297b409c1cd9b1f4d2b6b4b5d2c7f6fa": "",
+		"": "",
+	}
+	for imageID, expected := range testCases {
+		if actual := DigestFromImageID(imageID); actual != expected {
+			t.Errorf("Expected [%s] for [%s], but got [%s]", expected, imageID, actual)
+		}
+	}
+}
+
+func TestPinned(t *testing.T) {
+	testCases := map[ImageRef]string{
+		{Image: "nginx:1.19", Digest: nginxDigest}:                "nginx:1.19@" + nginxDigest,
+		{Image: "nginx:1.19"}:                                     "nginx:1.19",
+		{Image: "nginx@" + nginxDigest, Digest: nginxDigest}:      "nginx@" + nginxDigest,
+		{Image: "nginx:1.19@" + nginxDigest, Digest: nginxDigest}: "nginx:1.19@" + nginxDigest,
+	}
+	for ref, expected := range testCases {
+		if actual := ref.Pinned(); actual != expected {
+			t.Errorf("Expected [%s] for %s, but got [%s]", expected, ref, actual)
+		}
+	}
+}
+
+func TestPodImageRefs(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f7-x2k9q", Namespace: "shop"},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init", Image: "busybox:1.32"}},
+			Containers:     []corev1.Container{{Name: "web", Image: "nginx:1.19"}, {Name: "sidecar", Image: "envoy:1.16"}},
+		},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{Name: "init", ImageID: "docker.io/library/busybox@sha256:b5cf"}},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "web", ImageID: "docker-pullable://nginx@" + nginxDigest},
+				// not pulled yet
+				{Name: "sidecar"},
+			},
+		},
+	}
+
+	expected := []ImageRef{
+		{Namespace: "shop", Image: "busybox:1.32", Digest: "sha256:b5cf", Workload: "Deployment/web"},
+		{Namespace: "shop", Image: "nginx:1.19", Digest: nginxDigest, Workload: "Deployment/web"},
+	}
+	if refs := PodImageRefs(pod, "Deployment/web"); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, refs)
+	}
+}
+
+func TestWorkloadImageRefs(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "web", Image: "nginx:1.19"}, {Name: "sidecar", Image: "envoy@sha256:9a1e"}},
+		}}},
+	}
+	expected := []ImageRef{
+		{Namespace: "shop", Image: "nginx:1.19", Workload: "Deployment/web"},
+		{Namespace: "shop", Image: "envoy@sha256:9a1e", Digest: "sha256:9a1e", Workload: "Deployment/web"},
+	}
+	if refs := WorkloadImageRefs(deployment); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, refs)
+	}
+
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "kube-system"},
+		Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "agent", Image: "fluentd:1.11"}},
+		}}},
+	}
+	if refs := WorkloadImageRefs(daemonSet); len(refs) != 1 || refs[0].Workload != "DaemonSet/agent" || refs[0].Namespace != "kube-system" {
+		t.Errorf("Expected the image of DaemonSet/agent, but got [%+v]", refs)
+	}
+
+	if refs := WorkloadImageRefs(&corev1.Pod{}); len(refs) != 0 {
+		t.Errorf("Expected no images of a pod, but got [%+v]", refs)
+	}
+}
@@ -0,0 +1,144 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/kube"
+)
+
+// Watcher offers the images of the Pods, Deployments, StatefulSets and DaemonSets of a namespace to a queue as they
+// roll out, and evicts the images of deleted workloads from it
+type Watcher struct {
+	factory informers.SharedInformerFactory
+	queue   *Queue
+}
+
+// NewWatcher watches a namespace, or all namespaces if it's empty
+func NewWatcher(clientset kubernetes.Interface, namespace string, queue *Queue) *Watcher {
+	return &Watcher{
+		factory: informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace)),
+		queue:   queue,
+	}
+}
+
+// Start syncs the informers and then offers the images already running, unless skipExisting marks them as seen,
+// and every image rolled out later; the informers stop with the context
+func (w *Watcher) Start(ctx context.Context, skipExisting bool) error {
+	pods := w.factory.Core().V1().Pods()
+	replicaSets := w.factory.Apps().V1().ReplicaSets()
+	workloadInformers := []cache.SharedIndexInformer{
+		w.factory.Apps().V1().Deployments().Informer(),
+		w.factory.Apps().V1().StatefulSets().Informer(),
+		w.factory.Apps().V1().DaemonSets().Informer(),
+	}
+	pods.Informer()
+	replicaSets.Informer()
+
+	w.factory.Start(ctx.Done())
+	for informerType, synced := range w.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return errors.Errorf("unable to sync the informer of %s", informerType)
+		}
+	}
+
+	if skipExisting {
+		var refs []ImageRef
+		for _, pod := range pods.Informer().GetStore().List() {
+			refs = append(refs, PodImageRefs(pod.(*corev1.Pod), "")...)
+		}
+		for _, informer := range workloadInformers {
+			for _, workload := range informer.GetStore().List() {
+				refs = append(refs, WorkloadImageRefs(workload)...)
+			}
+		}
+		for _, ref := range refs {
+			w.queue.Skip(ref)
+		}
+		log.Infof("skipping the %d images which are already running", len(refs))
+	}
+
+	// handlers added to started informers get the existing objects as additions first
+	replicaSetLister := replicaSets.Lister()
+	pods.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { w.offerPod(obj, replicaSetLister) },
+		UpdateFunc: func(oldObj, newObj interface{}) { w.offerPod(newObj, replicaSetLister) },
+	})
+	for _, informer := range workloadInformers {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) { w.offerWorkload(obj) },
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// only rollouts change the images, not the status updates
+				if imageRefKeys(WorkloadImageRefs(oldObj)) != imageRefKeys(WorkloadImageRefs(newObj)) {
+					w.offerWorkload(newObj)
+				}
+			},
+			DeleteFunc: func(obj interface{}) { w.evictWorkload(obj) },
+		})
+	}
+	return nil
+}
+
+func (w *Watcher) offerPod(obj interface{}, replicaSetLister appslisters.ReplicaSetLister) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	workload := kube.PodWorkload(pod, func(name string) string {
+		replicaSet, err := replicaSetLister.ReplicaSets(pod.Namespace).Get(name)
+		if err != nil {
+			return ""
+		}
+		return kube.ControllerName(replicaSet)
+	})
+	for _, ref := range PodImageRefs(pod, workload) {
+		w.queue.Offer(ref)
+	}
+}
+
+func (w *Watcher) offerWorkload(obj interface{}) {
+	for _, ref := range WorkloadImageRefs(obj) {
+		w.queue.Offer(ref)
+	}
+}
+
+// evictWorkload forgets the images of a deleted workload, so that they're scanned again if it comes back
+func (w *Watcher) evictWorkload(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if refs := WorkloadImageRefs(obj); len(refs) > 0 {
+		w.queue.Evict(refs[0].Namespace, refs[0].Workload)
+	}
+}
+
+// WorkloadImageRefs are the images of the pod template of a Deployment, StatefulSet or DaemonSet
+func WorkloadImageRefs(obj interface{}) []ImageRef {
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		return PodSpecImageRefs(workload.Namespace, fmt.Sprintf("Deployment/%s", workload.Name), workload.Spec.Template.Spec)
+	case *appsv1.StatefulSet:
+		return PodSpecImageRefs(workload.Namespace, fmt.Sprintf("StatefulSet/%s", workload.Name), workload.Spec.Template.Spec)
+	case *appsv1.DaemonSet:
+		return PodSpecImageRefs(workload.Namespace, fmt.Sprintf("DaemonSet/%s", workload.Name), workload.Spec.Template.Spec)
+	}
+	return nil
+}
+
+func imageRefKeys(refs []ImageRef) string {
+	var keys []string
+	for _, ref := range refs {
+		keys = append(keys, ref.Key())
+	}
+	return strings.Join(keys, ",")
+}
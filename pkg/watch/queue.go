@@ -0,0 +1,196 @@
+package watch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// MaxScanRequeues is how often a failed scan is queued again, with an exponential backoff, before it's given up
+	// until the image is offered again
+	MaxScanRequeues = 5
+
+	requeueBaseDelay = 30 * time.Second
+	requeueMaxDelay  = 30 * time.Minute
+)
+
+// ScanFunc scans an image; transient failures are expected to be retried by it
+type ScanFunc func(ctx context.Context, ref ImageRef) error
+
+// ResolveFunc looks up the digest of an image in its registry
+type ResolveFunc func(ref ImageRef) (string, error)
+
+// Queue scans images with a pool of workers, each image and digest once per namespace; images without digest are
+// resolved before scanning, so that a workload and its pods don't scan the same digest twice
+type Queue struct {
+	scan    ScanFunc
+	resolve ResolveFunc
+	queue   workqueue.RateLimitingInterface
+
+	mutex sync.Mutex
+	// refs are the queued images by key
+	refs map[string]ImageRef
+	// seen are the keys of the images which were queued, skipped or resolved to a digest which was
+	seen map[string]bool
+	// owners are the workloads using the seen images by key, i.e.: shop/Deployment/web; the keys of deleted workloads
+	// are forgotten, so that they don't pile up and are scanned again if the workload comes back
+	owners map[string]map[string]bool
+}
+
+// NewQueue creates a queue; resolve is optional, without it images without digest are scanned as they are
+func NewQueue(scan ScanFunc, resolve ResolveFunc) *Queue {
+	return newQueue(scan, resolve, workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay))
+}
+
+func newQueue(scan ScanFunc, resolve ResolveFunc, rateLimiter workqueue.RateLimiter) *Queue {
+	return &Queue{
+		scan:    scan,
+		resolve: resolve,
+		queue:   workqueue.NewRateLimitingQueue(rateLimiter),
+		refs:    map[string]ImageRef{},
+		seen:    map[string]bool{},
+		owners:  map[string]map[string]bool{},
+	}
+}
+
+// Offer queues the scan of an image, unless it was already seen; returns whether it was queued
+func (q *Queue) Offer(ref ImageRef) bool {
+	key := ref.Key()
+	q.mutex.Lock()
+	if q.seen[key] {
+		q.markSeen(ref)
+		q.mutex.Unlock()
+		return false
+	}
+	q.markSeen(ref)
+	q.refs[key] = ref
+	q.mutex.Unlock()
+
+	log.Debugf("queueing the scan of %s", ref)
+	q.queue.Add(key)
+	return true
+}
+
+// Skip marks an image as seen without scanning it, i.e.: because it already ran before watching
+func (q *Queue) Skip(ref ImageRef) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.markSeen(ref)
+}
+
+// Evict forgets the images of a deleted workload, unless other workloads still use them
+func (q *Queue) Evict(namespace, workload string) {
+	owner := namespace + "/" + workload
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for key, owners := range q.owners {
+		if !owners[owner] {
+			continue
+		}
+		delete(owners, owner)
+		if len(owners) == 0 {
+			log.Debugf("forgetting %s, its workloads were deleted", key)
+			delete(q.owners, key)
+			delete(q.seen, key)
+		}
+	}
+}
+
+// markSeen marks an image as seen, used by its workload; the mutex must be held
+func (q *Queue) markSeen(ref ImageRef) {
+	key := ref.Key()
+	q.seen[key] = true
+	if ref.Workload == "" {
+		return
+	}
+	if q.owners[key] == nil {
+		q.owners[key] = map[string]bool{}
+	}
+	q.owners[key][ref.Namespace+"/"+ref.Workload] = true
+}
+
+// Run scans the queued images with the workers until the context is done, and waits for the running scans
+func (q *Queue) Run(ctx context.Context, workers int) {
+	var waitGroup sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for q.processNextItem(ctx) {
+			}
+		}()
+	}
+	<-ctx.Done()
+	q.queue.ShutDown()
+	waitGroup.Wait()
+}
+
+func (q *Queue) processNextItem(ctx context.Context) bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	key := item.(string)
+	q.mutex.Lock()
+	ref := q.refs[key]
+	q.mutex.Unlock()
+	if ctx.Err() != nil {
+		// drain what's left after shutting down
+		q.forget(key)
+		return true
+	}
+
+	if ref.Digest == "" && q.resolve != nil {
+		digest, err := q.resolve(ref)
+		if err != nil {
+			log.Warnf("unable to look up the digest of %s, scanning it anyway: %+v", ref, err)
+		} else {
+			ref.Digest = digest
+			q.mutex.Lock()
+			seen := q.seen[ref.Key()]
+			q.markSeen(ref)
+			// a requeued scan doesn't resolve the image again
+			q.refs[key] = ref
+			q.mutex.Unlock()
+			if seen {
+				log.Debugf("skipping %s, its digest was already seen", ref)
+				q.forget(key)
+				return true
+			}
+		}
+	}
+
+	log.Infof("scanning %s", ref)
+	err := q.scan(ctx, ref)
+	if err == nil || ctx.Err() != nil {
+		q.forget(key)
+		return true
+	}
+	if requeues := q.queue.NumRequeues(key); requeues < MaxScanRequeues {
+		log.Errorf("scan of %s failed, queueing it again (%d of %d): %+v", ref, requeues+1, MaxScanRequeues, err)
+		q.queue.AddRateLimited(key)
+		return true
+	}
+	// the next rollout or status update of the image queues it again
+	log.Errorf("scan of %s failed %d times, giving up until it's offered again: %+v", ref, MaxScanRequeues+1, err)
+	q.forget(key)
+	q.mutex.Lock()
+	delete(q.seen, key)
+	delete(q.seen, ref.Key())
+	q.mutex.Unlock()
+	return true
+}
+
+// forget drops a queued image which is done, successfully or not
+func (q *Queue) forget(key string) {
+	q.queue.Forget(key)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.refs, key)
+}
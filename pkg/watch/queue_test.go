@@ -0,0 +1,161 @@
+package watch
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestQueue(t *testing.T) {
+	var mutex sync.Mutex
+	var scanned []string
+	scans := make(chan ImageRef, 10)
+	scan := func(ctx context.Context, ref ImageRef) error {
+		mutex.Lock()
+		scanned = append(scanned, ref.Key())
+		mutex.Unlock()
+		scans <- ref
+		if ref.Image == "broken:1.0" {
+			return errors.Errorf("scan failed")
+		}
+		return nil
+	}
+	resolve := func(ref ImageRef) (string, error) {
+		if ref.Image == "nginx:1.19" {
+			return nginxDigest, nil
+		}
+		return "", errors.Errorf("not found")
+	}
+	queue := NewQueue(scan, resolve)
+
+	offers := []struct {
+		ref    ImageRef
+		queued bool
+	}{
+		{ImageRef{Namespace: "shop", Image: "nginx:1.19", Digest: nginxDigest, Workload: "Deployment/web"}, true},
+		// another pod of the same rollout
+		{ImageRef{Namespace: "shop", Image: "nginx:1.19", Digest: nginxDigest, Workload: "Deployment/web"}, false},
+		// the workload, which resolves to the digest of its pods
+		{ImageRef{Namespace: "shop", Image: "nginx:1.19", Workload: "Deployment/web"}, true},
+		// the same image in another namespace has other names
+		{ImageRef{Namespace: "blog", Image: "nginx:1.19", Digest: nginxDigest}, true},
+		// a new digest rolled out
+		{ImageRef{Namespace: "shop", Image: "nginx:1.19", Digest: "sha256:b5cf"}, true},
+		// unresolvable images are scanned as they are
+		{ImageRef{Namespace: "shop", Image: "broken:1.0"}, true},
+	}
+	for _, offer := range offers {
+		if queued := queue.Offer(offer.ref); queued != offer.queued {
+			t.Errorf("Expected [%t] for %s, but got [%t]", offer.queued, offer.ref, queued)
+		}
+	}
+	queue.Skip(ImageRef{Namespace: "shop", Image: "redis:6.0", Digest: "sha256:9a1e"})
+	if queue.Offer(ImageRef{Namespace: "shop", Image: "redis:6.0", Digest: "sha256:9a1e"}) {
+		t.Errorf("Expected a skipped image not to be queued")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		queue.Run(ctx, 2)
+		close(done)
+	}()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-scans:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected 4 scans, but got %d", i)
+		}
+	}
+	cancel()
+	<-done
+
+	sort.Strings(scanned)
+	expected := []string{
+		"blog/nginx:1.19@" + nginxDigest,
+		"shop/broken:1.0@",
+		"shop/nginx:1.19@" + nginxDigest,
+		"shop/nginx:1.19@sha256:b5cf",
+	}
+	if strings.Join(scanned, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected [%v], but got [%v]", expected, scanned)
+	}
+}
+
+func TestQueueRequeuesFailedScans(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := map[string]int{}
+	scans := make(chan ImageRef, 20)
+	scan := func(ctx context.Context, ref ImageRef) error {
+		mutex.Lock()
+		attempts[ref.Image]++
+		attempt := attempts[ref.Image]
+		mutex.Unlock()
+		scans <- ref
+		// flaky succeeds the second time, broken never does
+		if ref.Image == "broken:1.0" || attempt < 2 {
+			return errors.Errorf("scan failed")
+		}
+		return nil
+	}
+	queue := newQueue(scan, nil, workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond))
+	broken := ImageRef{Namespace: "shop", Image: "broken:1.0", Digest: "sha256:b5cf"}
+	queue.Offer(ImageRef{Namespace: "shop", Image: "flaky:1.0", Digest: "sha256:9a1e"})
+	queue.Offer(broken)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		queue.Run(ctx, 2)
+		close(done)
+	}()
+	for i := 0; i < MaxScanRequeues+3; i++ {
+		select {
+		case <-scans:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %d scans, but got %d", MaxScanRequeues+3, i)
+		}
+	}
+	// the queue gives up on broken:1.0 right after its last scan
+	for i := 0; i < 100 && !queue.Offer(broken); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-scans:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected broken:1.0 to be queued again after giving up on it")
+	}
+	cancel()
+	<-done
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if attempts["flaky:1.0"] != 2 || attempts["broken:1.0"] != MaxScanRequeues+2 {
+		t.Errorf("Expected [2 %d] attempts, but got [%v]", MaxScanRequeues+2, attempts)
+	}
+}
+
+func TestQueueEvict(t *testing.T) {
+	queue := NewQueue(func(ctx context.Context, ref ImageRef) error { return nil }, nil)
+	web := ImageRef{Namespace: "shop", Image: "nginx:1.19", Digest: nginxDigest, Workload: "Deployment/web"}
+	admin := ImageRef{Namespace: "shop", Image: "nginx:1.19", Digest: nginxDigest, Workload: "Deployment/admin"}
+	queue.Offer(web)
+	queue.Skip(admin)
+
+	// still used by admin
+	queue.Evict("shop", "Deployment/web")
+	if queue.Offer(web) {
+		t.Errorf("Expected %s not to be queued while another workload uses it", web)
+	}
+	queue.Evict("shop", "Deployment/web")
+	queue.Evict("shop", "Deployment/admin")
+	if !queue.Offer(admin) {
+		t.Errorf("Expected %s to be queued again after its workloads were deleted", admin)
+	}
+}
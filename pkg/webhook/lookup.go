@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/blackduck"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/detect"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/remediation"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/results"
+)
+
+const (
+	SourceBlackDuck    = "Black Duck"
+	SourceResultsIndex = "results index"
+)
+
+// Lookup finds the result of the latest scan of an image deployed to a namespace; it gives up once ctx is done
+type Lookup interface {
+	Lookup(ctx context.Context, namespace, image string) (Result, error)
+}
+
+// IndexLookup looks up the latest local run of an image in the results index, which only has the scans run on the
+// same machine, i.e.: by `bd-xray watch` next to the webhook; a webhook running in the cluster only has the results
+// of Black Duck. Runs scanned in another namespace are skipped, since they may have been scanned into other projects
+// and so against other policies; runs not scanned in a namespace, i.e.: by `bd-xray images`, count for every namespace
+type IndexLookup struct {
+	Index *results.Index
+}
+
+func (l *IndexLookup) Lookup(ctx context.Context, namespace, image string) (Result, error) {
+	entries, err := l.Index.Entries()
+	if err != nil {
+		return Result{}, err
+	}
+	reference := normalizeImage(image)
+	for idx := len(entries) - 1; idx >= 0; idx-- {
+		entry := entries[idx]
+		if entry.Namespace != "" && entry.Namespace != namespace {
+			continue
+		}
+		entryReference := normalizeImage(entry.Image)
+		// images scanned while watching are pinned to the digest which ran, but reviewed by their tag
+		if !strings.Contains(reference, "@") {
+			entryReference = strings.SplitN(entryReference, "@", 2)[0]
+		}
+		if entryReference != reference {
+			continue
+		}
+		result := Result{Image: image, Source: SourceResultsIndex, ScannedAt: entry.StartedAt}
+		switch entry.ExitCode {
+		case detect.ExitCodeSuccess:
+			result.Status = StatusPassed
+		case detect.ExitCodeFailurePolicyViolation:
+			result.Status = StatusViolation
+			result.Detail = fmt.Sprintf("see %s", entry.LogFile)
+		default:
+			result.Status = StatusFailed
+			result.Detail = entry.Error
+		}
+		return result, nil
+	}
+	return Result{Image: image, Status: StatusUnscanned}, nil
+}
+
+// normalizeImage is the fully qualified reference of an image, so that i.e.: nginx:1.19 and
+// docker.io/library/nginx:1.19 are the same image; invalid references are returned as they are
+func normalizeImage(image string) string {
+	parsed, err := remediation.NewImage(image)
+	if err != nil {
+		return image
+	}
+	normalized := parsed.URL + "/" + parsed.Name
+	if parsed.Version != "" {
+		normalized += ":" + parsed.Version
+	}
+	if parsed.Digest != "" {
+		normalized += "@" + parsed.Digest
+	}
+	return normalized
+}
+
+// BlackDuckLookup looks up the policy status of the project version an image was scanned to
+type BlackDuckLookup struct {
+	Client *blackduck.Client
+	// Names are the names of the project and version of an image deployed to a namespace
+	Names func(namespace, image string) (string, string, error)
+}
+
+func (l *BlackDuckLookup) Lookup(ctx context.Context, namespace, image string) (Result, error) {
+	projectName, versionName, err := l.Names(namespace, image)
+	if err != nil {
+		return Result{}, err
+	}
+	client := l.Client.WithContext(ctx)
+	version, err := client.FindProjectVersion(projectName, versionName)
+	if err != nil {
+		return Result{}, err
+	}
+	if version == nil {
+		return Result{Image: image, Status: StatusUnscanned, Detail: fmt.Sprintf("no version '%s' of project '%s' in Black Duck", versionName, projectName)}, nil
+	}
+	policyStatus, err := client.GetPolicyStatus(version.Meta.Href)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Image: image, Status: StatusPassed, Source: SourceBlackDuck}
+	if policyStatus.OverallStatus == blackduck.PolicyStatusInViolation {
+		result.Status = StatusViolation
+		result.Detail = fmt.Sprintf("%d components in violation, see %s", policyStatus.Count(blackduck.PolicyStatusInViolation), version.Meta.Href)
+	}
+	return result, nil
+}
+
+// CachedLookup tries its lookups in order until one has a result of the image, and caches the results, so that
+// admission requests stay fast and repeated requests, i.e.: of the pods of a ReplicaSet, don't hit Black Duck
+type CachedLookup struct {
+	lookups []Lookup
+	ttl     time.Duration
+	now     func() time.Time
+
+	mutex sync.Mutex
+	cache map[string]cachedResult
+}
+
+type cachedResult struct {
+	result   Result
+	cachedAt time.Time
+}
+
+func NewCachedLookup(ttl time.Duration, lookups ...Lookup) *CachedLookup {
+	return &CachedLookup{
+		lookups: lookups,
+		ttl:     ttl,
+		now:     time.Now,
+		cache:   map[string]cachedResult{},
+	}
+}
+
+// Lookup returns the cached result if it's younger than the TTL; failed lookups aren't cached
+func (l *CachedLookup) Lookup(ctx context.Context, namespace, image string) (Result, error) {
+	key := namespace + "/" + image
+	l.mutex.Lock()
+	cached, ok := l.cache[key]
+	l.mutex.Unlock()
+	if ok && l.now().Sub(cached.cachedAt) < l.ttl {
+		return cached.result, nil
+	}
+
+	result := Result{Image: image, Status: StatusUnscanned}
+	for _, lookup := range l.lookups {
+		found, err := lookup.Lookup(ctx, namespace, image)
+		if err != nil {
+			return Result{}, err
+		}
+		if found.Status != StatusUnscanned {
+			result = found
+			break
+		}
+		if found.Detail != "" {
+			result.Detail = found.Detail
+		}
+	}
+
+	l.mutex.Lock()
+	l.cache[key] = cachedResult{result: result, cachedAt: l.now()}
+	l.mutex.Unlock()
+	return result, nil
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/detect"
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/results"
+)
+
+func TestIndexLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+	index := results.NewIndex(filepath.Join(dir, results.IndexFileName))
+	startedAt := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	entries := []results.Entry{
+		{RunID: "1", Image: "nginx:1.19", ExitCode: detect.ExitCodeFailureScan, Error: "scan failed", StartedAt: startedAt},
+		{RunID: "2", Image: "nginx:1.19", ExitCode: detect.ExitCodeFailurePolicyViolation, LogFile: "/tmp/2/detect.log", StartedAt: startedAt.Add(time.Hour)},
+		{RunID: "3", Image: "nginx:1.18", ExitCode: detect.ExitCodeSuccess, StartedAt: startedAt.Add(2 * time.Hour)},
+		{RunID: "4", Image: "redis:6.0", ExitCode: detect.ExitCodeFailureScan, Error: "scan failed", StartedAt: startedAt},
+		{RunID: "5", Image: "envoyproxy/envoy:v1.16.0@sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac", ExitCode: detect.ExitCodeSuccess, StartedAt: startedAt},
+		{RunID: "6", Image: "nginx:1.18", Namespace: "blog", ExitCode: detect.ExitCodeFailurePolicyViolation, LogFile: "/tmp/6/detect.log", StartedAt: startedAt.Add(3 * time.Hour)},
+		{RunID: "7", Image: "redis:6.2", Namespace: "blog", ExitCode: detect.ExitCodeSuccess, StartedAt: startedAt},
+	}
+	for _, entry := range entries {
+		if err := index.Add(entry); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	lookup := &IndexLookup{Index: index}
+	expected := map[string]Result{
+		"nginx:1.19": {Image: "nginx:1.19", Status: StatusViolation, Source: SourceResultsIndex, Detail: "see /tmp/2/detect.log", ScannedAt: startedAt.Add(time.Hour)},
+		"nginx:1.18": {Image: "nginx:1.18", Status: StatusPassed, Source: SourceResultsIndex, ScannedAt: startedAt.Add(2 * time.Hour)},
+		"redis:6.0":  {Image: "redis:6.0", Status: StatusFailed, Source: SourceResultsIndex, Detail: "scan failed", ScannedAt: startedAt},
+		"nginx:1.20": {Image: "nginx:1.20", Status: StatusUnscanned},
+		// the runs of other namespaces are skipped
+		"redis:6.2": {Image: "redis:6.2", Status: StatusUnscanned},
+		// the references of Pods are often fully qualified
+		"docker.io/library/nginx:1.18": {Image: "docker.io/library/nginx:1.18", Status: StatusPassed, Source: SourceResultsIndex, ScannedAt: startedAt.Add(2 * time.Hour)},
+		// the scans of bd-xray watch are pinned to the digest, another digest of the tag wasn't scanned
+		"envoyproxy/envoy:v1.16.0": {Image: "envoyproxy/envoy:v1.16.0", Status: StatusPassed, Source: SourceResultsIndex, ScannedAt: startedAt},
+		"envoyproxy/envoy:v1.16.0@sha256:9a1e0a5b6c4b1f2e3d4c5b6a7f8e9d0c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e": {Image: "envoyproxy/envoy:v1.16.0@sha256:9a1e0a5b6c4b1f2e3d4c5b6a7f8e9d0c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e", Status: StatusUnscanned},
+	}
+	for image, expectedResult := range expected {
+		result, err := lookup.Lookup(context.Background(), "shop", image)
+		if err != nil || result != expectedResult {
+			t.Errorf("Expected [%+v], but got [%+v %+v]", expectedResult, result, err)
+		}
+	}
+
+	expectedResult := Result{Image: "nginx:1.18", Status: StatusViolation, Source: SourceResultsIndex, Detail: "see /tmp/6/detect.log", ScannedAt: startedAt.Add(3 * time.Hour)}
+	if result, err := lookup.Lookup(context.Background(), "blog", "nginx:1.18"); err != nil || result != expectedResult {
+		t.Errorf("Expected [%+v], but got [%+v %+v]", expectedResult, result, err)
+	}
+}
+
+// countingLookup counts how often each image is looked up
+type countingLookup struct {
+	results map[string]Result
+	counts  map[string]int
+}
+
+func (l *countingLookup) Lookup(ctx context.Context, namespace, image string) (Result, error) {
+	l.counts[image]++
+	if image == "broken:1.0" {
+		return Result{}, errors.Errorf("unable to reach Black Duck")
+	}
+	if result, ok := l.results[image]; ok {
+		return result, nil
+	}
+	return Result{Image: image, Status: StatusUnscanned, Detail: "not in Black Duck"}, nil
+}
+
+func TestCachedLookup(t *testing.T) {
+	blackDuck := &countingLookup{results: map[string]Result{"nginx:1.19": {Image: "nginx:1.19", Status: StatusViolation}}, counts: map[string]int{}}
+	index := &countingLookup{results: map[string]Result{"redis:6.0": {Image: "redis:6.0", Status: StatusPassed}}, counts: map[string]int{}}
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	lookup := NewCachedLookup(time.Minute, blackDuck, index)
+	lookup.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if result, err := lookup.Lookup(context.Background(), "shop", "nginx:1.19"); err != nil || result.Status != StatusViolation {
+			t.Errorf("Expected [%s], but got [%+v %+v]", StatusViolation, result, err)
+		}
+		if result, err := lookup.Lookup(context.Background(), "shop", "redis:6.0"); err != nil || result.Status != StatusPassed {
+			t.Errorf("Expected [%s], but got [%+v %+v]", StatusPassed, result, err)
+		}
+		if result, err := lookup.Lookup(context.Background(), "shop", "alpine:3.12"); err != nil || result.Status != StatusUnscanned || result.Detail != "not in Black Duck" {
+			t.Errorf("Expected [%s], but got [%+v %+v]", StatusUnscanned, result, err)
+		}
+		if _, err := lookup.Lookup(context.Background(), "shop", "broken:1.0"); err == nil {
+			t.Errorf("Expected an error for a failed lookup")
+		}
+	}
+	// only the failed lookup was repeated, the index wasn't needed for nginx
+	if blackDuck.counts["nginx:1.19"] != 1 || index.counts["nginx:1.19"] != 0 || index.counts["redis:6.0"] != 1 || blackDuck.counts["broken:1.0"] != 2 {
+		t.Errorf("Expected the results to be cached, but got [%v %v]", blackDuck.counts, index.counts)
+	}
+
+	now = now.Add(2 * time.Minute)
+	lookup.Lookup(context.Background(), "shop", "nginx:1.19")
+	lookup.Lookup(context.Background(), "blog", "nginx:1.19")
+	if blackDuck.counts["nginx:1.19"] != 3 {
+		t.Errorf("Expected expired and other namespaces' results to be looked up again, but got [%d]", blackDuck.counts["nginx:1.19"])
+	}
+}
+
+func TestPolicyMaxAge(t *testing.T) {
+	now := time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC)
+	policy := Policy{Violation: ActionDeny, Failed: ActionWarn, Unscanned: ActionDeny, MaxAge: 7 * 24 * time.Hour}
+
+	action, _ := policy.Evaluate(Result{Image: "nginx:1.19", Status: StatusPassed, ScannedAt: now.Add(-24 * time.Hour)}, now)
+	if action != ActionAllow {
+		t.Errorf("Expected [%s], but got [%s]", ActionAllow, action)
+	}
+	action, message := policy.Evaluate(Result{Image: "nginx:1.19", Status: StatusPassed, ScannedAt: now.Add(-8 * 24 * time.Hour)}, now)
+	if expected := "image 'nginx:1.19' wasn't scanned: the latest scan is from 2021-03-02T00:00:00Z, older than 168h0m0s"; action != ActionDeny || message != expected {
+		t.Errorf("Expected [%s %s], but got [%s %s]", ActionDeny, expected, action, message)
+	}
+	// results without scan time, i.e.: of Black Duck, don't expire
+	if action, _ := policy.Evaluate(Result{Image: "nginx:1.19", Status: StatusFailed}, now); action != ActionWarn {
+		t.Errorf("Expected [%s], but got [%s]", ActionWarn, action)
+	}
+
+	if err := (&Policy{Violation: ActionDeny, Failed: "block", Unscanned: ActionAllow}).Validate(); err == nil {
+		t.Errorf("Expected an error for an unsupported action")
+	}
+}
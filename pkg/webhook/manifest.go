@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	// WebhookName is the fully qualified name of the webhook in the ValidatingWebhookConfiguration
+	WebhookName = "images.bd-xray.blackducksoftware.com"
+
+	// namespaceNameLabel is set on every namespace by kubernetes 1.21 and later; older clusters don't exclude
+	// namespaces
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+// ManifestOptions configure the ValidatingWebhookConfiguration of a webhook server running behind a service
+type ManifestOptions struct {
+	Name             string
+	ServiceName      string
+	ServiceNamespace string
+	ServicePort      int32
+	// CABundle is the PEM encoded CA the serving certificate of the webhook is signed by
+	CABundle []byte
+	// FailurePolicy is Ignore or Fail, what the API server does if the webhook can't be reached
+	FailurePolicy  string
+	TimeoutSeconds int32
+	// ExcludeNamespaces aren't validated, i.e.: kube-system and the namespace of the webhook itself
+	ExcludeNamespaces []string
+}
+
+// Manifest renders the ValidatingWebhookConfiguration sending the Pods and workloads created or updated to the webhook
+func Manifest(options ManifestOptions) ([]byte, error) {
+	failurePolicy := admissionregistrationv1.FailurePolicyType(options.FailurePolicy)
+	if failurePolicy != admissionregistrationv1.Ignore && failurePolicy != admissionregistrationv1.Fail {
+		return nil, errors.Errorf("unsupported failure policy '%s', expected %s or %s", options.FailurePolicy, admissionregistrationv1.Ignore, admissionregistrationv1.Fail)
+	}
+	path := ValidatePath
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	scope := admissionregistrationv1.NamespacedScope
+	rule := func(group, version string, resources ...string) admissionregistrationv1.RuleWithOperations {
+		return admissionregistrationv1.RuleWithOperations{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{group},
+				APIVersions: []string{version},
+				Resources:   resources,
+				Scope:       &scope,
+			},
+		}
+	}
+
+	webhook := admissionregistrationv1.ValidatingWebhook{
+		Name: WebhookName,
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{
+				Namespace: options.ServiceNamespace,
+				Name:      options.ServiceName,
+				Path:      &path,
+				Port:      &options.ServicePort,
+			},
+			CABundle: options.CABundle,
+		},
+		Rules: []admissionregistrationv1.RuleWithOperations{
+			rule("", "v1", "pods"),
+			rule("apps", "v1", "deployments", "statefulsets", "daemonsets", "replicasets"),
+			rule("batch", "v1", "jobs"),
+			rule("batch", "v1beta1", "cronjobs"),
+		},
+		FailurePolicy:           &failurePolicy,
+		SideEffects:             &sideEffects,
+		TimeoutSeconds:          &options.TimeoutSeconds,
+		AdmissionReviewVersions: []string{"v1", "v1beta1"},
+	}
+	if len(options.ExcludeNamespaces) > 0 {
+		webhook.NamespaceSelector = &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      namespaceNameLabel,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   options.ExcludeNamespaces,
+			}},
+		}
+	}
+
+	configuration := admissionregistrationv1.ValidatingWebhookConfiguration{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "admissionregistration.k8s.io/v1", Kind: "ValidatingWebhookConfiguration"},
+		ObjectMeta: metav1.ObjectMeta{Name: options.Name},
+		Webhooks:   []admissionregistrationv1.ValidatingWebhook{webhook},
+	}
+	content, err := sigsyaml.Marshal(configuration)
+	return content, errors.Wrapf(err, "unable to marshal ValidatingWebhookConfiguration")
+}
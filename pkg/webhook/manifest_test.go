@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+func TestManifest(t *testing.T) {
+	options := ManifestOptions{
+		Name:              "bd-xray",
+		ServiceName:       "bd-xray-webhook",
+		ServiceNamespace:  "bd-xray",
+		ServicePort:       443,
+		CABundle:          []byte("-----BEGIN CERTIFICATE-----\n"),
+		FailurePolicy:     "Ignore",
+		TimeoutSeconds:    10,
+		ExcludeNamespaces: []string{"kube-system", "bd-xray"},
+	}
+	content, err := Manifest(options)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var configuration admissionregistrationv1.ValidatingWebhookConfiguration
+	if err := sigsyaml.UnmarshalStrict(content, &configuration); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if configuration.Kind != "ValidatingWebhookConfiguration" || configuration.Name != "bd-xray" || len(configuration.Webhooks) != 1 {
+		t.Fatalf("Expected one webhook in ValidatingWebhookConfiguration bd-xray, but got [%s]", content)
+	}
+	webhook := configuration.Webhooks[0]
+	service := webhook.ClientConfig.Service
+	if webhook.Name != WebhookName || service == nil || service.Name != "bd-xray-webhook" || service.Namespace != "bd-xray" || *service.Path != ValidatePath || *service.Port != 443 {
+		t.Errorf("Expected the webhook to call service bd-xray/bd-xray-webhook, but got [%s]", content)
+	}
+	if string(webhook.ClientConfig.CABundle) != string(options.CABundle) || *webhook.FailurePolicy != admissionregistrationv1.Ignore || *webhook.SideEffects != admissionregistrationv1.SideEffectClassNone || *webhook.TimeoutSeconds != 10 {
+		t.Errorf("Expected the CA bundle, failure policy, side effects and timeout, but got [%s]", content)
+	}
+	var resources []string
+	for _, rule := range webhook.Rules {
+		resources = append(resources, rule.Resources...)
+	}
+	expectedResources := []string{"pods", "deployments", "statefulsets", "daemonsets", "replicasets", "jobs", "cronjobs"}
+	if !reflect.DeepEqual(resources, expectedResources) {
+		t.Errorf("Expected [%v], but got [%v]", expectedResources, resources)
+	}
+	if webhook.NamespaceSelector == nil || !reflect.DeepEqual(webhook.NamespaceSelector.MatchExpressions[0].Values, options.ExcludeNamespaces) {
+		t.Errorf("Expected the namespaces [%v] to be excluded, but got [%s]", options.ExcludeNamespaces, content)
+	}
+
+	options.FailurePolicy = "Retry"
+	if _, err := Manifest(options); err == nil {
+		t.Errorf("Expected an error for an unsupported failure policy")
+	}
+}
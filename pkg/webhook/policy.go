@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// actions of a policy rule
+const (
+	ActionAllow = "allow"
+	ActionWarn  = "warn"
+	ActionDeny  = "deny"
+)
+
+// statuses of the latest scan of an image
+const (
+	// StatusPassed means the image was scanned without policy violations
+	StatusPassed = "PASSED"
+	// StatusViolation means components of the image violate Black Duck policies
+	StatusViolation = "IN_VIOLATION"
+	// StatusFailed means the latest scan of the image failed
+	StatusFailed = "FAILED"
+	// StatusUnscanned means no result of the image was found, or it's older than the policy accepts
+	StatusUnscanned = "UNSCANNED"
+)
+
+// Result is what's known about the latest scan of an image
+type Result struct {
+	Image  string
+	Status string
+	// Source is where the result was found, i.e.: Black Duck
+	Source string
+	// Detail explains the status, i.e.: the number of components in violation or the error of a failed scan
+	Detail string
+	// ScannedAt is when the image was scanned, if known
+	ScannedAt time.Time
+}
+
+// Policy decides what to do with an image by the result of its latest scan
+type Policy struct {
+	Violation string
+	Failed    string
+	Unscanned string
+	// MaxAge treats results scanned longer ago as unscanned; 0 accepts results of any age
+	MaxAge time.Duration
+	// Exempt images are allowed without looking up their results
+	Exempt []*regexp.Regexp
+}
+
+// ValidateAction checks that an action is allow, warn or deny
+func ValidateAction(action string) error {
+	switch action {
+	case ActionAllow, ActionWarn, ActionDeny:
+		return nil
+	}
+	return errors.Errorf("unsupported policy action '%s', expected %s, %s or %s", action, ActionAllow, ActionWarn, ActionDeny)
+}
+
+// Validate checks the actions of all rules
+func (p *Policy) Validate() error {
+	for _, action := range []string{p.Violation, p.Failed, p.Unscanned} {
+		if err := ValidateAction(action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsExempt is true if an image matches one of the exempt expressions
+func (p *Policy) IsExempt(image string) bool {
+	for _, exempt := range p.Exempt {
+		if exempt.MatchString(image) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate is the action for the result of an image, and the message explaining it
+func (p *Policy) Evaluate(result Result, now time.Time) (string, string) {
+	if result.Status != StatusUnscanned && p.MaxAge > 0 && !result.ScannedAt.IsZero() && now.Sub(result.ScannedAt) > p.MaxAge {
+		result = Result{
+			Image:  result.Image,
+			Status: StatusUnscanned,
+			Source: result.Source,
+			Detail: fmt.Sprintf("the latest scan is from %s, older than %s", result.ScannedAt.Format(time.RFC3339), p.MaxAge),
+		}
+	}
+
+	var action, message string
+	switch result.Status {
+	case StatusPassed:
+		return ActionAllow, fmt.Sprintf("image '%s' passed its scan", result.Image)
+	case StatusViolation:
+		action, message = p.Violation, fmt.Sprintf("image '%s' violates Black Duck policies", result.Image)
+	case StatusFailed:
+		action, message = p.Failed, fmt.Sprintf("the latest scan of image '%s' failed", result.Image)
+	default:
+		action, message = p.Unscanned, fmt.Sprintf("image '%s' wasn't scanned", result.Image)
+	}
+	if result.Detail != "" {
+		message = fmt.Sprintf("%s: %s", message, result.Detail)
+	}
+	return action, message
+}
@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/blackducksoftware/kubectl-bd-xray/pkg/yaml"
+)
+
+const (
+	// ValidatePath is where the server receives the AdmissionReviews
+	ValidatePath = "/validate"
+	// HealthPath answers liveness and readiness probes
+	HealthPath = "/healthz"
+
+	// DefaultLookupTimeout is how long the images of an AdmissionReview are looked up, below the default timeout of
+	// 10s the API server waits for the webhook
+	DefaultLookupTimeout = 8 * time.Second
+
+	// maxRequestSize is the size limit of AdmissionReviews, well above the request size limit of the API server
+	maxRequestSize = 10 * 1024 * 1024
+)
+
+// Server is a validating admission webhook, which denies or warns about the images of pods and workloads by the
+// results of their latest scans
+type Server struct {
+	Lookup Lookup
+	Policy Policy
+	// LookupTimeout is how long the images of an AdmissionReview are looked up; images not looked up in time are
+	// unscanned
+	LookupTimeout time.Duration
+	now           func() time.Time
+}
+
+func NewServer(lookup Lookup, policy Policy) *Server {
+	return &Server{Lookup: lookup, Policy: policy, LookupTimeout: DefaultLookupTimeout, now: time.Now}
+}
+
+// Handler serves the AdmissionReviews and the health checks
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, s)
+	mux.HandleFunc(HealthPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
+
+// ServeHTTP answers an AdmissionReview of admission.k8s.io/v1 or v1beta1, which have the same fields, with the same
+// version
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "expected a POST", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to read request: %v", err), http.StatusBadRequest)
+		return
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("expected an AdmissionReview with a request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.LookupTimeout)
+	defer cancel()
+	response := s.Review(ctx, review.Request)
+	review.Response = response
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Errorf("unable to write AdmissionReview response: %+v", err)
+	}
+}
+
+// Review decides about the images of the object of an admission request; images whose results can't be looked up
+// before ctx is done are treated as unscanned
+func (s *Server) Review(ctx context.Context, request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	if request.Operation == admissionv1.Delete || len(request.Object.Raw) == 0 {
+		return response
+	}
+	object := fmt.Sprintf("%s '%s' in '%s'", request.Kind.Kind, request.Name, request.Namespace)
+	images, err := ImagesFromObject(request.Object.Raw)
+	if err != nil {
+		log.Errorf("unable to find the images of %s, allowing it: %+v", object, err)
+		return response
+	}
+
+	var denials []string
+	for _, image := range images {
+		if s.Policy.IsExempt(image) {
+			log.Debugf("allowing exempt image '%s' of %s", image, object)
+			continue
+		}
+		result, err := s.lookup(ctx, request.Namespace, image)
+		if err != nil && ctx.Err() != nil {
+			log.Errorf("looking up the scan of '%s' timed out: %+v", image, err)
+			result = Result{Image: image, Status: StatusUnscanned, Detail: "looking up its scan timed out"}
+		} else if err != nil {
+			log.Errorf("unable to look up the scan of '%s': %+v", image, err)
+			result = Result{Image: image, Status: StatusUnscanned, Detail: fmt.Sprintf("unable to look up its scan: %v", err)}
+		}
+		action, message := s.Policy.Evaluate(result, s.now())
+		switch action {
+		case ActionDeny:
+			log.Infof("denying %s: %s", object, message)
+			denials = append(denials, message)
+		case ActionWarn:
+			log.Infof("warning about %s: %s", object, message)
+			response.Warnings = append(response.Warnings, message)
+		default:
+			log.Debugf("allowing %s: %s", object, message)
+		}
+	}
+
+	if len(denials) > 0 {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    http.StatusForbidden,
+			Message: strings.Join(denials, "; "),
+		}
+	}
+	return response
+}
+
+// lookup looks up the result of an image, giving up once ctx is done, even if the lookup doesn't, i.e.: while it
+// looks up the digest of the image in a registry
+func (s *Server) lookup(ctx context.Context, namespace, image string) (Result, error) {
+	type lookupResult struct {
+		result Result
+		err    error
+	}
+	done := make(chan lookupResult, 1)
+	go func() {
+		result, err := s.Lookup.Lookup(ctx, namespace, image)
+		done <- lookupResult{result: result, err: err}
+	}()
+	select {
+	case found := <-done:
+		return found.result, found.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// ImagesFromObject finds the images of a Pod or workload like `bd-xray yaml` does, without duplicates
+func ImagesFromObject(raw []byte) ([]string, error) {
+	content, err := sigsyaml.JSONToYAML(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to convert object to yaml")
+	}
+	var images []string
+	found := map[string]bool{}
+	for _, image := range yaml.GetImageFromYamlString(string(content)) {
+		if image != "" && !found[image] {
+			found[image] = true
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// fakeLookup has the results of the images by name; other images fail to be looked up
+type fakeLookup map[string]Result
+
+func (l fakeLookup) Lookup(ctx context.Context, namespace, image string) (Result, error) {
+	result, ok := l[image]
+	if !ok {
+		return Result{}, errors.Errorf("unable to reach Black Duck")
+	}
+	result.Image = image
+	return result, nil
+}
+
+func newTestServer() *Server {
+	lookup := fakeLookup{
+		"nginx:1.19":               {Status: StatusViolation, Source: SourceBlackDuck, Detail: "2 components in violation"},
+		"busybox:1.32":             {Status: StatusPassed},
+		"envoyproxy/envoy:v1.16.0": {Status: StatusUnscanned},
+		"redis:6.0":                {Status: StatusPassed},
+	}
+	return NewServer(lookup, Policy{Violation: ActionDeny, Failed: ActionWarn, Unscanned: ActionWarn})
+}
+
+func postFixture(t *testing.T, server *Server, fixture string) (*http.Response, map[string]interface{}, *admissionv1.AdmissionReview) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	resp, err := http.Post(httpServer.URL+ValidatePath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var raw map[string]interface{}
+	review := &admissionv1.AdmissionReview{}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(content, &raw); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if err := json.Unmarshal(content, review); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	return resp, raw, review
+}
+
+func TestDenyPodWithPolicyViolation(t *testing.T) {
+	_, raw, review := postFixture(t, newTestServer(), "pod-create.json")
+
+	if raw["apiVersion"] != "admission.k8s.io/v1" || raw["kind"] != "AdmissionReview" || raw["request"] != nil {
+		t.Errorf("Expected an admission.k8s.io/v1 AdmissionReview without request, but got [%v %v %v]", raw["apiVersion"], raw["kind"], raw["request"])
+	}
+	response := review.Response
+	if response == nil || response.UID != "705ab4f5-6393-11e8-b7cc-42010a800002" || response.Allowed {
+		t.Fatalf("Expected the pod to be denied, but got [%+v]", response)
+	}
+	expectedMessage := "image 'nginx:1.19' violates Black Duck policies: 2 components in violation"
+	if response.Result == nil || response.Result.Code != http.StatusForbidden || response.Result.Message != expectedMessage {
+		t.Errorf("Expected [%s], but got [%+v]", expectedMessage, response.Result)
+	}
+	expectedWarnings := []string{"image 'envoyproxy/envoy:v1.16.0' wasn't scanned"}
+	if !reflect.DeepEqual(response.Warnings, expectedWarnings) {
+		t.Errorf("Expected [%v], but got [%v]", expectedWarnings, response.Warnings)
+	}
+}
+
+func TestAllowDeploymentV1beta1(t *testing.T) {
+	_, raw, review := postFixture(t, newTestServer(), "deployment-update-v1beta1.json")
+
+	if raw["apiVersion"] != "admission.k8s.io/v1beta1" {
+		t.Errorf("Expected the version of the request [admission.k8s.io/v1beta1], but got [%v]", raw["apiVersion"])
+	}
+	// only the new object counts, not the old redis:5.0
+	response := review.Response
+	if response == nil || response.UID != "0df28fbd-5f5f-11e8-bc74-36e6bb280816" || !response.Allowed || len(response.Warnings) != 0 {
+		t.Errorf("Expected the deployment to be allowed without warnings, but got [%+v]", response)
+	}
+}
+
+func TestAllowDelete(t *testing.T) {
+	server := newTestServer()
+	server.Lookup = fakeLookup{}
+	server.Policy.Unscanned = ActionDeny
+	_, _, review := postFixture(t, server, "pod-delete.json")
+	if review.Response == nil || !review.Response.Allowed {
+		t.Errorf("Expected a deletion to be allowed, but got [%+v]", review.Response)
+	}
+}
+
+func TestReviewPolicies(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "pod-create.json"))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	server := newTestServer()
+	server.Policy = Policy{Violation: ActionWarn, Failed: ActionWarn, Unscanned: ActionAllow}
+	if response := server.Review(context.Background(), review.Request); !response.Allowed || len(response.Warnings) != 1 || !strings.Contains(response.Warnings[0], "nginx:1.19") {
+		t.Errorf("Expected a warning about nginx:1.19, but got [%+v]", response)
+	}
+
+	server.Policy = Policy{Violation: ActionDeny, Failed: ActionWarn, Unscanned: ActionDeny, Exempt: []*regexp.Regexp{regexp.MustCompile(`^nginx:`)}}
+	if response := server.Review(context.Background(), review.Request); response.Allowed || response.Result.Message != "image 'envoyproxy/envoy:v1.16.0' wasn't scanned" {
+		t.Errorf("Expected the unscanned envoy to be denied, but got [%+v]", response.Result)
+	}
+
+	// lookup errors count as unscanned
+	server.Lookup = fakeLookup{}
+	server.Policy = Policy{Violation: ActionDeny, Failed: ActionDeny, Unscanned: ActionWarn}
+	if response := server.Review(context.Background(), review.Request); !response.Allowed || len(response.Warnings) != 3 {
+		t.Errorf("Expected 3 warnings, but got [%+v]", response.Warnings)
+	}
+}
+
+// slowLookup takes longer than the lookup timeout, like a Black Duck server retrying its requests
+type slowLookup struct{}
+
+func (slowLookup) Lookup(ctx context.Context, namespace, image string) (Result, error) {
+	time.Sleep(time.Second)
+	return Result{Image: image, Status: StatusPassed}, nil
+}
+
+func TestLookupTimeout(t *testing.T) {
+	server := newTestServer()
+	server.Lookup = slowLookup{}
+	server.LookupTimeout = 50 * time.Millisecond
+	server.Policy.Unscanned = ActionDeny
+	start := time.Now()
+	_, _, review := postFixture(t, server, "pod-create.json")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the review to give up after the lookup timeout, but it took [%s]", elapsed)
+	}
+	if review.Response == nil || review.Response.Allowed || !strings.Contains(review.Response.Result.Message, "looking up its scan timed out") {
+		t.Errorf("Expected the images to be denied as unscanned, but got [%+v]", review.Response)
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	httpServer := httptest.NewServer(newTestServer().Handler())
+	defer httpServer.Close()
+
+	resp, err := http.Post(httpServer.URL+ValidatePath, "application/json", strings.NewReader(`{"kind": "AdmissionReview"}`))
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected [%d] for a review without request, but got [%+v %+v]", http.StatusBadRequest, resp, err)
+	}
+	resp, err = http.Get(httpServer.URL + ValidatePath)
+	if err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected [%d] for a GET, but got [%+v %+v]", http.StatusMethodNotAllowed, resp, err)
+	}
+	resp, err = http.Get(httpServer.URL + HealthPath)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected [%d] for the health check, but got [%+v %+v]", http.StatusOK, resp, err)
+	}
+}
+
+func TestImagesFromObject(t *testing.T) {
+	object := `{"spec": {"template": {"spec": {"initContainers": [{"name": "init", "image": "busybox:1.32"}], "containers": [{"name": "web", "image": "nginx:1.19"}, {"image": "nginx:1.19", "name": "metrics"}]}}}}`
+	images, err := ImagesFromObject([]byte(object))
+	expected := []string{"nginx:1.19", "busybox:1.32"}
+	if err != nil || !reflect.DeepEqual(images, expected) {
+		t.Errorf("Expected [%v], but got [%v %+v]", expected, images, err)
+	}
+	if _, err := ImagesFromObject([]byte(`{`)); err == nil {
+		t.Errorf("Expected an error for invalid JSON")
+	}
+}
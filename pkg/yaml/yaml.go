@@ -20,10 +20,7 @@ func GetImageFromYaml(filename string) ([]string, error) {
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		if strings.Contains(scanner.Text(), "image:") {
-			imageString := strings.TrimSpace(scanner.Text())
-			imageString = strings.TrimPrefix(imageString, "image:")
-			imageString = strings.TrimSpace(imageString)
-			list = append(list, imageString)
+			list = append(list, parseImageLine(scanner.Text()))
 		}
 	}
 
@@ -42,14 +39,18 @@ func GetImageFromYamlString(templateOutput string) []string {
 	for _, line := range linesToProcess {
 		repoSubstringSubmatch := repoRegexp.FindStringSubmatch(line)
 		if len(repoSubstringSubmatch) > 0 {
-
-			imageString := strings.TrimSpace(line)
-			imageString = strings.TrimPrefix(imageString, "image:")
-			imageString = strings.TrimSpace(imageString)
-			imageString = strings.Trim(imageString, "\"")
-			list = append(list, imageString)
+			list = append(list, strings.Trim(parseImageLine(line), "\""))
 		}
 	}
 
 	return list
 }
+
+// parseImageLine is the image of an image: line, which may be the first line of a list item, i.e.: - image: nginx
+func parseImageLine(line string) string {
+	imageString := strings.TrimSpace(line)
+	imageString = strings.TrimPrefix(imageString, "- ")
+	imageString = strings.TrimSpace(imageString)
+	imageString = strings.TrimPrefix(imageString, "image:")
+	return strings.TrimSpace(imageString)
+}